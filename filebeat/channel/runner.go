@@ -49,6 +49,7 @@ type commonInputConfig struct {
 	} `config:"publisher_pipeline"`
 
 	// implicit event fields
+	ID          string `config:"id"`           // input ID, for the input quotas
 	Type        string `config:"type"`         // input.type
 	ServiceType string `config:"service.type"` // service.type
 
@@ -187,6 +188,9 @@ func newCommonConfigEditor(
 		clientCfg.Processing.Processor = procs
 		clientCfg.Processing.KeepNull = config.KeepNull
 		clientCfg.Processing.DisableHost = config.PublisherPipeline.DisableHost
+		if clientCfg.InputID == "" {
+			clientCfg.InputID = config.ID
+		}
 
 		return clientCfg, nil
 	}, nil
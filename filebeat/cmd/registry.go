@@ -0,0 +1,41 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/filebeat/cmd/registry"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+)
+
+func genRegistryCmd(settings instance.Settings) *cobra.Command {
+	registryCmd := &cobra.Command{
+		Use:   "registry",
+		Short: "Export, import and edit the registry",
+		Long: "Export, import and edit the entries of the registry. Filebeat must be stopped " +
+			"while the registry is handled.",
+	}
+
+	registryCmd.AddCommand(registry.GenExportCmd(settings))
+	registryCmd.AddCommand(registry.GenImportCmd(settings))
+	registryCmd.AddCommand(registry.GenSetCmd(settings))
+	registryCmd.AddCommand(registry.GenDeleteCmd(settings))
+
+	return registryCmd
+}
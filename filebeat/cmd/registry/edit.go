@@ -0,0 +1,231 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+)
+
+var errEmptySelection = errors.New("no entry selected, use --key, --input-type, --input-id or --path")
+
+// GenSetCmd is the command used to modify the selected registry entries.
+func GenSetCmd(settings instance.Settings) *cobra.Command {
+	var (
+		s      selection
+		offset int64
+		cursor string
+		value  string
+		dryRun bool
+	)
+	cmd := &cobra.Command{
+		Use:   "set",
+		Short: "Modify the selected registry entries",
+		Long: "Modify the selected registry entries. --offset sets the offset of filestream and log " +
+			"entries, --cursor replaces the cursor of the entries and --value replaces their whole " +
+			"value. The modified entries are validated before the registry is modified, the " +
+			"entries of the filestream, log, httpjson and cel inputs against the format of the " +
+			"input, the entries of other inputs only for the presence of the cursor.",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) (err error) {
+			if s.empty() {
+				return errEmptySelection
+			}
+
+			var update func(inputType string, value map[string]interface{}) (map[string]interface{}, error)
+			switch flags := cmd.Flags(); {
+			case countChanged(cmd, "offset", "cursor", "value") != 1:
+				return errors.New("exactly one of --offset, --cursor or --value is required")
+			case flags.Changed("offset"):
+				update = func(inputType string, value map[string]interface{}) (map[string]interface{}, error) {
+					return setOffset(inputType, value, offset)
+				}
+			case flags.Changed("cursor"):
+				newCursor, err := parseJSON(cursor)
+				if err != nil {
+					return fmt.Errorf("invalid cursor: %w", err)
+				}
+				update = func(inputType string, value map[string]interface{}) (map[string]interface{}, error) {
+					if inputType == "log" {
+						return nil, errors.New("log entries have no cursor, use --offset or --value")
+					}
+					value["cursor"] = newCursor
+					return value, nil
+				}
+			default:
+				newValue, err := parseJSON(value)
+				if err != nil {
+					return fmt.Errorf("invalid value: %w", err)
+				}
+				m, ok := newValue.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("the value must be an object, got %v", newValue)
+				}
+				update = func(string, map[string]interface{}) (map[string]interface{}, error) {
+					return m, nil
+				}
+			}
+
+			reg, err := openRegistry(settings, false)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				err = errors.Join(err, reg.Close())
+			}()
+
+			entries, err := reg.entries(&s)
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				return errors.New("no registry entry matches the selection")
+			}
+
+			// Validate all the entries before writing any of them.
+			var errs []error
+			for i, e := range entries {
+				inputType, _ := parseKey(e.Key)
+				newValue, err := update(inputType, e.Value)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", e.Key, err))
+					continue
+				}
+				if err := validateEntry(e.Key, newValue); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				entries[i].Value = newValue
+			}
+			if len(errs) > 0 {
+				return errors.Join(errs...)
+			}
+
+			for _, e := range entries {
+				if !dryRun {
+					if err := reg.store.Set(e.Key, e.Value); err != nil {
+						return fmt.Errorf("error writing the registry entry %q: %w", e.Key, err)
+					}
+				}
+				report(dryRun, "set", e.Key)
+			}
+			return nil
+		}),
+	}
+	s.addFlags(cmd)
+	cmd.Flags().Int64Var(&offset, "offset", 0, "Offset the selected filestream or log entries resume reading from")
+	cmd.Flags().StringVar(&cursor, "cursor", "", "JSON cursor replacing the cursor of the selected entries")
+	cmd.Flags().StringVar(&value, "value", "", "JSON object replacing the value of the selected entries")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Validate the entries and print the changes without applying them")
+	return cmd
+}
+
+// GenDeleteCmd is the command used to delete the selected registry entries.
+func GenDeleteCmd(settings instance.Settings) *cobra.Command {
+	var (
+		s      selection
+		dryRun bool
+	)
+	cmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete the selected registry entries",
+		Long: "Delete the selected registry entries. The inputs read the files of deleted " +
+			"entries again from the beginning.",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) (err error) {
+			if s.empty() {
+				return errEmptySelection
+			}
+
+			reg, err := openRegistry(settings, false)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				err = errors.Join(err, reg.Close())
+			}()
+
+			entries, err := reg.entries(&s)
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				return errors.New("no registry entry matches the selection")
+			}
+
+			for _, e := range entries {
+				if !dryRun {
+					if err := reg.store.Remove(e.Key); err != nil {
+						return fmt.Errorf("error deleting the registry entry %q: %w", e.Key, err)
+					}
+				}
+				report(dryRun, "delete", e.Key)
+			}
+			return nil
+		}),
+	}
+	s.addFlags(cmd)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the entries which would be deleted without deleting them")
+	return cmd
+}
+
+// setOffset sets the offset the input resumes reading the file from. The
+// EOF flag of filestream entries is cleared, as the file is read again.
+func setOffset(inputType string, value map[string]interface{}, offset int64) (map[string]interface{}, error) {
+	switch inputType {
+	case "filestream":
+		cursor, _ := value["cursor"].(map[string]interface{})
+		if cursor == nil {
+			cursor = map[string]interface{}{}
+		}
+		cursor["offset"] = offset
+		cursor["eof"] = false
+		value["cursor"] = cursor
+	case "log":
+		value["offset"] = offset
+	default:
+		return nil, fmt.Errorf("%s entries have no offset, use --cursor or --value", inputType)
+	}
+	return value, nil
+}
+
+func countChanged(cmd *cobra.Command, names ...string) int {
+	n := 0
+	for _, name := range names {
+		if cmd.Flags().Changed(name) {
+			n++
+		}
+	}
+	return n
+}
+
+func parseJSON(s string) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return normalizeNumbers(v), nil
+}
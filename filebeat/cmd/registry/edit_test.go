@@ -0,0 +1,78 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetOffset(t *testing.T) {
+	tests := map[string]struct {
+		inputType string
+		value     map[string]interface{}
+		want      map[string]interface{}
+		wantErr   bool
+	}{
+		"filestream": {
+			inputType: "filestream",
+			value: map[string]interface{}{
+				"cursor": map[string]interface{}{"offset": int64(100), "eof": true},
+				"meta":   map[string]interface{}{"source": "/var/log/a.log"},
+			},
+			want: map[string]interface{}{
+				"cursor": map[string]interface{}{"offset": int64(10), "eof": false},
+				"meta":   map[string]interface{}{"source": "/var/log/a.log"},
+			},
+		},
+		"filestream without cursor yet": {
+			inputType: "filestream",
+			value: map[string]interface{}{
+				"cursor": nil,
+				"meta":   map[string]interface{}{"source": "/var/log/a.log"},
+			},
+			want: map[string]interface{}{
+				"cursor": map[string]interface{}{"offset": int64(10), "eof": false},
+				"meta":   map[string]interface{}{"source": "/var/log/a.log"},
+			},
+		},
+		"log": {
+			inputType: "log",
+			value:     map[string]interface{}{"source": "/var/log/a.log", "offset": int64(100)},
+			want:      map[string]interface{}{"source": "/var/log/a.log", "offset": int64(10)},
+		},
+		"input without offset": {
+			inputType: "httpjson",
+			value:     map[string]interface{}{"cursor": map[string]interface{}{}},
+			wantErr:   true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			value, err := setOffset(tc.inputType, tc.value, 10)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, value)
+		})
+	}
+}
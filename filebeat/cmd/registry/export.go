@@ -0,0 +1,83 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+)
+
+// GenExportCmd is the command used to export the registry entries to JSON.
+func GenExportCmd(settings instance.Settings) *cobra.Command {
+	var (
+		s    selection
+		file string
+	)
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the registry entries to JSON",
+		Long: "Export the registry entries to JSON. Each line of the output is an object holding " +
+			"the key and the value of an entry, in the format read by the import command.",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) (err error) {
+			reg, err := openRegistry(settings, false)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				err = errors.Join(err, reg.Close())
+			}()
+
+			entries, err := reg.entries(&s)
+			if err != nil {
+				return err
+			}
+
+			var out io.Writer = os.Stdout
+			if file != "" {
+				f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+				if err != nil {
+					return fmt.Errorf("error creating the export file: %w", err)
+				}
+				defer f.Close()
+				out = f
+			}
+			return writeEntries(out, entries)
+		}),
+	}
+	s.addFlags(cmd)
+	cmd.Flags().StringVar(&file, "file", "", "File the entries are written to, instead of stdout")
+	return cmd
+}
+
+func writeEntries(out io.Writer, entries []entry) error {
+	enc := json.NewEncoder(out)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("error writing the registry entry %q: %w", e.Key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+)
+
+// GenImportCmd is the command used to import registry entries exported by
+// the export command.
+func GenImportCmd(settings instance.Settings) *cobra.Command {
+	var (
+		file    string
+		dryRun  bool
+		replace bool
+	)
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import registry entries from JSON",
+		Long: "Import registry entries from JSON, in the format written by the export command. " +
+			"All the entries are validated before the registry is modified, existing entries " +
+			"are overwritten. The entries of the filestream, log, httpjson and cel inputs are " +
+			"checked against the format of the input, only the presence of the cursor is " +
+			"checked for other inputs.",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) (err error) {
+			if file == "" {
+				return errors.New("--file is required")
+			}
+			entries, err := readEntriesFile(file)
+			if err != nil {
+				return err
+			}
+
+			// A dry run doesn't create the registry, if there is none yet
+			// all the entries would be created.
+			reg, err := openRegistry(settings, !dryRun)
+			if dryRun && errors.Is(err, os.ErrNotExist) {
+				for _, e := range entries {
+					report(dryRun, "set", e.Key)
+				}
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			defer func() {
+				err = errors.Join(err, reg.Close())
+			}()
+
+			return reg.importEntries(entries, replace, dryRun)
+		}),
+	}
+	cmd.Flags().StringVar(&file, "file", "", "File the entries are read from")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Validate the entries and print the changes without applying them")
+	cmd.Flags().BoolVar(&replace, "replace", false, "Delete the registry entries missing from the file")
+	return cmd
+}
+
+// importEntries writes the entries to the registry. If replace is set, the
+// registry entries missing from entries are deleted.
+func (r *registry) importEntries(entries []entry, replace, dryRun bool) error {
+	if replace {
+		imported := make(map[string]bool, len(entries))
+		for _, e := range entries {
+			imported[e.Key] = true
+		}
+		existing, err := r.entries(&selection{})
+		if err != nil {
+			return err
+		}
+		for _, e := range existing {
+			if imported[e.Key] {
+				continue
+			}
+			if !dryRun {
+				if err := r.store.Remove(e.Key); err != nil {
+					return fmt.Errorf("error deleting the registry entry %q: %w", e.Key, err)
+				}
+			}
+			report(dryRun, "delete", e.Key)
+		}
+	}
+
+	for _, e := range entries {
+		if !dryRun {
+			if err := r.store.Set(e.Key, e.Value); err != nil {
+				return fmt.Errorf("error writing the registry entry %q: %w", e.Key, err)
+			}
+		}
+		report(dryRun, "set", e.Key)
+	}
+	return nil
+}
+
+// readEntriesFile reads and validates the entries of an export file.
+func readEntriesFile(path string) ([]entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the import file: %w", err)
+	}
+	defer f.Close()
+
+	entries, err := readEntries(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+func readEntries(in io.Reader) ([]entry, error) {
+	dec := json.NewDecoder(in)
+	dec.UseNumber()
+
+	var (
+		entries []entry
+		errs    []error
+		seen    = map[string]bool{}
+	)
+	for i := 1; ; i++ {
+		var e entry
+		err := dec.Decode(&e)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+
+		e.Value, _ = normalizeNumbers(e.Value).(map[string]interface{})
+		if err := validateEntry(e.Key, e.Value); err != nil {
+			errs = append(errs, fmt.Errorf("entry %d: %w", i, err))
+			continue
+		}
+		if seen[e.Key] {
+			errs = append(errs, fmt.Errorf("entry %d: %s: duplicate key", i, e.Key))
+			continue
+		}
+		seen[e.Key] = true
+		entries = append(entries, e)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return entries, nil
+}
+
+// normalizeNumbers replaces the JSON numbers of a decoded value by integers
+// where possible, so that offsets and timestamps keep their precision when
+// they are written to the registry.
+func normalizeNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, elem := range v {
+			v[k] = normalizeNumbers(elem)
+		}
+		return v
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = normalizeNumbers(elem)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,169 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestReadEntries(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		want    []entry
+		wantErr []string
+	}{
+		"entries": {
+			input: `{"key":"filebeat::logs::native::1-2","value":{"source":"/var/log/a.log","offset":9007199254740993}}
+{"key":"journald::LOCAL_SYSTEM_JOURNAL","value":{"cursor":"s=abc","ttl":-1,"ratio":0.5}}
+`,
+			want: []entry{
+				{Key: "filebeat::logs::native::1-2", Value: map[string]interface{}{
+					"source": "/var/log/a.log",
+					"offset": int64(9007199254740993),
+				}},
+				{Key: "journald::LOCAL_SYSTEM_JOURNAL", Value: map[string]interface{}{
+					"cursor": "s=abc",
+					"ttl":    int64(-1),
+					"ratio":  0.5,
+				}},
+			},
+		},
+		"empty input": {},
+		"invalid entries": {
+			input: `{"key":"filebeat::logs::native::1-2","value":{"source":"/var/log/a.log"}}
+{"key":"journald::LOCAL_SYSTEM_JOURNAL"}
+{"key":"journald::LOCAL_SYSTEM_JOURNAL","value":{"cursor":null}}
+{"key":"journald::LOCAL_SYSTEM_JOURNAL","value":{"cursor":null}}
+`,
+			wantErr: []string{
+				"entry 1: filebeat::logs::native::1-2: offset is missing",
+				"entry 2: journald::LOCAL_SYSTEM_JOURNAL: the value is missing",
+				"entry 4: journald::LOCAL_SYSTEM_JOURNAL: duplicate key",
+			},
+		},
+		"malformed JSON": {
+			input:   `{"key":"journald::LOCAL_SYSTEM_JOURNAL","value":{"cursor":null}}` + "\n{\n",
+			wantErr: []string{"entry 2: unexpected EOF"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			entries, err := readEntries(strings.NewReader(tc.input))
+			if len(tc.wantErr) > 0 {
+				for _, msg := range tc.wantErr {
+					assert.ErrorContains(t, err, msg)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, entries)
+		})
+	}
+}
+
+func TestNormalizeNumbers(t *testing.T) {
+	value := map[string]interface{}{
+		"int":    json.Number("-42"),
+		"uint":   json.Number("18446744073709551615"),
+		"float":  json.Number("1.5"),
+		"string": "10",
+		"nested": map[string]interface{}{
+			"list": []interface{}{json.Number("1"), json.Number("2.5"), true},
+		},
+	}
+	want := map[string]interface{}{
+		"int":    int64(-42),
+		"uint":   uint64(math.MaxUint64),
+		"float":  1.5,
+		"string": "10",
+		"nested": map[string]interface{}{
+			"list": []interface{}{int64(1), 2.5, true},
+		},
+	}
+	assert.Equal(t, want, normalizeNumbers(value))
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src := openTestRegistry(t)
+	values := map[string]interface{}{
+		"filestream::my-id::native::123-45": map[string]interface{}{
+			"ttl":     int64(-1),
+			"updated": []interface{}{int64(516031837), int64(1729173622)},
+			"cursor":  map[string]interface{}{"offset": int64(1024), "eof": false},
+			"meta":    map[string]interface{}{"source": "/var/log/a.log", "identifier_name": "native"},
+		},
+		"filebeat::logs::native::678-90": map[string]interface{}{
+			"source": "/var/log/b.log",
+			"offset": int64(2048),
+			"ttl":    int64(-2),
+		},
+		"httpjson::my-id::https://example.com/api": map[string]interface{}{
+			"cursor": map[string]interface{}{"page": map[string]interface{}{"token": "abc"}},
+		},
+	}
+	for key, value := range values {
+		require.NoError(t, src.store.Set(key, value))
+	}
+	exported, err := src.entries(&selection{})
+	require.NoError(t, err)
+	require.Len(t, exported, len(values))
+
+	var buf bytes.Buffer
+	require.NoError(t, writeEntries(&buf, exported))
+	entries, err := readEntries(&buf)
+	require.NoError(t, err)
+
+	dst := openTestRegistry(t)
+	require.NoError(t, dst.store.Set("journald::LOCAL_SYSTEM_JOURNAL", map[string]interface{}{"cursor": "s=abc"}))
+
+	// A dry run doesn't modify the registry.
+	require.NoError(t, dst.importEntries(entries, true, true))
+	existing, err := dst.entries(&selection{})
+	require.NoError(t, err)
+	require.Len(t, existing, 1)
+
+	require.NoError(t, dst.importEntries(entries, true, false))
+	imported, err := dst.entries(&selection{})
+	require.NoError(t, err)
+	assert.Equal(t, exported, imported)
+}
+
+// openTestRegistry opens a memlog store in a temporary directory.
+func openTestRegistry(t *testing.T) *registry {
+	t.Helper()
+	logger := logptest.NewTestingLogger(t, "")
+	reg, err := memlog.New(logger, memlog.Settings{Root: t.TempDir()})
+	require.NoError(t, err)
+	store, err := reg.Access("filebeat")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		store.Close()
+		reg.Close()
+	})
+	return &registry{backend: reg, store: store}
+}
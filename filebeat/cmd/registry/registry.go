@@ -0,0 +1,217 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package registry implements the commands used to export, import and edit
+// the entries of the Filebeat registry while Filebeat is stopped.
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/filebeat/beater"
+	"github.com/elastic/beats/v7/filebeat/config"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance/locks"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+// entry is a key-value pair of the registry, as exported by the export
+// command and read by the import command.
+type entry struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// registry gives access to the store of the Filebeat registry. The data
+// path is locked while the registry is open, which guarantees Filebeat isn't
+// running.
+type registry struct {
+	lock    *locks.Locker
+	backend backend.Registry
+	store   backend.Store
+}
+
+// openRegistry opens the registry configured for the beat. If create is
+// false, a registry that doesn't exist yet is reported as an error instead
+// of being created.
+func openRegistry(settings instance.Settings, create bool) (*registry, error) {
+	b, err := instance.NewInitializedBeat(settings)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing beat: %w", err)
+	}
+
+	beatConfig, err := b.BeatConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error reading configuration file: %w", err)
+	}
+	cfg := config.DefaultConfig
+	if err := beatConfig.Unpack(&cfg); err != nil {
+		return nil, fmt.Errorf("error reading configuration file: %w", err)
+	}
+
+	root := paths.Resolve(paths.Data, cfg.Registry.Path)
+	if !create {
+		if _, err := os.Stat(root); err != nil {
+			return nil, fmt.Errorf("no registry found at %s: %w", root, err)
+		}
+	}
+
+	lock := locks.New(b.Info)
+	if err := lock.Lock(); err != nil {
+		if errors.Is(err, locks.ErrAlreadyLocked) {
+			return nil, fmt.Errorf("%s must be stopped while the registry is handled: %w", b.Info.Beat, err)
+		}
+		return nil, err
+	}
+
+	reg, err := beater.OpenRegistryBackend(b.Info.Logger, cfg.Registry)
+	if err != nil {
+		_ = lock.Unlock()
+		return nil, fmt.Errorf("error opening the registry at %s: %w", root, err)
+	}
+	store, err := reg.Access(b.Info.Beat)
+	if err != nil {
+		reg.Close()
+		_ = lock.Unlock()
+		return nil, fmt.Errorf("error opening the registry at %s: %w", root, err)
+	}
+	return &registry{lock: lock, backend: reg, store: store}, nil
+}
+
+// Close closes the registry and releases the lock on the data path.
+func (r *registry) Close() error {
+	return errors.Join(r.store.Close(), r.backend.Close(), r.lock.Unlock())
+}
+
+// entries returns the entries of the registry matching the selection,
+// sorted by key.
+func (r *registry) entries(s *selection) ([]entry, error) {
+	var entries []entry
+	err := r.store.Each(func(key string, dec backend.ValueDecoder) (bool, error) {
+		var value map[string]interface{}
+		if err := dec.Decode(&value); err != nil {
+			return false, fmt.Errorf("error decoding the registry entry %q: %w", key, err)
+		}
+		if s.matches(key, value) {
+			entries = append(entries, entry{Key: key, Value: value})
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// selection selects the registry entries handled by a command. An empty
+// selection matches every entry.
+type selection struct {
+	keys      []string
+	inputType string
+	inputID   string
+	path      string
+}
+
+func (s *selection) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&s.keys, "key", nil, "Only handle the entries with this key (can be repeated)")
+	cmd.Flags().StringVar(&s.inputType, "input-type", "", "Only handle the entries of this input type")
+	cmd.Flags().StringVar(&s.inputID, "input-id", "", "Only handle the entries of the input with this ID")
+	cmd.Flags().StringVar(&s.path, "path", "", "Only handle the entries of the file with this path")
+}
+
+func (s *selection) empty() bool {
+	return len(s.keys) == 0 && s.inputType == "" && s.inputID == "" && s.path == ""
+}
+
+func (s *selection) matches(key string, value map[string]interface{}) bool {
+	if len(s.keys) > 0 && !containsString(s.keys, key) {
+		return false
+	}
+	inputType, inputID := parseKey(key)
+	if s.inputType != "" && s.inputType != inputType {
+		return false
+	}
+	if s.inputID != "" && s.inputID != inputID {
+		return false
+	}
+	if s.path != "" && s.path != sourceOf(inputType, value) {
+		return false
+	}
+	return true
+}
+
+// parseKey returns the type and the ID of the input owning a registry key.
+// Keys have the form '<type>::<input ID>::<source>', or '<type>::<source>'
+// for inputs without ID. The entries of the log input are stored under the
+// 'filebeat::logs::' prefix.
+func parseKey(key string) (inputType, inputID string) {
+	parts := strings.SplitN(key, "::", 3)
+	switch {
+	case len(parts) == 3 && parts[0] == "filebeat" && parts[1] == "logs":
+		return "log", ""
+	case len(parts) == 3:
+		return parts[0], parts[1]
+	default:
+		return parts[0], ""
+	}
+}
+
+// sourceOf returns the path of the file tracked by a registry entry, or an
+// empty string if the entry doesn't track a file.
+func sourceOf(inputType string, value map[string]interface{}) string {
+	switch inputType {
+	case "log":
+		source, _ := value["source"].(string)
+		return source
+	default:
+		meta, _ := value["meta"].(map[string]interface{})
+		source, _ := meta["source"].(string)
+		return source
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
+			return true
+		}
+	}
+	return false
+}
+
+// report prints an operation applied to the registry, or which would be
+// applied in dry-run mode.
+func report(dryRun bool, op, key string) {
+	if dryRun {
+		fmt.Printf("Would %s %s\n", op, key)
+		return
+	}
+	fmt.Printf("%s %s\n", pastTense[op], key)
+}
+
+var pastTense = map[string]string{
+	"set":    "Set",
+	"delete": "Deleted",
+}
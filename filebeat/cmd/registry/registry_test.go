@@ -0,0 +1,111 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := map[string]struct {
+		key       string
+		inputType string
+		inputID   string
+	}{
+		"filestream":       {key: "filestream::my-id::native::123-45", inputType: "filestream", inputID: "my-id"},
+		"log":              {key: "filebeat::logs::native::123-45", inputType: "log"},
+		"httpjson":         {key: "httpjson::my-id::https://example.com/api", inputType: "httpjson", inputID: "my-id"},
+		"input without ID": {key: "journald::LOCAL_SYSTEM_JOURNAL", inputType: "journald"},
+		"no separator":     {key: "unknown", inputType: "unknown"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			inputType, inputID := parseKey(tc.key)
+			assert.Equal(t, tc.inputType, inputType)
+			assert.Equal(t, tc.inputID, inputID)
+		})
+	}
+}
+
+func TestSelectionMatches(t *testing.T) {
+	filestreamKey := "filestream::my-id::native::123-45"
+	filestreamValue := map[string]interface{}{
+		"cursor": map[string]interface{}{"offset": int64(10)},
+		"meta":   map[string]interface{}{"source": "/var/log/a.log"},
+	}
+	logKey := "filebeat::logs::native::123-45"
+	logValue := map[string]interface{}{"source": "/var/log/b.log", "offset": int64(20)}
+
+	tests := map[string]struct {
+		selection selection
+		key       string
+		value     map[string]interface{}
+		want      bool
+	}{
+		"empty selection": {
+			key: filestreamKey, value: filestreamValue, want: true,
+		},
+		"key": {
+			selection: selection{keys: []string{"other", filestreamKey}},
+			key:       filestreamKey, value: filestreamValue, want: true,
+		},
+		"other key": {
+			selection: selection{keys: []string{"other"}},
+			key:       filestreamKey, value: filestreamValue,
+		},
+		"input type": {
+			selection: selection{inputType: "filestream"},
+			key:       filestreamKey, value: filestreamValue, want: true,
+		},
+		"other input type": {
+			selection: selection{inputType: "filestream"},
+			key:       logKey, value: logValue,
+		},
+		"input ID": {
+			selection: selection{inputID: "my-id"},
+			key:       filestreamKey, value: filestreamValue, want: true,
+		},
+		"other input ID": {
+			selection: selection{inputID: "other-id"},
+			key:       filestreamKey, value: filestreamValue,
+		},
+		"filestream path": {
+			selection: selection{path: "/var/log/a.log"},
+			key:       filestreamKey, value: filestreamValue, want: true,
+		},
+		"log path": {
+			selection: selection{inputType: "log", path: "/var/log/b.log"},
+			key:       logKey, value: logValue, want: true,
+		},
+		"other path": {
+			selection: selection{path: "/var/log/a.log"},
+			key:       logKey, value: logValue,
+		},
+		"all criteria must match": {
+			selection: selection{inputType: "filestream", inputID: "my-id", path: "/var/log/b.log"},
+			key:       filestreamKey, value: filestreamValue,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.selection.matches(tc.key, tc.value))
+		})
+	}
+}
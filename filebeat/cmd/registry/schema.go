@@ -0,0 +1,240 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// validateEntry checks that the value of a registry entry matches the
+// format used by the input owning the key, so that the input can load it
+// when Filebeat starts. The entries of the filestream, log, httpjson and cel
+// inputs are fully validated, only the presence of the cursor is checked for
+// the other inputs.
+func validateEntry(key string, value map[string]interface{}) error {
+	if key == "" {
+		return errors.New("the key is empty")
+	}
+	if value == nil {
+		return fmt.Errorf("%s: the value is missing", key)
+	}
+
+	if err := validateCommon(value); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	var err error
+	switch inputType, _ := parseKey(key); inputType {
+	case "filestream":
+		err = validateFilestream(value)
+	case "log":
+		err = validateLog(value)
+	case "httpjson":
+		err = validateHTTPJSON(value)
+	case "cel":
+		err = validateCEL(value)
+	default:
+		err = validateCursor(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// validateCommon checks the fields shared by the entries of all inputs.
+func validateCommon(value map[string]interface{}) error {
+	if ttl, ok := value["ttl"]; ok {
+		if _, ok := asInt(ttl); !ok {
+			return fmt.Errorf("ttl must be an integer, got %v", ttl)
+		}
+	}
+	if updated, ok := value["updated"]; ok {
+		if !isTimestamp(updated) {
+			return fmt.Errorf("updated must be a timestamp, got %v", updated)
+		}
+	}
+	return nil
+}
+
+// validateFilestream checks the entries of the filestream input, whose
+// cursor holds the offset of the file, and whose meta holds the path of the
+// file and the name of the file identity.
+func validateFilestream(value map[string]interface{}) error {
+	cursor, ok := value["cursor"]
+	if !ok {
+		return errors.New("cursor is missing")
+	}
+	// The cursor is nil until the first event of the file is acknowledged.
+	if cursor != nil {
+		fields, ok := cursor.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("cursor must be an object, got %v", cursor)
+		}
+		if err := validateOffset(fields, "cursor.offset"); err != nil {
+			return err
+		}
+		if eof, ok := fields["eof"]; ok {
+			if _, ok := eof.(bool); !ok {
+				return fmt.Errorf("cursor.eof must be a boolean, got %v", eof)
+			}
+		}
+	}
+
+	meta, ok := value["meta"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("meta must be an object, got %v", value["meta"])
+	}
+	if _, ok := meta["source"].(string); !ok {
+		return fmt.Errorf("meta.source must be a string, got %v", meta["source"])
+	}
+	if name, ok := meta["identifier_name"]; ok {
+		if _, ok := name.(string); !ok {
+			return fmt.Errorf("meta.identifier_name must be a string, got %v", name)
+		}
+	}
+	return nil
+}
+
+// validateLog checks the entries of the log input, which store the file
+// state at the top level of the value.
+func validateLog(value map[string]interface{}) error {
+	if _, ok := value["source"].(string); !ok {
+		return fmt.Errorf("source must be a string, got %v", value["source"])
+	}
+	return validateOffset(value, "offset")
+}
+
+// validateCursor checks the entries of the inputs built on the input-cursor
+// package. The content of their cursor is specific to each input.
+func validateCursor(value map[string]interface{}) error {
+	if _, ok := value["cursor"]; !ok {
+		return errors.New("cursor is missing")
+	}
+	return nil
+}
+
+// validateHTTPJSON checks the entries of the httpjson input, whose cursor
+// holds the rendered values of the cursor templates. Templates with dotted
+// names are stored as nested objects.
+func validateHTTPJSON(value map[string]interface{}) error {
+	cursor, err := cursorObject(value)
+	if err != nil || cursor == nil {
+		return err
+	}
+	return validateTemplateValues(cursor, "cursor")
+}
+
+func validateTemplateValues(fields map[string]interface{}, name string) error {
+	for k, v := range fields {
+		switch v := v.(type) {
+		case string:
+		case map[string]interface{}:
+			if err := validateTemplateValues(v, name+"."+k); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s.%s must be a string, got %v", name, k, v)
+		}
+	}
+	return nil
+}
+
+// validateCEL checks the entries of the cel input, whose cursor is the
+// object returned by the program.
+func validateCEL(value map[string]interface{}) error {
+	_, err := cursorObject(value)
+	return err
+}
+
+// cursorObject returns the cursor of an entry, which must be an object or
+// nil if the input hasn't stored a cursor yet.
+func cursorObject(value map[string]interface{}) (map[string]interface{}, error) {
+	cursor, ok := value["cursor"]
+	if !ok {
+		return nil, errors.New("cursor is missing")
+	}
+	if cursor == nil {
+		return nil, nil
+	}
+	fields, ok := cursor.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cursor must be an object, got %v", cursor)
+	}
+	return fields, nil
+}
+
+func validateOffset(fields map[string]interface{}, name string) error {
+	offset, ok := fields["offset"]
+	if !ok {
+		return fmt.Errorf("%s is missing", name)
+	}
+	if n, ok := asInt(offset); !ok || n < 0 {
+		return fmt.Errorf("%s must be a non-negative integer, got %v", name, offset)
+	}
+	return nil
+}
+
+// isTimestamp reports whether v is a timestamp as encoded by the registry:
+// a pair of integers or a string.
+func isTimestamp(v interface{}) bool {
+	switch ts := v.(type) {
+	case string:
+		return true
+	case []interface{}:
+		if len(ts) != 2 {
+			return false
+		}
+		for _, elem := range ts {
+			if _, isUint := elem.(uint64); isUint {
+				continue
+			}
+			if _, ok := asInt(elem); !ok {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// asInt returns v as an integer if it is a number without fractional part.
+func asInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), n <= math.MaxInt64
+	case float64:
+		if n != math.Trunc(n) {
+			return 0, false
+		}
+		return int64(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
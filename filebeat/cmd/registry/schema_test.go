@@ -0,0 +1,154 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEntry(t *testing.T) {
+	filestream := func(cursor interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"ttl":     int64(-1),
+			"updated": []interface{}{int64(516031837), int64(1729173622)},
+			"cursor":  cursor,
+			"meta":    map[string]interface{}{"source": "/var/log/a.log", "identifier_name": "native"},
+		}
+	}
+
+	tests := map[string]struct {
+		key     string
+		value   map[string]interface{}
+		wantErr string
+	}{
+		"filestream": {
+			key:   "filestream::my-id::native::123-45",
+			value: filestream(map[string]interface{}{"offset": int64(10), "eof": true}),
+		},
+		"filestream without cursor yet": {
+			key:   "filestream::my-id::native::123-45",
+			value: filestream(nil),
+		},
+		"filestream negative offset": {
+			key:     "filestream::my-id::native::123-45",
+			value:   filestream(map[string]interface{}{"offset": int64(-1)}),
+			wantErr: "cursor.offset must be a non-negative integer",
+		},
+		"filestream fractional offset": {
+			key:     "filestream::my-id::native::123-45",
+			value:   filestream(map[string]interface{}{"offset": 1.5}),
+			wantErr: "cursor.offset must be a non-negative integer",
+		},
+		"filestream invalid eof": {
+			key:     "filestream::my-id::native::123-45",
+			value:   filestream(map[string]interface{}{"offset": int64(10), "eof": "yes"}),
+			wantErr: "cursor.eof must be a boolean",
+		},
+		"filestream without source": {
+			key: "filestream::my-id::native::123-45",
+			value: map[string]interface{}{
+				"cursor": nil,
+				"meta":   map[string]interface{}{},
+			},
+			wantErr: "meta.source must be a string",
+		},
+		"log": {
+			key:   "filebeat::logs::native::123-45",
+			value: map[string]interface{}{"source": "/var/log/a.log", "offset": uint64(10)},
+		},
+		"log without offset": {
+			key:     "filebeat::logs::native::123-45",
+			value:   map[string]interface{}{"source": "/var/log/a.log"},
+			wantErr: "offset is missing",
+		},
+		"httpjson": {
+			key: "httpjson::my-id::https://example.com/api",
+			value: map[string]interface{}{"cursor": map[string]interface{}{
+				"last_published_login": "2024-10-17T15:00:00Z",
+				"page":                 map[string]interface{}{"token": "abc"},
+			}},
+		},
+		"httpjson without cursor yet": {
+			key:   "httpjson::my-id::https://example.com/api",
+			value: map[string]interface{}{"cursor": nil},
+		},
+		"httpjson cursor not an object": {
+			key:     "httpjson::my-id::https://example.com/api",
+			value:   map[string]interface{}{"cursor": "2024-10-17T15:00:00Z"},
+			wantErr: "cursor must be an object",
+		},
+		"httpjson cursor value not a string": {
+			key: "httpjson::my-id::https://example.com/api",
+			value: map[string]interface{}{"cursor": map[string]interface{}{
+				"page": map[string]interface{}{"number": int64(2)},
+			}},
+			wantErr: "cursor.page.number must be a string",
+		},
+		"cel": {
+			key: "cel::my-id::https://example.com/api",
+			value: map[string]interface{}{"cursor": map[string]interface{}{
+				"since": "2024-10-17T15:00:00Z",
+				"ids":   []interface{}{int64(1), int64(2)},
+			}},
+		},
+		"cel cursor not an object": {
+			key:     "cel::my-id::https://example.com/api",
+			value:   map[string]interface{}{"cursor": []interface{}{"a"}},
+			wantErr: "cursor must be an object",
+		},
+		"other input": {
+			key:   "journald::LOCAL_SYSTEM_JOURNAL",
+			value: map[string]interface{}{"cursor": "s=abc;i=1"},
+		},
+		"other input without cursor": {
+			key:     "journald::LOCAL_SYSTEM_JOURNAL",
+			value:   map[string]interface{}{},
+			wantErr: "cursor is missing",
+		},
+		"empty key": {
+			value:   map[string]interface{}{"cursor": nil},
+			wantErr: "the key is empty",
+		},
+		"missing value": {
+			key:     "journald::LOCAL_SYSTEM_JOURNAL",
+			wantErr: "the value is missing",
+		},
+		"invalid ttl": {
+			key:     "journald::LOCAL_SYSTEM_JOURNAL",
+			value:   map[string]interface{}{"cursor": nil, "ttl": "1h"},
+			wantErr: "ttl must be an integer",
+		},
+		"invalid updated": {
+			key:     "journald::LOCAL_SYSTEM_JOURNAL",
+			value:   map[string]interface{}{"cursor": nil, "updated": []interface{}{int64(1)}},
+			wantErr: "updated must be a timestamp",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateEntry(tc.key, tc.value)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
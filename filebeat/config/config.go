@@ -56,6 +56,8 @@ type Registry struct {
 	FlushTimeout  time.Duration `config:"flush"`
 	CleanInterval time.Duration `config:"cleanup_interval"`
 	MigrateFile   string        `config:"migrate_file"`
+	Backend       string        `config:"backend"`
+	NoSync        bool          `config:"no_sync"`
 }
 
 var DefaultConfig = Config{
@@ -65,6 +67,7 @@ var DefaultConfig = Config{
 		MigrateFile:   "",
 		CleanInterval: 5 * time.Minute,
 		FlushTimeout:  time.Second,
+		Backend:       "memlog",
 	},
 	ShutdownTimeout:    0,
 	OverwritePipelines: false,
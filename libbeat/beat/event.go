@@ -75,6 +75,20 @@ func (e *Event) SetID(id string) {
 	_, _ = e.PutValue(metadataKeyPrefix+"_id", id)
 }
 
+// SetPriority overwrites the "priority" field in the events metadata, which
+// selects the memory queue lane the event is published to.
+// If Meta is nil, a new Meta dictionary is created.
+func (e *Event) SetPriority(priority string) {
+	_, _ = e.PutValue(metadataKeyPrefix+"priority", priority)
+}
+
+// Priority returns the "priority" field of the events metadata, or an empty
+// string if it is not set.
+func (e *Event) Priority() string {
+	priority, _ := e.Meta["priority"].(string)
+	return priority
+}
+
 // GetValue gets a value from the event. If the key does not exist then an error
 // is returned.
 //
@@ -429,6 +429,14 @@ func TestEvent(t *testing.T) {
 			event.SetID("unique")
 			require.Equal(t, "unique", event.Meta["_id"])
 		})
+
+		t.Run("SetPriority", func(t *testing.T) {
+			event := &Event{}
+			require.Equal(t, "", event.Priority())
+			event.SetPriority("high")
+			require.Equal(t, "high", event.Meta["priority"])
+			require.Equal(t, "high", event.Priority())
+		})
 	})
 
 	t.Run("SetErrorWithOption", func(t *testing.T) {
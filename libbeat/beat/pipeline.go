@@ -18,6 +18,7 @@
 package beat
 
 import (
+	"errors"
 	"time"
 
 	"github.com/elastic/elastic-agent-libs/mapstr"
@@ -47,6 +48,11 @@ type Client interface {
 type ClientConfig struct {
 	PublishMode PublishMode
 
+	// InputID identifies the input the client publishes events for. The
+	// clients of an input share its quota, if the pipeline has input quotas
+	// enabled.
+	InputID string
+
 	Processing ProcessingConfig
 
 	// WaitClose sets the maximum duration to wait on ACK, if client still has events
@@ -74,6 +80,9 @@ type EventListener interface {
 	// AddEvent is called after the processors have handled the event. If the
 	// event has been dropped by the processor `published` will be set to false.
 	// This allows the ACKer to do some bookkeeping for dropped events.
+	// If the processors split the event into several events, AddEvent is
+	// called once with the last of them, and the event is reported to
+	// ACKEvents once all of them have been ACKed.
 	AddEvent(event Event, published bool)
 
 	// ACKEvents ack events from the output and pipeline queue are forwarded to ACKEvents.
@@ -151,6 +160,51 @@ type Processor interface {
 	Run(in *Event) (event *Event, err error)
 }
 
+// MultiEventProcessor is implemented by processors that can turn an event into
+// several events. Processors running other processors, like processor lists
+// and conditionals, must implement it too and use RunProcessor, so the events
+// are not lost.
+type MultiEventProcessor interface {
+	Processor
+
+	// RunMulti processes an event and returns the resulting events. An empty
+	// result drops the event. The events are published in order, and the
+	// input is notified once all of them have been ACKed.
+	RunMulti(in *Event) (events []*Event, err error)
+}
+
+// ErrMultipleEvents is returned by Run when a processor turned the event into
+// several events, but the caller supports a single event. Only the first
+// event is returned.
+var ErrMultipleEvents = errors.New("processor returned multiple events, only the first one is kept")
+
+// RunProcessor runs the processor on the event and returns the resulting
+// events, using RunMulti if the processor implements MultiEventProcessor.
+func RunProcessor(p Processor, event *Event) ([]*Event, error) {
+	if mp, ok := p.(MultiEventProcessor); ok {
+		return mp.RunMulti(event)
+	}
+	event, err := p.Run(event)
+	if event == nil {
+		return nil, err
+	}
+	return []*Event{event}, err
+}
+
+// SingleEvent converts the result of RunMulti into the result of Run, for
+// MultiEventProcessor implementations that are run by callers supporting a
+// single event.
+func SingleEvent(events []*Event, err error) (*Event, error) {
+	switch len(events) {
+	case 0:
+		return nil, err
+	case 1:
+		return events[0], err
+	default:
+		return events[0], errors.Join(err, ErrMultipleEvents)
+	}
+}
+
 // PublishMode enum sets some requirements on the client connection to the beats
 // publisher pipeline
 type PublishMode uint8
@@ -0,0 +1,39 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+)
+
+func genDiskQueueCmd(settings instance.Settings) *cobra.Command {
+	diskQueueCmd := &cobra.Command{
+		Use:   "diskqueue",
+		Short: "Inspect and repair the disk queue",
+	}
+
+	diskQueueCmd.AddCommand(diskqueue.GenListCmd(settings))
+	diskQueueCmd.AddCommand(diskqueue.GenDumpCmd(settings))
+	diskQueueCmd.AddCommand(diskqueue.GenCheckCmd(settings))
+	diskQueueCmd.AddCommand(diskqueue.GenRepairCmd(settings))
+
+	return diskQueueCmd
+}
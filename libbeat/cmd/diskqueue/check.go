@@ -0,0 +1,112 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+)
+
+// GenCheckCmd is the command used to verify the checksums of the frames in
+// the disk queue.
+func GenCheckCmd(settings instance.Settings) *cobra.Command {
+	var s selection
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Verify the frames of the disk queue segments",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			_, queueSettings, err := openSettings(settings, s.path)
+			if err != nil {
+				return err
+			}
+			segments, err := s.list(queueSettings)
+			if err != nil {
+				return err
+			}
+
+			invalid := 0
+			for _, segment := range segments {
+				check, err := diskqueue.ReadSegment(queueSettings, segment.ID, nil)
+				switch {
+				case err != nil:
+					fmt.Printf("Segment %d: %v\n", segment.ID, err)
+					invalid++
+				case check.Err != nil:
+					fmt.Printf("Segment %d: invalid after %d frames (byte %d): %v\n",
+						segment.ID, check.ValidFrames, check.ValidBytes, check.Err)
+					invalid++
+				default:
+					fmt.Printf("Segment %d: %d frames OK\n", segment.ID, check.ValidFrames)
+				}
+			}
+			if invalid > 0 {
+				return fmt.Errorf("%d of %d segments are invalid", invalid, len(segments))
+			}
+			return nil
+		}),
+	}
+	s.addFlags(cmd)
+	return cmd
+}
+
+// GenRepairCmd is the command used to truncate the invalid frames at the
+// end of the disk queue segments.
+func GenRepairCmd(settings instance.Settings) *cobra.Command {
+	var s selection
+	cmd := &cobra.Command{
+		Use:   "repair",
+		Short: "Truncate the invalid frames at the end of the disk queue segments",
+		Long: "Truncate the invalid frames at the end of the disk queue segments. The frames following " +
+			"the first invalid frame of a segment are lost, and segments without valid frames are " +
+			"deleted. The beat must be stopped while the queue is repaired.",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			_, queueSettings, err := openSettings(settings, s.path)
+			if err != nil {
+				return err
+			}
+			segments, err := s.list(queueSettings)
+			if err != nil {
+				return err
+			}
+
+			var errs []error
+			for _, segment := range segments {
+				check, err := diskqueue.RepairSegment(queueSettings, segment.ID)
+				switch {
+				case err != nil:
+					errs = append(errs, fmt.Errorf("couldn't repair segment %d: %w", segment.ID, err))
+				case check.Err == nil:
+				case check.ValidFrames == 0:
+					fmt.Printf("Segment %d: deleted, no frame is valid: %v\n", segment.ID, check.Err)
+				default:
+					fmt.Printf("Segment %d: truncated after %d frames: %v\n",
+						segment.ID, check.ValidFrames, check.Err)
+				}
+			}
+			return errors.Join(errs...)
+		}),
+	}
+	s.addFlags(cmd)
+	return cmd
+}
@@ -0,0 +1,97 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/hybridqueue"
+)
+
+// openSettings returns the settings of the disk queue configured for the
+// beat, which is either a disk queue or the disk tier of a hybrid queue. If
+// path isn't empty, it replaces the configured directory.
+func openSettings(settings instance.Settings, path string) (*instance.Beat, diskqueue.Settings, error) {
+	b, err := instance.NewInitializedBeat(settings)
+	if err != nil {
+		return nil, diskqueue.Settings{}, fmt.Errorf("error initializing beat: %w", err)
+	}
+
+	var queueSettings diskqueue.Settings
+	queueConfig := b.Config.Pipeline.Queue
+	switch queueConfig.Name() {
+	case diskqueue.QueueType:
+		queueSettings, err = diskqueue.SettingsForUserConfig(queueConfig.Config())
+	case hybridqueue.QueueType:
+		var hybridSettings hybridqueue.Settings
+		hybridSettings, err = hybridqueue.SettingsForUserConfig(queueConfig.Config())
+		queueSettings = hybridSettings.Disk
+	default:
+		if path == "" {
+			return nil, diskqueue.Settings{}, fmt.Errorf(
+				"the beat isn't configured with a disk queue, use --path to select the queue directory")
+		}
+		queueSettings = diskqueue.DefaultSettings()
+	}
+	if err != nil {
+		return nil, diskqueue.Settings{}, err
+	}
+	if path != "" {
+		queueSettings.Path = path
+	}
+	return b, queueSettings, nil
+}
+
+// selection selects the segments handled by a command.
+type selection struct {
+	path     string
+	segments []uint
+}
+
+func (s *selection) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&s.path, "path", "", "Directory of the disk queue, overriding the beat configuration")
+	cmd.Flags().UintSliceVar(&s.segments, "segment", nil, "Only handle the segments with these IDs")
+}
+
+// list returns the selected segments of the queue.
+func (s *selection) list(settings diskqueue.Settings) ([]diskqueue.SegmentInfo, error) {
+	segments, err := diskqueue.ListSegments(settings)
+	if err != nil || len(s.segments) == 0 {
+		return segments, err
+	}
+
+	selected := make(map[uint64]bool, len(s.segments))
+	for _, id := range s.segments {
+		selected[uint64(id)] = true
+	}
+	var filtered []diskqueue.SegmentInfo
+	for _, segment := range segments {
+		if selected[segment.ID] {
+			filtered = append(filtered, segment)
+			delete(selected, segment.ID)
+		}
+	}
+	for id := range selected {
+		return nil, fmt.Errorf("segment %d not found", id)
+	}
+	return filtered, nil
+}
@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+)
+
+// GenDumpCmd is the command used to dump the events of the disk queue as
+// newline delimited JSON.
+func GenDumpCmd(settings instance.Settings) *cobra.Command {
+	var (
+		s       selection
+		path    string
+		pending bool
+	)
+	cmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Dump the events of the disk queue as NDJSON to stdout",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			b, queueSettings, err := openSettings(settings, s.path)
+			if err != nil {
+				return err
+			}
+			segments, err := s.list(queueSettings)
+			if err != nil {
+				return err
+			}
+
+			var position diskqueue.Position
+			if pending {
+				if position, err = diskqueue.ReadPosition(queueSettings); err != nil {
+					return fmt.Errorf("couldn't read the queue position: %w", err)
+				}
+			}
+
+			var out io.Writer = os.Stdout
+			if path != "" {
+				file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+				if err != nil {
+					return fmt.Errorf("error creating dump file: %w", err)
+				}
+				defer file.Close()
+				out = file
+			}
+
+			encoder := json.New(b.Info.Version, json.Config{})
+			return dump(queueSettings, segments, position, b.Info.Beat, encoder, out)
+		}),
+	}
+	s.addFlags(cmd)
+	cmd.Flags().StringVar(&path, "file", "", "Write the events to this file instead of stdout")
+	cmd.Flags().BoolVar(&pending, "pending", false, "Only dump the events that aren't acknowledged yet")
+	return cmd
+}
+
+// dump writes the events of the segments that follow position. Segments
+// with invalid frames are dumped up to the first invalid frame.
+func dump(
+	settings diskqueue.Settings,
+	segments []diskqueue.SegmentInfo,
+	position diskqueue.Position,
+	index string,
+	encoder *json.Encoder,
+	out io.Writer,
+) error {
+	w := bufio.NewWriter(out)
+	for _, segment := range segments {
+		if segment.ID < position.SegmentID {
+			continue
+		}
+		check, err := diskqueue.ReadSegment(settings, segment.ID, func(frame diskqueue.Frame) error {
+			if segment.ID == position.SegmentID && frame.Index < position.FrameIndex {
+				return nil
+			}
+			data, err := encoder.Encode(index, &frame.Event.Content)
+			if err != nil {
+				return fmt.Errorf("error encoding frame %d of segment %d: %w", frame.Index, segment.ID, err)
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			return w.WriteByte('\n')
+		})
+		if err != nil {
+			return err
+		}
+		if check.Err != nil {
+			fmt.Fprintf(os.Stderr, "Segment %d is invalid after frame %d: %v\n",
+				segment.ID, check.ValidFrames, check.Err)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+)
+
+// GenListCmd is the command used to list the segments of the disk queue.
+func GenListCmd(settings instance.Settings) *cobra.Command {
+	var s selection
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the segments of the disk queue and the acknowledged position",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			_, queueSettings, err := openSettings(settings, s.path)
+			if err != nil {
+				return err
+			}
+			segments, err := s.list(queueSettings)
+			if err != nil {
+				return err
+			}
+
+			position, err := diskqueue.ReadPosition(queueSettings)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Couldn't read the queue position: %v\n", err)
+			} else {
+				fmt.Printf("Acknowledged up to segment %d, frame %d (byte %d)\n\n",
+					position.SegmentID, position.FrameIndex, position.ByteIndex)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tVERSION\tOPTIONS\tFRAMES\tSIZE\tERROR")
+			for _, segment := range segments {
+				errMsg := ""
+				if segment.Err != nil {
+					errMsg = segment.Err.Error()
+				}
+				fmt.Fprintf(w, "%d\t%d\t%v\t%d\t%d\t%v\n",
+					segment.ID, segment.Version, optionNames(segment.Options),
+					segment.FrameCount, segment.Size, errMsg)
+			}
+			return w.Flush()
+		}),
+	}
+	s.addFlags(cmd)
+	return cmd
+}
+
+// optionNames describes the options of a segment.
+func optionNames(options uint32) string {
+	var names []string
+	if options&diskqueue.ENABLE_ENCRYPTION != 0 {
+		names = append(names, "encrypted")
+	}
+	if options&diskqueue.ENABLE_COMPRESSION != 0 {
+		names = append(names, "compressed")
+	}
+	if options&diskqueue.ENABLE_PROTOBUF != 0 {
+		names = append(names, "protobuf")
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
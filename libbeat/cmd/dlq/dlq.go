@@ -0,0 +1,85 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dlq
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/publisher/dlq"
+)
+
+// openQueue opens the dead letter queue configured for the beat. The queue
+// can be opened even if it is disabled, to handle the entries stored while
+// it was enabled.
+func openQueue(settings instance.Settings) (*instance.Beat, *dlq.Queue, error) {
+	b, err := instance.NewInitializedBeat(settings)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error initializing beat: %w", err)
+	}
+
+	config, err := dlq.ReadConfig(b.Config.Pipeline.DeadLetterQueue)
+	if err != nil {
+		return nil, nil, err
+	}
+	q, err := dlq.Open(b.Info.Logger.Named("dead_letter_queue"), config, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, q, nil
+}
+
+// filter selects the entries handled by a command.
+type filter struct {
+	output string
+	ids    []string
+
+	parsedIDs map[dlq.EntryID]bool
+}
+
+func (f *filter) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.output, "output", "", "Only handle the entries of this output")
+	cmd.Flags().StringSliceVar(&f.ids, "id", nil, "Only handle the entries with these IDs")
+}
+
+func (f *filter) parse() error {
+	if len(f.ids) == 0 {
+		return nil
+	}
+	f.parsedIDs = make(map[dlq.EntryID]bool, len(f.ids))
+	for _, s := range f.ids {
+		id, err := dlq.ParseEntryID(s)
+		if err != nil {
+			return err
+		}
+		f.parsedIDs[id] = true
+	}
+	return nil
+}
+
+func (f *filter) match(entry *dlq.Entry) bool {
+	if f.output != "" && entry.Output != f.output {
+		return false
+	}
+	if f.parsedIDs != nil && !f.parsedIDs[entry.ID] {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dlq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/publisher/dlq"
+)
+
+// GenExportCmd is the command used to export the entries of the dead letter
+// queue as newline delimited JSON.
+func GenExportCmd(settings instance.Settings) *cobra.Command {
+	var (
+		f    filter
+		path string
+	)
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the entries of the dead letter queue as NDJSON to stdout",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			if err := f.parse(); err != nil {
+				return err
+			}
+			_, q, err := openQueue(settings)
+			if err != nil {
+				return err
+			}
+			defer q.Close()
+
+			var out io.Writer = os.Stdout
+			if path != "" {
+				file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+				if err != nil {
+					return fmt.Errorf("error creating export file: %w", err)
+				}
+				defer file.Close()
+				out = file
+			}
+			return export(q, &f, out)
+		}),
+	}
+	f.addFlags(cmd)
+	cmd.Flags().StringVar(&path, "file", "", "Write the entries to this file instead of stdout")
+	return cmd
+}
+
+func export(q *dlq.Queue, f *filter, out io.Writer) error {
+	w := bufio.NewWriter(out)
+	err := q.Scan(func(entry *dlq.Entry) error {
+		if !f.match(entry) {
+			return nil
+		}
+		data, err := entry.MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("error encoding entry %v: %w", entry.ID, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		return w.WriteByte('\n')
+	})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dlq
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/publisher/dlq"
+)
+
+// errLimit stops scanning the queue once enough entries are listed.
+var errLimit = errors.New("limit reached")
+
+// GenListCmd is the command used to list the entries of the dead letter queue.
+func GenListCmd(settings instance.Settings) *cobra.Command {
+	var (
+		f     filter
+		limit int
+	)
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the entries of the dead letter queue",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			if err := f.parse(); err != nil {
+				return err
+			}
+			_, q, err := openQueue(settings)
+			if err != nil {
+				return err
+			}
+			defer q.Close()
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tTIME\tOUTPUT\tERROR")
+			count := 0
+			err = q.Scan(func(entry *dlq.Entry) error {
+				if !f.match(entry) {
+					return nil
+				}
+				if limit > 0 && count >= limit {
+					return errLimit
+				}
+				count++
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\n",
+					entry.ID, entry.Timestamp.Format(time.RFC3339), entry.Output, entry.Error)
+				return nil
+			})
+			if err != nil && !errors.Is(err, errLimit) {
+				return err
+			}
+			return w.Flush()
+		}),
+	}
+	f.addFlags(cmd)
+	cmd.Flags().IntVar(&limit, "limit", 0, "Maximum number of entries to list, 0 lists all of them")
+	return cmd
+}
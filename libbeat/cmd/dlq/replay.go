@@ -0,0 +1,129 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dlq
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/acker"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/publisher/dlq"
+	"github.com/elastic/beats/v7/libbeat/publisher/pipeline"
+)
+
+// GenReplayCmd is the command used to publish the entries of the dead letter
+// queue again, through the pipeline and output configured for the beat.
+func GenReplayCmd(settings instance.Settings) *cobra.Command {
+	var (
+		f       filter
+		keep    bool
+		timeout time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Publish the entries of the dead letter queue to the configured output",
+		Long: "Publish the entries of the dead letter queue to the configured output.\n" +
+			"Entries are removed once the output is done with them, events failing again\n" +
+			"are stored as new entries. The beat must not be running while replaying.",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			if err := f.parse(); err != nil {
+				return err
+			}
+			b, q, err := openQueue(settings)
+			if err != nil {
+				return err
+			}
+			defer q.Close()
+			return replay(b, q, &f, keep, timeout)
+		}),
+	}
+	f.addFlags(cmd)
+	cmd.Flags().BoolVar(&keep, "keep", false, "Keep the replayed entries in the dead letter queue")
+	cmd.Flags().DurationVar(&timeout, "timeout", time.Minute, "How long to wait for the output to acknowledge the events")
+	return cmd
+}
+
+func replay(b *instance.Beat, q *dlq.Queue, f *filter, keep bool, timeout time.Duration) error {
+	monitors := pipeline.Monitors{
+		Logger: b.Info.Logger.Named("publisher"),
+	}
+	// The events were processed before, so the pipeline has no processors.
+	// Events failing again are stored in q.
+	p, err := pipeline.LoadWithSettings(b.Info, monitors, b.Config.Pipeline,
+		b.MakeOutputFactory(b.Config.Output), pipeline.Settings{DeadLetterQueue: q})
+	if err != nil {
+		return fmt.Errorf("error initializing publisher: %w", err)
+	}
+	defer p.Close()
+
+	var (
+		mu   sync.Mutex
+		done []dlq.EntryID
+	)
+	client, err := p.ConnectWith(beat.ClientConfig{
+		WaitClose: timeout,
+		EventListener: acker.EventPrivateReporter(func(_ int, data []interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, d := range data {
+				if id, ok := d.(dlq.EntryID); ok {
+					done = append(done, id)
+				}
+			}
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("error connecting to the publisher: %w", err)
+	}
+
+	published := 0
+	err = q.Scan(func(entry *dlq.Entry) error {
+		if !f.match(entry) {
+			return nil
+		}
+		event := entry.Event
+		event.Private = entry.ID
+		client.Publish(event)
+		published++
+		return nil
+	})
+	// Closing the client waits for the pending events to be acknowledged.
+	client.Close()
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	fmt.Printf("Replayed %d of %d entries\n", len(done), published)
+	if keep || len(done) == 0 {
+		return nil
+	}
+	removed, err := q.Remove(done)
+	if err != nil {
+		return fmt.Errorf("error removing replayed entries: %w", err)
+	}
+	fmt.Printf("Removed %d entries from the dead letter queue\n", removed)
+	return nil
+}
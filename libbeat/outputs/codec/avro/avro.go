@@ -0,0 +1,255 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package avro provides a codec serializing events to the Avro binary
+// encoding. Events are encoded using either a user provided schema or the
+// generic envelope schema of this package.
+//
+// The codec writes plain Avro datums without any framing. Outputs can use
+// Schema to register the schema with a schema registry and prefix every datum
+// with the schema ID.
+package avro
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/go-structform/gotype"
+)
+
+// EnvelopeSchema is the schema used if no schema is configured. It stores the
+// event timestamp, the metadata and all fields. Metadata and field values are
+// wrapped into the recursive Value record.
+const EnvelopeSchema = `{
+  "type": "record",
+  "name": "Event",
+  "namespace": "co.elastic.beats",
+  "fields": [
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "metadata", "type": {"type": "map", "values": {
+      "type": "record",
+      "name": "Value",
+      "fields": [
+        {"name": "value", "type": [
+          "null", "boolean", "long", "double", "string",
+          {"type": "array", "items": "Value"},
+          {"type": "map", "values": "Value"}
+        ]}
+      ]
+    }}},
+    {"name": "fields", "type": {"type": "map", "values": "Value"}}
+  ]
+}`
+
+// Encoder for serializing a beat.Event to Avro.
+type Encoder struct {
+	unfolder *gotype.Unfolder
+	folder   *gotype.Iterator
+	enc      encoder
+
+	version  string
+	schema   schema
+	raw      string
+	envelope bool
+}
+
+// Config is used to pass encoding parameters to New.
+type Config struct {
+	// Schema is the Avro schema in its JSON representation. Fields of the top
+	// level record are looked up in the event by name or alias. The event
+	// timestamp and metadata are available as `@timestamp` and `@metadata`.
+	Schema string `config:"schema"`
+
+	// SchemaFile is the path of a file containing the Avro schema.
+	SchemaFile string `config:"schema_file"`
+}
+
+func (c *Config) Validate() error {
+	if c.Schema != "" && c.SchemaFile != "" {
+		return errors.New("only one of schema and schema_file can be configured")
+	}
+	return nil
+}
+
+func init() {
+	codec.RegisterType("avro", func(info beat.Info, cfg *config.C) (codec.Codec, error) {
+		config := Config{}
+		if cfg != nil {
+			if err := cfg.Unpack(&config); err != nil {
+				return nil, err
+			}
+		}
+
+		return New(info.Version, config)
+	})
+}
+
+// New creates a new Avro Encoder.
+func New(version string, config Config) (*Encoder, error) {
+	raw := config.Schema
+	if config.SchemaFile != "" {
+		contents, err := os.ReadFile(config.SchemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read avro schema: %w", err)
+		}
+		raw = string(contents)
+	}
+
+	envelope := raw == ""
+	if envelope {
+		raw = EnvelopeSchema
+	}
+
+	s, err := parseSchema(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// Normalize the schema by removing whitespace, it is passed to schema
+	// registries as is.
+	var compact map[string]interface{}
+	var schemaJSON []byte
+	if err := json.Unmarshal([]byte(raw), &compact); err == nil {
+		schemaJSON, err = json.Marshal(compact)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		schemaJSON = []byte(raw)
+	}
+
+	e := &Encoder{
+		version:  version,
+		schema:   s,
+		raw:      string(schemaJSON),
+		envelope: envelope,
+	}
+	e.reset()
+	return e, nil
+}
+
+func (e *Encoder) reset() {
+	// NewUnfolder and NewIterator only fail on invalid arguments, which are
+	// fixed here.
+	e.unfolder, _ = gotype.NewUnfolder(nil)
+	e.folder, _ = gotype.NewIterator(e.unfolder,
+		gotype.Folders(
+			codec.MakeTimestampEncoder(),
+			codec.MakeBCTimestampEncoder(),
+		),
+	)
+}
+
+// Schema returns the Avro schema used by the encoder in its JSON
+// representation.
+func (e *Encoder) Schema() string {
+	return e.raw
+}
+
+// Encode serializes a beat event to an Avro datum.
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	metadata := map[string]interface{}{}
+	for k, v := range event.Meta {
+		metadata[k] = v
+	}
+	metadata["beat"] = index
+	metadata["type"] = "_doc"
+	metadata["version"] = e.version
+
+	meta, err := e.normalize(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event metadata: %w", err)
+	}
+	fields, err := e.normalize(event.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event fields: %w", err)
+	}
+
+	var datum map[string]interface{}
+	if e.envelope {
+		datum = map[string]interface{}{
+			"timestamp": event.Timestamp,
+			"metadata":  wrapValue(meta),
+			"fields":    wrapValue(fields),
+		}
+	} else {
+		datum = fields
+		if datum == nil {
+			datum = map[string]interface{}{}
+		}
+		datum["@timestamp"] = event.Timestamp
+		datum["@metadata"] = meta
+	}
+
+	e.enc.buf = e.enc.buf[:0]
+	if err := e.enc.encode(e.schema, datum); err != nil {
+		return nil, err
+	}
+	return e.enc.buf, nil
+}
+
+// IsBinary reports Avro as a binary encoding.
+func (e *Encoder) IsBinary() bool { return true }
+
+// normalize converts v into plain maps, slices and primitives.
+func (e *Encoder) normalize(v interface{}) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := e.unfolder.SetTarget(&m); err != nil {
+		return nil, err
+	}
+	defer e.unfolder.Reset()
+
+	if err := e.folder.Fold(v); err != nil {
+		e.reset()
+		return nil, err
+	}
+	return m, nil
+}
+
+// wrapValue wraps all values of m into Value records of the envelope schema.
+func wrapValue(m map[string]interface{}) map[string]interface{} {
+	wrapped := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		wrapped[k] = map[string]interface{}{"value": wrapAny(v)}
+	}
+	return wrapped
+}
+
+func wrapAny(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return wrapValue(v)
+	case nil, bool, string:
+		return v
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return v
+	}
+	s := make([]interface{}, rv.Len())
+	for i := range s {
+		s[i] = map[string]interface{}{"value": wrapAny(rv.Index(i).Interface())}
+	}
+	return s
+}
@@ -0,0 +1,192 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestEncodePrimitives(t *testing.T) {
+	tests := map[string]struct {
+		schema   string
+		value    interface{}
+		expected []byte
+	}{
+		"null":             {schema: `"null"`, value: nil, expected: nil},
+		"true":             {schema: `"boolean"`, value: true, expected: []byte{1}},
+		"int zero":         {schema: `"int"`, value: 0, expected: []byte{0x00}},
+		"int negative":     {schema: `"int"`, value: int64(-1), expected: []byte{0x01}},
+		"long 64":          {schema: `"long"`, value: int64(64), expected: []byte{0x80, 0x01}},
+		"long -64":         {schema: `"long"`, value: int64(-64), expected: []byte{0x7f}},
+		"float":            {schema: `"float"`, value: 1.5, expected: []byte{0x00, 0x00, 0xc0, 0x3f}},
+		"double":           {schema: `"double"`, value: 1.5, expected: []byte{0, 0, 0, 0, 0, 0, 0xf8, 0x3f}},
+		"string":           {schema: `"string"`, value: "foo", expected: []byte{0x06, 'f', 'o', 'o'}},
+		"bytes":            {schema: `"bytes"`, value: []byte{1, 2}, expected: []byte{0x04, 1, 2}},
+		"enum":             {schema: `{"type":"enum","name":"E","symbols":["A","B"]}`, value: "B", expected: []byte{0x02}},
+		"fixed":            {schema: `{"type":"fixed","name":"F","size":2}`, value: "ab", expected: []byte{'a', 'b'}},
+		"array":            {schema: `{"type":"array","items":"long"}`, value: []int64{3, 27}, expected: []byte{0x04, 0x06, 0x36, 0x00}},
+		"empty array":      {schema: `{"type":"array","items":"long"}`, value: []interface{}{}, expected: []byte{0x00}},
+		"map":              {schema: `{"type":"map","values":"string"}`, value: map[string]interface{}{"a": "b"}, expected: []byte{0x02, 0x02, 'a', 0x02, 'b', 0x00}},
+		"union null":       {schema: `["null","string"]`, value: nil, expected: []byte{0x00}},
+		"union string":     {schema: `["null","string"]`, value: "a", expected: []byte{0x02, 0x02, 'a'}},
+		"union int double": {schema: `["null","long","double"]`, value: 1.5, expected: []byte{0x04, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f}},
+		"timestamp string": {
+			schema:   `{"type":"long","logicalType":"timestamp-millis"}`,
+			value:    "1970-01-01T00:00:00.064Z",
+			expected: []byte{0x80, 0x01},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := parseSchema(test.schema)
+			require.NoError(t, err)
+
+			var enc encoder
+			require.NoError(t, enc.encode(s, test.value))
+			assert.Equal(t, test.expected, enc.buf)
+		})
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	tests := map[string]struct {
+		schema string
+		value  interface{}
+	}{
+		"string as long":  {schema: `"long"`, value: "1"},
+		"int overflow":    {schema: `"int"`, value: int64(1) << 40},
+		"unknown symbol":  {schema: `{"type":"enum","name":"E","symbols":["A"]}`, value: "B"},
+		"fixed size":      {schema: `{"type":"fixed","name":"F","size":2}`, value: "abc"},
+		"no union branch": {schema: `["null","long"]`, value: "a"},
+		"missing field":   {schema: `{"type":"record","name":"R","fields":[{"name":"a","type":"long"}]}`, value: map[string]interface{}{}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := parseSchema(test.schema)
+			require.NoError(t, err)
+
+			var enc encoder
+			assert.Error(t, enc.encode(s, test.value))
+		})
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	tests := map[string]string{
+		"invalid json":    `{`,
+		"unknown type":    `"unknown"`,
+		"missing fields":  `{"type":"record","name":"R"}`,
+		"duplicate name":  `{"type":"record","name":"R","fields":[{"name":"a","type":{"type":"record","name":"R","fields":[]}}]}`,
+		"nested union":    `["null",["string"]]`,
+		"enum no symbols": `{"type":"enum","name":"E","symbols":[]}`,
+	}
+
+	for name, schema := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseSchema(schema)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEncodeRecordWithSchema(t *testing.T) {
+	schema := `{
+		"type": "record",
+		"name": "Log",
+		"namespace": "test",
+		"fields": [
+			{"name": "timestamp", "aliases": ["@timestamp"], "type": {"type": "long", "logicalType": "timestamp-millis"}},
+			{"name": "message", "type": "string"},
+			{"name": "level", "type": ["null", "string"], "default": null},
+			{"name": "count", "type": "long", "default": 7},
+			{"name": "host", "type": {"type": "record", "name": "Host", "fields": [{"name": "name", "type": "string"}]}}
+		]
+	}`
+
+	enc, err := New("1.2.3", Config{Schema: schema})
+	require.NoError(t, err)
+
+	event := &beat.Event{
+		Timestamp: time.UnixMilli(64).UTC(),
+		Fields: mapstr.M{
+			"message": "hi",
+			"host":    mapstr.M{"name": "h"},
+			"ignored": "not in schema",
+		},
+	}
+	encoded, err := enc.Encode("test", event)
+	require.NoError(t, err)
+
+	expected := []byte{
+		0x80, 0x01, // timestamp
+		0x04, 'h', 'i', // message
+		0x00,      // level: null branch
+		0x0e,      // count default
+		0x02, 'h', // host.name
+	}
+	assert.Equal(t, expected, encoded)
+	assert.True(t, enc.IsBinary())
+	assert.NotContains(t, enc.Schema(), "\n")
+}
+
+func TestEncodeEnvelope(t *testing.T) {
+	enc, err := New("1.2.3", Config{})
+	require.NoError(t, err)
+
+	encoded, err := enc.Encode("test", &beat.Event{
+		Timestamp: time.UnixMilli(1).UTC(),
+		Fields:    mapstr.M{"tags": []string{"a"}},
+	})
+	require.NoError(t, err)
+
+	// timestamp, then the metadata map, then the fields map
+	assert.Equal(t, []byte{0x02}, encoded[:1])
+	assert.Equal(t, []byte{
+		// fields map with the single key "tags"
+		0x02, 0x08, 't', 'a', 'g', 's',
+		// array branch with one item
+		0x0a, 0x02,
+		// string branch "a"
+		0x08, 0x02, 'a',
+		// end of array and end of map
+		0x00, 0x00,
+	}, encoded[len(encoded)-13:])
+}
+
+func TestSchemaFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.avsc")
+	require.NoError(t, os.WriteFile(path, []byte(`{"type":"record","name":"R","fields":[{"name":"message","type":"string"}]}`), 0o600))
+
+	enc, err := New("1.2.3", Config{SchemaFile: path})
+	require.NoError(t, err)
+	assert.Equal(t, `{"fields":[{"name":"message","type":"string"}],"name":"R","type":"record"}`, enc.Schema())
+
+	_, err = New("1.2.3", Config{SchemaFile: filepath.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+}
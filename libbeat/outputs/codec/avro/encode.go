@@ -0,0 +1,337 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// encoder appends the Avro binary encoding of values to a buffer. Values are
+// expected in the normalized form produced by the unfolder: nil, bool,
+// integers, floats, strings, maps and slices.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) encode(s schema, v interface{}) error {
+	switch s := s.(type) {
+	case *primitiveSchema:
+		return e.encodePrimitive(s, v)
+	case *recordSchema:
+		return e.encodeRecord(s, v)
+	case *enumSchema:
+		return e.encodeEnum(s, v)
+	case *fixedSchema:
+		return e.encodeFixed(s, v)
+	case *arraySchema:
+		return e.encodeArray(s, v)
+	case *mapSchema:
+		return e.encodeMap(s, v)
+	case *unionSchema:
+		return e.encodeUnion(s, v)
+	default:
+		return fmt.Errorf("unsupported avro schema type %T", s)
+	}
+}
+
+func (e *encoder) encodePrimitive(s *primitiveSchema, v interface{}) error {
+	switch s.typ {
+	case "null":
+		if v != nil {
+			return typeError(s, v)
+		}
+		return nil
+	case "boolean":
+		b, ok := v.(bool)
+		if !ok {
+			return typeError(s, v)
+		}
+		if b {
+			e.buf = append(e.buf, 1)
+		} else {
+			e.buf = append(e.buf, 0)
+		}
+		return nil
+	case "int", "long":
+		i, ok := toLong(s.logical, v)
+		if !ok {
+			return typeError(s, v)
+		}
+		if s.typ == "int" && (i < math.MinInt32 || i > math.MaxInt32) {
+			return fmt.Errorf("value %v overflows avro int", v)
+		}
+		e.writeLong(i)
+		return nil
+	case "float":
+		f, ok := toDouble(v)
+		if !ok {
+			return typeError(s, v)
+		}
+		e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(float32(f)))
+		return nil
+	case "double":
+		f, ok := toDouble(v)
+		if !ok {
+			return typeError(s, v)
+		}
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+		return nil
+	case "bytes":
+		switch v := v.(type) {
+		case []byte:
+			e.writeBytes(v)
+		case string:
+			e.writeString(v)
+		default:
+			return typeError(s, v)
+		}
+		return nil
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return typeError(s, v)
+		}
+		e.writeString(str)
+		return nil
+	default:
+		return fmt.Errorf("unsupported avro type '%v'", s.typ)
+	}
+}
+
+func (e *encoder) encodeRecord(s *recordSchema, v interface{}) error {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return typeError(s, v)
+	}
+
+	for _, field := range s.fields {
+		value, found := m[field.name]
+		for _, alias := range field.aliases {
+			if found {
+				break
+			}
+			value, found = m[alias]
+		}
+		if !found {
+			if field.hasDefault {
+				value = field.def
+			} else if !acceptsNull(field.schema) {
+				return fmt.Errorf("missing required field '%v' of avro record '%v'", field.name, s.name)
+			}
+		}
+
+		if err := e.encode(field.schema, value); err != nil {
+			return fmt.Errorf("field '%v': %w", field.name, err)
+		}
+	}
+	return nil
+}
+
+func (e *encoder) encodeEnum(s *enumSchema, v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return typeError(s, v)
+	}
+	for i, symbol := range s.symbols {
+		if symbol == str {
+			e.writeLong(int64(i))
+			return nil
+		}
+	}
+	return fmt.Errorf("'%v' is not a symbol of avro enum '%v'", str, s.name)
+}
+
+func (e *encoder) encodeFixed(s *fixedSchema, v interface{}) error {
+	var b []byte
+	switch v := v.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return typeError(s, v)
+	}
+	if len(b) != s.size {
+		return fmt.Errorf("value of size %d does not match avro fixed '%v' of size %d", len(b), s.name, s.size)
+	}
+	e.buf = append(e.buf, b...)
+	return nil
+}
+
+func (e *encoder) encodeArray(s *arraySchema, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if v == nil || rv.Kind() != reflect.Slice {
+		return typeError(s, v)
+	}
+
+	if n := rv.Len(); n > 0 {
+		e.writeLong(int64(n))
+		for i := 0; i < n; i++ {
+			if err := e.encode(s.items, rv.Index(i).Interface()); err != nil {
+				return fmt.Errorf("array index %d: %w", i, err)
+			}
+		}
+	}
+	e.writeLong(0)
+	return nil
+}
+
+func (e *encoder) encodeMap(s *mapSchema, v interface{}) error {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return typeError(s, v)
+	}
+
+	if len(m) > 0 {
+		e.writeLong(int64(len(m)))
+		for k, value := range m {
+			e.writeString(k)
+			if err := e.encode(s.values, value); err != nil {
+				return fmt.Errorf("map key '%v': %w", k, err)
+			}
+		}
+	}
+	e.writeLong(0)
+	return nil
+}
+
+// encodeUnion encodes v using the first branch of the union accepting it.
+func (e *encoder) encodeUnion(s *unionSchema, v interface{}) error {
+	start := len(e.buf)
+	for i, branch := range s.branches {
+		e.writeLong(int64(i))
+		if err := e.encode(branch, v); err == nil {
+			return nil
+		}
+		e.buf = e.buf[:start]
+	}
+	return fmt.Errorf("value %v (%T) does not match any branch of avro union", v, v)
+}
+
+func (e *encoder) writeLong(i int64) {
+	e.buf = binary.AppendVarint(e.buf, i)
+}
+
+func (e *encoder) writeBytes(b []byte) {
+	e.writeLong(int64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) writeString(s string) {
+	e.writeLong(int64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func acceptsNull(s schema) bool {
+	switch s := s.(type) {
+	case *primitiveSchema:
+		return s.typ == "null"
+	case *unionSchema:
+		for _, branch := range s.branches {
+			if acceptsNull(branch) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// toLong converts integer values to int64. Timestamp and date logical types
+// additionally accept RFC3339 formatted strings and time.Time values.
+func toLong(logical string, v interface{}) (int64, bool) {
+	switch logical {
+	case "timestamp-millis", "timestamp-micros", "timestamp-nanos",
+		"local-timestamp-millis", "local-timestamp-micros", "local-timestamp-nanos", "date":
+		if ts, ok := toTime(v); ok {
+			switch logical {
+			case "timestamp-millis", "local-timestamp-millis":
+				return ts.UnixMilli(), true
+			case "timestamp-micros", "local-timestamp-micros":
+				return ts.UnixMicro(), true
+			case "date":
+				return int64(math.Floor(float64(ts.Unix()) / 86400)), true
+			default:
+				return ts.UnixNano(), true
+			}
+		}
+	}
+
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint:
+		return int64(v), v <= math.MaxInt64
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case float64:
+		// schema defaults are parsed from JSON as float64
+		return int64(v), v == math.Trunc(v) && math.Abs(v) < (1<<63)
+	default:
+		return 0, false
+	}
+}
+
+func toDouble(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	if i, ok := toLong("", v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		ts, err := time.Parse(time.RFC3339Nano, v)
+		return ts, err == nil
+	default:
+		return time.Time{}, false
+	}
+}
+
+var errType = errors.New("type mismatch")
+
+func typeError(s schema, v interface{}) error {
+	return fmt.Errorf("%w: value %v (%T) is not a valid avro %v", errType, v, v, s.typeName())
+}
@@ -0,0 +1,305 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// schema is a parsed Avro schema node. Named types (records, enums and fixed)
+// are shared by pointer, so recursive schemas form a cyclic graph.
+type schema interface {
+	// typeName returns the Avro type name, or the full name of named types.
+	typeName() string
+}
+
+type primitiveSchema struct {
+	typ     string
+	logical string
+}
+
+type recordSchema struct {
+	name   string
+	fields []*recordField
+}
+
+type recordField struct {
+	name       string
+	aliases    []string
+	schema     schema
+	def        interface{}
+	hasDefault bool
+}
+
+type enumSchema struct {
+	name    string
+	symbols []string
+}
+
+type fixedSchema struct {
+	name string
+	size int
+}
+
+type arraySchema struct {
+	items schema
+}
+
+type mapSchema struct {
+	values schema
+}
+
+type unionSchema struct {
+	branches []schema
+}
+
+func (s *primitiveSchema) typeName() string { return s.typ }
+func (s *recordSchema) typeName() string    { return s.name }
+func (s *enumSchema) typeName() string      { return s.name }
+func (s *fixedSchema) typeName() string     { return s.name }
+func (s *arraySchema) typeName() string     { return "array" }
+func (s *mapSchema) typeName() string       { return "map" }
+func (s *unionSchema) typeName() string     { return "union" }
+
+var primitiveTypes = map[string]bool{
+	"null":    true,
+	"boolean": true,
+	"int":     true,
+	"long":    true,
+	"float":   true,
+	"double":  true,
+	"bytes":   true,
+	"string":  true,
+}
+
+// schemaParser resolves named type references while parsing a schema.
+type schemaParser struct {
+	named map[string]schema
+}
+
+// parseSchema parses an Avro schema in its JSON representation.
+func parseSchema(raw string) (schema, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return nil, fmt.Errorf("invalid avro schema: %w", err)
+	}
+
+	p := &schemaParser{named: map[string]schema{}}
+	return p.parse(v, "")
+}
+
+func (p *schemaParser) parse(v interface{}, namespace string) (schema, error) {
+	switch v := v.(type) {
+	case string:
+		return p.resolve(v, namespace)
+	case []interface{}:
+		return p.parseUnion(v, namespace)
+	case map[string]interface{}:
+		return p.parseComplex(v, namespace)
+	default:
+		return nil, fmt.Errorf("invalid avro schema element %v", v)
+	}
+}
+
+func (p *schemaParser) resolve(name, namespace string) (schema, error) {
+	if primitiveTypes[name] {
+		return &primitiveSchema{typ: name}, nil
+	}
+	if s, ok := p.named[fullName(name, namespace)]; ok {
+		return s, nil
+	}
+	if s, ok := p.named[name]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown avro type '%v'", name)
+}
+
+func (p *schemaParser) parseUnion(branches []interface{}, namespace string) (schema, error) {
+	if len(branches) == 0 {
+		return nil, errors.New("avro union must have at least one branch")
+	}
+
+	union := &unionSchema{branches: make([]schema, len(branches))}
+	for i, branch := range branches {
+		s, err := p.parse(branch, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := s.(*unionSchema); ok {
+			return nil, errors.New("avro unions must not contain unions")
+		}
+		union.branches[i] = s
+	}
+	return union, nil
+}
+
+func (p *schemaParser) parseComplex(m map[string]interface{}, namespace string) (schema, error) {
+	typ, ok := m["type"]
+	if !ok {
+		return nil, errors.New("avro schema is missing 'type'")
+	}
+
+	typName, ok := typ.(string)
+	if !ok {
+		// type is a nested schema, e.g. {"type": {"type": "array", ...}}
+		return p.parse(typ, namespace)
+	}
+
+	if primitiveTypes[typName] {
+		logical, _ := m["logicalType"].(string)
+		return &primitiveSchema{typ: typName, logical: logical}, nil
+	}
+
+	switch typName {
+	case "record", "error":
+		return p.parseRecord(m, namespace)
+	case "enum":
+		return p.parseEnum(m, namespace)
+	case "fixed":
+		return p.parseFixed(m, namespace)
+	case "array":
+		items, err := p.parse(m["items"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid avro array items: %w", err)
+		}
+		return &arraySchema{items: items}, nil
+	case "map":
+		values, err := p.parse(m["values"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid avro map values: %w", err)
+		}
+		return &mapSchema{values: values}, nil
+	default:
+		return p.resolve(typName, namespace)
+	}
+}
+
+// defineName registers a named type. It returns the full name of the type and
+// the namespace to use for nested definitions.
+func (p *schemaParser) defineName(m map[string]interface{}, namespace string, s schema) (string, string, error) {
+	name, _ := m["name"].(string)
+	if name == "" {
+		return "", "", errors.New("avro named type is missing 'name'")
+	}
+	if ns, ok := m["namespace"].(string); ok && !strings.Contains(name, ".") {
+		namespace = ns
+	}
+
+	full := fullName(name, namespace)
+	if _, exists := p.named[full]; exists {
+		return "", "", fmt.Errorf("avro type '%v' is defined more than once", full)
+	}
+	p.named[full] = s
+
+	if i := strings.LastIndexByte(full, '.'); i >= 0 {
+		namespace = full[:i]
+	} else {
+		namespace = ""
+	}
+	return full, namespace, nil
+}
+
+func (p *schemaParser) parseRecord(m map[string]interface{}, namespace string) (schema, error) {
+	record := &recordSchema{}
+	name, namespace, err := p.defineName(m, namespace, record)
+	if err != nil {
+		return nil, err
+	}
+	record.name = name
+
+	fields, ok := m["fields"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("avro record '%v' is missing 'fields'", name)
+	}
+
+	for _, f := range fields {
+		fm, ok := f.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid field in avro record '%v'", name)
+		}
+
+		field := &recordField{}
+		field.name, _ = fm["name"].(string)
+		if field.name == "" {
+			return nil, fmt.Errorf("field without name in avro record '%v'", name)
+		}
+		if aliases, ok := fm["aliases"].([]interface{}); ok {
+			for _, alias := range aliases {
+				if s, ok := alias.(string); ok {
+					field.aliases = append(field.aliases, s)
+				}
+			}
+		}
+		field.def, field.hasDefault = fm["default"]
+
+		field.schema, err = p.parse(fm["type"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid type of field '%v' in avro record '%v': %w", field.name, name, err)
+		}
+		record.fields = append(record.fields, field)
+	}
+	return record, nil
+}
+
+func (p *schemaParser) parseEnum(m map[string]interface{}, namespace string) (schema, error) {
+	enum := &enumSchema{}
+	name, _, err := p.defineName(m, namespace, enum)
+	if err != nil {
+		return nil, err
+	}
+	enum.name = name
+
+	symbols, ok := m["symbols"].([]interface{})
+	if !ok || len(symbols) == 0 {
+		return nil, fmt.Errorf("avro enum '%v' is missing 'symbols'", name)
+	}
+	for _, symbol := range symbols {
+		s, ok := symbol.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid symbol in avro enum '%v'", name)
+		}
+		enum.symbols = append(enum.symbols, s)
+	}
+	return enum, nil
+}
+
+func (p *schemaParser) parseFixed(m map[string]interface{}, namespace string) (schema, error) {
+	fixed := &fixedSchema{}
+	name, _, err := p.defineName(m, namespace, fixed)
+	if err != nil {
+		return nil, err
+	}
+	fixed.name = name
+
+	size, ok := m["size"].(float64)
+	if !ok || size < 0 || size != float64(int(size)) {
+		return nil, fmt.Errorf("avro fixed '%v' has an invalid 'size'", name)
+	}
+	fixed.size = int(size)
+	return fixed, nil
+}
+
+func fullName(name, namespace string) string {
+	if namespace == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return namespace + "." + name
+}
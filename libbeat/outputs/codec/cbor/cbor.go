@@ -0,0 +1,136 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package cbor provides a codec serializing events to CBOR (RFC 8949).
+// Events are encoded with the same structure as the json codec, including
+// the `@metadata` namespace, so consumers can switch between both encodings
+// without changing their data model.
+package cbor
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/go-structform"
+	"github.com/elastic/go-structform/cborl"
+	"github.com/elastic/go-structform/gotype"
+)
+
+// Encoder for serializing a beat.Event to CBOR.
+type Encoder struct {
+	buf    bytes.Buffer
+	folder *gotype.Iterator
+
+	version string
+	config  Config
+}
+
+// Config is used to pass encoding parameters to New.
+type Config struct {
+	LocalTime bool `config:"local_time"`
+}
+
+var defaultConfig = Config{
+	LocalTime: false,
+}
+
+type event struct {
+	Timestamp time.Time `struct:"@timestamp"`
+	Meta      meta      `struct:"@metadata"`
+	Fields    mapstr.M  `struct:",inline"`
+}
+
+type meta struct {
+	Beat    string                 `struct:"beat"`
+	Type    string                 `struct:"type"`
+	Version string                 `struct:"version"`
+	Fields  map[string]interface{} `struct:",inline"`
+}
+
+func init() {
+	codec.RegisterType("cbor", func(info beat.Info, cfg *config.C) (codec.Codec, error) {
+		config := defaultConfig
+		if cfg != nil {
+			if err := cfg.Unpack(&config); err != nil {
+				return nil, err
+			}
+		}
+
+		return New(info.Version, config), nil
+	})
+}
+
+// New creates a new CBOR Encoder.
+func New(version string, config Config) *Encoder {
+	e := &Encoder{version: version, config: config}
+	e.reset()
+	return e
+}
+
+// objectVisitor encodes all objects as indefinite-length maps. Object lengths
+// reported by the folder include inlined fields as a single entry, so they
+// can't be used for definite-length maps.
+type objectVisitor struct {
+	*cborl.Visitor
+}
+
+func (v objectVisitor) OnObjectStart(_ int, baseType structform.BaseType) error {
+	return v.Visitor.OnObjectStart(-1, baseType)
+}
+
+func (e *Encoder) reset() {
+	visitor := objectVisitor{cborl.NewVisitor(&e.buf)}
+
+	// NewIterator only fails on invalid options, which are fixed here.
+	e.folder, _ = gotype.NewIterator(visitor,
+		gotype.Folders(
+			codec.MakeUTCOrLocalTimestampEncoder(e.config.LocalTime),
+			codec.MakeBCTimestampEncoder(),
+		),
+	)
+}
+
+// Encode serializes a beat event to CBOR. It adds additional metadata in the
+// `@metadata` namespace.
+func (e *Encoder) Encode(index string, in *beat.Event) ([]byte, error) {
+	e.buf.Reset()
+	err := e.folder.Fold(event{
+		Timestamp: in.Timestamp,
+		Meta: meta{
+			Beat:    index,
+			Version: e.version,
+			Type:    "_doc",
+			Fields:  in.Meta,
+		},
+		Fields: in.Fields,
+	})
+	if err != nil {
+		e.reset()
+		return nil, err
+	}
+
+	return e.buf.Bytes(), nil
+}
+
+// IsBinary reports CBOR as a binary encoding. CBOR data items are
+// self-delimiting, so encoded events can be concatenated into a CBOR
+// sequence (RFC 8742).
+func (e *Encoder) IsBinary() bool { return true }
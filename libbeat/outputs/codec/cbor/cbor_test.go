@@ -0,0 +1,93 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cbor
+
+import (
+	stdjson "encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/go-structform/cborl"
+	"github.com/elastic/go-structform/gotype"
+)
+
+func TestCBORCodecRoundTrip(t *testing.T) {
+	ts := time.Date(2025, 3, 4, 5, 6, 7, 890000000, time.UTC)
+	cases := map[string]beat.Event{
+		"empty": {},
+		"flat fields": {
+			Timestamp: ts,
+			Fields:    mapstr.M{"msg": "message", "count": 42, "ratio": 0.5, "ok": true, "none": nil},
+		},
+		"nested fields and metadata": {
+			Timestamp: ts,
+			Meta:      mapstr.M{"pipeline": "test", "_id": "abc"},
+			Fields: mapstr.M{
+				"event":   mapstr.M{"created": common.Time(ts), "kind": "event"},
+				"tags":    []string{"a", "b"},
+				"numbers": []int64{-1, 0, math.MaxInt64},
+				"message": "line\nwith newline",
+			},
+		},
+	}
+
+	for name, event := range cases {
+		t.Run(name, func(t *testing.T) {
+			expected, err := json.New("1.2.3", json.Config{}).Encode("test", &event)
+			require.NoError(t, err)
+
+			encoded, err := New("1.2.3", defaultConfig).Encode("test", &event)
+			require.NoError(t, err)
+
+			assert.Equal(t, normalizeJSON(t, expected), decodeCBOR(t, encoded))
+		})
+	}
+}
+
+func TestCBORCodecSeparator(t *testing.T) {
+	assert.Empty(t, codec.Separator(New("1.2.3", defaultConfig)))
+	assert.Equal(t, []byte("\n"), codec.Separator(json.New("1.2.3", json.Config{})))
+}
+
+// decodeCBOR decodes a CBOR document and normalizes it the same way as
+// normalizeJSON does, so the results can be compared.
+func decodeCBOR(t *testing.T, b []byte) map[string]interface{} {
+	var m map[string]interface{}
+	unfolder, err := gotype.NewUnfolder(&m)
+	require.NoError(t, err)
+	require.NoError(t, cborl.Parse(b, unfolder))
+
+	raw, err := stdjson.Marshal(m)
+	require.NoError(t, err)
+	return normalizeJSON(t, raw)
+}
+
+func normalizeJSON(t *testing.T, b []byte) map[string]interface{} {
+	var m map[string]interface{}
+	require.NoError(t, stdjson.Unmarshal(b, &m))
+	return m
+}
@@ -22,3 +22,45 @@ import "github.com/elastic/beats/v7/libbeat/beat"
 type Codec interface {
 	Encode(index string, event *beat.Event) ([]byte, error)
 }
+
+// Binary is implemented by codecs producing a binary encoding. Binary encodings
+// may contain newline characters, so outputs writing a stream of events must
+// not use newlines to separate them. Instead each encoded event has to be
+// self-delimiting.
+type Binary interface {
+	Codec
+	IsBinary() bool
+}
+
+// StreamValidator is implemented by binary codecs that are self-delimiting
+// only with some settings.
+type StreamValidator interface {
+	Codec
+	ValidateStream() error
+}
+
+var newline = []byte("\n")
+
+// ValidateStream returns an error if the events encoded by c can't be told
+// apart when written one after the other to a stream.
+func ValidateStream(c Codec) error {
+	if v, ok := c.(StreamValidator); ok {
+		return v.ValidateStream()
+	}
+	return nil
+}
+
+// IsBinary returns true if c produces a binary encoding.
+func IsBinary(c Codec) bool {
+	b, ok := c.(Binary)
+	return ok && b.IsBinary()
+}
+
+// Separator returns the separator to write after every event encoded by c when
+// writing events to a stream. It is a newline for all text based codecs.
+func Separator(c Codec) []byte {
+	if IsBinary(c) {
+		return nil
+	}
+	return newline
+}
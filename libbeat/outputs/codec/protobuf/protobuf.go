@@ -0,0 +1,224 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package protobuf provides a codec serializing events to Protocol Buffers.
+// Events are encoded as the elastic.beats.event.v1.Event message published in
+// event.proto. The message is small enough to be encoded by hand, so the codec
+// does not depend on generated code.
+package protobuf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/go-structform/gotype"
+)
+
+// Field numbers of the elastic.beats.event.v1.Event message.
+const (
+	fieldTimestamp protowire.Number = 1
+	fieldMetadata  protowire.Number = 2
+	fieldFields    protowire.Number = 3
+)
+
+// Field numbers of the google.protobuf.Timestamp message.
+const (
+	fieldSeconds protowire.Number = 1
+	fieldNanos   protowire.Number = 2
+)
+
+// Encoder for serializing a beat.Event to protobuf.
+type Encoder struct {
+	unfolder *gotype.Unfolder
+	folder   *gotype.Iterator
+
+	version string
+	config  Config
+}
+
+// Config is used to pass encoding parameters to New.
+type Config struct {
+	// Delimited prefixes every message with its varint encoded length, as
+	// required to write a stream of messages to the file or console output.
+	Delimited bool `config:"delimited"`
+}
+
+var defaultConfig = Config{
+	Delimited: false,
+}
+
+func init() {
+	codec.RegisterType("protobuf", func(info beat.Info, cfg *config.C) (codec.Codec, error) {
+		config := defaultConfig
+		if cfg != nil {
+			if err := cfg.Unpack(&config); err != nil {
+				return nil, err
+			}
+		}
+
+		return New(info.Version, config), nil
+	})
+}
+
+// New creates a new protobuf Encoder.
+func New(version string, config Config) *Encoder {
+	e := &Encoder{version: version, config: config}
+	e.reset()
+	return e
+}
+
+func (e *Encoder) reset() {
+	// NewUnfolder and NewIterator only fail on invalid arguments, which are
+	// fixed here.
+	e.unfolder, _ = gotype.NewUnfolder(nil)
+	e.folder, _ = gotype.NewIterator(e.unfolder,
+		gotype.Folders(
+			codec.MakeTimestampEncoder(),
+			codec.MakeBCTimestampEncoder(),
+		),
+	)
+}
+
+// Encode serializes a beat event to an elastic.beats.event.v1.Event message.
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	metadata := map[string]interface{}{}
+	for k, v := range event.Meta {
+		metadata[k] = v
+	}
+	metadata["beat"] = index
+	metadata["type"] = "_doc"
+	metadata["version"] = e.version
+
+	metaMsg, err := e.marshalStruct(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event metadata: %w", err)
+	}
+	fieldsMsg, err := e.marshalStruct(event.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event fields: %w", err)
+	}
+
+	ts := event.Timestamp.UTC()
+	var tsMsg []byte
+	if secs := ts.Unix(); secs != 0 {
+		tsMsg = protowire.AppendTag(tsMsg, fieldSeconds, protowire.VarintType)
+		tsMsg = protowire.AppendVarint(tsMsg, uint64(secs))
+	}
+	if nanos := ts.Nanosecond(); nanos != 0 {
+		tsMsg = protowire.AppendTag(tsMsg, fieldNanos, protowire.VarintType)
+		tsMsg = protowire.AppendVarint(tsMsg, uint64(nanos))
+	}
+
+	size := protowire.SizeTag(fieldTimestamp) + protowire.SizeBytes(len(tsMsg)) +
+		protowire.SizeTag(fieldMetadata) + protowire.SizeBytes(len(metaMsg)) +
+		protowire.SizeTag(fieldFields) + protowire.SizeBytes(len(fieldsMsg))
+
+	buf := make([]byte, 0, protowire.SizeVarint(uint64(size))+size)
+	if e.config.Delimited {
+		buf = protowire.AppendVarint(buf, uint64(size))
+	}
+	buf = protowire.AppendTag(buf, fieldTimestamp, protowire.BytesType)
+	buf = protowire.AppendBytes(buf, tsMsg)
+	buf = protowire.AppendTag(buf, fieldMetadata, protowire.BytesType)
+	buf = protowire.AppendBytes(buf, metaMsg)
+	buf = protowire.AppendTag(buf, fieldFields, protowire.BytesType)
+	buf = protowire.AppendBytes(buf, fieldsMsg)
+	return buf, nil
+}
+
+// marshalStruct normalizes v into plain maps, slices and primitives, and
+// serializes the result as a google.protobuf.Struct message.
+func (e *Encoder) marshalStruct(v interface{}) ([]byte, error) {
+	var m map[string]interface{}
+	if err := e.unfolder.SetTarget(&m); err != nil {
+		return nil, err
+	}
+	defer e.unfolder.Reset()
+
+	if err := e.folder.Fold(v); err != nil {
+		e.reset()
+		return nil, err
+	}
+
+	fields, err := newFields(m)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&structpb.Struct{Fields: fields})
+}
+
+func newFields(m map[string]interface{}) (map[string]*structpb.Value, error) {
+	fields := make(map[string]*structpb.Value, len(m))
+	for k, v := range m {
+		value, err := newValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("field '%v': %w", k, err)
+		}
+		fields[k] = value
+	}
+	return fields, nil
+}
+
+// newValue converts v into a google.protobuf.Value. Unlike structpb.NewValue,
+// it accepts typed slices, as created by the unfolder for homogeneous arrays.
+func newValue(v interface{}) (*structpb.Value, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		fields, err := newFields(v)
+		if err != nil {
+			return nil, err
+		}
+		return structpb.NewStructValue(&structpb.Struct{Fields: fields}), nil
+	case []byte:
+		return structpb.NewValue(v)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return structpb.NewValue(v)
+	}
+
+	values := make([]*structpb.Value, rv.Len())
+	for i := range values {
+		value, err := newValue(rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return structpb.NewListValue(&structpb.ListValue{Values: values}), nil
+}
+
+// IsBinary reports protobuf as a binary encoding.
+func (e *Encoder) IsBinary() bool { return true }
+
+// ValidateStream returns an error if the messages are not delimited, as
+// protobuf messages written back to back can't be decoded.
+func (e *Encoder) ValidateStream() error {
+	if !e.config.Delimited {
+		return errors.New("protobuf messages written to a stream must be delimited, set codec.protobuf.delimited to true")
+	}
+	return nil
+}
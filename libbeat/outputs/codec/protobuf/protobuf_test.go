@@ -0,0 +1,158 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	stdjson "encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestProtobufCodecRoundTrip(t *testing.T) {
+	ts := time.Date(2025, 3, 4, 5, 6, 7, 890000000, time.UTC)
+	cases := map[string]beat.Event{
+		"empty": {},
+		"flat fields": {
+			Timestamp: ts,
+			Fields:    mapstr.M{"msg": "message", "count": 42, "ratio": 0.5, "ok": true, "none": nil},
+		},
+		"nested fields and metadata": {
+			Timestamp: ts,
+			Meta:      mapstr.M{"pipeline": "test", "_id": "abc"},
+			Fields: mapstr.M{
+				"event":   mapstr.M{"created": common.Time(ts), "kind": "event"},
+				"tags":    []string{"a", "b"},
+				"numbers": []int{-1, 0, 1},
+				"message": "line\nwith newline",
+			},
+		},
+	}
+
+	for name, event := range cases {
+		t.Run(name, func(t *testing.T) {
+			expected, err := json.New("1.2.3", json.Config{}).Encode("test", &event)
+			require.NoError(t, err)
+
+			encoded, err := New("1.2.3", defaultConfig).Encode("test", &event)
+			require.NoError(t, err)
+
+			timestamp, doc := decodeEvent(t, encoded)
+			assert.Equal(t, event.Timestamp, timestamp)
+			assert.Equal(t, normalizeJSON(t, expected), doc)
+		})
+	}
+}
+
+func TestProtobufCodecDelimited(t *testing.T) {
+	enc := New("1.2.3", Config{Delimited: true})
+
+	var stream []byte
+	for _, msg := range []string{"first", "second"} {
+		encoded, err := enc.Encode("test", &beat.Event{Fields: mapstr.M{"message": msg}})
+		require.NoError(t, err)
+		stream = append(stream, encoded...)
+	}
+
+	var messages []string
+	for len(stream) > 0 {
+		msg, n := protowire.ConsumeBytes(stream)
+		require.GreaterOrEqual(t, n, 0, "invalid length prefix")
+		stream = stream[n:]
+
+		_, doc := decodeEvent(t, msg)
+		messages = append(messages, doc["message"].(string))
+	}
+	assert.Equal(t, []string{"first", "second"}, messages)
+}
+
+// decodeEvent decodes an elastic.beats.event.v1.Event message. The metadata
+// and fields are merged into a single document structured like the json
+// codec output.
+func decodeEvent(t *testing.T, b []byte) (time.Time, map[string]interface{}) {
+	var seconds, nanos int64
+	doc := map[string]interface{}{}
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0)
+		require.Equal(t, protowire.BytesType, typ)
+		b = b[n:]
+
+		value, n := protowire.ConsumeBytes(b)
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+
+		switch num {
+		case fieldTimestamp:
+			for len(value) > 0 {
+				num, _, n := protowire.ConsumeTag(value)
+				require.GreaterOrEqual(t, n, 0)
+				value = value[n:]
+				v, n := protowire.ConsumeVarint(value)
+				require.GreaterOrEqual(t, n, 0)
+				value = value[n:]
+				if num == fieldSeconds {
+					seconds = int64(v)
+				} else {
+					nanos = int64(v)
+				}
+			}
+		case fieldMetadata:
+			doc["@metadata"] = unmarshalStruct(t, value)
+		case fieldFields:
+			for k, v := range unmarshalStruct(t, value) {
+				doc[k] = v
+			}
+		default:
+			t.Fatalf("unexpected field number %d", num)
+		}
+	}
+
+	timestamp := time.Unix(seconds, nanos).UTC()
+	doc["@timestamp"] = timestamp.Format("2006-01-02T15:04:05.000Z")
+	return timestamp, doc
+}
+
+func unmarshalStruct(t *testing.T, b []byte) map[string]interface{} {
+	var s structpb.Struct
+	require.NoError(t, proto.Unmarshal(b, &s))
+	return s.AsMap()
+}
+
+func normalizeJSON(t *testing.T, b []byte) map[string]interface{} {
+	var m map[string]interface{}
+	require.NoError(t, stdjson.Unmarshal(b, &m))
+	return m
+}
+
+func TestProtobufCodecValidateStream(t *testing.T) {
+	assert.Error(t, codec.ValidateStream(New("1.2.3", defaultConfig)))
+	assert.NoError(t, codec.ValidateStream(New("1.2.3", Config{Delimited: true})))
+}
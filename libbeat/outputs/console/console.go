@@ -40,6 +40,8 @@ type console struct {
 	writer   *bufio.Writer
 	codec    codec.Codec
 	index    string
+
+	separator []byte
 }
 
 func init() {
@@ -65,6 +67,9 @@ func makeConsole(
 		if err != nil {
 			return outputs.Fail(err)
 		}
+		if err := codec.ValidateStream(enc); err != nil {
+			return outputs.Fail(err)
+		}
 	} else {
 		enc = json.New(beat.Version, json.Config{
 			Pretty:     config.Pretty,
@@ -89,8 +94,9 @@ func makeConsole(
 	return outputs.Success(config.Queue, config.BatchSize, 0, nil, beat.Logger, c)
 }
 
-func newConsole(index string, observer outputs.Observer, codec codec.Codec, logger *logp.Logger) (*console, error) {
-	c := &console{log: logger.Named("console"), out: os.Stdout, codec: codec, observer: observer, index: index}
+func newConsole(index string, observer outputs.Observer, enc codec.Codec, logger *logp.Logger) (*console, error) {
+	c := &console{log: logger.Named("console"), out: os.Stdout, codec: enc, observer: observer, index: index}
+	c.separator = codec.Separator(enc)
 	c.writer = bufio.NewWriterSize(c.out, 8*1024)
 	return c, nil
 }
@@ -118,8 +124,6 @@ func (c *console) Publish(_ context.Context, batch publisher.Batch) error {
 	return nil
 }
 
-var nl = []byte("\n")
-
 func (c *console) publishEvent(event *publisher.Event) bool {
 	serializedEvent, err := c.codec.Encode(c.index, &event.Content)
 	if err != nil {
@@ -138,13 +142,13 @@ func (c *console) publishEvent(event *publisher.Event) bool {
 		return false
 	}
 
-	if err := c.writeBuffer(nl); err != nil {
+	if err := c.writeBuffer(c.separator); err != nil {
 		c.observer.WriteError(err)
 		c.log.Errorf("Error when appending newline to event: %+v", err)
 		return false
 	}
 
-	c.observer.WriteBytes(len(serializedEvent) + 1)
+	c.observer.WriteBytes(len(serializedEvent) + len(c.separator))
 	return true
 }
 
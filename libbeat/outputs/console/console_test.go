@@ -34,8 +34,10 @@ import (
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec/format"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/protobuf"
 	"github.com/elastic/beats/v7/libbeat/outputs/outest"
 	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/logp/logptest"
 	"github.com/elastic/elastic-agent-libs/mapstr"
@@ -142,3 +144,17 @@ func run(codec codec.Codec, logger *logp.Logger, batches ...publisher.Batch) (st
 func event(k, v string) mapstr.M {
 	return mapstr.M{k: v}
 }
+
+func TestConsoleProtobufMustBeDelimited(t *testing.T) {
+	info := beat.Info{Beat: "test", Logger: logptest.NewTestingLogger(t, "")}
+
+	_, err := makeConsole(nil, info, outputs.NewNilObserver(), config.MustNewConfigFrom(mapstr.M{
+		"codec.protobuf.delimited": false,
+	}))
+	assert.ErrorContains(t, err, "must be delimited")
+
+	_, err = makeConsole(nil, info, outputs.NewNilObserver(), config.MustNewConfigFrom(mapstr.M{
+		"codec.protobuf.delimited": true,
+	}))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,272 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// adaptiveConfig configures the adaptive mode, in which the bulk size and the
+// number of workers publishing at the same time are adjusted at runtime,
+// between their minimum values and the configured bulk_max_size and worker
+// settings.
+type adaptiveConfig struct {
+	Enabled          bool             `config:"enabled"`
+	MinBulkSize      int              `config:"min_bulk_size"`
+	MinWorkers       int              `config:"min_workers"`
+	TargetLatency    time.Duration    `config:"target_latency"`
+	MaxBulkBytes     cfgtype.ByteSize `config:"max_bulk_bytes"`
+	MaxRejectionRate float64          `config:"max_rejection_rate"`
+	Interval         time.Duration    `config:"interval"`
+}
+
+func defaultAdaptiveConfig() adaptiveConfig {
+	return adaptiveConfig{
+		Enabled:          false,
+		MinBulkSize:      50,
+		MinWorkers:       1,
+		TargetLatency:    2 * time.Second,
+		MaxBulkBytes:     10 * 1024 * 1024,
+		MaxRejectionRate: 0.01,
+		Interval:         10 * time.Second,
+	}
+}
+
+func (c *adaptiveConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	switch {
+	case c.MinBulkSize < 1:
+		return errors.New("min_bulk_size must be at least 1")
+	case c.MinWorkers < 1:
+		return errors.New("min_workers must be at least 1")
+	case c.TargetLatency <= 0:
+		return errors.New("target_latency must be greater than 0")
+	case c.MaxBulkBytes <= 0:
+		return errors.New("max_bulk_bytes must be greater than 0")
+	case c.MaxRejectionRate < 0 || c.MaxRejectionRate > 1:
+		return errors.New("max_rejection_rate must be between 0 and 1")
+	case c.Interval <= 0:
+		return errors.New("interval must be greater than 0")
+	}
+	return nil
+}
+
+// adaptiveSizer adjusts the bulk size and the number of workers from the
+// bulk requests observed during each interval:
+//
+//   - If more events than max_rejection_rate are rejected with 429 Too Many
+//     Requests, the bulk size is halved and a worker is removed.
+//   - If the average latency is above target_latency, or the average payload
+//     above max_bulk_bytes, the bulk size is reduced by a quarter.
+//   - If both are below half their target, the bulk size is increased by a
+//     quarter until it reaches bulk_max_size, after which a worker is added.
+//
+// Workers above the current number wait in Publish until another worker is
+// done.
+type adaptiveSizer struct {
+	log         *logp.Logger
+	config      adaptiveConfig
+	maxBulkSize int
+	maxWorkers  int
+	now         func() time.Time
+
+	mu       sync.Mutex
+	bulkSize int
+	workers  int
+	active   int
+	// wakeup is closed when a worker is done or workers are added, to wake
+	// up the workers waiting in acquire.
+	wakeup chan struct{}
+
+	// Requests observed since the last adjustment.
+	windowStart    time.Time
+	windowRequests int
+	windowEvents   int
+	windowRejected int
+	windowBytes    int
+	windowLatency  time.Duration
+
+	bulkSizeMetric    *monitoring.Int
+	workersMetric     *monitoring.Int
+	latencyMetric     *monitoring.Int
+	bytesMetric       *monitoring.Int
+	rejectionMetric   *monitoring.Float
+	adjustmentsMetric *monitoring.Uint
+}
+
+// newAdaptiveSizer creates an adaptiveSizer starting at the maximum bulk size
+// and number of workers. Its metrics are registered in reg.
+func newAdaptiveSizer(
+	log *logp.Logger,
+	config adaptiveConfig,
+	maxBulkSize, maxWorkers int,
+	reg *monitoring.Registry,
+) *adaptiveSizer {
+	if maxBulkSize < config.MinBulkSize {
+		maxBulkSize = config.MinBulkSize
+	}
+	if maxWorkers < config.MinWorkers {
+		maxWorkers = config.MinWorkers
+	}
+
+	s := &adaptiveSizer{
+		log:         log,
+		config:      config,
+		maxBulkSize: maxBulkSize,
+		maxWorkers:  maxWorkers,
+		now:         time.Now,
+		bulkSize:    maxBulkSize,
+		workers:     maxWorkers,
+		wakeup:      make(chan struct{}),
+
+		bulkSizeMetric:    monitoring.NewInt(reg, "bulk_size"),
+		workersMetric:     monitoring.NewInt(reg, "workers"),
+		latencyMetric:     monitoring.NewInt(reg, "latency.ms"),
+		bytesMetric:       monitoring.NewInt(reg, "bulk_bytes"),
+		rejectionMetric:   monitoring.NewFloat(reg, "rejection_rate"),
+		adjustmentsMetric: monitoring.NewUint(reg, "adjustments"),
+	}
+	s.windowStart = s.now()
+	s.bulkSizeMetric.Set(int64(s.bulkSize))
+	s.workersMetric.Set(int64(s.workers))
+	return s
+}
+
+// BatchSize returns the current bulk size. It is used as the BatchSizer of
+// the output group.
+func (s *adaptiveSizer) BatchSize() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bulkSize
+}
+
+// acquire waits until the number of workers publishing is below the current
+// number of workers.
+func (s *adaptiveSizer) acquire(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		if s.active < s.workers {
+			s.active++
+			s.mu.Unlock()
+			return nil
+		}
+		wakeup := s.wakeup
+		s.mu.Unlock()
+
+		select {
+		case <-wakeup:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release marks a worker as done publishing.
+func (s *adaptiveSizer) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	s.wake()
+}
+
+func (s *adaptiveSizer) wake() {
+	close(s.wakeup)
+	s.wakeup = make(chan struct{})
+}
+
+// observe records the result of a bulk request, adjusting the bulk size and
+// number of workers once per interval.
+func (s *adaptiveSizer) observe(events, rejected, bytes int, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.windowRequests++
+	s.windowEvents += events
+	s.windowRejected += rejected
+	s.windowBytes += bytes
+	s.windowLatency += latency
+
+	now := s.now()
+	if now.Sub(s.windowStart) < s.config.Interval {
+		return
+	}
+	s.adjust()
+
+	s.windowStart = now
+	s.windowRequests = 0
+	s.windowEvents = 0
+	s.windowRejected = 0
+	s.windowBytes = 0
+	s.windowLatency = 0
+}
+
+func (s *adaptiveSizer) adjust() {
+	if s.windowRequests == 0 || s.windowEvents == 0 {
+		return
+	}
+
+	rejectionRate := float64(s.windowRejected) / float64(s.windowEvents)
+	latency := s.windowLatency / time.Duration(s.windowRequests)
+	bytes := s.windowBytes / s.windowRequests
+
+	s.latencyMetric.Set(latency.Milliseconds())
+	s.bytesMetric.Set(int64(bytes))
+	s.rejectionMetric.Set(rejectionRate)
+
+	bulkSize, workers := s.bulkSize, s.workers
+	maxBytes := int(s.config.MaxBulkBytes)
+	switch {
+	case rejectionRate > s.config.MaxRejectionRate:
+		// Elasticsearch is overloaded, back off quickly.
+		bulkSize /= 2
+		workers--
+	case latency > s.config.TargetLatency || bytes > maxBytes:
+		bulkSize -= bulkSize / 4
+	case latency < s.config.TargetLatency/2 && bytes < maxBytes/2:
+		if bulkSize < s.maxBulkSize {
+			bulkSize += max(bulkSize/4, 1)
+		} else {
+			workers++
+		}
+	}
+	bulkSize = min(max(bulkSize, s.config.MinBulkSize), s.maxBulkSize)
+	workers = min(max(workers, s.config.MinWorkers), s.maxWorkers)
+
+	if bulkSize == s.bulkSize && workers == s.workers {
+		return
+	}
+	s.log.Debugf("Adjusting bulk size from %d to %d and workers from %d to %d (latency: %v, bulk bytes: %d, rejection rate: %.3f)",
+		s.bulkSize, bulkSize, s.workers, workers, latency, bytes, rejectionRate)
+
+	if workers > s.workers {
+		s.wake()
+	}
+	s.bulkSize, s.workers = bulkSize, workers
+	s.bulkSizeMetric.Set(int64(bulkSize))
+	s.workersMetric.Set(int64(workers))
+	s.adjustmentsMetric.Inc()
+}
@@ -0,0 +1,164 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// newTestSizer returns a sizer with a bulk size between 100 and 1000 and up
+// to 4 workers, along with a function advancing its clock by an interval.
+func newTestSizer(t *testing.T) (*adaptiveSizer, func()) {
+	config := defaultAdaptiveConfig()
+	config.Enabled = true
+	config.MinBulkSize = 100
+
+	s := newAdaptiveSizer(logptest.NewTestingLogger(t, ""), config, 1000, 4, monitoring.NewRegistry())
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	s.windowStart = now
+	return s, func() { now = now.Add(config.Interval) }
+}
+
+func TestAdaptiveSizerStartsAtMaximum(t *testing.T) {
+	s, _ := newTestSizer(t)
+	assert.Equal(t, 1000, s.BatchSize())
+	assert.Equal(t, 4, s.workers)
+}
+
+func TestAdaptiveSizerAdjustsOncePerInterval(t *testing.T) {
+	s, tick := newTestSizer(t)
+
+	s.observe(1000, 1000, 1024, time.Second)
+	assert.Equal(t, 1000, s.BatchSize(), "no adjustment before the interval is over")
+
+	tick()
+	s.observe(1000, 0, 1024, time.Second)
+	assert.Equal(t, 500, s.BatchSize())
+	assert.Equal(t, 3, s.workers)
+}
+
+func TestAdaptiveSizerRejections(t *testing.T) {
+	s, tick := newTestSizer(t)
+
+	for i := 0; i < 10; i++ {
+		tick()
+		s.observe(1000, 500, 1024, time.Second)
+	}
+	assert.Equal(t, 100, s.BatchSize(), "bulk size is bounded by min_bulk_size")
+	assert.Equal(t, 1, s.workers, "workers are bounded by min_workers")
+}
+
+func TestAdaptiveSizerLatency(t *testing.T) {
+	s, tick := newTestSizer(t)
+
+	tick()
+	s.observe(1000, 0, 1024, 5*time.Second)
+	assert.Equal(t, 750, s.BatchSize())
+	assert.Equal(t, 4, s.workers, "slow responses only reduce the bulk size")
+
+	// Requests with a latency between half the target and the target
+	// don't change anything.
+	tick()
+	s.observe(750, 0, 1024, 1500*time.Millisecond)
+	assert.Equal(t, 750, s.BatchSize())
+}
+
+func TestAdaptiveSizerBulkBytes(t *testing.T) {
+	s, tick := newTestSizer(t)
+
+	tick()
+	s.observe(1000, 0, 20*1024*1024, 100*time.Millisecond)
+	assert.Equal(t, 750, s.BatchSize())
+}
+
+func TestAdaptiveSizerGrows(t *testing.T) {
+	s, tick := newTestSizer(t)
+	s.bulkSize, s.workers = 100, 1
+
+	for i := 0; i < 20; i++ {
+		tick()
+		s.observe(s.BatchSize(), 0, 1024, 100*time.Millisecond)
+	}
+	assert.Equal(t, 1000, s.BatchSize(), "bulk size is bounded by bulk_max_size")
+	assert.Equal(t, 4, s.workers, "workers grow once the bulk size is at its maximum")
+}
+
+func TestAdaptiveSizerLimitsWorkers(t *testing.T) {
+	s, tick := newTestSizer(t)
+	s.workers = 1
+
+	require.NoError(t, s.acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.acquire(ctx), context.DeadlineExceeded, "second worker must wait")
+
+	acquired := make(chan error)
+	go func() { acquired <- s.acquire(context.Background()) }()
+
+	// Adding a worker wakes up the waiting one.
+	tick()
+	s.observe(1000, 0, 1024, 100*time.Millisecond)
+	require.NoError(t, <-acquired)
+	assert.Equal(t, 2, s.workers)
+
+	s.release()
+	s.release()
+	require.NoError(t, s.acquire(context.Background()))
+}
+
+func TestAdaptiveConfig(t *testing.T) {
+	cfg := conf.MustNewConfigFrom(`
+adaptive:
+  enabled: true
+  min_bulk_size: 10
+  target_latency: 500ms
+  max_bulk_bytes: 5MiB
+`)
+	esConfig, err := readConfig(cfg)
+	require.NoError(t, err)
+	assert.True(t, esConfig.Adaptive.Enabled)
+	assert.Equal(t, 10, esConfig.Adaptive.MinBulkSize)
+	assert.Equal(t, 500*time.Millisecond, esConfig.Adaptive.TargetLatency)
+	assert.EqualValues(t, 5*1024*1024, esConfig.Adaptive.MaxBulkBytes)
+	assert.Equal(t, 10*time.Second, esConfig.Adaptive.Interval)
+
+	_, err = readConfig(conf.MustNewConfigFrom(`{adaptive.enabled: true, adaptive.max_rejection_rate: 2}`))
+	assert.Error(t, err)
+}
+
+func TestAdaptivePreset(t *testing.T) {
+	cfg := conf.MustNewConfigFrom(`hosts: ["localhost:9200"]`)
+	_, _, err := ApplyPreset(presetAdaptive, cfg)
+	require.NoError(t, err)
+
+	esConfig, err := readConfig(cfg)
+	require.NoError(t, err)
+	assert.True(t, esConfig.Adaptive.Enabled)
+	assert.Equal(t, 3200, esConfig.BulkMaxSize)
+}
@@ -64,6 +64,10 @@ type Client struct {
 	// forwarded to this index. Otherwise, they will be dropped.
 	deadLetterIndex string
 
+	// If sizer is set, the output runs in adaptive mode and the client
+	// reports its bulk requests to it.
+	sizer *adaptiveSizer
+
 	log                    *logp.Logger
 	pLogIndex              *periodic.Doer
 	pLogIndexTryDeadLetter *periodic.Doer
@@ -84,6 +88,10 @@ type clientSettings struct {
 	// If deadLetterIndex is set, events with bulk-ingest errors will be
 	// forwarded to this index. Otherwise, they will be dropped.
 	deadLetterIndex string
+
+	// The adaptive sizer shared by the clients of the output, if adaptive
+	// mode is enabled.
+	sizer *adaptiveSizer
 }
 
 type bulkResultStats struct {
@@ -109,8 +117,16 @@ type bulkResult struct {
 	// The http status returned by the bulk request.
 	status int
 
+	// The size of the encoded events and the duration of the bulk request.
+	bytes   int
+	latency time.Duration
+
 	// The API response from Elasticsearch.
 	response eslegclient.BulkResponse
+
+	// The batch the events belong to, events that can't be indexed are
+	// passed to its dead letter queue.
+	batch publisher.Batch
 }
 
 const (
@@ -195,6 +211,7 @@ func NewClient(
 		pipelineSelector: pipeline,
 		observer:         observer,
 		deadLetterIndex:  s.deadLetterIndex,
+		sizer:            s.sizer,
 
 		log:                    logger,
 		pLogDeadLetter:         pLogDeadLetter,
@@ -251,10 +268,24 @@ func (client *Client) Publish(ctx context.Context, batch publisher.Batch) error
 	span.Context.SetLabel("events_original", len(batch.Events()))
 	client.observer.NewBatch(len(batch.Events()))
 
+	if client.sizer != nil {
+		// Wait until this worker is allowed to publish.
+		if err := client.sizer.acquire(ctx); err != nil {
+			batch.Cancelled()
+			client.observer.RetryableErrors(len(batch.Events()))
+			return err
+		}
+		defer client.sizer.release()
+	}
+
 	// Create and send the bulk request.
 	bulkResult := client.doBulkRequest(ctx, batch)
 	span.Context.SetLabel("events_encoded", len(bulkResult.events))
 	if bulkResult.connErr != nil {
+		if client.sizer != nil && bulkResult.status == http.StatusTooManyRequests {
+			n := len(bulkResult.events)
+			client.sizer.observe(n, n, bulkResult.bytes, bulkResult.latency)
+		}
 		// If there was a connection-level error there is no per-item response,
 		// handle it and return.
 		return client.handleBulkResultError(ctx, batch, bulkResult)
@@ -265,6 +296,9 @@ func (client *Client) Publish(ctx context.Context, batch publisher.Batch) error
 	// check and report the per-item results.
 	eventsToRetry, stats := client.bulkCollectPublishFails(bulkResult)
 	stats.reportToObserver(client.observer)
+	if client.sizer != nil {
+		client.sizer.observe(len(bulkResult.events), stats.tooMany, bulkResult.bytes, bulkResult.latency)
+	}
 
 	if len(eventsToRetry) > 0 {
 		span.Context.SetLabel("events_failed", len(eventsToRetry))
@@ -294,7 +328,7 @@ func (client *Client) doBulkRequest(
 	ctx context.Context,
 	batch publisher.Batch,
 ) bulkResult {
-	var result bulkResult
+	result := bulkResult{batch: batch}
 
 	rawEvents := batch.Events()
 
@@ -306,13 +340,15 @@ func (client *Client) doBulkRequest(
 
 	// If we encoded any events, send the network request.
 	if len(result.events) > 0 {
+		result.bytes = encodedSize(result.events)
 		begin := time.Now()
 		h := make(http.Header)
 		h.Set(HeaderEventCount, strconv.Itoa(len(result.events)))
 		result.status, result.response, result.connErr =
 			client.conn.Bulk(ctx, "", "", h, bulkRequestParams, bulkItems)
+		result.latency = time.Since(begin)
 		if result.connErr == nil {
-			duration := time.Since(begin)
+			duration := result.latency
 			client.observer.ReportLatency(duration)
 			client.log.Debugf(
 				"doBulkRequest: %d events have been sent to elasticsearch in %v.",
@@ -334,7 +370,7 @@ func (client *Client) handleBulkResultError(
 		} else {
 			// If the batch could not be split, there is no option left but
 			// to drop it and log the error state.
-			batch.Drop()
+			publisher.DropWithError(batch, errPayloadTooLarge)
 			client.observer.PermanentErrors(len(bulkResult.events))
 			client.log.Error(errPayloadTooLarge)
 		}
@@ -392,6 +428,18 @@ func (client *Client) bulkEncodePublishRequest(version version.V, data []publish
 	return okEvents, bulkItems
 }
 
+// encodedSize returns the size of the encoded events, which is close to the
+// size of the bulk request before compression.
+func encodedSize(events []publisher.Event) int {
+	size := 0
+	for i := range events {
+		if event, ok := events[i].EncodedEvent.(*encodedEvent); ok {
+			size += len(event.encoding)
+		}
+	}
+	return size
+}
+
 func (client *Client) createEventBulkMeta(version version.V, event *encodedEvent) (interface{}, error) {
 	eventType := ""
 	if version.Major < 7 {
@@ -474,9 +522,15 @@ func (client *Client) bulkCollectPublishFails(bulkResult bulkResult) ([]publishe
 			break
 		}
 
+		nonIndexable := stats.nonIndexable
 		if client.applyItemStatus(events[i], itemStatus, itemMessage, &stats) {
 			eventsToRetry = append(eventsToRetry, events[i])
 			client.log.Debugf("Bulk item insert failed (i=%v, status=%v): %s", i, itemStatus, itemMessage)
+		} else if stats.nonIndexable > nonIndexable && bulkResult.batch != nil {
+			// The event is dropped, store it in the dead letter queue. This
+			// happens before events[i] can be overwritten by eventsToRetry.
+			publisher.DeadLetter(bulkResult.batch, events[i:i+1],
+				fmt.Errorf("cannot index event (status=%v): %s", itemStatus, itemMessage))
 		}
 	}
 
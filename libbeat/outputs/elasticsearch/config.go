@@ -44,6 +44,7 @@ type ElasticsearchConfig struct {
 	NonIndexablePolicy *config.Namespace `config:"non_indexable_policy"`
 	AllowOlderVersion  bool              `config:"allow_older_versions"`
 	Queue              config.Namespace  `config:"queue"`
+	Adaptive           adaptiveConfig    `config:"adaptive"`
 
 	Transport httpcommon.HTTPTransportSettings `config:",inline"`
 }
@@ -75,6 +76,7 @@ var (
 			Max:  60 * time.Second,
 		},
 		BulkMaxSize: defaultBulkSize,
+		Adaptive:    defaultAdaptiveConfig(),
 		Transport:   esDefaultTransportSettings(),
 	}
 )
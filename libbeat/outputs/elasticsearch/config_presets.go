@@ -32,6 +32,7 @@ const (
 	presetThroughput = "throughput"
 	presetScale      = "scale"
 	presetLatency    = "latency"
+	presetAdaptive   = "adaptive"
 )
 
 var presetConfigs = map[string]*config.C{
@@ -75,6 +76,18 @@ var presetConfigs = map[string]*config.C{
 		"compression_level":          1,
 		"idle_connection_timeout":    60 * time.Second,
 	}),
+	// The adaptive preset sets upper bounds for the bulk size and the
+	// workers, the values used are adjusted at runtime.
+	presetAdaptive: config.MustNewConfigFrom(map[string]interface{}{
+		"bulk_max_size":              3200,
+		"worker":                     4,
+		"queue.mem.events":           12800,
+		"queue.mem.flush.min_events": 1600,
+		"queue.mem.flush.timeout":    5 * time.Second,
+		"compression_level":          1,
+		"idle_connection_timeout":    15 * time.Second,
+		"adaptive.enabled":           true,
+	}),
 }
 
 // Given a user config, check its preset field and apply any corresponding
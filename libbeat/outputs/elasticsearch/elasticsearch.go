@@ -25,6 +25,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/outputs/outil"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
 )
 
 func init() {
@@ -91,6 +92,13 @@ func makeES(
 	encoderFactory := newEventEncoderFactory(
 		esConfig.EscapeHTML, indexSelector, pipelineSelector)
 
+	// In adaptive mode all clients share a sizer, which limits the number
+	// of them publishing at the same time.
+	var sizer *adaptiveSizer
+	if esConfig.Adaptive.Enabled {
+		sizer = newAdaptiveSizer(log, esConfig.Adaptive, esConfig.BulkMaxSize, len(hosts), adaptiveRegistry(observer))
+	}
+
 	clients := make([]outputs.NetworkClient, len(hosts))
 	for i, host := range hosts {
 		esURL, err := common.MakeURL(esConfig.Protocol, esConfig.Path, host, 9200)
@@ -121,6 +129,7 @@ func makeES(
 			pipelineSelector: pipelineSelector,
 			observer:         observer,
 			deadLetterIndex:  deadLetterIndex,
+			sizer:            sizer,
 		}, &connectCallbackRegistry, log)
 		if err != nil {
 			return outputs.Fail(err)
@@ -130,7 +139,24 @@ func makeES(
 		clients[i] = client
 	}
 
-	return outputs.SuccessNet(esConfig.Queue, esConfig.LoadBalance, esConfig.BulkMaxSize, esConfig.MaxRetries, encoderFactory, beatInfo.Logger, clients)
+	group, err := outputs.SuccessNet(esConfig.Queue, esConfig.LoadBalance, esConfig.BulkMaxSize, esConfig.MaxRetries, encoderFactory, beatInfo.Logger, clients)
+	if err == nil && sizer != nil {
+		group.BatchSizer = sizer.BatchSize
+	}
+	return group, err
+}
+
+// adaptiveRegistry returns the registry for the metrics of the adaptive mode,
+// below the metrics of the output if the observer reports to a registry.
+func adaptiveRegistry(observer outputs.Observer) *monitoring.Registry {
+	stats, ok := observer.(*outputs.Stats)
+	if !ok || stats.Registry() == nil {
+		return monitoring.NewRegistry()
+	}
+	// The output may be reloaded, replace the metrics of the previous one.
+	reg := stats.Registry()
+	reg.Remove("elasticsearch.adaptive")
+	return reg.NewRegistry("elasticsearch.adaptive")
 }
 
 func buildSelectors(
@@ -30,6 +30,8 @@ import (
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/go-structform/gotype"
+	"github.com/elastic/go-structform/json"
 )
 
 type eventEncoder struct {
@@ -157,6 +159,34 @@ func (e *encodedEvent) setDeadLetter(
 	e.encoding = []byte(deadLetterReencoding.String())
 }
 
+// Timestamp returns the timestamp of the source event, so that the pipeline
+// can check the age of the event without decoding it.
+func (e *encodedEvent) Timestamp() time.Time {
+	return e.timestamp
+}
+
+// DecodeEvent decodes the event from its encoding, so that it can be stored
+// in the dead letter queue.
+func (e *encodedEvent) DecodeEvent() (beat.Event, error) {
+	if e.err != nil {
+		return beat.Event{}, e.err
+	}
+	var fields mapstr.M
+	unfolder, err := gotype.NewUnfolder(&fields)
+	if err != nil {
+		return beat.Event{}, err
+	}
+	if err := json.Parse(e.encoding, unfolder); err != nil {
+		return beat.Event{}, fmt.Errorf("failed to decode event: %w", err)
+	}
+	delete(fields, "@timestamp")
+	return beat.Event{
+		Timestamp: e.timestamp,
+		Meta:      e.meta,
+		Fields:    fields,
+	}, nil
+}
+
 // String converts e.encoding (and meta fields if present)
 // to string and returns it.
 // The goal of this method is to provide an easy way to log
@@ -105,6 +105,34 @@ func TestEncodeEntry(t *testing.T) {
 	assert.Contains(t, encBeatEvent.String(), `"pipeline":"TEST_PIPELINE"`, "String representation of encoded event should include the original event's meta fields")
 }
 
+func TestDecodeEncodedEvent(t *testing.T) {
+	encoder := newEventEncoder(true, testIndexSelector{}, nil)
+
+	timestamp := time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+	meta := mapstr.M{events.FieldMetaID: "test_id"}
+	encoded, _ := encoder.EncodeEntry(publisher.Event{
+		Content: beat.Event{
+			Timestamp: timestamp,
+			Meta:      meta,
+			Fields: mapstr.M{
+				"test_field":   "test_value",
+				"number_field": 5,
+			},
+		},
+	})
+
+	decodable, ok := encoded.(publisher.Event).EncodedEvent.(publisher.DecodableEvent)
+	require.True(t, ok, "encodedEvent should implement publisher.DecodableEvent")
+	event, err := decodable.DecodeEvent()
+	require.NoError(t, err)
+
+	assert.Equal(t, timestamp, event.Timestamp)
+	assert.Equal(t, meta, event.Meta)
+	assert.Equal(t, "test_value", event.Fields["test_field"])
+	assert.EqualValues(t, 5, event.Fields["number_field"])
+	assert.NotContains(t, event.Fields, "@timestamp")
+}
+
 // encodeBatch encodes a publisher.Batch so it can be provided to
 // Client.Publish and other helpers.
 // This modifies the batch in place, but also returns its input batch
@@ -0,0 +1,199 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fanout
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+var (
+	errBatchDropped    = errors.New("batch dropped by the output")
+	errRetriesExceeded = errors.New("retry limit exceeded")
+)
+
+// indexKey is the key of the event cache holding the index of the event in
+// the batch read from the queue.
+const indexKey = "fanout_index"
+
+// fanoutBatch tracks a batch read from the queue until every output is done
+// with its share of the events.
+type fanoutBatch struct {
+	batch    publisher.Batch
+	observer outputs.Observer
+	count    int
+	pending  atomic.Int64
+
+	// Indexes of the events that at least one output dropped or failed to
+	// publish permanently.
+	mu      sync.Mutex
+	dropped map[int]struct{}
+}
+
+func (b *fanoutBatch) done() {
+	if b.pending.Add(-1) == 0 {
+		b.mu.Lock()
+		dropped := len(b.dropped)
+		b.mu.Unlock()
+
+		// An event only counts as ACKed if all its outputs published it.
+		b.observer.AckedEvents(b.count - dropped)
+		if dropped > 0 {
+			b.observer.PermanentErrors(dropped)
+		}
+		b.batch.ACK()
+	}
+}
+
+// drop records events an output gave up on.
+func (b *fanoutBatch) drop(events []publisher.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := range events {
+		v, err := events[i].Cache.GetValue(indexKey)
+		if err != nil {
+			continue
+		}
+		if idx, ok := v.(int); ok {
+			if b.dropped == nil {
+				b.dropped = map[int]struct{}{}
+			}
+			b.dropped[idx] = struct{}{}
+		}
+	}
+}
+
+// subBatch holds the events of a fanoutBatch sent to one output. It is
+// retried by the output it belongs to, independently of the other outputs.
+type subBatch struct {
+	parent *fanoutBatch
+	output *output
+	events []publisher.Event
+
+	// How many retries until the non-guaranteed events are dropped. A value
+	// of 0 or less means the batch is retried until it is published.
+	ttl int
+}
+
+func (b *subBatch) Events() []publisher.Event {
+	return b.events
+}
+
+func (b *subBatch) ACK() {
+	b.events = nil
+	b.parent.done()
+}
+
+func (b *subBatch) Drop() {
+	b.DropWithError(errBatchDropped)
+}
+
+func (b *subBatch) DropWithError(err error) {
+	b.DeadLetter(b.events, err)
+	b.events = nil
+	b.parent.done()
+}
+
+// DeadLetter passes events to the dead letter queue of the batch read from
+// the queue, prefixing the error with the name of the output.
+func (b *subBatch) DeadLetter(events []publisher.Event, err error) {
+	b.parent.drop(events)
+	publisher.DeadLetter(b.parent.batch, events, fmt.Errorf("%s: %w", b.output.name, err))
+}
+
+func (b *subBatch) Retry() {
+	b.retry(true)
+}
+
+func (b *subBatch) RetryEvents(events []publisher.Event) {
+	b.events = events
+	b.retry(true)
+}
+
+func (b *subBatch) Cancelled() {
+	b.retry(false)
+}
+
+func (b *subBatch) SplitRetry() bool {
+	if len(b.events) < 2 {
+		return false
+	}
+
+	// The new batches replace b in the count of the parent batch.
+	b.parent.pending.Add(1)
+	split := len(b.events) / 2
+	first := &subBatch{parent: b.parent, output: b.output, events: b.events[:split:split], ttl: b.ttl}
+	second := &subBatch{parent: b.parent, output: b.output, events: b.events[split:], ttl: b.ttl}
+	first.retry(false)
+	second.retry(false)
+	return true
+}
+
+// retry returns the batch to the workers of its output.
+func (b *subBatch) retry(decreaseTTL bool) {
+	if decreaseTTL && !b.reduceTTL() {
+		b.output.log.Info("Drop batch")
+		b.Drop()
+		return
+	}
+
+	go func() {
+		select {
+		case b.output.work <- b:
+		case <-b.output.done:
+		}
+	}()
+}
+
+// reduceTTL reduces the time to live of the batch, dropping the events
+// without guaranteed delivery once it expires. It returns true if the batch
+// is still alive.
+func (b *subBatch) reduceTTL() bool {
+	if b.ttl <= 0 {
+		return true
+	}
+
+	b.ttl--
+	if b.ttl > 0 {
+		return true
+	}
+
+	var dropped []publisher.Event
+	events := b.events[:0]
+	for _, event := range b.events {
+		if event.Guaranteed() {
+			events = append(events, event)
+		} else {
+			dropped = append(dropped, event)
+		}
+	}
+	b.events = events
+	b.DeadLetter(dropped, errRetriesExceeded)
+
+	if len(b.events) > 0 {
+		b.ttl = -1
+		return true
+	}
+	return false
+}
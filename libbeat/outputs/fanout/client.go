@@ -0,0 +1,276 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fanout
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/testing"
+)
+
+// client routes the events of each batch to the outputs whose condition they
+// match. The outputs share the queue of the pipeline: a batch is only ACKed
+// once every output has published or dropped its share of the events, while
+// failed events are retried by each output on its own, so that outputs
+// that already published them do not receive them twice.
+type client struct {
+	log      *logp.Logger
+	observer outputs.Observer
+	outputs  []*output
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// output is one of the named outputs of the fanout output, with its own
+// clients, batch size and retry settings.
+type output struct {
+	log       *logp.Logger
+	name      string
+	cond      conditions.Condition
+	observer  outputs.Observer
+	clients   []outputs.Client
+	batchSize int
+	retry     int
+
+	// batchSizer is the BatchSizer of the output, if it adjusts its batch
+	// size at runtime.
+	batchSizer func() int
+
+	// encoder is the early encoder of the output, if it supports one. It is
+	// only used from client.Publish.
+	encoder queue.Encoder
+
+	work chan *subBatch
+	done <-chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newClient(log *logp.Logger, observer outputs.Observer, outs []*output) *client {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &client{
+		log:      log,
+		observer: observer,
+		outputs:  outs,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for _, out := range outs {
+		out.start(ctx)
+	}
+	return c
+}
+
+func newOutput(
+	log *logp.Logger,
+	name string,
+	cond conditions.Condition,
+	observer outputs.Observer,
+	group outputs.Group,
+) *output {
+	out := &output{
+		log:        log,
+		name:       name,
+		cond:       cond,
+		observer:   observer,
+		clients:    group.Clients,
+		batchSize:  group.BatchSize,
+		retry:      group.Retry,
+		batchSizer: group.BatchSizer,
+		work:       make(chan *subBatch),
+	}
+	if group.EncoderFactory != nil {
+		out.encoder = group.EncoderFactory()
+	}
+	return out
+}
+
+func (c *client) Close() error {
+	c.cancel()
+
+	var errs []error
+	for _, out := range c.outputs {
+		out.wg.Wait()
+		if err := out.closeClients(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	parent := &fanoutBatch{batch: batch, observer: c.observer, count: len(events)}
+	// Hold a reference while the events are dispatched, so the batch is not
+	// ACKed before all outputs received their share.
+	parent.pending.Add(1)
+
+	for _, out := range c.outputs {
+		selected := out.selectEvents(events)
+		for len(selected) > 0 {
+			n := len(selected)
+			if size := out.nextBatchSize(); size > 0 && n > size {
+				n = size
+			}
+
+			parent.pending.Add(1)
+			sub := &subBatch{parent: parent, output: out, events: selected[:n:n], ttl: out.retry + 1}
+			select {
+			case out.work <- sub:
+			case <-c.ctx.Done():
+				return nil
+			}
+			selected = selected[n:]
+		}
+	}
+
+	parent.done()
+	return nil
+}
+
+func (c *client) Test(d testing.Driver) {
+	for _, out := range c.outputs {
+		for _, client := range out.clients {
+			d.Run(out.name+" "+client.String(), func(d testing.Driver) {
+				testable, ok := client.(testing.Testable)
+				if !ok {
+					d.Fatal("output", errors.New("client doesn't support testing"))
+				}
+				testable.Test(d)
+			})
+		}
+	}
+}
+
+func (c *client) String() string {
+	names := make([]string, len(c.outputs))
+	for i, out := range c.outputs {
+		names[i] = out.name
+	}
+	return "fanout(" + strings.Join(names, ",") + ")"
+}
+
+// selectEvents returns a copy of the events matching the condition of the
+// output, encoded by the early encoder of the output if it has one.
+func (o *output) selectEvents(events []publisher.Event) []publisher.Event {
+	var selected []publisher.Event
+	for i := range events {
+		if o.cond != nil && !o.cond.Check(&events[i].Content) {
+			continue
+		}
+
+		// Each output gets its own copy of the event, as outputs may store
+		// per-event state in the cache or replace the content when encoding.
+		event := events[i]
+		event.Cache = publisher.EventCache{}
+		if o.encoder != nil {
+			entry, _ := o.encoder.EncodeEntry(event)
+			if encoded, ok := entry.(publisher.Event); ok {
+				event = encoded
+			}
+		}
+		// Keep track of the event in the batch read from the queue, to
+		// report the events dropped by the output.
+		_, _ = event.Cache.Put(indexKey, i)
+		selected = append(selected, event)
+	}
+	return selected
+}
+
+// nextBatchSize returns the maximum number of events to send to the output
+// in one batch.
+func (o *output) nextBatchSize() int {
+	if o.batchSizer != nil {
+		return o.batchSizer()
+	}
+	return o.batchSize
+}
+
+func (o *output) start(ctx context.Context) {
+	o.done = ctx.Done()
+	for _, client := range o.clients {
+		o.wg.Add(1)
+		go func(client outputs.Client) {
+			defer o.wg.Done()
+			o.run(ctx, client)
+		}(client)
+	}
+}
+
+// run publishes the batches of the output with one of its clients. Like the
+// pipeline output workers, it (re)connects network clients before
+// publishing, returning the batches to other workers in the meantime.
+func (o *output) run(ctx context.Context, client outputs.Client) {
+	netClient, reconnect := client.(outputs.NetworkClient)
+	connected := !reconnect
+	attempts := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case batch := <-o.work:
+			if !connected {
+				batch.Cancelled()
+
+				if attempts == 0 {
+					o.log.Infof("Connecting to %v", client)
+				} else {
+					o.log.Infof("Attempting to reconnect to %v with %d reconnect attempt(s)", client, attempts)
+				}
+
+				err := netClient.Connect(ctx)
+				connected = err == nil
+				if connected {
+					o.log.Infof("Connection to %v established", client)
+					attempts = 0
+				} else {
+					o.log.Errorf("Failed to connect to %v: %v", client, err)
+					attempts++
+				}
+				continue
+			}
+
+			if err := client.Publish(ctx, batch); err != nil {
+				o.log.Errorf("Failed to publish events: %v", err)
+				connected = !reconnect
+			}
+		}
+	}
+}
+
+func (o *output) closeClients() error {
+	var errs []error
+	for _, client := range o.clients {
+		if err := client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
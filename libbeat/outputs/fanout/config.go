@@ -0,0 +1,55 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fanout
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+type fanoutConfig struct {
+	Outputs     map[string]*config.C `config:"outputs" validate:"required"`
+	BulkMaxSize int                  `config:"bulk_max_size"`
+	Queue       config.Namespace     `config:"queue"`
+}
+
+// outputConfig holds the settings of a named output that are handled by the
+// fanout output. All other settings are passed on to the output.
+type outputConfig struct {
+	Type string             `config:"type" validate:"required"`
+	When *conditions.Config `config:"when"`
+}
+
+func defaultConfig() fanoutConfig {
+	return fanoutConfig{
+		BulkMaxSize: 1600,
+	}
+}
+
+func (c *fanoutConfig) Validate() error {
+	if len(c.Outputs) == 0 {
+		return errors.New("at least one output must be configured")
+	}
+	if c.BulkMaxSize <= 0 {
+		return fmt.Errorf("bulk_max_size must be greater than 0, got %d", c.BulkMaxSize)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fanout
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func init() {
+	outputs.RegisterType("fanout", makeFanout)
+}
+
+// makeFanout creates an output sending events to several named outputs.
+// Each output receives the events matching its `when` condition, or all
+// events if it has no condition.
+func makeFanout(
+	im outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *config.C,
+) (outputs.Group, error) {
+	log := beat.Logger.Named("fanout")
+
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return outputs.Fail(err)
+	}
+
+	names := make([]string, 0, len(config.Outputs))
+	for name := range config.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	outs := make([]*output, 0, len(names))
+	for _, name := range names {
+		out, err := loadOutput(log, im, beat, observer, name, config.Outputs[name])
+		if err != nil {
+			for _, out := range outs {
+				out.closeClients()
+			}
+			return outputs.Fail(fmt.Errorf("failed to load output '%v': %w", name, err))
+		}
+		outs = append(outs, out)
+	}
+
+	// Batches are never retried by the pipeline, as each output retries its
+	// share of the events itself.
+	client := newClient(log, observer, outs)
+	return outputs.Success(config.Queue, config.BulkMaxSize, -1, nil, beat.Logger, client)
+}
+
+func loadOutput(
+	log *logp.Logger,
+	im outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	name string,
+	cfg *config.C,
+) (*output, error) {
+	var settings outputConfig
+	if err := cfg.Unpack(&settings); err != nil {
+		return nil, err
+	}
+	if settings.Type == "fanout" {
+		return nil, fmt.Errorf("output type '%v' can not be nested", settings.Type)
+	}
+
+	var cond conditions.Condition
+	if settings.When != nil {
+		var err error
+		cond, err = conditions.NewCondition(settings.When, log)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The remaining settings are the configuration of the output itself.
+	for _, key := range []string{"type", "when"} {
+		if _, err := cfg.Remove(key, -1); err != nil && cfg.HasField(key) {
+			return nil, err
+		}
+	}
+
+	var stats outputs.Observer = outputs.NewNilObserver()
+	if s, ok := observer.(*outputs.Stats); ok && s != nil {
+		stats = s.Named(name)
+	}
+
+	group, err := outputs.Load(im, beat, stats, settings.Type, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(group.Clients) == 0 {
+		return nil, fmt.Errorf("output type '%v' has no clients", settings.Type)
+	}
+	if group.QueueFactory != nil {
+		log.Warnf("The queue settings of output '%v' are ignored, events are buffered in the queue of the fanout output.", name)
+	}
+
+	return newOutput(log.With("output", name), name, cond, stats, group), nil
+}
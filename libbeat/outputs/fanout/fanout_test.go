@@ -0,0 +1,342 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package fanout
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func init() {
+	outputs.RegisterType("fanout_test", makeRecorder)
+}
+
+// recorder is a test output recording the events it publishes. It fails
+// the first `fail` calls to Publish by retrying the batch.
+type recorder struct {
+	observer outputs.Observer
+
+	mu      sync.Mutex
+	fail    int
+	calls   int
+	events  []beat.Event
+	batches []int
+}
+
+var (
+	recordersMu sync.Mutex
+	recorders   = map[string]*recorder{}
+)
+
+func makeRecorder(_ outputs.IndexManager, _ beat.Info, observer outputs.Observer, cfg *config.C) (outputs.Group, error) {
+	settings := struct {
+		ID          string `config:"id"`
+		Fail        int    `config:"fail"`
+		BulkMaxSize int    `config:"bulk_max_size"`
+		MaxRetries  int    `config:"max_retries"`
+	}{MaxRetries: 3}
+	if err := cfg.Unpack(&settings); err != nil {
+		return outputs.Fail(err)
+	}
+
+	r := &recorder{observer: observer, fail: settings.Fail}
+	recordersMu.Lock()
+	recorders[settings.ID] = r
+	recordersMu.Unlock()
+	return outputs.Success(config.Namespace{}, settings.BulkMaxSize, settings.MaxRetries, nil, nil, r)
+}
+
+func getRecorder(t *testing.T, id string) *recorder {
+	recordersMu.Lock()
+	defer recordersMu.Unlock()
+	r := recorders[id]
+	require.NotNil(t, r, "recorder %v not created", id)
+	return r
+}
+
+func (r *recorder) Publish(_ context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	r.observer.NewBatch(len(events))
+
+	r.mu.Lock()
+	r.calls++
+	if r.calls <= r.fail {
+		r.mu.Unlock()
+		r.observer.RetryableErrors(len(events))
+		batch.Retry()
+		return nil
+	}
+	for _, event := range events {
+		r.events = append(r.events, event.Content)
+	}
+	r.batches = append(r.batches, len(events))
+	r.mu.Unlock()
+
+	r.observer.AckedEvents(len(events))
+	batch.ACK()
+	return nil
+}
+
+func (r *recorder) messages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var messages []string
+	for _, event := range r.events {
+		msg, _ := event.Fields.GetValue("message")
+		messages = append(messages, msg.(string))
+	}
+	return messages
+}
+
+func (r *recorder) Close() error   { return nil }
+func (r *recorder) String() string { return "fanout_test" }
+
+func makeTestClient(t *testing.T, observer outputs.Observer, settings map[string]interface{}) outputs.Client {
+	info := beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")}
+	if observer == nil {
+		observer = outputs.NewNilObserver()
+	}
+	group, err := makeFanout(nil, info, observer, config.MustNewConfigFrom(settings))
+	require.NoError(t, err)
+	require.Len(t, group.Clients, 1)
+	t.Cleanup(func() { group.Clients[0].Close() })
+	return group.Clients[0]
+}
+
+func testEvents() []beat.Event {
+	return []beat.Event{
+		{Timestamp: time.Now(), Fields: mapstr.M{"message": "first", "event": mapstr.M{"category": "network"}}},
+		{Timestamp: time.Now(), Fields: mapstr.M{"message": "second", "event": mapstr.M{"category": "security"}}},
+		{Timestamp: time.Now(), Fields: mapstr.M{"message": "third", "event": mapstr.M{"category": "network"}}},
+	}
+}
+
+// publish publishes the events and waits for the batch to be completed.
+func publish(t *testing.T, client outputs.Client, events ...beat.Event) outest.BatchSignal {
+	signals := make(chan outest.BatchSignal, 1)
+	batch := outest.NewBatch(events...)
+	batch.OnSignal = func(sig outest.BatchSignal) { signals <- sig }
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	select {
+	case sig := <-signals:
+		return sig
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch was not completed")
+		return outest.BatchSignal{}
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"no outputs": {},
+		"nested fanout": {
+			"outputs.inner.type": "fanout",
+		},
+		"missing type": {
+			"outputs.a.id": "a",
+		},
+		"unknown type": {
+			"outputs.a.type": "does_not_exist",
+		},
+		"invalid condition": {
+			"outputs.a.type":         "fanout_test",
+			"outputs.a.when.unknown": "x",
+		},
+	}
+
+	for name, settings := range cases {
+		t.Run(name, func(t *testing.T) {
+			info := beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")}
+			_, err := makeFanout(nil, info, outputs.NewNilObserver(), config.MustNewConfigFrom(settings))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPublishRoutesEvents(t *testing.T) {
+	client := makeTestClient(t, nil, map[string]interface{}{
+		"outputs": map[string]interface{}{
+			"security": map[string]interface{}{
+				"type":                       "fanout_test",
+				"id":                         t.Name() + "-security",
+				"when.equals.event.category": "security",
+			},
+			"all": map[string]interface{}{
+				"type": "fanout_test",
+				"id":   t.Name() + "-all",
+			},
+		},
+	})
+	assert.Equal(t, "fanout(all,security)", client.String())
+
+	sig := publish(t, client, testEvents()...)
+	assert.Equal(t, outest.BatchACK, sig.Tag)
+
+	assert.Equal(t, []string{"second"}, getRecorder(t, t.Name()+"-security").messages())
+	assert.Equal(t, []string{"first", "second", "third"}, getRecorder(t, t.Name()+"-all").messages())
+}
+
+func TestPublishNoMatchingOutput(t *testing.T) {
+	client := makeTestClient(t, nil, map[string]interface{}{
+		"outputs.security": map[string]interface{}{
+			"type":                       "fanout_test",
+			"id":                         t.Name(),
+			"when.equals.event.category": "security",
+		},
+	})
+
+	sig := publish(t, client, testEvents()[0])
+	assert.Equal(t, outest.BatchACK, sig.Tag)
+	assert.Empty(t, getRecorder(t, t.Name()).messages())
+}
+
+func TestPublishRetriesPerOutput(t *testing.T) {
+	client := makeTestClient(t, nil, map[string]interface{}{
+		"outputs": map[string]interface{}{
+			"failing": map[string]interface{}{
+				"type": "fanout_test",
+				"id":   t.Name() + "-failing",
+				"fail": 2,
+			},
+			"healthy": map[string]interface{}{
+				"type": "fanout_test",
+				"id":   t.Name() + "-healthy",
+			},
+		},
+	})
+
+	sig := publish(t, client, testEvents()...)
+	assert.Equal(t, outest.BatchACK, sig.Tag)
+
+	failing := getRecorder(t, t.Name()+"-failing")
+	assert.Equal(t, []string{"first", "second", "third"}, failing.messages())
+	assert.Equal(t, 3, failing.calls)
+
+	// The healthy output does not receive the events again.
+	healthy := getRecorder(t, t.Name()+"-healthy")
+	assert.Equal(t, []string{"first", "second", "third"}, healthy.messages())
+	assert.Equal(t, 1, healthy.calls)
+}
+
+func TestPublishDropsAfterMaxRetries(t *testing.T) {
+	client := makeTestClient(t, nil, map[string]interface{}{
+		"outputs.a": map[string]interface{}{
+			"type":        "fanout_test",
+			"id":          t.Name(),
+			"fail":        10,
+			"max_retries": 1,
+		},
+	})
+
+	sig := publish(t, client, testEvents()...)
+	assert.Equal(t, outest.BatchACK, sig.Tag)
+
+	r := getRecorder(t, t.Name())
+	assert.Empty(t, r.messages())
+	assert.Equal(t, 2, r.calls)
+}
+
+func TestPublishSplitsByOutputBatchSize(t *testing.T) {
+	client := makeTestClient(t, nil, map[string]interface{}{
+		"outputs.a": map[string]interface{}{
+			"type":          "fanout_test",
+			"id":            t.Name(),
+			"bulk_max_size": 2,
+		},
+	})
+
+	sig := publish(t, client, testEvents()...)
+	assert.Equal(t, outest.BatchACK, sig.Tag)
+
+	r := getRecorder(t, t.Name())
+	assert.Equal(t, []string{"first", "second", "third"}, r.messages())
+	assert.Equal(t, []int{2, 1}, r.batches)
+}
+
+func TestPerOutputMetrics(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	client := makeTestClient(t, outputs.NewStats(reg), map[string]interface{}{
+		"outputs": map[string]interface{}{
+			"security": map[string]interface{}{
+				"type":                       "fanout_test",
+				"id":                         t.Name() + "-security",
+				"when.equals.event.category": "security",
+			},
+			"all": map[string]interface{}{
+				"type": "fanout_test",
+				"id":   t.Name() + "-all",
+				"fail": 1,
+			},
+		},
+	})
+
+	publish(t, client, testEvents()...)
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, int64(3), snapshot.Ints["events.acked"])
+	assert.Equal(t, int64(1), snapshot.Ints["outputs.security.events.acked"])
+	assert.Equal(t, int64(3), snapshot.Ints["outputs.all.events.acked"])
+	assert.Equal(t, int64(3), snapshot.Ints["outputs.all.events.failed"])
+}
+
+func TestDroppedEventsMetrics(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	client := makeTestClient(t, outputs.NewStats(reg), map[string]interface{}{
+		"outputs": map[string]interface{}{
+			"security": map[string]interface{}{
+				"type":                       "fanout_test",
+				"id":                         t.Name() + "-security",
+				"when.equals.event.category": "security",
+				"fail":                       10,
+				"max_retries":                1,
+			},
+			"all": map[string]interface{}{
+				"type": "fanout_test",
+				"id":   t.Name() + "-all",
+			},
+		},
+	})
+
+	sig := publish(t, client, testEvents()...)
+	assert.Equal(t, outest.BatchACK, sig.Tag)
+
+	// The event dropped by the security output is not ACKed, even though
+	// the other output published it.
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, int64(2), snapshot.Ints["events.acked"])
+	assert.Equal(t, int64(1), snapshot.Ints["events.dropped"])
+	assert.Equal(t, int64(0), snapshot.Ints["events.active"])
+	assert.Equal(t, int64(3), snapshot.Ints["outputs.all.events.acked"])
+}
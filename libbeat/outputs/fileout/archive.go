@@ -0,0 +1,283 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fileout
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/elastic/elastic-agent-libs/file"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+
+	// fileExtension is the extension the rotator uses for the files it writes.
+	fileExtension = ".ndjson"
+)
+
+// archiver post-processes the files left behind by the rotator. Rotated
+// files are compressed and files that exceed the retention settings are
+// removed. The rotator only knows about uncompressed files, so the archiver
+// also enforces number_of_files for the compressed ones.
+type archiver struct {
+	log         *logp.Logger
+	compression string
+	maxBackups  uint
+	maxAge      time.Duration
+	permissions os.FileMode
+	now         func() time.Time
+
+	// mu serializes sweeps, which can run from the publisher and the
+	// background loop at the same time when the path changes.
+	mu sync.Mutex
+}
+
+// archivedFile is a rotated file along with the ordering information
+// encoded in its name: {filename}-{date}[-{index}].ndjson[.gz|.zst].
+type archivedFile struct {
+	name  string
+	date  time.Time
+	index int
+}
+
+func newArchiver(log *logp.Logger, c fileOutConfig) *archiver {
+	return &archiver{
+		log:         log,
+		compression: c.Compression,
+		maxBackups:  c.NumberOfFiles,
+		maxAge:      c.MaxAge,
+		permissions: os.FileMode(c.Permissions),
+		now:         time.Now,
+	}
+}
+
+// enabled reports whether the archiver has any work to do.
+func (a *archiver) enabled() bool {
+	return a.compression != compressionNone || a.maxAge > 0
+}
+
+// sweep compresses the rotated files of the file set at path and removes
+// the files that exceed the retention settings. If active is true the newest
+// uncompressed file is assumed to be written by the rotator and is left
+// alone.
+func (a *archiver) sweep(path string, active bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	plain := a.list(path, fileExtension)
+	if active && len(plain) > 0 {
+		plain = plain[:len(plain)-1]
+	}
+
+	if a.compression != compressionNone {
+		for _, f := range plain {
+			if err := a.compress(f.name); err != nil {
+				a.log.Errorf("Failed to compress rotated file %v: %+v", f.name, err)
+			}
+		}
+		a.expire(a.list(path, fileExtension+a.suffix()))
+		return
+	}
+
+	a.expire(plain)
+}
+
+// expire removes the files older than max_age and, oldest first, the files
+// exceeding number_of_files. files must be sorted oldest first.
+func (a *archiver) expire(files []archivedFile) {
+	var keep []archivedFile
+	for _, f := range files {
+		if a.maxAge > 0 {
+			info, err := os.Stat(f.name)
+			if err != nil {
+				if !os.IsNotExist(err) {
+					a.log.Errorf("Failed to stat rotated file %v: %+v", f.name, err)
+				}
+				continue
+			}
+			if a.now().Sub(info.ModTime()) > a.maxAge {
+				a.remove(f.name, "max_age")
+				continue
+			}
+		}
+		keep = append(keep, f)
+	}
+
+	if uint(len(keep)) > a.maxBackups {
+		for _, f := range keep[:uint(len(keep))-a.maxBackups] {
+			a.remove(f.name, "number_of_files")
+		}
+	}
+}
+
+func (a *archiver) remove(name, reason string) {
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		a.log.Errorf("Failed to remove rotated file %v: %+v", name, err)
+		return
+	}
+	a.log.Debugf("Removed rotated file %v (%v)", name, reason)
+}
+
+// compress writes a compressed copy of name next to it and removes the
+// original. The copy keeps the modification time of the original so that
+// max_age is based on when the events were written.
+func (a *archiver) compress(name string) error {
+	target := name + a.suffix()
+	if _, err := os.Stat(target); err == nil {
+		return fmt.Errorf("archive %v already exists", target)
+	}
+
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := target + ".tmp"
+	if err := a.writeCompressed(tmp, src); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("compressed to %v but failed to remove the original: %w", target, err)
+	}
+
+	a.log.Debugf("Compressed rotated file %v to %v", name, target)
+	return nil
+}
+
+func (a *archiver) writeCompressed(name string, src io.Reader) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, a.permissions)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var w io.WriteCloser
+	switch a.compression {
+	case compressionGzip:
+		w = gzip.NewWriter(f)
+	case compressionZstd:
+		w, err = zstd.NewWriter(f)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported compression %v", a.compression)
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		_ = w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// suffix returns the extension added to compressed files.
+func (a *archiver) suffix() string {
+	switch a.compression {
+	case compressionGzip:
+		return ".gz"
+	case compressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// list returns the files of the file set at path with the given extension,
+// sorted oldest first.
+func (a *archiver) list(path, ext string) []archivedFile {
+	prefix := path + "-"
+	names, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		a.log.Errorf("Failed to list rotated files of %v: %+v", path, err)
+		return nil
+	}
+
+	files := make([]archivedFile, 0, len(names))
+	for _, name := range names {
+		f, ok := parseArchivedFile(name, prefix, ext)
+		if !ok {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].date.Equal(files[j].date) {
+			return files[i].index < files[j].index
+		}
+		return files[i].date.Before(files[j].date)
+	})
+	return files
+}
+
+func parseArchivedFile(name, prefix, ext string) (archivedFile, bool) {
+	order := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+	if len(order) < len(file.DateFormat) {
+		return archivedFile{}, false
+	}
+
+	date, err := time.Parse(file.DateFormat, order[:len(file.DateFormat)])
+	if err != nil {
+		return archivedFile{}, false
+	}
+
+	f := archivedFile{name: name, date: date}
+	if rest := order[len(file.DateFormat):]; rest != "" {
+		if !strings.HasPrefix(rest, "-") {
+			return archivedFile{}, false
+		}
+		f.index, err = strconv.Atoi(rest[1:])
+		if err != nil {
+			return archivedFile{}, false
+		}
+	}
+	return f, true
+}
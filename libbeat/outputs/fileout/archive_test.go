@@ -0,0 +1,208 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package fileout
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestArchiverCompress(t *testing.T) {
+	for compression, read := range map[string]func(t *testing.T, r io.Reader) []byte{
+		compressionGzip: func(t *testing.T, r io.Reader) []byte {
+			zr, err := gzip.NewReader(r)
+			require.NoError(t, err)
+			b, err := io.ReadAll(zr)
+			require.NoError(t, err)
+			return b
+		},
+		compressionZstd: func(t *testing.T, r io.Reader) []byte {
+			zr, err := zstd.NewReader(r)
+			require.NoError(t, err)
+			defer zr.Close()
+			b, err := io.ReadAll(zr)
+			require.NoError(t, err)
+			return b
+		},
+	} {
+		t.Run(compression, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "pb")
+			writeFiles(t, path, "20240101.ndjson", "20240101-1.ndjson", "20240102.ndjson")
+
+			a := testArchiver(t, compression, 7, 0)
+			a.sweep(path, true)
+
+			suffix := a.suffix()
+			assert.Equal(t, []string{
+				"pb-20240101-1.ndjson" + suffix,
+				"pb-20240101.ndjson" + suffix,
+				"pb-20240102.ndjson",
+			}, listDir(t, dir))
+
+			f, err := os.Open(path + "-20240101-1.ndjson" + suffix)
+			require.NoError(t, err)
+			defer f.Close()
+			assert.Equal(t, "pb-20240101-1.ndjson\n", string(read(t, f)))
+		})
+	}
+}
+
+func TestArchiverCompressInactive(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pb")
+	writeFiles(t, path, "20240101.ndjson", "20240102.ndjson")
+
+	a := testArchiver(t, compressionGzip, 7, 0)
+	a.sweep(path, false)
+
+	assert.Equal(t, []string{"pb-20240101.ndjson.gz", "pb-20240102.ndjson.gz"}, listDir(t, dir))
+}
+
+func TestArchiverMaxAge(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	for _, compression := range []string{compressionNone, compressionGzip} {
+		t.Run(compression, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "pb")
+			writeFiles(t, path, "20240101.ndjson", "20240108.ndjson", "20240110.ndjson")
+			setModTime(t, path+"-20240101.ndjson", now.Add(-9*24*time.Hour))
+			setModTime(t, path+"-20240108.ndjson", now.Add(-2*24*time.Hour))
+			setModTime(t, path+"-20240110.ndjson", now.Add(-20*24*time.Hour))
+
+			a := testArchiver(t, compression, 7, 7*24*time.Hour)
+			a.now = func() time.Time { return now }
+			a.sweep(path, true)
+
+			// The active file is never removed, regardless of its age.
+			assert.Equal(t, []string{
+				"pb-20240108.ndjson" + a.suffix(),
+				"pb-20240110.ndjson",
+			}, listDir(t, dir))
+		})
+	}
+}
+
+func TestArchiverNumberOfFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pb")
+	writeFiles(t, path,
+		"20240101.ndjson.gz",
+		"20240101-1.ndjson.gz",
+		"20240101-2.ndjson",
+		"20240102.ndjson",
+		"20240103.ndjson",
+	)
+
+	a := testArchiver(t, compressionGzip, 2, 0)
+	a.sweep(path, true)
+
+	assert.Equal(t, []string{
+		"pb-20240101-2.ndjson.gz",
+		"pb-20240102.ndjson.gz",
+		"pb-20240103.ndjson",
+	}, listDir(t, dir))
+}
+
+func TestFileOutputPathChange(t *testing.T) {
+	dir := t.TempDir()
+	logger := logptest.NewTestingLogger(t, "")
+
+	cfg := config.MustNewConfigFrom(mapstr.M{
+		"path":        filepath.Join(dir, "%{+yyyy-MM-dd}"),
+		"filename":    "pb",
+		"compression": compressionGzip,
+	})
+	foConfig, err := readConfig(cfg)
+	require.NoError(t, err)
+
+	fo := &fileOutput{
+		log:      logger,
+		beat:     beat.Info{Beat: "libbeat", Logger: logger},
+		observer: outputs.NewNilObserver(),
+	}
+	require.NoError(t, fo.init(fo.beat, *foConfig))
+	defer fo.Close()
+
+	first := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+
+	require.NoError(t, fo.updatePath(first))
+	assert.Equal(t, filepath.Join(dir, "2024-01-02", "pb"), fo.filePath)
+	_, err = fo.rotator.Write([]byte("first\n"))
+	require.NoError(t, err)
+
+	require.NoError(t, fo.updatePath(second))
+	assert.Equal(t, filepath.Join(dir, "2024-01-03", "pb"), fo.filePath)
+
+	// The file written in the previous directory is no longer active and
+	// is compressed when the path changes.
+	matches, err := filepath.Glob(filepath.Join(dir, "2024-01-02", "pb-*.ndjson.gz"))
+	require.NoError(t, err)
+	assert.Len(t, matches, 1)
+}
+
+func testArchiver(t *testing.T, compression string, maxBackups uint, maxAge time.Duration) *archiver {
+	c := defaultConfig()
+	c.Compression = compression
+	c.NumberOfFiles = maxBackups
+	c.MaxAge = maxAge
+	return newArchiver(logptest.NewTestingLogger(t, ""), c)
+}
+
+func writeFiles(t *testing.T, path string, suffixes ...string) {
+	for _, s := range suffixes {
+		name := path + "-" + s
+		require.NoError(t, os.WriteFile(name, []byte(filepath.Base(name)+"\n"), 0600))
+	}
+}
+
+func setModTime(t *testing.T, name string, mtime time.Time) {
+	require.NoError(t, os.Chtimes(name, mtime, mtime))
+}
+
+func listDir(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
@@ -19,6 +19,7 @@ package fileout
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
 	"github.com/elastic/elastic-agent-libs/config"
@@ -33,6 +34,9 @@ type fileOutConfig struct {
 	Codec           codec.Config      `config:"codec"`
 	Permissions     uint32            `config:"permissions"`
 	RotateOnStartup bool              `config:"rotate_on_startup"`
+	RotateInterval  time.Duration     `config:"rotate_interval"`
+	Compression     string            `config:"compression"`
+	MaxAge          time.Duration     `config:"max_age"`
 	Queue           config.Namespace  `config:"queue"`
 }
 
@@ -43,6 +47,7 @@ func defaultConfig() fileOutConfig {
 		RotateEveryKb:   10 * 1024,
 		Permissions:     0600,
 		RotateOnStartup: true,
+		Compression:     compressionNone,
 	}
 }
 
@@ -64,5 +69,20 @@ func (c *fileOutConfig) Validate() error {
 			file.MaxBackupsLimit)
 	}
 
+	if c.RotateInterval != 0 && c.RotateInterval < time.Second {
+		return fmt.Errorf("the rotate_interval must be at least 1s, got %v", c.RotateInterval)
+	}
+
+	switch c.Compression {
+	case compressionNone, compressionGzip, compressionZstd:
+	default:
+		return fmt.Errorf("unsupported compression %q, must be one of %v, %v or %v",
+			c.Compression, compressionNone, compressionGzip, compressionZstd)
+	}
+
+	if c.MaxAge < 0 {
+		return fmt.Errorf("the max_age must not be negative, got %v", c.MaxAge)
+	}
+
 	return nil
 }
@@ -42,6 +42,7 @@ func TestConfig(t *testing.T) {
 					RotateEveryKb:   10 * 1024,
 					Permissions:     0600,
 					RotateOnStartup: true,
+					Compression:     "none",
 				}
 
 				assert.Equal(t, expectedConfig, actual)
@@ -91,6 +92,38 @@ func TestConfig(t *testing.T) {
 				assert.Nil(t, err)
 			},
 		},
+		"config given with rotation and retention policies": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"path":            "/tmp/packetbeat",
+				"rotate_interval": "24h",
+				"compression":     "zstd",
+				"max_age":         "720h",
+			}),
+			assertion: func(t *testing.T, actual *fileOutConfig, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 24*time.Hour, actual.RotateInterval)
+				assert.Equal(t, "zstd", actual.Compression)
+				assert.Equal(t, 720*time.Hour, actual.MaxAge)
+			},
+		},
+		"config given with unsupported compression": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"path":        "/tmp/packetbeat",
+				"compression": "lz4",
+			}),
+			assertion: func(t *testing.T, actual *fileOutConfig, err error) {
+				assert.ErrorContains(t, err, "unsupported compression")
+			},
+		},
+		"config given with too short rotate_interval": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"path":            "/tmp/packetbeat",
+				"rotate_interval": "10ms",
+			}),
+			assertion: func(t *testing.T, actual *fileOutConfig, err error) {
+				assert.ErrorContains(t, err, "rotate_interval")
+			},
+		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			isWindowsPath = test.useWindowsPath
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
@@ -37,13 +38,27 @@ func init() {
 	outputs.RegisterType("file", makeFileout)
 }
 
+// archiveInterval is how often rotated files are compressed and expired.
+var archiveInterval = time.Minute
+
 type fileOutput struct {
 	log      *logp.Logger
-	filePath string
 	beat     beat.Info
 	observer outputs.Observer
-	rotator  *file.Rotator
+	config   fileOutConfig
 	codec    codec.Codec
+	archiver *archiver
+
+	separator []byte
+
+	// mu protects filePath and rotator, which are replaced when the
+	// configured path expands to a different directory.
+	mu       sync.Mutex
+	filePath string
+	rotator  *file.Rotator
+
+	done chan struct{}
+	wg   sync.WaitGroup
 }
 
 // makeFileout instantiates a new file output instance.
@@ -71,52 +86,153 @@ func makeFileout(
 }
 
 func (out *fileOutput) init(beat beat.Info, c fileOutConfig) error {
-	var path string
+	out.config = c
+
 	configPath, runErr := c.Path.Run(time.Now().UTC())
 	if runErr != nil {
 		return runErr
 	}
-	if c.Filename != "" {
-		path = filepath.Join(configPath, c.Filename)
-	} else {
-		path = filepath.Join(configPath, out.beat.Beat)
-	}
+	path := out.joinFilename(configPath)
 
+	var err error
+	out.rotator, err = out.newRotator(path)
+	if err != nil {
+		return err
+	}
 	out.filePath = path
 
-	var err error
-	out.rotator, err = file.NewFileRotator(
+	out.codec, err = codec.CreateEncoder(beat, c.Codec)
+	if err != nil {
+		return err
+	}
+	if err := codec.ValidateStream(out.codec); err != nil {
+		return err
+	}
+	out.separator = codec.Separator(out.codec)
+
+	out.archiver = newArchiver(out.log, c)
+	if out.archiver.enabled() {
+		out.done = make(chan struct{})
+		out.wg.Add(1)
+		go out.runArchiver()
+	}
+
+	out.log.Infof("Initialized file output. "+
+		"path=%v max_size_bytes=%v max_backups=%v permissions=%v "+
+		"rotate_interval=%v compression=%v max_age=%v",
+		path, c.RotateEveryKb*1024, c.NumberOfFiles, os.FileMode(c.Permissions),
+		c.RotateInterval, c.Compression, c.MaxAge)
+
+	return nil
+}
+
+func (out *fileOutput) joinFilename(dir string) string {
+	if out.config.Filename != "" {
+		return filepath.Join(dir, out.config.Filename)
+	}
+	return filepath.Join(dir, out.beat.Beat)
+}
+
+func (out *fileOutput) newRotator(path string) (*file.Rotator, error) {
+	c := out.config
+	return file.NewFileRotator(
 		path,
 		file.MaxSizeBytes(c.RotateEveryKb*1024),
 		file.MaxBackups(c.NumberOfFiles),
 		file.Permissions(os.FileMode(c.Permissions)),
 		file.RotateOnStartup(c.RotateOnStartup),
-		file.WithLogger(beat.Logger.Named("rotator").With(logp.Namespace("rotator"))),
+		file.Interval(c.RotateInterval),
+		file.WithLogger(out.beat.Logger.Named("rotator").With(logp.Namespace("rotator"))),
 	)
+}
+
+// updatePath switches to a new rotator when the configured path expands to a
+// different directory, for example because it contains a date that changed.
+// The files left in the previous directory are archived right away.
+func (out *fileOutput) updatePath(now time.Time) error {
+	if out.config.Path.IsConst() {
+		return nil
+	}
+
+	configPath, err := out.config.Path.Run(now)
 	if err != nil {
 		return err
 	}
+	path := out.joinFilename(configPath)
 
-	out.codec, err = codec.CreateEncoder(beat, c.Codec)
+	out.mu.Lock()
+	if path == out.filePath {
+		out.mu.Unlock()
+		return nil
+	}
+	rotator, err := out.newRotator(path)
 	if err != nil {
+		out.mu.Unlock()
 		return err
 	}
+	prevRotator, prevPath := out.rotator, out.filePath
+	out.rotator, out.filePath = rotator, path
+	out.mu.Unlock()
 
-	out.log.Infof("Initialized file output. "+
-		"path=%v max_size_bytes=%v max_backups=%v permissions=%v",
-		path, c.RotateEveryKb*1024, c.NumberOfFiles, os.FileMode(c.Permissions))
-
+	out.log.Infof("File output path changed from %v to %v", prevPath, path)
+	if err := prevRotator.Close(); err != nil {
+		out.log.Errorf("Failed to close file output at %v: %+v", prevPath, err)
+	}
+	if out.archiver.enabled() {
+		out.archiver.sweep(prevPath, false)
+	}
 	return nil
 }
 
+func (out *fileOutput) runArchiver() {
+	defer out.wg.Done()
+
+	ticker := time.NewTicker(archiveInterval)
+	defer ticker.Stop()
+
+	for {
+		out.mu.Lock()
+		path := out.filePath
+		out.mu.Unlock()
+
+		out.archiver.sweep(path, true)
+
+		select {
+		case <-out.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 // Implement Outputer
 func (out *fileOutput) Close() error {
-	return out.rotator.Close()
+	if out.done != nil {
+		close(out.done)
+		out.wg.Wait()
+	}
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	err := out.rotator.Close()
+	if out.archiver.enabled() {
+		out.archiver.sweep(out.filePath, true)
+	}
+	return err
 }
 
 func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 	defer batch.ACK()
 
+	if err := out.updatePath(time.Now().UTC()); err != nil {
+		out.log.Errorf("Failed to update the file output path: %+v", err)
+	}
+
+	out.mu.Lock()
+	rotator := out.rotator
+	out.mu.Unlock()
+
 	st := out.observer
 	events := batch.Events()
 	st.NewBatch(len(events))
@@ -141,7 +257,7 @@ func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 		}
 
 		begin := time.Now()
-		if _, err = out.rotator.Write(append(serializedEvent, '\n')); err != nil {
+		if _, err = rotator.Write(append(serializedEvent, out.separator...)); err != nil {
 			st.WriteError(err)
 
 			if event.Guaranteed() {
@@ -154,7 +270,7 @@ func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 			continue
 		}
 
-		st.WriteBytes(len(serializedEvent) + 1)
+		st.WriteBytes(len(serializedEvent) + len(out.separator))
 		took := time.Since(begin)
 		st.ReportLatency(took)
 	}
@@ -167,5 +283,7 @@ func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 }
 
 func (out *fileOutput) String() string {
+	out.mu.Lock()
+	defer out.mu.Unlock()
 	return "file(" + out.filePath + ")"
 }
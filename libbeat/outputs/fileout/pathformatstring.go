@@ -51,6 +51,12 @@ func (fs *PathFormatString) Run(timestamp time.Time) (string, error) {
 	return fs.efs.Run(placeholderEvent)
 }
 
+// IsConst reports whether the path expands to the same value regardless of
+// the timestamp.
+func (fs *PathFormatString) IsConst() bool {
+	return fs.efs == nil || fs.efs.IsConst()
+}
+
 // Unpack tries to initialize the PathFormatString from provided value
 // (which must be a string). Unpack method satisfies go-ucfg.Unpacker interface
 // required by config.C, in order to use PathFormatString with
@@ -0,0 +1,377 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+type client struct {
+	log       *logp.Logger
+	observer  outputs.Observer
+	index     string
+	userAgent string
+	url       string
+	config    *httpConfig
+	codec     codec.Codec
+	separator []byte
+
+	client *http.Client
+}
+
+// sendError is returned when the endpoint does not accept a request.
+type sendError struct {
+	status     int
+	retryAfter time.Duration
+}
+
+func (e *sendError) Error() string {
+	return fmt.Sprintf("endpoint responded with %d %v", e.status, http.StatusText(e.status))
+}
+
+func newClient(info beat.Info, observer outputs.Observer, url string, enc codec.Codec, config *httpConfig) *client {
+	return &client{
+		log:       info.Logger.Named("http"),
+		observer:  observer,
+		index:     info.Beat,
+		userAgent: info.UserAgent,
+		url:       url,
+		config:    config,
+		codec:     enc,
+		separator: codec.Separator(enc),
+	}
+}
+
+func (c *client) Connect(ctx context.Context) error {
+	c.log.Debugf("connect to HTTP endpoint %v", c.url)
+
+	httpClient, err := c.config.Transport.Client()
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP client for %v: %w", c.url, err)
+	}
+
+	if o := c.config.OAuth2; o != nil {
+		creds := clientcredentials.Config{
+			ClientID:       o.ClientID,
+			ClientSecret:   o.ClientSecret,
+			TokenURL:       o.TokenURL,
+			Scopes:         o.Scopes,
+			EndpointParams: o.EndpointParams,
+		}
+		// The token requests share the TLS and proxy settings of the output.
+		tokenCtx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+		oauthClient := creds.Client(tokenCtx)
+		oauthClient.Timeout = httpClient.Timeout
+		httpClient = oauthClient
+	}
+
+	c.client = httpClient
+	return nil
+}
+
+func (c *client) Close() error {
+	if c.client != nil {
+		c.client.CloseIdleConnections()
+		c.client = nil
+	}
+	return nil
+}
+
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+	if len(events) == 0 {
+		batch.ACK()
+		return nil
+	}
+
+	if c.config.Format == formatJSON {
+		return c.publishEach(ctx, batch, events)
+	}
+	return c.publishBatch(ctx, batch, events)
+}
+
+// publishBatch sends all events of the batch in a single request.
+func (c *client) publishBatch(ctx context.Context, batch publisher.Batch, events []publisher.Event) error {
+	var body bytes.Buffer
+	if c.config.Format == formatJSONArray {
+		body.WriteByte('[')
+	}
+
+	encoded := make([]publisher.Event, 0, len(events))
+	for i := range events {
+		data, err := c.encode(&events[i])
+		if err != nil {
+			continue
+		}
+
+		if c.config.Format == formatJSONArray {
+			if len(encoded) > 0 {
+				body.WriteByte(',')
+			}
+			body.Write(data)
+		} else {
+			body.Write(data)
+			body.Write(c.separator)
+		}
+		encoded = append(encoded, events[i])
+	}
+
+	if c.config.Format == formatJSONArray {
+		body.WriteByte(']')
+	}
+
+	if dropped := len(events) - len(encoded); dropped > 0 {
+		c.observer.PermanentErrors(dropped)
+	}
+	if len(encoded) == 0 {
+		batch.ACK()
+		return nil
+	}
+
+	if err := c.send(ctx, body.Bytes()); err != nil {
+		if !isRetryable(err) {
+			c.log.Errorf("Dropping %d events rejected by %v: %v", len(encoded), c.url, err)
+			c.observer.PermanentErrors(len(encoded))
+			batch.Drop()
+			return nil
+		}
+
+		c.retryLater(ctx, err, len(encoded))
+		batch.RetryEvents(encoded)
+		return err
+	}
+
+	batch.ACK()
+	c.observer.AckedEvents(len(encoded))
+	return nil
+}
+
+// publishEach sends every event of the batch in its own request. Events the
+// endpoint rejects are dropped one by one, while a retryable error retries
+// the event and all events following it.
+func (c *client) publishEach(ctx context.Context, batch publisher.Batch, events []publisher.Event) error {
+	acked, dropped := 0, 0
+	for i := range events {
+		data, err := c.encode(&events[i])
+		if err != nil {
+			dropped++
+			continue
+		}
+
+		if err := c.send(ctx, data); err != nil {
+			if !isRetryable(err) {
+				c.log.Errorf("Dropping event rejected by %v: %v", c.url, err)
+				dropped++
+				continue
+			}
+
+			c.observer.PermanentErrors(dropped)
+			c.observer.AckedEvents(acked)
+			c.retryLater(ctx, err, len(events)-i)
+			batch.RetryEvents(events[i:])
+			return err
+		}
+		acked++
+	}
+
+	c.observer.PermanentErrors(dropped)
+	c.observer.AckedEvents(acked)
+	batch.ACK()
+	return nil
+}
+
+func (c *client) encode(event *publisher.Event) ([]byte, error) {
+	data, err := c.codec.Encode(c.index, &event.Content)
+	if err != nil {
+		if event.Guaranteed() {
+			c.log.Errorf("Failed to serialize the event: %+v", err)
+		} else {
+			c.log.Warnf("Failed to serialize the event: %+v", err)
+		}
+		c.log.Debugw(fmt.Sprintf("Failed event: %v", event), logp.TypeKey, logp.EventType)
+		return nil, err
+	}
+	return data, nil
+}
+
+// retryLater updates the metrics for a failed request and, if the endpoint
+// asked for it with a Retry-After header, waits before returning. The wait is
+// capped by backoff.max so that a misbehaving endpoint can't stall the output.
+func (c *client) retryLater(ctx context.Context, err error, n int) {
+	c.observer.RetryableErrors(n)
+
+	var sendErr *sendError
+	if !errors.As(err, &sendErr) {
+		return
+	}
+	if sendErr.status == http.StatusTooManyRequests {
+		c.observer.ErrTooMany(n)
+	}
+
+	wait := sendErr.retryAfter
+	if wait <= 0 {
+		return
+	}
+	if limit := c.config.Backoff.Max; limit > 0 && wait > limit {
+		wait = limit
+	}
+
+	c.log.Debugf("%v asked to retry after %v", c.url, wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+func (c *client) send(ctx context.Context, data []byte) error {
+	if c.client == nil {
+		return errors.New("HTTP client not initialized")
+	}
+
+	body := data
+	if c.config.CompressionLevel > 0 {
+		var buf bytes.Buffer
+		w, err := gzip.NewWriterLevel(&buf, c.config.CompressionLevel)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, c.config.Method, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	c.setHeaders(req)
+
+	begin := time.Now()
+	resp, err := c.client.Do(req)
+	c.observer.ReportLatency(time.Since(begin))
+	if err != nil {
+		c.observer.WriteError(err)
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		c.observer.WriteBytes(len(body))
+		return nil
+	}
+
+	return &sendError{
+		status:     resp.StatusCode,
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+func (c *client) setHeaders(req *http.Request) {
+	switch {
+	case c.config.Format == formatNDJSON:
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	case codec.IsBinary(c.codec):
+		req.Header.Set("Content-Type", "application/octet-stream")
+	default:
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.config.CompressionLevel > 0 {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	switch {
+	case c.config.Username != "" || c.config.Password != "":
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	case c.config.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.config.BearerToken)
+	}
+
+	// Custom headers are set last, so they can override the defaults.
+	for k, v := range c.config.Headers {
+		req.Header.Set(k, v)
+	}
+}
+
+func (c *client) String() string {
+	return "http(" + c.url + ")"
+}
+
+// isRetryable reports whether a failed request should be sent again.
+// Transport errors, 408, 429 and 5xx responses are retried, other responses
+// mean the endpoint refused the events.
+func isRetryable(err error) bool {
+	var sendErr *sendError
+	if !errors.As(err, &sendErr) {
+		return true
+	}
+	switch code := sendErr.status; {
+	case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+		return true
+	case code >= 500:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either
+// a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
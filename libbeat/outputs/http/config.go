@@ -0,0 +1,135 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+const (
+	// formatJSON sends every event in its own request.
+	formatJSON = "json"
+	// formatNDJSON sends a batch as newline delimited events.
+	formatNDJSON = "ndjson"
+	// formatJSONArray sends a batch as a JSON array of events.
+	formatJSONArray = "json_array"
+)
+
+type httpConfig struct {
+	Path             string            `config:"path"`
+	Method           string            `config:"method"`
+	Headers          map[string]string `config:"headers"`
+	Format           string            `config:"format"`
+	Codec            codec.Config      `config:"codec"`
+	CompressionLevel int               `config:"compression_level" validate:"min=0, max=9"`
+	Username         string            `config:"username"`
+	Password         string            `config:"password"`
+	BearerToken      string            `config:"bearer_token"`
+	OAuth2           *oauth2Config     `config:"oauth2"`
+	LoadBalance      bool              `config:"loadbalance"`
+	BulkMaxSize      int               `config:"bulk_max_size"`
+	MaxRetries       int               `config:"max_retries"`
+	Backoff          backoff           `config:"backoff"`
+	Queue            config.Namespace  `config:"queue"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+// oauth2Config configures the OAuth2 client credentials flow. The option
+// names follow the httpjson and cel inputs.
+type oauth2Config struct {
+	ClientID       string              `config:"client.id"`
+	ClientSecret   string              `config:"client.secret"`
+	TokenURL       string              `config:"token_url"`
+	Scopes         []string            `config:"scopes"`
+	EndpointParams map[string][]string `config:"endpoint_params"`
+}
+
+func defaultConfig() httpConfig {
+	return httpConfig{
+		Method:      http.MethodPost,
+		Format:      formatNDJSON,
+		LoadBalance: true,
+		BulkMaxSize: 50,
+		MaxRetries:  3,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+		Transport: httpcommon.DefaultHTTPTransportSettings(),
+	}
+}
+
+func (c *httpConfig) Validate() error {
+	switch c.Method {
+	case http.MethodPost, http.MethodPut:
+	default:
+		return fmt.Errorf("unsupported http method '%v', must be one of %q or %q", c.Method, http.MethodPost, http.MethodPut)
+	}
+
+	switch c.Format {
+	case formatJSON, formatNDJSON, formatJSONArray:
+	default:
+		return fmt.Errorf("unsupported format '%v', must be one of %q, %q or %q", c.Format, formatJSON, formatNDJSON, formatJSONArray)
+	}
+
+	auth := 0
+	if c.Username != "" || c.Password != "" {
+		auth++
+	}
+	if c.BearerToken != "" {
+		auth++
+	}
+	if c.OAuth2 != nil {
+		auth++
+	}
+	if auth > 1 {
+		return errors.New("only one of username/password, bearer_token or oauth2 can be set")
+	}
+
+	return nil
+}
+
+// validateCodec returns an error if the events encoded by enc can't be sent in
+// the configured format. The ndjson and json_array formats join the events of a
+// batch into one JSON document, which binary codecs can't be part of.
+func (c *httpConfig) validateCodec(enc codec.Codec) error {
+	if c.Format != formatJSON && codec.IsBinary(enc) {
+		return fmt.Errorf("format '%v' requires a text codec, use format %q to send events encoded by a binary codec", c.Format, formatJSON)
+	}
+	return nil
+}
+
+func (c *oauth2Config) Validate() error {
+	if c.ClientID == "" || c.ClientSecret == "" || c.TokenURL == "" {
+		return errors.New("oauth2 requires client.id, client.secret and token_url to be set")
+	}
+	return nil
+}
@@ -0,0 +1,449 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/cbor"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// testEndpoint records all requests it receives. The respond function
+// decides about the status code of every request.
+type testEndpoint struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+	respond  func(w http.ResponseWriter, n int)
+}
+
+func (e *testEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reader = zr
+	}
+	body, _ := io.ReadAll(reader)
+
+	e.requests = append(e.requests, r)
+	e.bodies = append(e.bodies, string(body))
+
+	if e.respond != nil {
+		e.respond(w, len(e.requests))
+	}
+}
+
+func startEndpoint(t *testing.T, e *testEndpoint) string {
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func makeTestClient(t *testing.T, settings map[string]interface{}) outputs.NetworkClient {
+	cfg := config.MustNewConfigFrom(settings)
+	require.NoError(t, cfg.Merge(map[string]interface{}{"backoff.init": "1ms", "backoff.max": "1ms"}))
+	info := beat.Info{Beat: "testbeat", Version: "9.9.9", Logger: logptest.NewTestingLogger(t, "")}
+
+	group, err := makeHTTP(nil, info, outputs.NewNilObserver(), cfg)
+	require.NoError(t, err)
+	require.Len(t, group.Clients, 1)
+
+	client, ok := group.Clients[0].(outputs.NetworkClient)
+	require.True(t, ok, "expected a network client, got %T", group.Clients[0])
+	require.NoError(t, client.Connect(context.Background()))
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func testEvents() []beat.Event {
+	ts := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	return []beat.Event{
+		{Timestamp: ts, Fields: mapstr.M{"message": "first"}},
+		{Timestamp: ts, Fields: mapstr.M{"message": "second"}},
+	}
+}
+
+func messages(t *testing.T, docs ...string) []string {
+	var out []string
+	for _, doc := range docs {
+		var event struct {
+			Message string `json:"message"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(doc), &event))
+		out = append(out, event.Message)
+	}
+	return out
+}
+
+func TestMakeHTTP(t *testing.T) {
+	tests := map[string]struct {
+		config map[string]interface{}
+		valid  bool
+	}{
+		"no host": {
+			config: map[string]interface{}{"hosts": []string{}},
+		},
+		"defaults": {
+			config: map[string]interface{}{"hosts": []string{"localhost:8080"}},
+			valid:  true,
+		},
+		"invalid format": {
+			config: map[string]interface{}{"hosts": []string{"localhost:8080"}, "format": "xml"},
+		},
+		"invalid method": {
+			config: map[string]interface{}{"hosts": []string{"localhost:8080"}, "method": "GET"},
+		},
+		"basic and bearer auth": {
+			config: map[string]interface{}{
+				"hosts":        []string{"localhost:8080"},
+				"username":     "user",
+				"password":     "pass",
+				"bearer_token": "token",
+			},
+		},
+		"incomplete oauth2": {
+			config: map[string]interface{}{
+				"hosts":            []string{"localhost:8080"},
+				"oauth2.client.id": "id",
+			},
+		},
+		"binary codec with ndjson": {
+			config: map[string]interface{}{"hosts": []string{"localhost:8080"}, "codec.cbor": map[string]interface{}{}},
+		},
+		"binary codec with json_array": {
+			config: map[string]interface{}{"hosts": []string{"localhost:8080"}, "format": "json_array", "codec.cbor": map[string]interface{}{}},
+		},
+		"binary codec with json": {
+			config: map[string]interface{}{"hosts": []string{"localhost:8080"}, "format": "json", "codec.cbor": map[string]interface{}{}},
+			valid:  true,
+		},
+		"invalid compression level": {
+			config: map[string]interface{}{"hosts": []string{"localhost:8080"}, "compression_level": 10},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			info := beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")}
+			group, err := makeHTTP(nil, info, outputs.NewNilObserver(), config.MustNewConfigFrom(test.config))
+			if test.valid {
+				require.NoError(t, err)
+				assert.Len(t, group.Clients, 1)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestPublishFormats(t *testing.T) {
+	tests := map[string]struct {
+		format      string
+		requests    int
+		contentType string
+		decode      func(t *testing.T, bodies []string) []string
+	}{
+		formatNDJSON: {
+			requests:    1,
+			contentType: "application/x-ndjson",
+			decode: func(t *testing.T, bodies []string) []string {
+				return messages(t, strings.Split(strings.TrimSuffix(bodies[0], "\n"), "\n")...)
+			},
+		},
+		formatJSONArray: {
+			requests:    1,
+			contentType: "application/json",
+			decode: func(t *testing.T, bodies []string) []string {
+				var docs []json.RawMessage
+				require.NoError(t, json.Unmarshal([]byte(bodies[0]), &docs))
+				var raw []string
+				for _, d := range docs {
+					raw = append(raw, string(d))
+				}
+				return messages(t, raw...)
+			},
+		},
+		formatJSON: {
+			requests:    2,
+			contentType: "application/json",
+			decode: func(t *testing.T, bodies []string) []string {
+				return messages(t, bodies...)
+			},
+		},
+	}
+
+	for format, test := range tests {
+		t.Run(format, func(t *testing.T) {
+			endpoint := &testEndpoint{}
+			url := startEndpoint(t, endpoint)
+
+			client := makeTestClient(t, map[string]interface{}{
+				"hosts":  []string{url},
+				"path":   "/ingest",
+				"format": format,
+			})
+
+			batch := outest.NewBatch(testEvents()...)
+			require.NoError(t, client.Publish(context.Background(), batch))
+			require.Len(t, batch.Signals, 1)
+			assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+			require.Len(t, endpoint.requests, test.requests)
+			for _, r := range endpoint.requests {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "/ingest", r.URL.Path)
+				assert.Equal(t, test.contentType, r.Header.Get("Content-Type"))
+			}
+			assert.Equal(t, []string{"first", "second"}, test.decode(t, endpoint.bodies))
+		})
+	}
+}
+
+func TestPublishHeadersAndAuth(t *testing.T) {
+	endpoint := &testEndpoint{}
+	url := startEndpoint(t, endpoint)
+
+	client := makeTestClient(t, map[string]interface{}{
+		"hosts":             []string{url},
+		"method":            "PUT",
+		"username":          "beat",
+		"password":          "secret",
+		"compression_level": 5,
+		"headers": map[string]interface{}{
+			"X-Custom":     "value",
+			"Content-Type": "application/vnd.custom+json",
+		},
+	})
+
+	batch := outest.NewBatch(testEvents()...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	require.Len(t, endpoint.requests, 1)
+	r := endpoint.requests[0]
+	assert.Equal(t, http.MethodPut, r.Method)
+	assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+	assert.Equal(t, "value", r.Header.Get("X-Custom"))
+	assert.Equal(t, "application/vnd.custom+json", r.Header.Get("Content-Type"))
+	user, pass, ok := r.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "beat", user)
+	assert.Equal(t, "secret", pass)
+	assert.Equal(t, []string{"first", "second"}, messages(t, strings.Split(strings.TrimSuffix(endpoint.bodies[0], "\n"), "\n")...))
+}
+
+func TestPublishBinaryCodec(t *testing.T) {
+	endpoint := &testEndpoint{}
+	url := startEndpoint(t, endpoint)
+
+	client := makeTestClient(t, map[string]interface{}{
+		"hosts":      []string{url},
+		"format":     "json",
+		"codec.cbor": map[string]interface{}{},
+	})
+
+	require.NoError(t, client.Publish(context.Background(), outest.NewBatch(testEvents()...)))
+	require.Len(t, endpoint.requests, 2)
+	for _, r := range endpoint.requests {
+		assert.Equal(t, "application/octet-stream", r.Header.Get("Content-Type"))
+	}
+}
+
+func TestPublishBearerToken(t *testing.T) {
+	endpoint := &testEndpoint{}
+	url := startEndpoint(t, endpoint)
+
+	client := makeTestClient(t, map[string]interface{}{
+		"hosts":        []string{url},
+		"bearer_token": "abc",
+	})
+
+	require.NoError(t, client.Publish(context.Background(), outest.NewBatch(testEvents()...)))
+	require.Len(t, endpoint.requests, 1)
+	assert.Equal(t, "Bearer abc", endpoint.requests[0].Header.Get("Authorization"))
+}
+
+func TestPublishOAuth2(t *testing.T) {
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+		assert.Equal(t, "events:write", r.Form.Get("scope"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"oauth-token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	t.Cleanup(tokenSrv.Close)
+
+	endpoint := &testEndpoint{}
+	url := startEndpoint(t, endpoint)
+
+	client := makeTestClient(t, map[string]interface{}{
+		"hosts":                []string{url},
+		"oauth2.client.id":     "id",
+		"oauth2.client.secret": "secret",
+		"oauth2.token_url":     tokenSrv.URL,
+		"oauth2.scopes":        []string{"events:write"},
+	})
+
+	require.NoError(t, client.Publish(context.Background(), outest.NewBatch(testEvents()...)))
+	require.Len(t, endpoint.requests, 1)
+	assert.Equal(t, "Bearer oauth-token", endpoint.requests[0].Header.Get("Authorization"))
+}
+
+func TestPublishErrors(t *testing.T) {
+	tests := map[string]struct {
+		format string
+		status int
+		tag    outest.BatchSignalTag
+		err    bool
+	}{
+		"bad request drops the batch": {
+			status: http.StatusBadRequest,
+			tag:    outest.BatchDrop,
+		},
+		"too many requests retries the batch": {
+			status: http.StatusTooManyRequests,
+			tag:    outest.BatchRetryEvents,
+			err:    true,
+		},
+		"unavailable retries the batch": {
+			status: http.StatusServiceUnavailable,
+			tag:    outest.BatchRetryEvents,
+			err:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			endpoint := &testEndpoint{respond: func(w http.ResponseWriter, _ int) {
+				w.WriteHeader(test.status)
+			}}
+			url := startEndpoint(t, endpoint)
+			client := makeTestClient(t, map[string]interface{}{"hosts": []string{url}})
+
+			batch := outest.NewBatch(testEvents()...)
+			err := client.Publish(context.Background(), batch)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			require.Len(t, batch.Signals, 1)
+			assert.Equal(t, test.tag, batch.Signals[0].Tag)
+		})
+	}
+}
+
+func TestPublishEachPartialFailure(t *testing.T) {
+	// The first event is accepted, the second one hits a rate limit.
+	endpoint := &testEndpoint{respond: func(w http.ResponseWriter, n int) {
+		if n > 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}}
+	url := startEndpoint(t, endpoint)
+	client := makeTestClient(t, map[string]interface{}{
+		"hosts":  []string{url},
+		"format": formatJSON,
+	})
+
+	batch := outest.NewBatch(testEvents()...)
+	require.Error(t, client.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	require.Len(t, batch.Signals[0].Events, 1)
+	assert.Equal(t, "second", batch.Signals[0].Events[0].Content.Fields["message"])
+}
+
+func TestRetryAfterIsHonored(t *testing.T) {
+	endpoint := &testEndpoint{respond: func(w http.ResponseWriter, _ int) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}}
+	url := startEndpoint(t, endpoint)
+
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"hosts":        []string{url},
+		"backoff.init": "1ms",
+		"backoff.max":  "200ms",
+	})
+	info := beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")}
+	c := defaultConfig()
+	require.NoError(t, cfg.Unpack(&c))
+
+	client := newClient(info, outputs.NewNilObserver(), url, nil, &c)
+	require.NoError(t, client.Connect(context.Background()))
+	defer client.Close()
+
+	begin := time.Now()
+	err := client.send(context.Background(), []byte("{}"))
+	require.Error(t, err)
+	client.retryLater(context.Background(), err, 1)
+
+	// Retry-After asks for 1s, the wait is capped by backoff.max.
+	took := time.Since(begin)
+	assert.GreaterOrEqual(t, took, 200*time.Millisecond)
+	assert.Less(t, took, time.Second)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	tests := map[string]struct {
+		value string
+		want  time.Duration
+	}{
+		"empty":        {value: "", want: 0},
+		"seconds":      {value: "120", want: 2 * time.Minute},
+		"negative":     {value: "-1", want: 0},
+		"http date":    {value: now.Add(30 * time.Second).Format(http.TimeFormat), want: 30 * time.Second},
+		"date in past": {value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		"garbage":      {value: "soon", want: 0},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.want, parseRetryAfter(test.value, now))
+		})
+	}
+}
@@ -48,12 +48,16 @@ type client struct {
 	key      *fmtstr.EventFormatString
 	index    string
 	codec    codec.Codec
+	registry *schemaRegistry
 	config   sarama.Config
 	mux      sync.Mutex
 	done     chan struct{}
 
 	producer sarama.AsyncProducer
 
+	// transactional is set if each batch is published in a transaction.
+	transactional bool
+
 	recordHeaders []sarama.RecordHeader
 
 	wg sync.WaitGroup
@@ -66,6 +70,15 @@ type msgRef struct {
 	failed []publisher.Event
 	batch  publisher.Batch
 
+	// txnDone is closed once all the messages of a batch published in a
+	// transaction are done. acked holds the messages stored by the brokers,
+	// which become visible to consumers when the transaction is committed.
+	txnDone chan struct{}
+	acked   []publisher.Event
+
+	// mu protects failed and err, which are updated by the error worker
+	// and by Publish for events failing before being sent.
+	mu  sync.Mutex
 	err error
 }
 
@@ -95,6 +108,7 @@ func newKafkaClient(
 	topic outil.Selector,
 	headers []header,
 	writer codec.Codec,
+	registry *schemaRegistry,
 	cfg *sarama.Config,
 	logger *logp.Logger,
 ) (*client, error) {
@@ -106,8 +120,11 @@ func newKafkaClient(
 		key:      key,
 		index:    strings.ToLower(index),
 		codec:    writer,
+		registry: registry,
 		config:   *cfg,
 		done:     make(chan struct{}),
+
+		transactional: cfg.Producer.Transaction.ID != "",
 	}
 
 	if len(headers) != 0 {
@@ -135,6 +152,12 @@ func (c *client) Connect(_ context.Context) error {
 
 	c.log.Debugf("connect: %v", c.hosts)
 
+	// A producer left over from a failed transaction is replaced, sarama
+	// producers can't start new transactions after a fatal error.
+	if c.producer != nil {
+		c.closeProducer()
+	}
+
 	// try to connect
 	producer, err := sarama.NewAsyncProducer(c.hosts, &c.config)
 	if err != nil {
@@ -143,6 +166,7 @@ func (c *client) Connect(_ context.Context) error {
 	}
 
 	c.producer = producer
+	c.done = make(chan struct{})
 
 	c.wg.Add(2)
 	go c.successWorker(producer.Successes())
@@ -161,14 +185,20 @@ func (c *client) Close() error {
 		return nil
 	}
 
+	c.closeProducer()
+	return nil
+}
+
+// closeProducer closes the producer and waits for its workers to finish.
+// It must be called with c.mux held.
+func (c *client) closeProducer() {
 	close(c.done)
 	c.producer.AsyncClose()
 	c.wg.Wait()
 	c.producer = nil
-	return nil
 }
 
-func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
 	events := batch.Events()
 	c.observer.NewBatch(len(events))
 
@@ -179,11 +209,109 @@ func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
 		failed: nil,
 		batch:  batch,
 	}
+	if c.transactional {
+		return c.publishTransaction(ctx, ref)
+	}
+	c.send(ctx, ref)
+	return nil
+}
+
+// publishTransaction publishes a batch in a transaction, which is committed
+// once all the messages of the batch are stored by the brokers. The batch is
+// only ACKed after the commit, and retried if the transaction is aborted, so
+// a batch is never partially visible to consumers reading committed messages.
+// This doesn't make the delivery exactly-once: a batch committed before a
+// restart, but not yet ACKed, is published again in a new transaction.
+// An error is returned if the producer can't be used for new transactions, in
+// which case it is closed and recreated when the pipeline reconnects the
+// client.
+func (c *client) publishTransaction(ctx context.Context, ref *msgRef) error {
+	if ref.total == 0 {
+		ref.batch.ACK()
+		return nil
+	}
+	if err := c.producer.BeginTxn(); err != nil {
+		ref.batch.Retry()
+		c.observer.RetryableErrors(ref.total)
+		return c.failTransaction(fmt.Errorf("failed to begin kafka transaction: %w", err))
+	}
+
+	ref.txnDone = make(chan struct{})
+	sent := c.send(ctx, ref)
+	select {
+	case <-ref.txnDone:
+	case <-ctx.Done():
+		ref.batch.Cancelled()
+		if err := c.producer.AbortTxn(); err != nil {
+			return errors.Join(ctx.Err(), c.failTransaction(fmt.Errorf("failed to abort kafka transaction: %w", err)))
+		}
+		return ctx.Err()
+	}
+
+	// Messages failing before being sent, like schema registry failures,
+	// don't belong to the transaction and are retried in any case.
+	if len(ref.acked) == sent {
+		if err := c.producer.CommitTxn(); err != nil {
+			c.log.Errorf("Failed to commit kafka transaction, aborting it: %+v", err)
+			return c.abortTransaction(ref)
+		}
+		if len(ref.failed) > 0 {
+			ref.batch.RetryEvents(ref.failed)
+			c.observer.RetryableErrors(len(ref.failed))
+		} else {
+			ref.batch.ACK()
+		}
+		if len(ref.acked) > 0 {
+			c.observer.AckedEvents(len(ref.acked))
+		}
+		return nil
+	}
+
+	c.log.Debugf("Kafka publish failed, aborting transaction: %+v", ref.err)
+	return c.abortTransaction(ref)
+}
+
+// abortTransaction aborts the transaction of a batch and retries the events
+// of the batch which weren't dropped. An error is returned if the
+// transaction can't be aborted.
+func (c *client) abortTransaction(ref *msgRef) error {
+	retry := append(ref.failed, ref.acked...)
+	ref.batch.RetryEvents(retry)
+	c.observer.RetryableErrors(len(retry))
 
+	if err := c.producer.AbortTxn(); err != nil {
+		return c.failTransaction(fmt.Errorf("failed to abort kafka transaction: %w", err))
+	}
+	return nil
+}
+
+// failTransaction closes the producer after a transaction error it can't
+// recover from. The pipeline reconnects the client once Publish returns the
+// error, which creates a new producer.
+func (c *client) failTransaction(err error) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.producer != nil {
+		c.closeProducer()
+	}
+	return err
+}
+
+// send passes the events of a batch to the producer and returns the number
+// of messages sent.
+func (c *client) send(ctx context.Context, ref *msgRef) int {
+	events := ref.batch.Events()
+	sent := 0
 	ch := c.producer.Input()
 	for i := range events {
 		d := &events[i]
-		msg, err := c.getEventMessage(d)
+		msg, err := c.getEventMessage(ctx, d)
+		var registryErr *schemaRegistryError
+		if errors.As(err, &registryErr) {
+			c.log.Errorf("Schema registry failure, retrying event: %+v", err)
+			ref.fail(&message{data: *d}, err)
+			continue
+		}
 		if err != nil {
 			c.log.Errorf("Dropping event: %+v", err)
 			ref.done()
@@ -194,16 +322,16 @@ func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
 		msg.ref = ref
 		msg.initProducerMessage()
 		ch <- &msg.msg
+		sent++
 	}
-
-	return nil
+	return sent
 }
 
 func (c *client) String() string {
 	return "kafka(" + strings.Join(c.hosts, ",") + ")"
 }
 
-func (c *client) getEventMessage(data *publisher.Event) (*message, error) {
+func (c *client) getEventMessage(ctx context.Context, data *publisher.Event) (*message, error) {
 	event := &data.Content
 	msg := &message{partition: -1, data: *data}
 
@@ -250,9 +378,17 @@ func (c *client) getEventMessage(data *publisher.Event) (*message, error) {
 		return nil, err
 	}
 
-	buf := make([]byte, len(serializedEvent))
-	copy(buf, serializedEvent)
-	msg.value = buf
+	if c.registry != nil {
+		// framing copies the serialized event into a new buffer
+		msg.value, err = c.registry.frame(ctx, msg.topic, serializedEvent)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		buf := make([]byte, len(serializedEvent))
+		copy(buf, serializedEvent)
+		msg.value = buf
+	}
 
 	// message timestamps have been added to kafka with version 0.10.0.0
 	if c.config.Version.IsAtLeast(sarama.V0_10_0_0) {
@@ -278,6 +414,9 @@ func (c *client) successWorker(ch <-chan *sarama.ProducerMessage) {
 			c.log.Debug("Failed to assert libMsg.Metadata to *message")
 			return
 		}
+		if msg.ref.txnDone != nil {
+			msg.ref.acked = append(msg.ref.acked, msg.data)
+		}
 		msg.ref.done()
 	}
 }
@@ -358,8 +497,8 @@ func (c *client) errorWorker(ch <-chan *sarama.ProducerError) {
 			if breakerOpen {
 				// Immediately log the error that presumably caused this state,
 				// since the error reporting on this batch will be delayed.
-				if msg.ref.err != nil {
-					c.log.Errorf("Kafka (topic=%v): %v", msg.topic, msg.ref.err)
+				if err := msg.ref.firstError(); err != nil {
+					c.log.Errorf("Kafka (topic=%v): %v", msg.topic, err)
 				}
 				select {
 				case <-time.After(10 * time.Second):
@@ -404,25 +543,43 @@ func (r *msgRef) fail(msg *message, err error) {
 	case errors.Is(err, breaker.ErrBreakerOpen):
 		// Add this message to the failed list, but don't overwrite r.err since
 		// all the breaker error means is "there were a lot of other errors".
-		r.failed = append(r.failed, msg.data)
+		r.addFailed(msg.data, nil)
 
 	default:
-		r.failed = append(r.failed, msg.data)
-		if r.err == nil {
-			// Don't overwrite an existing error. This way at the end of the batch
-			// we report the first error that we saw, rather than the last one.
-			r.err = err
-		}
+		r.addFailed(msg.data, err)
 	}
 	r.dec()
 }
 
+func (r *msgRef) addFailed(event publisher.Event, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed = append(r.failed, event)
+	if r.err == nil {
+		// Don't overwrite an existing error. This way at the end of the batch
+		// we report the first error that we saw, rather than the last one.
+		r.err = err
+	}
+}
+
+func (r *msgRef) firstError() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
 func (r *msgRef) dec() {
 	i := atomic.AddInt32(&r.count, -1)
 	if i > 0 {
 		return
 	}
 
+	if r.txnDone != nil {
+		// The batch is handled once the transaction is finished.
+		close(r.txnDone)
+		return
+	}
+
 	r.client.log.Debug("finished kafka batch")
 	stats := r.client.observer
 
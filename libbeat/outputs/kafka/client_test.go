@@ -0,0 +1,205 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/sarama"
+	"github.com/elastic/sarama/mocks"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// txnProducer counts the transactions finished by a mock producer.
+type txnProducer struct {
+	*mocks.AsyncProducer
+	commits int
+	aborts  int
+
+	// abortErr is returned by AbortTxn if set.
+	abortErr error
+
+	// input replaces the input of the mock producer if set, messages sent
+	// to it are never handled.
+	input chan *sarama.ProducerMessage
+}
+
+func (p *txnProducer) CommitTxn() error {
+	p.commits++
+	return p.AsyncProducer.CommitTxn()
+}
+
+func (p *txnProducer) AbortTxn() error {
+	p.aborts++
+	if p.abortErr != nil {
+		return p.abortErr
+	}
+	return p.AsyncProducer.AbortTxn()
+}
+
+func (p *txnProducer) Input() chan<- *sarama.ProducerMessage {
+	if p.input != nil {
+		return p.input
+	}
+	return p.AsyncProducer.Input()
+}
+
+func TestPublishTransaction(t *testing.T) {
+	tests := map[string]struct {
+		results     []error
+		wantCommits int
+		wantAborts  int
+		wantSignal  outest.BatchSignalTag
+		wantRetried int
+	}{
+		"all messages stored": {
+			results:     []error{nil, nil, nil},
+			wantCommits: 1,
+			wantSignal:  outest.BatchACK,
+		},
+		"retryable error aborts the transaction": {
+			results:     []error{nil, sarama.ErrNotLeaderForPartition, nil},
+			wantAborts:  1,
+			wantSignal:  outest.BatchRetryEvents,
+			wantRetried: 3,
+		},
+		"dropped message aborts the transaction": {
+			results:     []error{nil, nil, sarama.ErrMessageSizeTooLarge},
+			wantAborts:  1,
+			wantSignal:  outest.BatchRetryEvents,
+			wantRetried: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, producer := newTransactionalTestClient(t)
+			for _, err := range test.results {
+				if err == nil {
+					producer.ExpectInputAndSucceed()
+				} else {
+					producer.ExpectInputAndFail(err)
+				}
+			}
+
+			events := make([]beat.Event, len(test.results))
+			for i := range events {
+				events[i] = beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": i}}
+			}
+			batch := outest.NewBatch(events...)
+			var signals []outest.BatchSignal
+			batch.OnSignal = func(sig outest.BatchSignal) {
+				signals = append(signals, sig)
+			}
+
+			// Publish returns once the transaction is finished.
+			require.NoError(t, c.Publish(context.Background(), batch))
+
+			assert.Equal(t, test.wantCommits, producer.commits, "commits")
+			assert.Equal(t, test.wantAborts, producer.aborts, "aborts")
+			require.Len(t, signals, 1)
+			assert.Equal(t, test.wantSignal, signals[0].Tag)
+			assert.Len(t, signals[0].Events, test.wantRetried)
+		})
+	}
+}
+
+func TestPublishTransactionAbortFailureClosesProducer(t *testing.T) {
+	c, producer := newTransactionalTestClient(t)
+	producer.abortErr = sarama.ErrProducerFenced
+	producer.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+
+	batch := outest.NewBatch(beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": 1}})
+	var signals []outest.BatchSignal
+	batch.OnSignal = func(sig outest.BatchSignal) {
+		signals = append(signals, sig)
+	}
+
+	// The error makes the pipeline reconnect the client, which creates a
+	// new producer.
+	err := c.Publish(context.Background(), batch)
+	require.ErrorIs(t, err, sarama.ErrProducerFenced)
+	assert.Nil(t, c.producer, "the producer must be closed")
+	require.Len(t, signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, signals[0].Tag)
+	assert.Len(t, signals[0].Events, 1)
+}
+
+func TestPublishTransactionCancelled(t *testing.T) {
+	c, producer := newTransactionalTestClient(t)
+	producer.input = make(chan *sarama.ProducerMessage, 1)
+
+	batch := outest.NewBatch(beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": 1}})
+	var signals []outest.BatchSignal
+	batch.OnSignal = func(sig outest.BatchSignal) {
+		signals = append(signals, sig)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-producer.input
+		cancel()
+	}()
+	err := c.Publish(ctx, batch)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, producer.commits, "commits")
+	assert.Equal(t, 1, producer.aborts, "aborts")
+	assert.Equal(t, sarama.ProducerTxnFlagReady, producer.TxnStatus())
+	require.Len(t, signals, 1)
+	assert.Equal(t, outest.BatchCancelled, signals[0].Tag)
+}
+
+func newTransactionalTestClient(t *testing.T) (*client, *txnProducer) {
+	logger := logptest.NewTestingLogger(t, "")
+	cfg := config.MustNewConfigFrom(mapstr.M{
+		"hosts":          []string{"localhost:9092"},
+		"topic":          "test",
+		"transaction.id": "test-transaction",
+	})
+	kConfig, err := readConfig(cfg)
+	require.NoError(t, err)
+	saramaConfig, err := newSaramaConfig(logger, kConfig)
+	require.NoError(t, err)
+	topic, err := buildTopicSelector(cfg, logger)
+	require.NoError(t, err)
+
+	c, err := newKafkaClient(outputs.NewNilObserver(), kConfig.Hosts, "testbeat", nil, topic, nil,
+		json.New("1.2.3", json.Config{}), nil, saramaConfig, logger)
+	require.NoError(t, err)
+	require.True(t, c.transactional)
+
+	producer := &txnProducer{AsyncProducer: mocks.NewAsyncProducer(t, saramaConfig)}
+	c.producer = producer
+	c.wg.Add(2)
+	go c.successWorker(producer.Successes())
+	go c.errorWorker(producer.Errors())
+	t.Cleanup(func() { c.Close() })
+	return c, producer
+}
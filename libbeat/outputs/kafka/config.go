@@ -77,6 +77,9 @@ type kafkaConfig struct {
 	Sasl               kafka.SaslConfig          `config:"sasl"`
 	EnableFAST         bool                      `config:"enable_krb5_fast"`
 	Queue              config.Namespace          `config:"queue"`
+	SchemaRegistry     *schemaRegistryConfig     `config:"schema_registry"`
+	Idempotent         bool                      `config:"idempotent"`
+	Transaction        transactionConfig         `config:"transaction"`
 
 	// Currently only used for validation. Those values are later
 	// unpacked into temporary structs whenever they're necessary.
@@ -84,6 +87,18 @@ type kafkaConfig struct {
 	Topics []any  `config:"topics"`
 }
 
+// transactionConfig configures the transactional producer. Transactions are
+// enabled by setting an ID, which must be unique to each Beat instance and
+// stable across restarts.
+type transactionConfig struct {
+	ID      string        `config:"id"`
+	Timeout time.Duration `config:"timeout" validate:"min=1"`
+}
+
+func (c transactionConfig) enabled() bool {
+	return c.ID != ""
+}
+
 type metaConfig struct {
 	Retry       metaRetryConfig `config:"retry"`
 	RefreshFreq time.Duration   `config:"refresh_frequency" validate:"min=0"`
@@ -146,11 +161,18 @@ func defaultConfig() kafkaConfig {
 		ChanBufferSize: 256,
 		Username:       "",
 		Password:       "",
+		Transaction: transactionConfig{
+			Timeout: 60 * time.Second,
+		},
 	}
 }
 
 func readConfig(cfg *config.C) (*kafkaConfig, error) {
 	c := defaultConfig()
+	if cfg.HasField("schema_registry") {
+		registry := defaultSchemaRegistryConfig()
+		c.SchemaRegistry = &registry
+	}
 	if err := cfg.Unpack(&c); err != nil {
 		return nil, err
 	}
@@ -189,6 +211,15 @@ func (c *kafkaConfig) Validate() error {
 		return errors.New("including headers is not supported for kafka versions < 0.11")
 	}
 
+	if c.Idempotent || c.Transaction.enabled() {
+		if version, _ := c.Version.Get(); !version.IsAtLeast(sarama.V0_11_0_0) {
+			return errors.New("idempotent and transactional producers are not supported for kafka versions < 0.11")
+		}
+		if c.RequiredACKs != nil && *c.RequiredACKs != int(sarama.WaitForAll) {
+			return errors.New("idempotent and transactional producers require required_acks to be -1")
+		}
+	}
+
 	// When running under Elastic-Agent we do not support dynamic topic
 	// selection, so `topics` is not supported and `topic` is treated as an
 	// plain string
@@ -302,6 +333,19 @@ func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, err
 	// configure client ID
 	k.ClientID = config.ClientID
 
+	// The idempotent producer lets the brokers discard the duplicates
+	// created by the retries of the producer. Transactions additionally
+	// commit each batch atomically.
+	if config.Idempotent || config.Transaction.enabled() {
+		k.Producer.Idempotent = true
+		k.Producer.RequiredAcks = sarama.WaitForAll
+		k.Net.MaxOpenRequests = 1
+	}
+	if config.Transaction.enabled() {
+		k.Producer.Transaction.ID = config.Transaction.ID
+		k.Producer.Transaction.Timeout = config.Transaction.Timeout
+	}
+
 	version, ok := config.Version.Get()
 	if !ok {
 		return nil, fmt.Errorf("Unknown/unsupported kafka version: %v", config.Version)
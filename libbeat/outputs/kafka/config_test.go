@@ -43,6 +43,15 @@ func TestConfigAcceptValid(t *testing.T) {
 			"version":     "1.0.0",
 			"topic":       "foo",
 		},
+		"idempotent producer": mapstr.M{
+			"idempotent": true,
+			"topic":      "foo",
+		},
+		"transactional producer": mapstr.M{
+			"transaction.id": "beat-1",
+			"required_acks":  -1,
+			"topic":          "foo",
+		},
 	}
 
 	for name, test := range tests {
@@ -76,6 +85,16 @@ func TestConfigInvalid(t *testing.T) {
 		},
 		// The default config does not set `topic` nor `topics`.
 		"No topics or topic provided": mapstr.M{},
+		"idempotent producer with 0.10": mapstr.M{
+			"idempotent": true,
+			"version":    "0.10",
+			"topic":      "foo",
+		},
+		"transactional producer without all acks": mapstr.M{
+			"transaction.id": "beat-1",
+			"required_acks":  1,
+			"topic":          "foo",
+		},
 	}
 
 	for name, test := range tests {
@@ -73,7 +73,19 @@ func makeKafka(
 		return outputs.Fail(err)
 	}
 
-	client, err := newKafkaClient(observer, hosts, beat.IndexPrefix, kConfig.Key, topic, kConfig.Headers, codec, libCfg, beat.Logger)
+	var registry *schemaRegistry
+	if kConfig.SchemaRegistry != nil {
+		enc, ok := codec.(schemaCodec)
+		if !ok {
+			return outputs.Fail(fmt.Errorf("schema_registry requires a codec with a schema, like the avro codec"))
+		}
+		registry, err = newSchemaRegistry(kConfig.SchemaRegistry, enc.Schema())
+		if err != nil {
+			return outputs.Fail(err)
+		}
+	}
+
+	client, err := newKafkaClient(observer, hosts, beat.IndexPrefix, kConfig.Key, topic, kConfig.Headers, codec, registry, libCfg, beat.Logger)
 	if err != nil {
 		return outputs.Fail(err)
 	}
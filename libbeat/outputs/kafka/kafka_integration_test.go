@@ -445,6 +445,111 @@ func TestKafkaErrors(t *testing.T) {
 
 }
 
+func TestKafkaTransactionalPublish(t *testing.T) {
+	id := strconv.Itoa(rand.Int())
+	testTopic := fmt.Sprintf("test-libbeat-txn-%s", id)
+	transactionID := fmt.Sprintf("test-libbeat-txn-%s", id)
+
+	cfg := makeConfig(t, map[string]interface{}{
+		"hosts":          []string{getTestKafkaHost()},
+		"topic":          testTopic,
+		"timeout":        "1s",
+		"transaction.id": transactionID,
+	})
+	logger := logptest.NewTestingLogger(t, "")
+	kConfig, err := readConfig(cfg)
+	require.NoError(t, err)
+	saramaConfig, err := newSaramaConfig(logger, kConfig)
+	require.NoError(t, err)
+
+	// Simulate a crash in the middle of a batch: a producer with the same
+	// transaction ID sends a message without committing its transaction.
+	crashed, err := sarama.NewAsyncProducer([]string{getTestKafkaHost()}, saramaConfig)
+	require.NoError(t, err)
+	defer crashed.Close()
+	require.NoError(t, crashed.BeginTxn())
+	crashed.Input() <- &sarama.ProducerMessage{Topic: testTopic, Value: sarama.StringEncoder("not committed")}
+	select {
+	case <-crashed.Successes():
+	case err := <-crashed.Errors():
+		t.Fatal(err)
+	}
+
+	// The restarted output fences the crashed producer, which aborts its
+	// transaction.
+	grp, err := makeKafka(nil, beat.Info{Beat: "libbeat", IndexPrefix: "testbeat", Logger: logger}, outputs.NewNilObserver(), cfg)
+	require.NoError(t, err)
+	output, ok := grp.Clients[0].(*client)
+	require.True(t, ok, "grp.Clients[0] didn't contain a ptr to client")
+	require.NoError(t, output.Connect(context.Background()))
+	defer output.Close()
+
+	batches := randMulti(3, 50, mapstr.M{"host": "test-host"})
+	for _, info := range batches {
+		batch := outest.NewBatch(info.events...)
+		var signals []outest.BatchSignal
+		batch.OnSignal = func(sig outest.BatchSignal) {
+			signals = append(signals, sig)
+		}
+		// Transactional batches are ACKed once Publish returns.
+		require.NoError(t, output.Publish(context.Background(), batch))
+		require.Len(t, signals, 1)
+		require.Equal(t, outest.BatchACK, signals[0].Tag)
+	}
+
+	expected := flatten(batches)
+	stored := testReadCommittedFromKafkaTopic(t, testTopic, 10*time.Second)
+	require.Len(t, stored, len(expected))
+	seenMsgs := map[string]struct{}{}
+	for _, s := range stored {
+		seenMsgs[validateJSON(t, s.Value, expected)] = struct{}{}
+	}
+	assert.Len(t, seenMsgs, len(expected))
+}
+
+// testReadCommittedFromKafkaTopic reads the committed messages of a topic
+// until no message is received during the timeout.
+func testReadCommittedFromKafkaTopic(t *testing.T, topic string, timeout time.Duration) []*sarama.ConsumerMessage {
+	consumerConfig := sarama.NewConfig()
+	consumerConfig.Version = sarama.V2_1_0_0
+	consumerConfig.Consumer.IsolationLevel = sarama.ReadCommitted
+	consumer, err := sarama.NewConsumer([]string{getTestKafkaHost()}, consumerConfig)
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	partitions, err := consumer.Partitions(topic)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	msgs := make(chan *sarama.ConsumerMessage)
+	for _, partition := range partitions {
+		partitionConsumer, err := consumer.ConsumePartition(topic, partition, sarama.OffsetOldest)
+		require.NoError(t, err)
+		defer partitionConsumer.Close()
+
+		go func() {
+			for msg := range partitionConsumer.Messages() {
+				select {
+				case msgs <- msg:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	defer close(done)
+
+	var messages []*sarama.ConsumerMessage
+	for {
+		select {
+		case msg := <-msgs:
+			messages = append(messages, msg)
+		case <-time.After(timeout):
+			return messages
+		}
+	}
+}
+
 func validateJSON(t *testing.T, value []byte, events []beat.Event) string {
 	var decoded map[string]interface{}
 	err := json.Unmarshal(value, &decoded)
@@ -0,0 +1,204 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+// wireFormatMagic is the first byte of every message in the Confluent wire
+// format, followed by the 4 byte big-endian schema ID.
+const wireFormatMagic byte = 0
+
+const schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+
+type schemaRegistryConfig struct {
+	URL          string `config:"url"           validate:"required"`
+	Username     string `config:"username"`
+	Password     string `config:"password"`
+	AutoRegister bool   `config:"auto_register"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+func defaultSchemaRegistryConfig() schemaRegistryConfig {
+	return schemaRegistryConfig{
+		AutoRegister: true,
+		Transport:    httpcommon.DefaultHTTPTransportSettings(),
+	}
+}
+
+func (c *schemaRegistryConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid schema registry url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid schema registry url scheme '%v'", u.Scheme)
+	}
+	return nil
+}
+
+// schemaCodec is implemented by codecs encoding events with a schema that can
+// be registered with a schema registry, like the avro codec.
+type schemaCodec interface {
+	codec.Codec
+	Schema() string
+}
+
+// schemaRegistryError is returned if the schema ID of a message could not be
+// resolved. Events failing with this error are retried.
+type schemaRegistryError struct {
+	err error
+}
+
+func (e *schemaRegistryError) Error() string { return e.err.Error() }
+func (e *schemaRegistryError) Unwrap() error { return e.err }
+
+// schemaRegistry resolves schema IDs from a Confluent compatible schema
+// registry. The schema of a topic is registered under the `<topic>-value`
+// subject. IDs are cached for the lifetime of the output.
+type schemaRegistry struct {
+	url          string
+	username     string
+	password     string
+	autoRegister bool
+	schema       string
+	client       *http.Client
+
+	mu  sync.Mutex
+	ids map[string]uint32
+}
+
+func newSchemaRegistry(cfg *schemaRegistryConfig, schema string) (*schemaRegistry, error) {
+	client, err := cfg.Transport.Client()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema registry client: %w", err)
+	}
+
+	return &schemaRegistry{
+		url:          strings.TrimSuffix(cfg.URL, "/"),
+		username:     cfg.Username,
+		password:     cfg.Password,
+		autoRegister: cfg.AutoRegister,
+		schema:       schema,
+		client:       client,
+		ids:          map[string]uint32{},
+	}, nil
+}
+
+// frame prefixes value with the wire format header for the schema registered
+// for topic.
+func (r *schemaRegistry) frame(ctx context.Context, topic string, value []byte) ([]byte, error) {
+	id, err := r.schemaID(ctx, topic+"-value")
+	if err != nil {
+		return nil, &schemaRegistryError{err: err}
+	}
+
+	buf := make([]byte, 5, 5+len(value))
+	buf[0] = wireFormatMagic
+	binary.BigEndian.PutUint32(buf[1:], id)
+	return append(buf, value...), nil
+}
+
+func (r *schemaRegistry) schemaID(ctx context.Context, subject string) (uint32, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id, ok := r.ids[subject]; ok {
+		return id, nil
+	}
+
+	path := "/subjects/" + url.PathEscape(subject)
+	id, found, err := r.request(ctx, path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up schema of subject '%v': %w", subject, err)
+	}
+	if !found {
+		if !r.autoRegister {
+			return 0, fmt.Errorf("schema is not registered for subject '%v'", subject)
+		}
+		id, _, err = r.request(ctx, path+"/versions")
+		if err != nil {
+			return 0, fmt.Errorf("failed to register schema of subject '%v': %w", subject, err)
+		}
+	}
+
+	r.ids[subject] = id
+	return id, nil
+}
+
+// request posts the schema to path and returns the schema ID from the
+// response. A 404 response is reported as not found.
+func (r *schemaRegistry) request(ctx context.Context, path string) (uint32, bool, error) {
+	body, err := json.Marshal(map[string]string{"schema": r.schema})
+	if err != nil {
+		return 0, false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", schemaRegistryContentType)
+	req.Header.Set("Accept", schemaRegistryContentType)
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("schema registry responded with %v: %s", resp.Status, respBody)
+	}
+
+	var result struct {
+		ID *uint32 `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return 0, false, fmt.Errorf("invalid schema registry response: %w", err)
+	}
+	if result.ID == nil {
+		return 0, false, errors.New("schema registry response is missing the schema id")
+	}
+	return *result.ID, true, nil
+}
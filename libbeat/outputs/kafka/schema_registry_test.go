@@ -0,0 +1,249 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/sarama"
+	"github.com/elastic/sarama/mocks"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/avro"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/outputs/outil"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// fakeSchemaRegistry implements the subset of the Confluent schema registry
+// API used by the Kafka output.
+type fakeSchemaRegistry struct {
+	mu       sync.Mutex
+	subjects map[string]uint32
+	nextID   uint32
+	requests int
+	failing  bool
+}
+
+func (r *fakeSchemaRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+
+	if r.failing {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	if req.Method != http.MethodPost || json.NewDecoder(req.Body).Decode(&body) != nil || body.Schema == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/subjects/")
+	subject, register := strings.CutSuffix(path, "/versions")
+
+	id, ok := r.subjects[subject]
+	switch {
+	case register && !ok:
+		r.nextID++
+		id = r.nextID
+		r.subjects[subject] = id
+	case !ok:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error_code":40401,"message":"Subject not found."}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", schemaRegistryContentType)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+func startFakeSchemaRegistry(t *testing.T) (*fakeSchemaRegistry, string) {
+	registry := &fakeSchemaRegistry{subjects: map[string]uint32{}, nextID: 41}
+	srv := httptest.NewServer(registry)
+	t.Cleanup(srv.Close)
+	return registry, srv.URL
+}
+
+func TestSchemaRegistryFrame(t *testing.T) {
+	fake, url := startFakeSchemaRegistry(t)
+	cfg := defaultSchemaRegistryConfig()
+	cfg.URL = url
+
+	registry, err := newSchemaRegistry(&cfg, `"string"`)
+	require.NoError(t, err)
+
+	framed, err := registry.frame(context.Background(), "logs", []byte{0x02, 'a'})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 42, 0x02, 'a'}, framed)
+
+	// cached IDs are reused without asking the registry again
+	framed, err = registry.frame(context.Background(), "logs", []byte{0x00})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 42, 0x00}, framed)
+	assert.Equal(t, 2, fake.requests, "expected a lookup and a registration request")
+
+	// other topics use their own subject
+	framed, err = registry.frame(context.Background(), "metrics", nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(43), binary.BigEndian.Uint32(framed[1:]))
+	assert.Equal(t, map[string]uint32{"logs-value": 42, "metrics-value": 43}, fake.subjects)
+}
+
+func TestSchemaRegistryExistingSubject(t *testing.T) {
+	fake, url := startFakeSchemaRegistry(t)
+	fake.subjects["logs-value"] = 7
+
+	cfg := defaultSchemaRegistryConfig()
+	cfg.URL = url
+	cfg.AutoRegister = false
+
+	registry, err := newSchemaRegistry(&cfg, `"string"`)
+	require.NoError(t, err)
+
+	framed, err := registry.frame(context.Background(), "logs", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 7}, framed)
+
+	_, err = registry.frame(context.Background(), "unknown", nil)
+	assert.Error(t, err, "subject must not be registered with auto_register disabled")
+}
+
+func TestKafkaClientSchemaRegistry(t *testing.T) {
+	fake, url := startFakeSchemaRegistry(t)
+
+	cfg := config.MustNewConfigFrom(mapstr.M{
+		"hosts":               []string{"localhost:9092"},
+		"topic":               "logs",
+		"codec.avro.schema":   `{"type":"record","name":"R","fields":[{"name":"message","type":"string"}]}`,
+		"schema_registry.url": url,
+	})
+	info := beat.Info{Beat: "libbeat", IndexPrefix: "testbeat", Logger: logptest.NewTestingLogger(t, "")}
+	group, err := makeKafka(nil, info, nil, cfg)
+	require.NoError(t, err)
+
+	client, ok := group.Clients[0].(*client)
+	require.True(t, ok)
+	require.NotNil(t, client.registry)
+
+	event := &publisher.Event{Content: beat.Event{Fields: mapstr.M{"message": "hi"}}}
+	msg, err := client.getEventMessage(context.Background(), event)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 42, 0x04, 'h', 'i'}, msg.value)
+
+	// registry failures are reported as retryable errors
+	fake.mu.Lock()
+	fake.failing = true
+	fake.mu.Unlock()
+	client.topic, err = outil.BuildSelectorFromConfig(config.MustNewConfigFrom(mapstr.M{"topic": "other"}), outil.Settings{
+		Key:              "topic",
+		MultiKey:         "topics",
+		EnableSingleOnly: true,
+		FailEmpty:        true,
+	}, info.Logger)
+	require.NoError(t, err)
+
+	_, err = client.getEventMessage(context.Background(), &publisher.Event{Content: beat.Event{Fields: mapstr.M{"message": "hi"}}})
+	var registryErr *schemaRegistryError
+	assert.ErrorAs(t, err, &registryErr)
+}
+
+// TestKafkaClientSchemaRegistryAndProducerErrors checks that events failing
+// in the schema registry and in the producer can be reported for the same
+// batch at the same time. Run with -race.
+func TestKafkaClientSchemaRegistryAndProducerErrors(t *testing.T) {
+	fake, url := startFakeSchemaRegistry(t)
+	fake.subjects["good-value"] = 1
+
+	cfg := config.MustNewConfigFrom(mapstr.M{
+		"hosts":                         []string{"localhost:9092"},
+		"topic":                         "%{[topic]}",
+		"codec.avro.schema":             `{"type":"record","name":"R","fields":[{"name":"message","type":"string"}]}`,
+		"schema_registry.url":           url,
+		"schema_registry.auto_register": false,
+	})
+	info := beat.Info{Beat: "libbeat", IndexPrefix: "testbeat", Logger: logptest.NewTestingLogger(t, "")}
+	group, err := makeKafka(nil, info, outputs.NewNilObserver(), cfg)
+	require.NoError(t, err)
+	c, ok := group.Clients[0].(*client)
+	require.True(t, ok)
+
+	producer := mocks.NewAsyncProducer(t, &c.config)
+	c.producer = producer
+	c.wg.Add(2)
+	go c.successWorker(producer.Successes())
+	go c.errorWorker(producer.Errors())
+	t.Cleanup(func() { c.Close() })
+
+	// Events for the "good" topic are sent and fail in the producer, events
+	// for the "bad" topic fail in the schema registry.
+	var events []beat.Event
+	for i := 0; i < 10; i++ {
+		producer.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+		events = append(events,
+			beat.Event{Fields: mapstr.M{"topic": "good", "message": "sent"}},
+			beat.Event{Fields: mapstr.M{"topic": "bad", "message": "not sent"}},
+		)
+	}
+
+	batch := outest.NewBatch(events...)
+	signals := make(chan outest.BatchSignal, 1)
+	batch.OnSignal = func(sig outest.BatchSignal) {
+		signals <- sig
+	}
+	require.NoError(t, c.Publish(context.Background(), batch))
+
+	select {
+	case sig := <-signals:
+		assert.Equal(t, outest.BatchRetryEvents, sig.Tag)
+		assert.Len(t, sig.Events, len(events))
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for the batch to be finished")
+	}
+}
+
+func TestKafkaSchemaRegistryRequiresSchemaCodec(t *testing.T) {
+	cfg := config.MustNewConfigFrom(mapstr.M{
+		"hosts":               []string{"localhost:9092"},
+		"topic":               "logs",
+		"schema_registry.url": "http://localhost:8081",
+	})
+	info := beat.Info{Beat: "libbeat", Logger: logptest.NewTestingLogger(t, "")}
+	_, err := makeKafka(nil, info, nil, cfg)
+	assert.ErrorContains(t, err, "schema_registry requires a codec with a schema")
+}
@@ -78,6 +78,8 @@ type Stats struct {
 	readErrors *monitoring.Uint // total number of errors while waiting for response on output
 
 	sendLatencyMillis metrics.Sample
+
+	reg *monitoring.Registry
 }
 
 // NewStats creates a new Stats instance using a backing monitoring registry.
@@ -104,11 +106,27 @@ func NewStats(reg *monitoring.Registry) *Stats {
 		readErrors: monitoring.NewUint(reg, "read.errors"),
 
 		sendLatencyMillis: metrics.NewUniformSample(1024),
+
+		reg: reg,
 	}
 	_ = adapter.NewGoMetrics(reg, "write.latency", adapter.Accept).Register("histogram", metrics.NewHistogram(obj.sendLatencyMillis))
 	return obj
 }
 
+// Named returns the Stats of a named sub-output, registered under
+// "outputs.<name>" in the registry backing s. It is used by outputs
+// forwarding events to other outputs, so each of them reports its own
+// metrics.
+func (s *Stats) Named(name string) *Stats {
+	return NewStats(s.reg.GetOrCreateRegistry("outputs." + name))
+}
+
+// Registry returns the registry the metrics of s are reported in. Outputs can
+// use it to register metrics of their own.
+func (s *Stats) Registry() *monitoring.Registry {
+	return s.reg
+}
+
 // NewBatch updates active batch and event metrics.
 func (s *Stats) NewBatch(n int) {
 	if s != nil {
@@ -0,0 +1,116 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+type client struct {
+	log      *logp.Logger
+	observer outputs.Observer
+	info     beat.Info
+	host     string
+	exporter exporter
+}
+
+func newClient(info beat.Info, observer outputs.Observer, host string, exp exporter) *client {
+	return &client{
+		log:      info.Logger.Named("otlp"),
+		observer: observer,
+		info:     info,
+		host:     host,
+		exporter: exp,
+	}
+}
+
+func (c *client) Connect(ctx context.Context) error {
+	c.log.Debugf("connect to OTLP endpoint %v", c.host)
+	return c.exporter.connect(ctx)
+}
+
+func (c *client) Close() error {
+	return c.exporter.close()
+}
+
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+	if len(events) == 0 {
+		batch.ACK()
+		return nil
+	}
+
+	req := plogotlp.NewExportRequestFromLogs(newLogs(c.info, events, c.log))
+
+	begin := time.Now()
+	resp, err := c.exporter.export(ctx, req)
+	c.observer.ReportLatency(time.Since(begin))
+	if errors.Is(err, errInvalidResponse) {
+		// The collector accepted the events, sending them again would
+		// duplicate them. Only partial successes are unknown.
+		c.log.Warnf("Failed to decode the response of %v, assuming all %d events were accepted: %v",
+			c.host, len(events), err)
+		batch.ACK()
+		c.observer.AckedEvents(len(events))
+		return nil
+	}
+	if err != nil {
+		if !isRetryable(err) {
+			// The collector refused the data, sending it again won't help.
+			c.log.Errorf("Dropping %d events rejected by %v: %v", len(events), c.host, err)
+			c.observer.PermanentErrors(len(events))
+			batch.Drop()
+			return nil
+		}
+
+		if isThrottled(err) {
+			c.observer.ErrTooMany(len(events))
+		}
+		c.observer.RetryableErrors(len(events))
+		batch.Retry()
+		return err
+	}
+
+	rejected := int(resp.PartialSuccess().RejectedLogRecords())
+	if rejected > len(events) {
+		rejected = len(events)
+	}
+	if rejected > 0 {
+		c.log.Warnf("%d of %d events rejected by %v: %v",
+			rejected, len(events), c.host, resp.PartialSuccess().ErrorMessage())
+		c.observer.PermanentErrors(rejected)
+	}
+
+	batch.ACK()
+	c.observer.AckedEvents(len(events) - rejected)
+	return nil
+}
+
+func (c *client) String() string {
+	return "otlp(" + c.host + ")"
+}
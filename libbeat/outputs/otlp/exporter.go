@@ -0,0 +1,251 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+// exporter sends OTLP export requests to a single collector endpoint.
+type exporter interface {
+	connect(ctx context.Context) error
+	export(ctx context.Context, req plogotlp.ExportRequest) (plogotlp.ExportResponse, error)
+	close() error
+}
+
+// exportError is returned by an exporter if the collector did not accept an
+// export request. Retryable errors are worth sending again later, while
+// non-retryable errors indicate that the collector refused the data.
+type exportError struct {
+	err       error
+	retryable bool
+	throttled bool
+}
+
+// errInvalidResponse is returned by an exporter if the collector accepted an
+// export request, but its response could not be decoded.
+var errInvalidResponse = errors.New("invalid export response")
+
+func (e *exportError) Error() string { return e.err.Error() }
+func (e *exportError) Unwrap() error { return e.err }
+
+// isRetryable reports whether the export might succeed if it is retried.
+// Errors not originating from the collector (e.g. connection failures) are
+// always retryable.
+func isRetryable(err error) bool {
+	var exportErr *exportError
+	if errors.As(err, &exportErr) {
+		return exportErr.retryable
+	}
+	return true
+}
+
+func isThrottled(err error) bool {
+	var exportErr *exportError
+	return errors.As(err, &exportErr) && exportErr.throttled
+}
+
+type grpcExporter struct {
+	target  string
+	tls     *tls.Config
+	headers metadata.MD
+	timeout time.Duration
+
+	conn   *grpc.ClientConn
+	client plogotlp.GRPCClient
+}
+
+func newGRPCExporter(target string, tlsConfig *tls.Config, headers map[string]string, timeout time.Duration) *grpcExporter {
+	return &grpcExporter{
+		target:  target,
+		tls:     tlsConfig,
+		headers: metadata.New(headers),
+		timeout: timeout,
+	}
+}
+
+func (e *grpcExporter) connect(_ context.Context) error {
+	creds := insecure.NewCredentials()
+	if e.tls != nil {
+		creds = credentials.NewTLS(e.tls)
+	}
+
+	conn, err := grpc.NewClient(e.target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("failed to create gRPC connection to %v: %w", e.target, err)
+	}
+	e.conn = conn
+	e.client = plogotlp.NewGRPCClient(conn)
+	return nil
+}
+
+func (e *grpcExporter) export(ctx context.Context, req plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	if e.client == nil {
+		return plogotlp.ExportResponse{}, errors.New("gRPC connection not established")
+	}
+
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+	if len(e.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, e.headers)
+	}
+
+	resp, err := e.client.Export(ctx, req)
+	if err != nil {
+		return resp, grpcExportError(err)
+	}
+	return resp, nil
+}
+
+func (e *grpcExporter) close() error {
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn, e.client = nil, nil
+	return err
+}
+
+// grpcExportError classifies gRPC errors as recommended by the OTLP
+// specification.
+func grpcExportError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	switch st.Code() {
+	case codes.ResourceExhausted:
+		return &exportError{err: err, retryable: true, throttled: true}
+	case codes.Canceled, codes.DeadlineExceeded, codes.Aborted,
+		codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+		return &exportError{err: err, retryable: true}
+	default:
+		return &exportError{err: err}
+	}
+}
+
+type httpExporter struct {
+	url       string
+	headers   map[string]string
+	userAgent string
+	transport httpcommon.HTTPTransportSettings
+
+	client *http.Client
+}
+
+func newHTTPExporter(url string, headers map[string]string, userAgent string, transport httpcommon.HTTPTransportSettings) *httpExporter {
+	return &httpExporter{
+		url:       url,
+		headers:   headers,
+		userAgent: userAgent,
+		transport: transport,
+	}
+}
+
+func (e *httpExporter) connect(_ context.Context) error {
+	client, err := e.transport.Client()
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP client for %v: %w", e.url, err)
+	}
+	e.client = client
+	return nil
+}
+
+func (e *httpExporter) export(ctx context.Context, req plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	resp := plogotlp.NewExportResponse()
+	if e.client == nil {
+		return resp, errors.New("HTTP client not initialized")
+	}
+
+	body, err := req.MarshalProto()
+	if err != nil {
+		return resp, &exportError{err: fmt.Errorf("failed to encode export request: %w", err)}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return resp, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	if e.userAgent != "" {
+		httpReq.Header.Set("User-Agent", e.userAgent)
+	}
+	for k, v := range e.headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	httpResp, err := e.client.Do(httpReq)
+	if err != nil {
+		return resp, err
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return resp, fmt.Errorf("failed to read response from %v: %w", e.url, err)
+	}
+
+	switch code := httpResp.StatusCode; {
+	case code >= 200 && code < 300:
+		if len(respBody) > 0 && httpResp.Header.Get("Content-Type") == "application/x-protobuf" {
+			if err := resp.UnmarshalProto(respBody); err != nil {
+				return resp, fmt.Errorf("%w: %w", errInvalidResponse, err)
+			}
+		}
+		return resp, nil
+	case code == http.StatusTooManyRequests:
+		return resp, &exportError{err: httpStatusError(code), retryable: true, throttled: true}
+	case code == http.StatusBadGateway, code == http.StatusServiceUnavailable, code == http.StatusGatewayTimeout:
+		return resp, &exportError{err: httpStatusError(code), retryable: true}
+	default:
+		return resp, &exportError{err: httpStatusError(code)}
+	}
+}
+
+func (e *httpExporter) close() error {
+	if e.client != nil {
+		e.client.CloseIdleConnections()
+		e.client = nil
+	}
+	return nil
+}
+
+func httpStatusError(code int) error {
+	return fmt.Errorf("collector responded with %d %v", code, http.StatusText(code))
+}
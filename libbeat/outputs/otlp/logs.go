@@ -0,0 +1,146 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/otelbeat/otelmap"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// docIDAttribute is the log record attribute holding the event's document ID,
+// as understood by the elasticsearchexporter.
+const docIDAttribute = "elasticsearch.document_id"
+
+// newLogs converts a list of events into OTLP logs. Every event is encoded as
+// a single log record, with all event fields stored as a map in the record body.
+// The beat information is reported as resource attributes.
+func newLogs(info beat.Info, events []publisher.Event, log *logp.Logger) plog.Logs {
+	logs := plog.NewLogs()
+	resourceLogs := logs.ResourceLogs().AppendEmpty()
+	setResourceAttributes(resourceLogs.Resource().Attributes(), info)
+
+	scopeLogs := resourceLogs.ScopeLogs().AppendEmpty()
+	scopeLogs.Scope().SetName(info.Beat)
+	scopeLogs.Scope().SetVersion(info.Version)
+
+	records := scopeLogs.LogRecords()
+	records.EnsureCapacity(len(events))
+	for i := range events {
+		appendLogRecord(records, &events[i].Content, log)
+	}
+	return logs
+}
+
+func setResourceAttributes(attrs pcommon.Map, info beat.Info) {
+	putNonEmpty := func(key, value string) {
+		if value != "" {
+			attrs.PutStr(key, value)
+		}
+	}
+	putNonEmpty("service.name", info.Beat)
+	putNonEmpty("service.version", info.Version)
+	putNonEmpty("service.instance.id", info.ID.String())
+	putNonEmpty("host.name", info.Hostname)
+}
+
+func appendLogRecord(records plog.LogRecordSlice, event *beat.Event, log *logp.Logger) {
+	record := records.AppendEmpty()
+
+	if id, ok := event.Meta["_id"].(string); ok {
+		record.Attributes().PutStr(docIDAttribute, id)
+	}
+
+	// The batch might be retried, so the event must not be modified in place.
+	// The conversion below modifies nested maps, including maps in slices
+	// that Clone shares with the event.
+	fields := deepCopy(event.Fields)
+	fields["@timestamp"] = event.Timestamp
+	record.SetTimestamp(pcommon.NewTimestampFromTime(event.Timestamp))
+
+	observed := record.Timestamp()
+	if created, err := fields.GetValue("event.created"); err == nil {
+		switch created := created.(type) {
+		case time.Time:
+			observed = pcommon.NewTimestampFromTime(created)
+		case common.Time:
+			observed = pcommon.NewTimestampFromTime(time.Time(created))
+		}
+	}
+	record.SetObservedTimestamp(observed)
+
+	otelmap.ConvertNonPrimitive(fields)
+
+	for _, key := range []string{"data_stream.type", "data_stream.dataset", "data_stream.namespace"} {
+		if value, err := fields.GetValue(key); err == nil {
+			if s, ok := value.(string); ok && s != "" {
+				record.Attributes().PutStr(key, s)
+			}
+		}
+	}
+
+	if err := record.Body().SetEmptyMap().FromRaw(map[string]any(fields)); err != nil {
+		log.Errorf("Failed to convert event to an OTLP log record, some fields might be missing: %v", err)
+	}
+}
+
+// deepCopy copies the maps and slices of maps of m that are modified when
+// converting it.
+func deepCopy(m mapstr.M) mapstr.M {
+	out := make(mapstr.M, len(m))
+	for k, v := range m {
+		out[k] = deepCopyValue(v)
+	}
+	return out
+}
+
+func deepCopyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case mapstr.M:
+		return deepCopy(v)
+	case map[string]interface{}:
+		return map[string]interface{}(deepCopy(v))
+	case []mapstr.M:
+		out := make([]mapstr.M, len(v))
+		for i, m := range v {
+			out[i] = deepCopy(m)
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]map[string]interface{}, len(v))
+		for i, m := range v {
+			out[i] = deepCopy(m)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, elem := range v {
+			out[i] = deepCopyValue(elem)
+		}
+		return out
+	}
+	return v
+}
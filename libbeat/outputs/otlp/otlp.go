@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+const (
+	defaultGRPCPort = 4317
+	defaultHTTPPort = 4318
+)
+
+func init() {
+	outputs.RegisterType("otlp", makeOTLP)
+}
+
+func makeOTLP(
+	_ outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *config.C,
+) (outputs.Group, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return outputs.Fail(err)
+	}
+
+	hosts, err := outputs.ReadHostList(cfg)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	tlsConfig, err := tlscommon.LoadTLSConfig(config.Transport.TLS)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	clients := make([]outputs.NetworkClient, len(hosts))
+	for i, host := range hosts {
+		var exp exporter
+		switch config.Protocol {
+		case protocolGRPC:
+			exp, err = makeGRPCExporter(host, tlsConfig, &config)
+		case protocolHTTP:
+			exp, err = makeHTTPExporter(host, tlsConfig, beat.UserAgent, &config)
+		}
+		if err != nil {
+			return outputs.Fail(err)
+		}
+
+		client := newClient(beat, observer, host, exp)
+		clients[i] = outputs.WithBackoff(client, config.Backoff.Init, config.Backoff.Max)
+	}
+
+	return outputs.SuccessNet(config.Queue, config.LoadBalance, config.BulkMaxSize, config.MaxRetries, nil, beat.Logger, clients)
+}
+
+func makeGRPCExporter(host string, tlsConfig *tlscommon.TLSConfig, config *otlpConfig) (exporter, error) {
+	rawURL, err := common.MakeURL(defaultScheme(tlsConfig), "", host, defaultGRPCPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid otlp host '%v': %w", host, err)
+	}
+	hostURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid otlp host '%v': %w", host, err)
+	}
+
+	var clientTLS *tls.Config
+	if hostURL.Scheme == "https" {
+		if tlsConfig == nil {
+			// enable TLS with system defaults if the https scheme is used
+			tlsConfig = &tlscommon.TLSConfig{}
+		}
+		clientTLS = tlsConfig.BuildModuleClientConfig(hostURL.Hostname())
+	}
+
+	return newGRPCExporter(hostURL.Host, clientTLS, config.Headers, config.Transport.Timeout), nil
+}
+
+func makeHTTPExporter(host string, tlsConfig *tlscommon.TLSConfig, userAgent string, config *otlpConfig) (exporter, error) {
+	endpoint, err := common.MakeURL(defaultScheme(tlsConfig), config.Path, host, defaultHTTPPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid otlp host '%v': %w", host, err)
+	}
+	return newHTTPExporter(endpoint, config.Headers, userAgent, config.Transport), nil
+}
+
+func defaultScheme(tlsConfig *tlscommon.TLSConfig) string {
+	if tlsConfig != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,393 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// testCollector is a minimal OTLP logs collector recording all received
+// requests. The respond function decides about the outcome of every export.
+type testCollector struct {
+	plogotlp.UnimplementedGRPCServer
+
+	mu       sync.Mutex
+	logs     []plog.Logs
+	metadata []metadata.MD
+	respond  func() (plogotlp.ExportResponse, error)
+}
+
+func (c *testCollector) Export(ctx context.Context, req plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	c.metadata = append(c.metadata, md)
+
+	logs := plog.NewLogs()
+	req.Logs().CopyTo(logs)
+	c.logs = append(c.logs, logs)
+
+	if c.respond != nil {
+		return c.respond()
+	}
+	return plogotlp.NewExportResponse(), nil
+}
+
+func (c *testCollector) received() []plog.Logs {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.logs
+}
+
+func startGRPCCollector(t *testing.T, collector *testCollector) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := grpc.NewServer()
+	plogotlp.RegisterGRPCServer(srv, collector)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String()
+}
+
+func startHTTPCollector(t *testing.T, collector *testCollector, status int) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, defaultHTTPPath, r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		req := plogotlp.NewExportRequest()
+		require.NoError(t, req.UnmarshalProto(body))
+		resp, err := collector.Export(metadata.NewIncomingContext(r.Context(), metadata.MD{}), req)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		require.NoError(t, err)
+
+		raw, err := resp.MarshalProto()
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = w.Write(raw)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL
+}
+
+func makeTestClient(t *testing.T, settings map[string]interface{}) outputs.NetworkClient {
+	cfg := config.MustNewConfigFrom(settings)
+	require.NoError(t, cfg.Merge(map[string]interface{}{"backoff.init": "1ms", "backoff.max": "1ms"}))
+	info := beat.Info{Beat: "testbeat", Version: "9.9.9", Hostname: "testhost", Logger: logptest.NewTestingLogger(t, "")}
+
+	group, err := makeOTLP(nil, info, outputs.NewNilObserver(), cfg)
+	require.NoError(t, err)
+	require.Len(t, group.Clients, 1)
+
+	client, ok := group.Clients[0].(outputs.NetworkClient)
+	require.True(t, ok, "expected a network client, got %T", group.Clients[0])
+	require.NoError(t, client.Connect(context.Background()))
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func testEvents() []beat.Event {
+	ts := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	return []beat.Event{
+		{
+			Timestamp: ts,
+			Meta:      mapstr.M{"_id": "abc"},
+			Fields: mapstr.M{
+				"message":     "first",
+				"data_stream": mapstr.M{"type": "logs", "dataset": "generic", "namespace": "default"},
+			},
+		},
+		{
+			Timestamp: ts.Add(time.Second),
+			Fields:    mapstr.M{"message": "second", "tags": []string{"a", "b"}},
+		},
+	}
+}
+
+func publish(t *testing.T, client outputs.Client, events ...beat.Event) (*outest.Batch, error) {
+	batch := outest.NewBatch(events...)
+	err := client.Publish(context.Background(), batch)
+	require.Len(t, batch.Signals, 1)
+	return batch, err
+}
+
+func TestMakeOTLP(t *testing.T) {
+	tests := map[string]struct {
+		config  map[string]interface{}
+		clients int
+		wantErr bool
+	}{
+		"default grpc": {
+			config:  map[string]interface{}{"hosts": []string{"localhost"}},
+			clients: 1,
+		},
+		"http with workers": {
+			config:  map[string]interface{}{"hosts": []string{"localhost:4318"}, "protocol": "http", "worker": 2},
+			clients: 2,
+		},
+		"invalid protocol": {
+			config:  map[string]interface{}{"hosts": []string{"localhost"}, "protocol": "thrift"},
+			wantErr: true,
+		},
+		"no hosts": {
+			config:  map[string]interface{}{},
+			wantErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.MustNewConfigFrom(test.config)
+			info := beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")}
+			group, err := makeOTLP(nil, info, outputs.NewNilObserver(), cfg)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, group.Clients, test.clients)
+		})
+	}
+}
+
+func TestPublishGRPC(t *testing.T) {
+	collector := &testCollector{}
+	addr := startGRPCCollector(t, collector)
+	client := makeTestClient(t, map[string]interface{}{
+		"hosts":   []string{addr},
+		"headers": map[string]string{"x-tenant": "beats"},
+	})
+
+	batch, err := publish(t, client, testEvents()...)
+	require.NoError(t, err)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	received := collector.received()
+	require.Len(t, received, 1)
+	assert.Equal(t, []string{"beats"}, collector.metadata[0].Get("x-tenant"))
+
+	resource := received[0].ResourceLogs().At(0)
+	serviceName, ok := resource.Resource().Attributes().Get("service.name")
+	require.True(t, ok)
+	assert.Equal(t, "testbeat", serviceName.Str())
+
+	records := resource.ScopeLogs().At(0).LogRecords()
+	require.Equal(t, 2, records.Len())
+
+	first := records.At(0)
+	assert.Equal(t, testEvents()[0].Timestamp, first.Timestamp().AsTime())
+	docID, ok := first.Attributes().Get(docIDAttribute)
+	require.True(t, ok)
+	assert.Equal(t, "abc", docID.Str())
+	dataset, ok := first.Attributes().Get("data_stream.dataset")
+	require.True(t, ok)
+	assert.Equal(t, "generic", dataset.Str())
+
+	body := first.Body().Map().AsRaw()
+	assert.Equal(t, "first", body["message"])
+	assert.Equal(t, "2025-03-04T05:06:07.000Z", body["@timestamp"])
+
+	second := records.At(1).Body().Map().AsRaw()
+	assert.Equal(t, []any{"a", "b"}, second["tags"])
+}
+
+func TestPublishGRPCErrors(t *testing.T) {
+	tests := map[string]struct {
+		code codes.Code
+		want outest.BatchSignalTag
+	}{
+		"unavailable is retried":        {code: codes.Unavailable, want: outest.BatchRetry},
+		"resource exhausted is retried": {code: codes.ResourceExhausted, want: outest.BatchRetry},
+		"invalid argument is dropped":   {code: codes.InvalidArgument, want: outest.BatchDrop},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			collector := &testCollector{
+				respond: func() (plogotlp.ExportResponse, error) {
+					return plogotlp.NewExportResponse(), status.Error(test.code, "test failure")
+				},
+			}
+			addr := startGRPCCollector(t, collector)
+			client := makeTestClient(t, map[string]interface{}{"hosts": []string{addr}})
+
+			batch, err := publish(t, client, testEvents()...)
+			assert.Equal(t, test.want, batch.Signals[0].Tag)
+			if test.want == outest.BatchRetry {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPublishHTTP(t *testing.T) {
+	tests := map[string]struct {
+		status int
+		want   outest.BatchSignalTag
+	}{
+		"ok":                {status: http.StatusOK, want: outest.BatchACK},
+		"too many requests": {status: http.StatusTooManyRequests, want: outest.BatchRetry},
+		"unavailable":       {status: http.StatusServiceUnavailable, want: outest.BatchRetry},
+		"bad request":       {status: http.StatusBadRequest, want: outest.BatchDrop},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			collector := &testCollector{}
+			url := startHTTPCollector(t, collector, test.status)
+			client := makeTestClient(t, map[string]interface{}{
+				"hosts":    []string{url},
+				"protocol": "http",
+			})
+
+			batch, _ := publish(t, client, testEvents()...)
+			assert.Equal(t, test.want, batch.Signals[0].Tag)
+
+			received := collector.received()
+			require.Len(t, received, 1)
+			assert.Equal(t, 2, received[0].LogRecordCount())
+		})
+	}
+}
+
+func TestPublishPartialSuccess(t *testing.T) {
+	collector := &testCollector{
+		respond: func() (plogotlp.ExportResponse, error) {
+			resp := plogotlp.NewExportResponse()
+			resp.PartialSuccess().SetRejectedLogRecords(1)
+			resp.PartialSuccess().SetErrorMessage("invalid record")
+			return resp, nil
+		},
+	}
+	url := startHTTPCollector(t, collector, http.StatusOK)
+
+	cfg := config.MustNewConfigFrom(map[string]interface{}{"hosts": []string{url}, "protocol": "http"})
+	info := beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")}
+	exp, err := makeHTTPExporter(url, nil, "", mustUnpack(t, cfg))
+	require.NoError(t, err)
+
+	observer := &countingObserver{Observer: outputs.NewNilObserver()}
+	client := newClient(info, observer, url, exp)
+	require.NoError(t, client.Connect(context.Background()))
+	defer client.Close()
+
+	batch, err := publish(t, client, testEvents()...)
+	require.NoError(t, err)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	assert.Equal(t, 1, observer.acked)
+	assert.Equal(t, 1, observer.permanent)
+}
+
+func mustUnpack(t *testing.T, cfg *config.C) *otlpConfig {
+	config := defaultConfig()
+	require.NoError(t, cfg.Unpack(&config))
+	return &config
+}
+
+type countingObserver struct {
+	outputs.Observer
+	acked     int
+	permanent int
+}
+
+func (o *countingObserver) AckedEvents(n int)     { o.acked += n }
+func (o *countingObserver) PermanentErrors(n int) { o.permanent += n }
+
+func TestPublishInvalidResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = w.Write([]byte{0xff, 0xff, 0xff})
+	}))
+	defer srv.Close()
+
+	cfg := config.MustNewConfigFrom(map[string]interface{}{"hosts": []string{srv.URL}, "protocol": "http"})
+	info := beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")}
+	exp, err := makeHTTPExporter(srv.URL, nil, "", mustUnpack(t, cfg))
+	require.NoError(t, err)
+
+	observer := &countingObserver{Observer: outputs.NewNilObserver()}
+	client := newClient(info, observer, srv.URL, exp)
+	require.NoError(t, client.Connect(context.Background()))
+	defer client.Close()
+
+	// The collector accepted the events, they must not be sent again.
+	batch, err := publish(t, client, testEvents()...)
+	require.NoError(t, err)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	assert.Equal(t, 2, observer.acked)
+}
+
+func TestNewLogsDoesNotModifyEvents(t *testing.T) {
+	ts := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	fields := func() mapstr.M {
+		return mapstr.M{
+			"list":  []mapstr.M{{"time": ts, "nested": mapstr.M{"a": 1}}},
+			"maps":  []map[string]interface{}{{"time": ts}},
+			"mixed": []interface{}{mapstr.M{"time": ts}},
+		}
+	}
+	event := beat.Event{Timestamp: ts, Fields: fields()}
+	want := fields()
+	events := []publisher.Event{{Content: event}}
+
+	info := beat.Info{Beat: "testbeat"}
+	first := newLogs(info, events, logptest.NewTestingLogger(t, ""))
+	assert.Equal(t, want, event.Fields)
+
+	// Converting the event again, as when the batch is retried, gives the
+	// same result.
+	second := newLogs(info, events, logptest.NewTestingLogger(t, ""))
+	assert.Equal(t,
+		first.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Body().AsRaw(),
+		second.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Body().AsRaw())
+}
@@ -75,6 +75,12 @@ type Group struct {
 	//   and clear Content anyway. Metadata about the error should be saved in
 	//   EncodedEvent and reported when Publish is called.
 	EncoderFactory queue.EncoderFactory
+
+	// If the output adjusts its batch size at runtime, it can provide a
+	// BatchSizer returning the size of the next batch. The pipeline then
+	// calls it each time it reads a batch from the queue, instead of using
+	// BatchSize.
+	BatchSizer func() int
 }
 
 // RegisterType registers a new output type.
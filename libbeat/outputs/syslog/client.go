@@ -0,0 +1,181 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package syslog
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport"
+)
+
+// client sends events to a syslog server. Over UDP every message is sent in
+// its own datagram, over TCP the messages of a batch are framed and written
+// at once.
+type client struct {
+	*transport.Client
+	log       *logp.Logger
+	observer  outputs.Observer
+	protocol  string
+	framing   string
+	timeout   time.Duration
+	formatter *formatter
+}
+
+func newClient(
+	conn *transport.Client,
+	log *logp.Logger,
+	observer outputs.Observer,
+	formatter *formatter,
+	c *syslogConfig,
+) *client {
+	return &client{
+		Client:    conn,
+		log:       log,
+		observer:  observer,
+		protocol:  c.Protocol,
+		framing:   c.Framing,
+		timeout:   c.Timeout,
+		formatter: formatter,
+	}
+}
+
+func (c *client) Connect(ctx context.Context) error {
+	return c.Client.ConnectContext(ctx)
+}
+
+func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	// Messages and the index of the event they were created from.
+	messages := make([][]byte, 0, len(events))
+	indexes := make([]int, 0, len(events))
+	dropped := 0
+	for i := range events {
+		msg, err := c.formatter.encode(&events[i].Content)
+		if err != nil {
+			if events[i].Guaranteed() {
+				c.log.Errorf("Failed to encode the event: %+v", err)
+			} else {
+				c.log.Warnf("Failed to encode the event: %+v", err)
+			}
+			dropped++
+			continue
+		}
+		messages = append(messages, msg)
+		indexes = append(indexes, i)
+	}
+	if dropped > 0 {
+		c.observer.PermanentErrors(dropped)
+	}
+
+	sent, err := c.send(messages)
+	if err != nil {
+		// Events that failed to encode are not retried.
+		var retry []publisher.Event
+		for _, i := range indexes[sent:] {
+			retry = append(retry, events[i])
+		}
+		c.observer.AckedEvents(sent)
+		c.observer.RetryableErrors(len(retry))
+		batch.RetryEvents(retry)
+
+		// Close the connection so that it is established again before the
+		// next batch is published.
+		_ = c.Client.Close()
+		return err
+	}
+
+	c.observer.AckedEvents(len(messages))
+	batch.ACK()
+	return nil
+}
+
+// send writes the messages, returning the number of messages written before
+// an error occurred.
+func (c *client) send(messages [][]byte) (int, error) {
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	if c.timeout > 0 {
+		if err := c.Client.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+			return 0, err
+		}
+	}
+
+	begin := time.Now()
+	defer func() { c.observer.ReportLatency(time.Since(begin)) }()
+
+	written := 0
+	defer func() { c.observer.WriteBytes(written) }()
+
+	if c.protocol == protocolUDP {
+		for i, msg := range messages {
+			n, err := c.Client.Write(msg)
+			written += n
+			if err != nil {
+				c.observer.WriteError(err)
+				return i, err
+			}
+		}
+		return len(messages), nil
+	}
+
+	var buf bytes.Buffer
+	for _, msg := range messages {
+		c.frame(&buf, msg)
+	}
+	n, err := c.Client.Write(buf.Bytes())
+	written += n
+	if err != nil {
+		c.observer.WriteError(err)
+		return 0, err
+	}
+	return len(messages), nil
+}
+
+// frame appends a message to buf, framed as configured for TCP.
+func (c *client) frame(buf *bytes.Buffer, msg []byte) {
+	if c.framing == framingOctetCounting {
+		buf.WriteString(strconv.Itoa(len(msg)))
+		buf.WriteByte(' ')
+		buf.Write(msg)
+		return
+	}
+
+	// The message can't contain the trailer used to delimit messages.
+	msg = bytes.TrimRight(msg, "\n")
+	for _, b := range msg {
+		if b == '\n' {
+			b = ' '
+		}
+		buf.WriteByte(b)
+	}
+	buf.WriteByte('\n')
+}
+
+func (c *client) String() string {
+	return "syslog(" + c.Client.String() + ")"
+}
@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package syslog
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	syslogreader "github.com/elastic/beats/v7/libbeat/reader/syslog"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+const (
+	protocolTCP = "tcp"
+	protocolUDP = "udp"
+
+	// framingOctetCounting prefixes every message with its length, as
+	// described in RFC 6587 section 3.4.1.
+	framingOctetCounting = "octet_counting"
+	// framingNonTransparent terminates every message with a newline, as
+	// described in RFC 6587 section 3.4.2.
+	framingNonTransparent = "non_transparent"
+)
+
+type syslogConfig struct {
+	Protocol    string                    `config:"protocol"`
+	Format      syslogreader.Format       `config:"format"`
+	Framing     string                    `config:"framing"`
+	Facility    *fmtstr.EventFormatString `config:"facility"`
+	Severity    *fmtstr.EventFormatString `config:"severity"`
+	AppName     *fmtstr.EventFormatString `config:"appname"`
+	Hostname    *fmtstr.EventFormatString `config:"hostname"`
+	ProcID      *fmtstr.EventFormatString `config:"procid"`
+	MsgID       *fmtstr.EventFormatString `config:"msgid"`
+	Codec       codec.Config              `config:"codec"`
+	TLS         *tlscommon.Config         `config:"ssl"`
+	Timeout     time.Duration             `config:"timeout"`
+	LoadBalance bool                      `config:"loadbalance"`
+	BulkMaxSize int                       `config:"bulk_max_size"`
+	MaxRetries  int                       `config:"max_retries"`
+	Backoff     backoff                   `config:"backoff"`
+	Queue       config.Namespace          `config:"queue"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+func defaultConfig() syslogConfig {
+	return syslogConfig{
+		Protocol:    protocolTCP,
+		Format:      syslogreader.FormatRFC5424,
+		Framing:     framingOctetCounting,
+		Facility:    fmtstr.MustCompileEvent("%{[log.syslog.facility.code]:user}"),
+		Severity:    fmtstr.MustCompileEvent("%{[log.syslog.severity.code]:info}"),
+		AppName:     fmtstr.MustCompileEvent("%{[log.syslog.appname]}"),
+		Hostname:    fmtstr.MustCompileEvent("%{[host.name]}"),
+		ProcID:      fmtstr.MustCompileEvent("%{[log.syslog.procid]}"),
+		MsgID:       fmtstr.MustCompileEvent("%{[log.syslog.msgid]}"),
+		Timeout:     30 * time.Second,
+		LoadBalance: false,
+		BulkMaxSize: 2048,
+		MaxRetries:  3,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+	}
+}
+
+func (c *syslogConfig) Validate() error {
+	switch c.Protocol {
+	case protocolTCP:
+	case protocolUDP:
+		if c.TLS != nil && c.TLS.IsEnabled() {
+			return errors.New("ssl is not supported with the udp protocol")
+		}
+	default:
+		return fmt.Errorf("unsupported protocol '%v', must be one of %q or %q", c.Protocol, protocolTCP, protocolUDP)
+	}
+
+	if c.Format == syslogreader.FormatAuto {
+		return errors.New("format must be one of \"rfc3164\" or \"rfc5424\"")
+	}
+
+	switch c.Framing {
+	case framingOctetCounting, framingNonTransparent:
+	default:
+		return fmt.Errorf("unsupported framing '%v', must be one of %q or %q", c.Framing, framingOctetCounting, framingNonTransparent)
+	}
+
+	if c.Facility == nil || c.Severity == nil {
+		return errors.New("facility and severity must not be empty")
+	}
+	if c.BulkMaxSize <= 0 {
+		return fmt.Errorf("bulk_max_size must be greater than 0, got %d", c.BulkMaxSize)
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	syslogreader "github.com/elastic/beats/v7/libbeat/reader/syslog"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const (
+	nilValue = "-"
+
+	// Facility and severity used when the configured values can not be
+	// mapped to a code.
+	defaultFacility = 1 // user-level
+	defaultSeverity = 6 // informational
+
+	// Maximum lengths of the header fields of RFC 5424.
+	maxHostnameLen = 255
+	maxAppNameLen  = 48
+	maxProcIDLen   = 128
+	maxMsgIDLen    = 32
+	maxSDNameLen   = 32
+
+	// Maximum length of the tag of RFC 3164.
+	maxTagLen = 32
+
+	// rfc5424Timestamp is RFC 3339 limited to microseconds, as required by
+	// RFC 5424.
+	rfc5424Timestamp = "2006-01-02T15:04:05.999999Z07:00"
+	rfc3164Timestamp = time.Stamp
+)
+
+// formatter turns events into syslog messages, taking the header fields
+// from the configured format strings and the message from the codec.
+type formatter struct {
+	log      *logp.Logger
+	format   syslogreader.Format
+	index    string
+	codec    codec.Codec
+	location *time.Location
+
+	facility *fmtstr.EventFormatString
+	severity *fmtstr.EventFormatString
+	appName  *fmtstr.EventFormatString
+	hostname *fmtstr.EventFormatString
+	procID   *fmtstr.EventFormatString
+	msgID    *fmtstr.EventFormatString
+
+	// Used when the format strings evaluate to an empty value.
+	defaultAppName  string
+	defaultHostname string
+}
+
+func newFormatter(log *logp.Logger, info beat.Info, enc codec.Codec, c *syslogConfig) *formatter {
+	return &formatter{
+		log:             log,
+		format:          c.Format,
+		index:           info.Beat,
+		codec:           enc,
+		location:        time.Local,
+		facility:        c.Facility,
+		severity:        c.Severity,
+		appName:         c.AppName,
+		hostname:        c.Hostname,
+		procID:          c.ProcID,
+		msgID:           c.MsgID,
+		defaultAppName:  info.Beat,
+		defaultHostname: info.Hostname,
+	}
+}
+
+// encode returns the syslog message of an event, without framing.
+func (f *formatter) encode(event *beat.Event) ([]byte, error) {
+	msg, err := f.codec.Encode(f.index, event)
+	if err != nil {
+		return nil, err
+	}
+
+	pri := syslogreader.Priority(
+		f.code(event, "facility", f.facility, syslogreader.FacilityCode, defaultFacility),
+		f.code(event, "severity", f.severity, syslogreader.SeverityCode, defaultSeverity),
+	)
+	hostname := f.render(event, f.hostname)
+	if hostname == "" {
+		hostname = f.defaultHostname
+	}
+	appName := f.render(event, f.appName)
+	if appName == "" {
+		appName = f.defaultAppName
+	}
+	procID := f.render(event, f.procID)
+
+	var buf bytes.Buffer
+	buf.WriteByte('<')
+	buf.WriteString(strconv.Itoa(pri))
+	buf.WriteByte('>')
+
+	if f.format == syslogreader.FormatRFC3164 {
+		// TIMESTAMP HOSTNAME TAG[PID]: MSG
+		buf.WriteString(event.Timestamp.In(f.location).Format(rfc3164Timestamp))
+		buf.WriteByte(' ')
+		buf.WriteString(headerValue(hostname, maxHostnameLen))
+		buf.WriteByte(' ')
+		buf.WriteString(tag(appName))
+		if procID != "" {
+			buf.WriteByte('[')
+			buf.WriteString(headerValue(procID, maxProcIDLen))
+			buf.WriteByte(']')
+		}
+		buf.WriteString(": ")
+		buf.Write(msg)
+		return buf.Bytes(), nil
+	}
+
+	// VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	buf.WriteString("1 ")
+	if event.Timestamp.IsZero() {
+		buf.WriteString(nilValue)
+	} else {
+		buf.WriteString(event.Timestamp.Format(rfc5424Timestamp))
+	}
+	for _, field := range []struct {
+		value  string
+		maxLen int
+	}{
+		{hostname, maxHostnameLen},
+		{appName, maxAppNameLen},
+		{procID, maxProcIDLen},
+		{f.render(event, f.msgID), maxMsgIDLen},
+	} {
+		buf.WriteByte(' ')
+		buf.WriteString(headerValue(field.value, field.maxLen))
+	}
+	buf.WriteByte(' ')
+	writeStructuredData(&buf, event)
+	if len(msg) > 0 {
+		buf.WriteByte(' ')
+		buf.Write(msg)
+	}
+	return buf.Bytes(), nil
+}
+
+// render evaluates a format string, returning an empty string if the fields
+// it references are missing.
+func (f *formatter) render(event *beat.Event, fs *fmtstr.EventFormatString) string {
+	if fs == nil {
+		return ""
+	}
+	s, err := fs.Run(event)
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+// code evaluates a facility or severity format string into its code.
+func (f *formatter) code(
+	event *beat.Event,
+	name string,
+	fs *fmtstr.EventFormatString,
+	lookup func(string) (int, bool),
+	fallback int,
+) int {
+	v := f.render(event, fs)
+	code, ok := lookup(v)
+	if !ok {
+		f.log.Debugf("Invalid %v %q, using %d", name, v, fallback)
+		return fallback
+	}
+	return code
+}
+
+// headerValue returns v as a header field: restricted to printable US-ASCII
+// without spaces and limited to maxLen characters, or the nil value if v is
+// empty.
+func headerValue(v string, maxLen int) string {
+	if v == "" {
+		return nilValue
+	}
+	if len(v) > maxLen {
+		v = v[:maxLen]
+	}
+	b := []byte(v)
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// tag returns the tag of an RFC 3164 message. RFC 3164 only allows
+// alphanumeric characters, but '-', '_', '.' and '/' are kept as well, as
+// they are common in program names like "postfix/smtpd". Other characters
+// are removed.
+func tag(v string) string {
+	b := make([]byte, 0, maxTagLen)
+	for i := 0; i < len(v) && len(b) < maxTagLen; i++ {
+		c := v[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '/':
+			b = append(b, c)
+		}
+	}
+	if len(b) == 0 {
+		return nilValue
+	}
+	return string(b)
+}
+
+// writeStructuredData writes the log.syslog.structured_data field of the
+// event, as parsed by the syslog reader, or the nil value if the event has
+// none.
+func writeStructuredData(buf *bytes.Buffer, event *beat.Event) {
+	v, _ := event.Fields.GetValue("log.syslog.structured_data")
+	elements := toMap(v)
+	if len(elements) == 0 {
+		buf.WriteString(nilValue)
+		return
+	}
+
+	for _, id := range sortedKeys(elements) {
+		buf.WriteByte('[')
+		buf.WriteString(sdName(id))
+		params := toMap(elements[id])
+		for _, name := range sortedKeys(params) {
+			buf.WriteByte(' ')
+			buf.WriteString(sdName(name))
+			buf.WriteString(`="`)
+			value := fmt.Sprint(params[name])
+			for i := 0; i < len(value); i++ {
+				// '"', '\' and ']' must be escaped in parameter values.
+				switch value[i] {
+				case '"', '\\', ']':
+					buf.WriteByte('\\')
+				}
+				buf.WriteByte(value[i])
+			}
+			buf.WriteByte('"')
+		}
+		buf.WriteByte(']')
+	}
+}
+
+// sdName returns v as the name of a structured data element or parameter,
+// which can't contain '=', ' ', ']' or '"'.
+func sdName(v string) string {
+	v = headerValue(v, maxSDNameLen)
+	b := []byte(v)
+	for i, c := range b {
+		switch c {
+		case '=', ']', '"':
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func toMap(v interface{}) map[string]interface{} {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m
+	case mapstr.M:
+		return m
+	case map[string]string:
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			out[k] = v
+		}
+		return out
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
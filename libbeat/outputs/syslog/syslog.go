@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package syslog
+
+import (
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/format"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+const (
+	defaultPort    = 514
+	defaultTLSPort = 6514
+)
+
+func init() {
+	outputs.RegisterType("syslog", makeSyslog)
+}
+
+func makeSyslog(
+	_ outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *config.C,
+) (outputs.Group, error) {
+	log := beat.Logger.Named("syslog")
+
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return outputs.Fail(err)
+	}
+
+	hosts, err := outputs.ReadHostList(cfg)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	tls, err := tlscommon.LoadTLSConfig(config.TLS)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+	port := defaultPort
+	if tls != nil {
+		port = defaultTLSPort
+	}
+
+	clients := make([]outputs.NetworkClient, len(hosts))
+	for i, host := range hosts {
+		// The client reports the bytes written and write errors itself, so
+		// the observer is not passed to the transport.
+		conn, err := transport.NewClient(transport.Config{
+			Timeout: config.Timeout,
+			TLS:     tls,
+		}, config.Protocol, host, port)
+		if err != nil {
+			return outputs.Fail(err)
+		}
+
+		// Unless a codec is configured, the message is the message field of
+		// the event.
+		var enc codec.Codec = format.New(fmtstr.MustCompileEvent("%{[message]}"))
+		if config.Codec.Namespace.IsSet() {
+			enc, err = codec.CreateEncoder(beat, config.Codec)
+			if err != nil {
+				return outputs.Fail(err)
+			}
+		}
+
+		client := newClient(conn, log, observer, newFormatter(log, beat, enc, &config), &config)
+		clients[i] = outputs.WithBackoff(client, config.Backoff.Init, config.Backoff.Max)
+	}
+
+	return outputs.SuccessNet(config.Queue, config.LoadBalance, config.BulkMaxSize, config.MaxRetries, nil, beat.Logger, clients)
+}
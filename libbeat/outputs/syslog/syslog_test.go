@@ -0,0 +1,390 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/common/transport/transptest"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/format"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+var testTime = time.Date(2025, 3, 4, 5, 6, 7, 123456789, time.UTC)
+
+func testInfo(t *testing.T) beat.Info {
+	return beat.Info{Beat: "testbeat", Hostname: "beathost", Logger: logptest.NewTestingLogger(t, "")}
+}
+
+func makeTestClient(t *testing.T, settings map[string]interface{}) outputs.NetworkClient {
+	return makeTestClientWithObserver(t, outputs.NewNilObserver(), settings)
+}
+
+func makeTestClientWithObserver(t *testing.T, observer outputs.Observer, settings map[string]interface{}) outputs.NetworkClient {
+	group, err := makeSyslog(nil, testInfo(t), observer, config.MustNewConfigFrom(settings))
+	require.NoError(t, err)
+	require.Len(t, group.Clients, 1)
+
+	client, ok := group.Clients[0].(outputs.NetworkClient)
+	require.True(t, ok)
+	require.NoError(t, client.Connect(context.Background()))
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func makeTestFormatter(t *testing.T, settings map[string]interface{}) *formatter {
+	cfg := defaultConfig()
+	require.NoError(t, config.MustNewConfigFrom(settings).Unpack(&cfg))
+
+	info := testInfo(t)
+	f := newFormatter(info.Logger, info, format.New(fmtstr.MustCompileEvent("%{[message]}")), &cfg)
+	f.location = time.UTC
+	return f
+}
+
+func testEvent(message string, fields mapstr.M) beat.Event {
+	event := beat.Event{Timestamp: testTime, Fields: mapstr.M{"message": message}}
+	event.Fields.DeepUpdate(fields)
+	return event
+}
+
+func TestConfigValidate(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"unknown protocol": {"protocol": "sctp"},
+		"udp with ssl":     {"protocol": "udp", "ssl.enabled": true},
+		"auto format":      {"format": "auto"},
+		"unknown framing":  {"framing": "lines"},
+		"no bulk size":     {"bulk_max_size": 0},
+	}
+
+	for name, settings := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaultConfig()
+			assert.Error(t, config.MustNewConfigFrom(settings).Unpack(&cfg))
+		})
+	}
+}
+
+func TestFormatRFC5424(t *testing.T) {
+	f := makeTestFormatter(t, map[string]interface{}{})
+
+	event := testEvent("connection accepted", mapstr.M{
+		"host": mapstr.M{"name": "web-1"},
+		"log": mapstr.M{"syslog": mapstr.M{
+			"appname":  "sshd",
+			"procid":   "4242",
+			"msgid":    "ID47",
+			"facility": mapstr.M{"code": 4},
+			"severity": mapstr.M{"code": 5},
+			"structured_data": map[string]interface{}{
+				"origin@32473": map[string]interface{}{"ip": "10.0.0.1", "note": `a "quoted" ]`},
+				"meta":         map[string]interface{}{"sequenceId": "1"},
+			},
+		}},
+	})
+	msg, err := f.encode(&event)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`<37>1 2025-03-04T05:06:07.123456Z web-1 sshd 4242 ID47 [meta sequenceId="1"][origin@32473 ip="10.0.0.1" note="a \"quoted\" \]"] connection accepted`,
+		string(msg))
+}
+
+func TestFormatRFC5424Defaults(t *testing.T) {
+	f := makeTestFormatter(t, map[string]interface{}{})
+
+	event := testEvent("hello", nil)
+	msg, err := f.encode(&event)
+	require.NoError(t, err)
+	assert.Equal(t, `<14>1 2025-03-04T05:06:07.123456Z beathost testbeat - - - hello`, string(msg))
+}
+
+func TestFormatRFC3164(t *testing.T) {
+	f := makeTestFormatter(t, map[string]interface{}{"format": "rfc3164"})
+
+	event := testEvent("session opened", mapstr.M{
+		"host": mapstr.M{"name": "web 1"},
+		"log":  mapstr.M{"syslog": mapstr.M{"appname": "su:do", "procid": "77"}},
+	})
+	msg, err := f.encode(&event)
+	require.NoError(t, err)
+	assert.Equal(t, `<14>Mar  4 05:06:07 web_1 sudo[77]: session opened`, string(msg))
+}
+
+func TestFormatPriorityMapping(t *testing.T) {
+	f := makeTestFormatter(t, map[string]interface{}{
+		"facility": "%{[fields.facility]:local0}",
+		"severity": "%{[log.level]}",
+	})
+
+	cases := map[string]struct {
+		fields mapstr.M
+		pri    string
+	}{
+		"names":            {mapstr.M{"fields.facility": "local4", "log.level": "warn"}, "<164>"},
+		"codes":            {mapstr.M{"fields.facility": 3, "log.level": 3}, "<27>"},
+		"default facility": {mapstr.M{"log.level": "error"}, "<131>"},
+		"invalid severity": {mapstr.M{"log.level": "fatal"}, "<134>"},
+		"invalid facility": {mapstr.M{"fields.facility": "local9", "log.level": "debug"}, "<15>"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			event := beat.Event{Timestamp: testTime, Fields: mapstr.M{"message": "x"}}
+			for k, v := range tc.fields {
+				_, _ = event.Fields.Put(k, v)
+			}
+			msg, err := f.encode(&event)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(msg), tc.pri), string(msg))
+		})
+	}
+}
+
+func TestHeaderValue(t *testing.T) {
+	assert.Equal(t, "-", headerValue("", 10))
+	assert.Equal(t, "a_b_c", headerValue("a b\tc", 10))
+	assert.Equal(t, "abc", headerValue("abcdef", 3))
+}
+
+// readOctetCounted reads n messages framed with octet counting.
+func readOctetCounted(t *testing.T, r *bufio.Reader, n int) []string {
+	var messages []string
+	for i := 0; i < n; i++ {
+		length, err := r.ReadString(' ')
+		require.NoError(t, err)
+		size, err := strconv.Atoi(strings.TrimSpace(length))
+		require.NoError(t, err)
+
+		msg := make([]byte, size)
+		_, err = io.ReadFull(r, msg)
+		require.NoError(t, err)
+		messages = append(messages, string(msg))
+	}
+	return messages
+}
+
+// acceptOne accepts a connection on l and sends a reader of it on the
+// returned channel.
+func acceptOne(t *testing.T, l net.Listener) <-chan *bufio.Reader {
+	ch := make(chan *bufio.Reader, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { conn.Close() })
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			// The client waits for the handshake when connecting.
+			_ = tlsConn.Handshake()
+		}
+		ch <- bufio.NewReader(conn)
+	}()
+	return ch
+}
+
+func TestPublishTCPOctetCounting(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	conns := acceptOne(t, l)
+
+	client := makeTestClient(t, map[string]interface{}{"hosts": []string{l.Addr().String()}})
+	batch := outest.NewBatch(
+		testEvent("first line\nsecond line", nil),
+		testEvent("second", nil),
+		// Events without a message can't be encoded and are dropped.
+		beat.Event{Timestamp: testTime, Fields: mapstr.M{}},
+	)
+	require.NoError(t, client.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	messages := readOctetCounted(t, <-conns, 2)
+	assert.True(t, strings.HasSuffix(messages[0], " first line\nsecond line"), messages[0])
+	assert.True(t, strings.HasSuffix(messages[1], " second"), messages[1])
+}
+
+func TestPublishTCPNonTransparent(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	conns := acceptOne(t, l)
+
+	client := makeTestClient(t, map[string]interface{}{
+		"hosts":   []string{l.Addr().String()},
+		"framing": "non_transparent",
+		"format":  "rfc3164",
+	})
+	batch := outest.NewBatch(testEvent("first line\nsecond line\n", nil), testEvent("second", nil))
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	r := <-conns
+	for _, want := range []string{": first line second line\n", ": second\n"} {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		assert.True(t, strings.HasSuffix(line, want), line)
+	}
+}
+
+func TestPublishUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := makeTestClient(t, map[string]interface{}{
+		"hosts":    []string{conn.LocalAddr().String()},
+		"protocol": "udp",
+	})
+	batch := outest.NewBatch(testEvent("first", nil), testEvent("second", nil))
+	require.NoError(t, client.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 2048)
+	for _, want := range []string{"first", "second"} {
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		msg := string(buf[:n])
+		assert.True(t, strings.HasPrefix(msg, "<14>1 "), msg)
+		assert.True(t, strings.HasSuffix(msg, " "+want), msg)
+	}
+}
+
+func TestPublishWriteBytes(t *testing.T) {
+	settings := map[string]interface{}{
+		"framing": "non_transparent",
+		"format":  "rfc3164",
+	}
+	events := []beat.Event{testEvent("first", nil), testEvent("second", nil)}
+
+	t.Run("tcp", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+		conns := acceptOne(t, l)
+
+		reg := monitoring.NewRegistry()
+		settings["hosts"] = []string{l.Addr().String()}
+		client := makeTestClientWithObserver(t, outputs.NewStats(reg), settings)
+		require.NoError(t, client.Publish(context.Background(), outest.NewBatch(events...)))
+
+		r := <-conns
+		received := 0
+		for range events {
+			line, err := r.ReadString('\n')
+			require.NoError(t, err)
+			received += len(line)
+		}
+
+		snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+		assert.Equal(t, int64(received), snapshot.Ints["write.bytes"])
+	})
+
+	t.Run("udp", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		reg := monitoring.NewRegistry()
+		settings["hosts"] = []string{conn.LocalAddr().String()}
+		settings["protocol"] = "udp"
+		client := makeTestClientWithObserver(t, outputs.NewStats(reg), settings)
+		require.NoError(t, client.Publish(context.Background(), outest.NewBatch(events...)))
+
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		buf := make([]byte, 2048)
+		received := 0
+		for range events {
+			n, _, err := conn.ReadFrom(buf)
+			require.NoError(t, err)
+			received += n
+		}
+
+		snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+		assert.Equal(t, int64(received), snapshot.Ints["write.bytes"])
+	})
+}
+
+func TestPublishTLS(t *testing.T) {
+	certName := filepath.Join(t.TempDir(), "syslog_test")
+	require.NoError(t, transptest.GenCertForTestingPurpose(t, certName, "", "127.0.0.1"))
+
+	serverConfig, err := tlscommon.LoadTLSConfig(&tlscommon.Config{
+		Certificate: tlscommon.CertificateConfig{
+			Certificate: certName + ".pem",
+			Key:         certName + ".key",
+		},
+	})
+	require.NoError(t, err)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig.BuildServerConfig(""))
+	require.NoError(t, err)
+	defer l.Close()
+	conns := acceptOne(t, l)
+
+	client := makeTestClient(t, map[string]interface{}{
+		"hosts":                       []string{l.Addr().String()},
+		"ssl.certificate_authorities": []string{certName + ".pem"},
+	})
+	batch := outest.NewBatch(testEvent("secure", nil))
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	messages := readOctetCounted(t, <-conns, 1)
+	assert.True(t, strings.HasSuffix(messages[0], " secure"), messages[0])
+}
+
+func TestPublishWriteError(t *testing.T) {
+	group, err := makeSyslog(nil, testInfo(t), outputs.NewNilObserver(), config.MustNewConfigFrom(map[string]interface{}{
+		"hosts":        []string{"127.0.0.1:514"},
+		"backoff.init": "1ms",
+		"backoff.max":  "1ms",
+	}))
+	require.NoError(t, err)
+	client := group.Clients[0]
+	defer client.Close()
+
+	// The client is not connected, so writing the events fails.
+	batch := outest.NewBatch(testEvent("first", nil), testEvent("second", nil))
+	assert.Error(t, client.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Len(t, batch.Signals[0].Events, 2)
+}
@@ -61,6 +61,9 @@ func NewConditionRule(
 	if cond == nil {
 		return p, nil
 	}
+	if _, ok := p.(beat.MultiEventProcessor); ok {
+		return &multiWhenProcessor{WhenProcessor{cond, p}}, nil
+	}
 	return &WhenProcessor{cond, p}, nil
 }
 
@@ -76,6 +79,25 @@ func (r *WhenProcessor) String() string {
 	return fmt.Sprintf("%v, condition=%v", r.p.String(), r.condition.String())
 }
 
+// multiWhenProcessor is a WhenProcessor running a processor that can turn an
+// event into several events.
+type multiWhenProcessor struct {
+	WhenProcessor
+}
+
+// Run executes this multiWhenProcessor, keeping only the first event.
+func (r *multiWhenProcessor) Run(event *beat.Event) (*beat.Event, error) {
+	return beat.SingleEvent(r.RunMulti(event))
+}
+
+// RunMulti executes this multiWhenProcessor.
+func (r *multiWhenProcessor) RunMulti(event *beat.Event) ([]*beat.Event, error) {
+	if !(r.condition).Check(event) {
+		return []*beat.Event{event}, nil
+	}
+	return beat.RunProcessor(r.p, event)
+}
+
 func addCondition(
 	cfg *config.C,
 	p beat.Processor,
@@ -152,12 +174,19 @@ func NewIfElseThenProcessor(cfg *config.C, logger *logp.Logger) (*IfThenElseProc
 // Run checks the if condition and executes the processors attached to the
 // then statement or the else statement based on the condition.
 func (p *IfThenElseProcessor) Run(event *beat.Event) (*beat.Event, error) {
+	return beat.SingleEvent(p.RunMulti(event))
+}
+
+// RunMulti checks the if condition and executes the processors attached to
+// the then statement or the else statement based on the condition, returning
+// all the resulting events.
+func (p *IfThenElseProcessor) RunMulti(event *beat.Event) ([]*beat.Event, error) {
 	if p.cond.Check(event) {
-		return p.then.Run(event)
+		return p.then.RunMulti(event)
 	} else if p.els != nil {
-		return p.els.Run(event)
+		return p.els.RunMulti(event)
 	}
-	return event, nil
+	return []*beat.Event{event}, nil
 }
 
 func (p *IfThenElseProcessor) String() string {
@@ -25,6 +25,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/conditions"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/logp/logptest"
@@ -233,3 +234,69 @@ func TestIfElseThenProcessor(t *testing.T) {
 		},
 	})
 }
+
+// splitFilter turns each event into n copies of it.
+type splitFilter struct {
+	n int
+}
+
+func (s *splitFilter) Run(e *beat.Event) (*beat.Event, error) {
+	return beat.SingleEvent(s.RunMulti(e))
+}
+
+func (s *splitFilter) RunMulti(e *beat.Event) ([]*beat.Event, error) {
+	events := []*beat.Event{e}
+	for i := 1; i < s.n; i++ {
+		events = append(events, e.Clone())
+	}
+	return events, nil
+}
+
+func (s *splitFilter) String() string { return "split" }
+
+func TestMultiEventProcessors(t *testing.T) {
+	log := logptest.NewTestingLogger(t, "")
+
+	when, err := NewConditional(func(_ *conf.C, log *logp.Logger) (beat.Processor, error) {
+		return &splitFilter{n: 2}, nil
+	})(conf.MustNewConfigFrom(map[string]interface{}{"when.equals.i": 10}), log)
+	assert.NoError(t, err)
+	assert.Implements(t, (*beat.MultiEventProcessor)(nil), when)
+
+	cf := &countFilter{}
+	procs := NewList(log)
+	procs.AddProcessor(when)
+	procs.AddProcessor(&splitFilter{n: 3})
+	procs.AddProcessor(cf)
+
+	events, err := procs.RunMulti(&beat.Event{Fields: mapstr.M{"i": 10}})
+	assert.NoError(t, err)
+	assert.Len(t, events, 6)
+	assert.Equal(t, 6, cf.N)
+
+	events, err = procs.RunMulti(&beat.Event{Fields: mapstr.M{"i": 11}})
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+	assert.Equal(t, 9, cf.N)
+
+	event, err := procs.Run(&beat.Event{Fields: mapstr.M{"i": 11}})
+	assert.ErrorIs(t, err, beat.ErrMultipleEvents)
+	assert.Equal(t, mapstr.M{"i": 11}, event.Fields)
+
+	var c conditions.Config
+	assert.NoError(t, conf.MustNewConfigFrom(map[string]interface{}{"equals.i": 10}).Unpack(&c))
+	cond, err := conditions.NewCondition(&c, log)
+	assert.NoError(t, err)
+
+	then := NewList(log)
+	then.AddProcessor(&splitFilter{n: 2})
+	ifThenElse := &IfThenElseProcessor{cond: cond, then: then}
+
+	events, err = ifThenElse.RunMulti(&beat.Event{Fields: mapstr.M{"i": 10}})
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	events, err = ifThenElse.RunMulti(&beat.Event{Fields: mapstr.M{"i": 11}})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
@@ -0,0 +1,123 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_kv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type decodeKV struct {
+	decodeKVConfig
+
+	parser *parser
+	log    *logp.Logger
+}
+
+var (
+	errFieldIsNotString = errors.New("field value is not a string")
+	errNoPairs          = errors.New("no key-value pairs found")
+)
+
+const (
+	procName = "decode_kv"
+	logName  = "processor." + procName
+)
+
+func init() {
+	processors.RegisterPlugin(procName,
+		checks.ConfigChecked(New,
+			checks.AllowedFields(
+				"field", "target_field",
+				"field_split", "value_split",
+				"include_keys", "exclude_keys",
+				"prefix", "trim_key", "trim_value",
+				"strip_brackets", "ignore_missing",
+				"ignore_failure", "when",
+			)))
+	jsprocessor.RegisterPlugin("DecodeKV", New)
+}
+
+// New constructs a new decode_kv processor.
+func New(c *config.C, log *logp.Logger) (beat.Processor, error) {
+	config := defaultConfig()
+
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the "+procName+" processor configuration: %w", err)
+	}
+
+	return &decodeKV{
+		decodeKVConfig: config,
+		parser:         newParser(config),
+		log:            log.Named(logName),
+	}, nil
+}
+
+func (kv *decodeKV) Run(event *beat.Event) (*beat.Event, error) {
+	if err := kv.run(event); err != nil && !kv.IgnoreFailure {
+		err = fmt.Errorf("failed in decode_kv on the %q field: %w", kv.Field, err)
+		_, _ = event.PutValue("error.message", err.Error())
+		return event, err
+	}
+	return event, nil
+}
+
+func (kv *decodeKV) run(event *beat.Event) error {
+	data, err := event.GetValue(kv.Field)
+	if err != nil {
+		if kv.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	text, ok := data.(string)
+	if !ok {
+		return errFieldIsNotString
+	}
+
+	pairs, found := kv.parser.parse(text)
+	if !found {
+		return errNoPairs
+	}
+
+	prefix := kv.Prefix
+	if kv.Target != "" {
+		prefix = kv.Target + "." + prefix
+	}
+	for k, v := range pairs {
+		if _, err := event.PutValue(prefix+k, v); err != nil {
+			return fmt.Errorf("failed to put value %v into field %q: %w", v, prefix+k, err)
+		}
+	}
+	return nil
+}
+
+func (kv *decodeKV) String() string {
+	json, _ := json.Marshal(kv.decodeKVConfig)
+	return procName + "=" + string(json)
+}
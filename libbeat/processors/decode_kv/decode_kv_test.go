@@ -0,0 +1,131 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_kv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestDecodeKV(t *testing.T) {
+	tests := map[string]struct {
+		config   mapstr.M
+		fields   mapstr.M
+		expected mapstr.M
+		err      bool
+	}{
+		"root target": {
+			config: mapstr.M{},
+			fields: mapstr.M{"message": `action=allow src=10.0.0.1 msg="session start"`},
+			expected: mapstr.M{
+				"message": `action=allow src=10.0.0.1 msg="session start"`,
+				"action":  "allow",
+				"src":     "10.0.0.1",
+				"msg":     "session start",
+			},
+		},
+		"target and prefix": {
+			config: mapstr.M{
+				"field":        "event.original",
+				"target_field": "firewall",
+				"prefix":       "fw_",
+			},
+			fields: mapstr.M{"event": mapstr.M{"original": "action=deny proto=udp"}},
+			expected: mapstr.M{
+				"event":    mapstr.M{"original": "action=deny proto=udp"},
+				"firewall": mapstr.M{"fw_action": "deny", "fw_proto": "udp"},
+			},
+		},
+		"dotted keys": {
+			config: mapstr.M{"target_field": "kv"},
+			fields: mapstr.M{"message": "src.ip=10.0.0.1 src.port=53"},
+			expected: mapstr.M{
+				"message": "src.ip=10.0.0.1 src.port=53",
+				"kv":      mapstr.M{"src": mapstr.M{"ip": "10.0.0.1", "port": "53"}},
+			},
+		},
+		"no pairs": {
+			config: mapstr.M{},
+			fields: mapstr.M{"message": "hello world"},
+			expected: mapstr.M{
+				"message": "hello world",
+				"error":   mapstr.M{"message": `failed in decode_kv on the "message" field: no key-value pairs found`},
+			},
+			err: true,
+		},
+		"no pairs ignoring failure": {
+			config:   mapstr.M{"ignore_failure": true},
+			fields:   mapstr.M{"message": "hello world"},
+			expected: mapstr.M{"message": "hello world"},
+		},
+		"included keys missing": {
+			config:   mapstr.M{"include_keys": []string{"user"}},
+			fields:   mapstr.M{"message": "a=1"},
+			expected: mapstr.M{"message": "a=1"},
+		},
+		"missing field": {
+			config:   mapstr.M{"ignore_missing": true},
+			fields:   mapstr.M{"other": "a=1"},
+			expected: mapstr.M{"other": "a=1"},
+		},
+		"field is not a string": {
+			config: mapstr.M{},
+			fields: mapstr.M{"message": 1},
+			expected: mapstr.M{
+				"message": 1,
+				"error":   mapstr.M{"message": `failed in decode_kv on the "message" field: field value is not a string`},
+			},
+			err: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(config.MustNewConfigFrom(test.config), logptest.NewTestingLogger(t, ""))
+			require.NoError(t, err)
+
+			event, err := p.Run(&beat.Event{Fields: test.fields})
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expected, event.Fields)
+		})
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	for name, cfg := range map[string]mapstr.M{
+		"invalid field_split":                  {"field_split": "(unclosed"},
+		"empty field_split":                    {"field_split": ""},
+		"value_split matching an empty string": {"value_split": "=*"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(config.MustNewConfigFrom(cfg), logptest.NewTestingLogger(t, ""))
+			assert.Error(t, err)
+		})
+	}
+}
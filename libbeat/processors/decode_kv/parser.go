@@ -0,0 +1,184 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_kv
+
+import (
+	"regexp"
+	"strings"
+)
+
+// brackets are the pairs of characters removed around values when
+// strip_brackets is enabled.
+var brackets = map[byte]byte{
+	'(':  ')',
+	'[':  ']',
+	'<':  '>',
+	'"':  '"',
+	'\'': '\'',
+}
+
+// parser splits strings into key-value pairs.
+type parser struct {
+	fieldSplit    *regexp.Regexp
+	valueSplit    *regexp.Regexp
+	trimKey       string
+	trimValue     string
+	stripBrackets bool
+	include       map[string]struct{}
+	exclude       map[string]struct{}
+}
+
+func newParser(c decodeKVConfig) *parser {
+	p := &parser{
+		// The separators were validated when the configuration was unpacked.
+		fieldSplit:    regexp.MustCompile(c.FieldSplit),
+		valueSplit:    regexp.MustCompile(c.ValueSplit),
+		trimKey:       c.TrimKey,
+		trimValue:     c.TrimValue,
+		stripBrackets: c.StripBrackets,
+	}
+	if len(c.IncludeKeys) > 0 {
+		p.include = toSet(c.IncludeKeys)
+	}
+	if len(c.ExcludeKeys) > 0 {
+		p.exclude = toSet(c.ExcludeKeys)
+	}
+	return p
+}
+
+func toSet(keys []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		set[k] = struct{}{}
+	}
+	return set
+}
+
+// parse returns the key-value pairs of s, and whether s contained any pair
+// before the keys were filtered. Keys and values enclosed in double
+// or single quotes can contain the separators, and the quote can be escaped
+// with a backslash inside them. Tokens without a value separator are
+// skipped. The values of repeated keys are collected in a slice.
+func (p *parser) parse(s string) (map[string]interface{}, bool) {
+	pairs := map[string]interface{}{}
+	found := false
+
+	for pos := 0; pos < len(s); {
+		if loc := p.fieldSplit.FindStringIndex(s[pos:]); loc != nil && loc[0] == 0 {
+			pos += loc[1]
+			continue
+		}
+
+		var key string
+		if quoted, end, ok := readQuoted(s, pos); ok {
+			loc := p.valueSplit.FindStringIndex(s[end:])
+			if loc == nil || loc[0] != 0 {
+				pos = p.skipToken(s, end)
+				continue
+			}
+			key, pos = quoted, end+loc[1]
+		} else {
+			vs := p.valueSplit.FindStringIndex(s[pos:])
+			fs := p.fieldSplit.FindStringIndex(s[pos:])
+			if vs == nil || (fs != nil && fs[0] < vs[0]) {
+				pos = p.skipToken(s, pos)
+				continue
+			}
+			key, pos = s[pos:pos+vs[0]], pos+vs[1]
+		}
+
+		var value string
+		if quoted, end, ok := readQuoted(s, pos); ok {
+			value, pos = quoted, end
+		} else if fs := p.fieldSplit.FindStringIndex(s[pos:]); fs != nil {
+			value, pos = s[pos:pos+fs[0]], pos+fs[1]
+		} else {
+			value, pos = s[pos:], len(s)
+		}
+
+		found = true
+		p.add(pairs, key, value)
+	}
+	return pairs, found
+}
+
+// skipToken returns the position following the next field separator, or
+// the end of s.
+func (p *parser) skipToken(s string, pos int) int {
+	if loc := p.fieldSplit.FindStringIndex(s[pos:]); loc != nil {
+		return pos + loc[1]
+	}
+	return len(s)
+}
+
+func (p *parser) add(pairs map[string]interface{}, key, value string) {
+	if p.trimKey != "" {
+		key = strings.Trim(key, p.trimKey)
+	}
+	if key == "" {
+		return
+	}
+	if _, found := p.include[key]; p.include != nil && !found {
+		return
+	}
+	if _, found := p.exclude[key]; found {
+		return
+	}
+
+	if p.trimValue != "" {
+		value = strings.Trim(value, p.trimValue)
+	}
+	if p.stripBrackets && len(value) >= 2 {
+		if closing, found := brackets[value[0]]; found && value[len(value)-1] == closing {
+			value = value[1 : len(value)-1]
+		}
+	}
+
+	switch prev := pairs[key].(type) {
+	case nil:
+		pairs[key] = value
+	case string:
+		pairs[key] = []string{prev, value}
+	case []string:
+		pairs[key] = append(prev, value)
+	}
+}
+
+// readQuoted returns the unescaped content of the quoted string starting at
+// pos and the position following the closing quote. It returns false if s
+// does not contain a quoted string at pos.
+func readQuoted(s string, pos int) (string, int, bool) {
+	if pos >= len(s) || (s[pos] != '"' && s[pos] != '\'') {
+		return "", 0, false
+	}
+	quote := s[pos]
+
+	var b strings.Builder
+	for i := pos + 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s) && (s[i+1] == quote || s[i+1] == '\\'):
+			i++
+			b.WriteByte(s[i])
+		case c == quote:
+			return b.String(), i + 1, true
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, false
+}
@@ -0,0 +1,125 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_kv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		config   func(*decodeKVConfig)
+		input    string
+		expected map[string]interface{}
+	}{
+		"simple": {
+			input:    "action=allow src=10.0.0.1 dst=10.0.0.2",
+			expected: map[string]interface{}{"action": "allow", "src": "10.0.0.1", "dst": "10.0.0.2"},
+		},
+		"repeated separators and tokens without value": {
+			input:    "  header  a=1   b=  c=3 trailer",
+			expected: map[string]interface{}{"a": "1", "b": "", "c": "3"},
+		},
+		"value containing the value separator": {
+			input:    "url=http://example.com/?q=1 status=200",
+			expected: map[string]interface{}{"url": "http://example.com/?q=1", "status": "200"},
+		},
+		"quoted values": {
+			input: `msg="user logged in" reason='it''s' path="C:\\temp \"x\"" n=1`,
+			expected: map[string]interface{}{
+				"msg":    "user logged in",
+				"reason": "it",
+				"path":   `C:\temp "x"`,
+				"n":      "1",
+			},
+		},
+		"quoted keys": {
+			input:    `"user name"="John Doe" id=1`,
+			expected: map[string]interface{}{"user name": "John Doe", "id": "1"},
+		},
+		"unterminated quote": {
+			input:    `msg="open a=1`,
+			expected: map[string]interface{}{"msg": `"open`, "a": "1"},
+		},
+		"regular expression separators": {
+			config: func(c *decodeKVConfig) {
+				c.FieldSplit = `[,;]\s*`
+				c.ValueSplit = `\s*:\s*`
+			},
+			input:    "proto : tcp, sport:1234;dport : 443",
+			expected: map[string]interface{}{"proto": "tcp", "sport": "1234", "dport": "443"},
+		},
+		"repeated keys": {
+			input:    "tag=a tag=b tag=c other=d",
+			expected: map[string]interface{}{"tag": []string{"a", "b", "c"}, "other": "d"},
+		},
+		"include keys": {
+			config: func(c *decodeKVConfig) {
+				c.IncludeKeys = []string{"src", "dst"}
+			},
+			input:    "action=allow src=10.0.0.1 dst=10.0.0.2",
+			expected: map[string]interface{}{"src": "10.0.0.1", "dst": "10.0.0.2"},
+		},
+		"exclude keys": {
+			config: func(c *decodeKVConfig) {
+				c.ExcludeKeys = []string{"src", "dst"}
+			},
+			input:    "action=allow src=10.0.0.1 dst=10.0.0.2",
+			expected: map[string]interface{}{"action": "allow"},
+		},
+		"trim and strip brackets": {
+			config: func(c *decodeKVConfig) {
+				c.FieldSplit = ","
+				c.TrimKey = " "
+				c.TrimValue = " "
+				c.StripBrackets = true
+			},
+			input: " a = (1) , b=[2], c = <3>,d=(4],e=x",
+			expected: map[string]interface{}{
+				"a": "1",
+				"b": "2",
+				"c": "3",
+				"d": "(4]",
+				"e": "x",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := defaultConfig()
+			if test.config != nil {
+				test.config(&c)
+			}
+			pairs, found := newParser(c).parse(test.input)
+			assert.True(t, found)
+			assert.Equal(t, test.expected, pairs)
+		})
+	}
+}
+
+func TestParseNoPairs(t *testing.T) {
+	p := newParser(defaultConfig())
+	for _, input := range []string{"", "   ", "no pairs here"} {
+		pairs, found := p.parse(input)
+		assert.False(t, found, input)
+		assert.Empty(t, pairs, input)
+	}
+}
@@ -47,8 +47,24 @@ type fingerprint struct {
 	hash   hashMethod
 }
 
+// Hasher computes the fingerprint of events without modifying them.
+type Hasher interface {
+	// Sum returns the encoded fingerprint of the event.
+	Sum(event *beat.Event) (string, error)
+}
+
 // New constructs a new fingerprint processor.
 func New(cfg *config.C, log *logp.Logger) (beat.Processor, error) {
+	return newFingerprint(cfg)
+}
+
+// NewHasher constructs a Hasher from the method, fields, encoding and
+// ignore_missing settings of a fingerprint processor configuration.
+func NewHasher(cfg *config.C) (Hasher, error) {
+	return newFingerprint(cfg)
+}
+
+func newFingerprint(cfg *config.C) (*fingerprint, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, makeErrConfigUnpack(err)
@@ -70,14 +86,11 @@ func New(cfg *config.C, log *logp.Logger) (beat.Processor, error) {
 
 // Run enriches the given event with a fingerprint.
 func (p *fingerprint) Run(event *beat.Event) (*beat.Event, error) {
-	hashFn := p.hash()
-
-	if err := p.writeFields(hashFn, event); err != nil {
-		return nil, makeErrComputeFingerprint(err)
+	encodedHash, err := p.Sum(event)
+	if err != nil {
+		return nil, err
 	}
 
-	encodedHash := p.config.Encoding.Encode(hashFn.Sum(nil))
-
 	if _, err := event.PutValue(p.config.TargetField, encodedHash); err != nil {
 		return nil, makeErrComputeFingerprint(err)
 	}
@@ -85,6 +98,17 @@ func (p *fingerprint) Run(event *beat.Event) (*beat.Event, error) {
 	return event, nil
 }
 
+// Sum computes the encoded fingerprint of the given event.
+func (p *fingerprint) Sum(event *beat.Event) (string, error) {
+	hashFn := p.hash()
+
+	if err := p.writeFields(hashFn, event); err != nil {
+		return "", makeErrComputeFingerprint(err)
+	}
+
+	return p.config.Encoding.Encode(hashFn.Sum(nil)), nil
+}
+
 func (p *fingerprint) String() string {
 	json, _ := json.Marshal(&p.config)
 	return procName + "=" + string(json)
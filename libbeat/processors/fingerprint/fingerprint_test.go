@@ -463,6 +463,28 @@ func TestIgnoreMissing(t *testing.T) {
 	}
 }
 
+func TestHasher(t *testing.T) {
+	testConfig, err := config.NewConfigFrom(mapstr.M{
+		"fields": []string{"message"},
+	})
+	require.NoError(t, err)
+
+	h, err := NewHasher(testConfig)
+	require.NoError(t, err)
+
+	testEvent := &beat.Event{
+		Fields:    mapstr.M{"message": "hello world"},
+		Timestamp: time.Now(),
+	}
+	sum, err := h.Sum(testEvent)
+	require.NoError(t, err)
+	assert.Equal(t, "50110bbfc1757f21caacc966b33f5ea2235c4176739447e0b3285dec4e1dd2a4", sum)
+	assert.Equal(t, mapstr.M{"message": "hello world"}, testEvent.Fields, "Sum must not modify the event")
+
+	_, err = h.Sum(&beat.Event{Fields: mapstr.M{}})
+	assert.Error(t, err)
+}
+
 func TestProcessorStringer(t *testing.T) {
 	testConfig, err := config.NewConfigFrom(mapstr.M{
 		"fields":   []string{"field1"},
@@ -0,0 +1,123 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+type cacheRecord struct {
+	fields  mapstr.M // nil if no database holds a record for the IP.
+	expires time.Time
+}
+
+func (r cacheRecord) IsExpired(now time.Time) bool {
+	return now.After(r.expires)
+}
+
+// lookupCache caches the fields looked up for an IP address, including the
+// absence of a record. It is purged when a database is reloaded.
+type lookupCache struct {
+	enabled bool
+	sync.RWMutex
+	data     map[string]cacheRecord
+	ttl      time.Duration
+	initSize int
+	maxSize  int
+	stats    cacheStats
+}
+
+type cacheStats struct {
+	Hit  *monitoring.Int
+	Miss *monitoring.Int
+}
+
+// newLookupCache returns a new cache.
+func newLookupCache(reg *monitoring.Registry, conf cacheSettings) *lookupCache {
+	return &lookupCache{
+		enabled:  conf.Enabled,
+		data:     make(map[string]cacheRecord, conf.InitialCapacity),
+		ttl:      conf.TTL,
+		initSize: conf.InitialCapacity,
+		maxSize:  conf.MaxCapacity,
+		stats: cacheStats{
+			Hit:  monitoring.NewInt(reg, "hits"),
+			Miss: monitoring.NewInt(reg, "misses"),
+		},
+	}
+}
+
+func (c *lookupCache) set(now time.Time, key string, fields mapstr.M) {
+	if !c.enabled {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.data) >= c.maxSize {
+		c.evict()
+	}
+
+	c.data[key] = cacheRecord{
+		fields:  fields,
+		expires: now.Add(c.ttl),
+	}
+}
+
+// evict removes a single random key from the cache.
+func (c *lookupCache) evict() {
+	var key string
+	for k := range c.data {
+		key = k
+		break
+	}
+	delete(c.data, key)
+}
+
+// get returns the cached fields of key and whether key was found in the
+// cache.
+func (c *lookupCache) get(now time.Time, key string) (mapstr.M, bool) {
+	if !c.enabled {
+		return nil, false
+	}
+	c.RLock()
+	defer c.RUnlock()
+
+	r, found := c.data[key]
+	if found && !r.IsExpired(now) {
+		c.stats.Hit.Inc()
+		return r.fields, true
+	}
+	c.stats.Miss.Inc()
+	return nil, false
+}
+
+// purge removes all items from the cache.
+func (c *lookupCache) purge() {
+	if !c.enabled {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	c.data = make(map[string]cacheRecord, c.initSize)
+}
@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// config defines the configuration options for the geoip processor.
+type config struct {
+	Database       databaseConfig `config:"database"`
+	Fields         mapstr.M       `config:"fields"`          // Mapping of IP fields to the objects receiving the geo and as fields.
+	TagOnFailure   []string       `config:"tag_on_failure"`  // Tags to append when a failure occurs.
+	ReloadInterval time.Duration  `config:"reload_interval"` // How often the database files are checked for changes, 0 disables reloading.
+	Cache          cacheSettings  `config:"cache"`
+	targets        map[string]string
+}
+
+// databaseConfig defines the paths of the MaxMind databases.
+type databaseConfig struct {
+	City string `config:"city"` // City or Country database, providing the geo fields.
+	ASN  string `config:"asn"`  // ASN database, providing the as fields.
+}
+
+// cacheSettings define the caching behavior of the lookups.
+type cacheSettings struct {
+	// Disable the use of the cache.
+	Enabled bool `config:"enabled"`
+
+	// TTL value for items in cache.
+	TTL time.Duration `config:"ttl" validate:"min=1ns"`
+
+	// Initial capacity. How much space is allocated at initialization.
+	InitialCapacity int `config:"capacity.initial" validate:"min=0"`
+
+	// Max capacity of the cache. When capacity is reached a random item is
+	// evicted from the cache.
+	MaxCapacity int `config:"capacity.max" validate:"min=1"`
+}
+
+// defaultFields are the ECS IP fields enriched when no fields are
+// configured.
+var defaultFields = map[string]string{
+	"source.ip":      "source",
+	"destination.ip": "destination",
+	"client.ip":      "client",
+	"server.ip":      "server",
+}
+
+// Validate validates the data contained in the config.
+func (c *config) Validate() error {
+	if c.Database.City == "" && c.Database.ASN == "" {
+		return errors.New("at least one of database.city or database.asn must be set")
+	}
+
+	if len(c.Fields) == 0 {
+		c.targets = defaultFields
+	} else {
+		// Flatten the mapping of IP fields to target fields.
+		c.targets = map[string]string{}
+		for k, v := range c.Fields.Flatten() {
+			target, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("target field for geoip lookup of %v "+
+					"must be a string but got %T", k, v)
+			}
+			c.targets[k] = target
+		}
+	}
+
+	if c.Cache.MaxCapacity < c.Cache.InitialCapacity {
+		return errors.New("cache.capacity.max must be >= cache.capacity.initial")
+	}
+	return nil
+}
+
+func defaultConfig() config {
+	return config{
+		ReloadInterval: time.Minute,
+		Cache: cacheSettings{
+			Enabled:         true,
+			TTL:             time.Hour,
+			InitialCapacity: 1000,
+			MaxCapacity:     10000,
+		},
+	}
+}
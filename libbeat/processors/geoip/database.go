@@ -0,0 +1,150 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// cityRecord holds the subset of a City or Country database record that is
+// mapped to the ECS geo fields.
+type cityRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Continent struct {
+		Code  string            `maxminddb:"code"`
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"continent"`
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+		TimeZone  string   `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+	Subdivisions []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+}
+
+// asnRecord holds an ASN database record.
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// database is a MaxMind database read from disk that can be reopened when
+// the file changes.
+type database struct {
+	path string
+	log  *logp.Logger
+
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+// openDatabase opens the database stored at path.
+func openDatabase(path string, log *logp.Logger) (*database, error) {
+	db := &database{path: path, log: log}
+	if _, err := db.reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// reload reopens the database if its file was modified since it was last
+// opened. It returns true if the database was reopened. On error the
+// previously opened database is kept.
+func (db *database) reload() (bool, error) {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat geoip database %s: %w", db.path, err)
+	}
+
+	db.mu.RLock()
+	unchanged := db.reader != nil && info.ModTime().Equal(db.modTime) && info.Size() == db.size
+	db.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	reader, err := maxminddb.Open(db.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open geoip database %s: %w", db.path, err)
+	}
+
+	db.mu.Lock()
+	old := db.reader
+	db.reader, db.modTime, db.size = reader, info.ModTime(), info.Size()
+	db.mu.Unlock()
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			db.log.Warnf("Failed to close previous geoip database %s: %v", db.path, err)
+		}
+		db.log.Infof("Reloaded geoip database %s (type %s, built %v)", db.path,
+			reader.Metadata.DatabaseType, time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC()) //nolint:gosec // build epoch is a unix timestamp
+	}
+	return true, nil
+}
+
+// lookup decodes the record of ip into result. It returns false if the
+// database holds no record for ip.
+func (db *database) lookup(ip net.IP, result interface{}) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.reader == nil {
+		return false, fmt.Errorf("geoip database %s is closed", db.path)
+	}
+	_, found, err := db.reader.LookupNetwork(ip, result)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %v in geoip database %s: %w", ip, db.path, err)
+	}
+	return found, nil
+}
+
+// Close closes the database.
+func (db *database) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.reader == nil {
+		return nil
+	}
+	err := db.reader.Close()
+	db.reader = nil
+	return err
+}
@@ -0,0 +1,27 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package geoip implements a processor that enriches IP addresses with the
+// geographical location and the autonomous system read from MaxMind
+// databases (.mmdb files) stored on disk, for example the GeoLite2 City and
+// ASN databases.
+//
+// The databases are checked for changes every reload_interval and reopened
+// when their file was replaced. Lookup results are cached in memory, the
+// cache evicts a random item when the configured maximum size is reached and
+// is cleared when a database is reloaded.
+package geoip
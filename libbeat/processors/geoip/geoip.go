@@ -0,0 +1,273 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+const logName = "processor.geoip"
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID atomic.Uint32
+
+func init() {
+	processors.RegisterPlugin("geoip", New)
+	jsprocessor.RegisterPlugin("GeoIP", New)
+}
+
+type processor struct {
+	config
+	city  *database
+	asn   *database
+	cache *lookupCache
+	log   *logp.Logger
+
+	reloadMu   sync.Mutex
+	lastReload time.Time
+}
+
+// New constructs a new geoip processor.
+func New(cfg *conf.C, log *logp.Logger) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("fail to unpack the geoip configuration: %w", err)
+	}
+
+	// Logging and metrics (each processor instance has a unique ID).
+	var (
+		id      = int(instanceID.Add(1))
+		metrics = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
+	log = log.Named(logName).With("instance_id", id)
+	log.Debugf("geoip processor config: %+v", c)
+
+	p := &processor{
+		config:     c,
+		cache:      newLookupCache(metrics.NewRegistry("cache"), c.Cache),
+		log:        log,
+		lastReload: time.Now(),
+	}
+
+	var err error
+	if c.Database.City != "" {
+		if p.city, err = openDatabase(c.Database.City, log); err != nil {
+			return nil, err
+		}
+	}
+	if c.Database.ASN != "" {
+		if p.asn, err = openDatabase(c.Database.ASN, log); err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	p.maybeReload()
+
+	var tagOnce sync.Once
+	for field, target := range p.targets {
+		if err := p.processField(field, target, event); err != nil {
+			p.log.Debugf("geoip processor failed: %v", err)
+			tagOnce.Do(func() { _ = mapstr.AddTags(event.Fields, p.TagOnFailure) })
+		}
+	}
+	return event, nil
+}
+
+// maybeReload reopens the databases whose files changed once the reload
+// interval has elapsed. The cache is purged if any database was reopened.
+func (p *processor) maybeReload() {
+	if p.ReloadInterval <= 0 {
+		return
+	}
+
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	now := time.Now()
+	if now.Sub(p.lastReload) < p.ReloadInterval {
+		return
+	}
+	p.lastReload = now
+
+	var reloaded bool
+	for _, db := range []*database{p.city, p.asn} {
+		if db == nil {
+			continue
+		}
+		ok, err := db.reload()
+		if err != nil {
+			p.log.Warnf("Failed to reload geoip database, keeping the previous one: %v", err)
+			continue
+		}
+		reloaded = reloaded || ok
+	}
+	if reloaded {
+		p.cache.purge()
+	}
+}
+
+func (p *processor) processField(source, target string, event *beat.Event) error {
+	v, err := event.GetValue(source)
+	if err != nil {
+		//nolint:nilerr // an empty source field isn't considered an error for this processor
+		return nil
+	}
+
+	strVal, ok := v.(string)
+	if !ok {
+		return nil
+	}
+
+	ip := net.ParseIP(strVal)
+	if ip == nil {
+		return fmt.Errorf("geoip lookup of %s value '%s' failed: invalid IP address", source, strVal)
+	}
+
+	fields, err := p.lookup(ip)
+	if err != nil {
+		return fmt.Errorf("geoip lookup of %s value '%s' failed: %w", source, strVal, err)
+	}
+
+	for k, v := range fields {
+		if _, err := event.PutValue(target+"."+k, v.(mapstr.M).Clone()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup returns the geo and as fields of ip. A cached result is returned if
+// it is contained in the cache, otherwise the databases are queried.
+func (p *processor) lookup(ip net.IP) (mapstr.M, error) {
+	now := time.Now()
+	key := ip.String()
+
+	if fields, found := p.cache.get(now, key); found {
+		return fields, nil
+	}
+
+	var fields mapstr.M
+	if p.city != nil {
+		var rec cityRecord
+		found, err := p.city.lookup(ip, &rec)
+		if err != nil {
+			return nil, err
+		}
+		if geo := rec.fields(); found && len(geo) != 0 {
+			fields = mapstr.M{"geo": geo}
+		}
+	}
+	if p.asn != nil {
+		var rec asnRecord
+		found, err := p.asn.lookup(ip, &rec)
+		if err != nil {
+			return nil, err
+		}
+		if as := rec.fields(); found && len(as) != 0 {
+			if fields == nil {
+				fields = mapstr.M{}
+			}
+			fields["as"] = as
+		}
+	}
+
+	p.cache.set(now, key, fields)
+	return fields, nil
+}
+
+// fields returns the ECS geo fields of the record.
+func (r *cityRecord) fields() mapstr.M {
+	geo := mapstr.M{}
+	putString(geo, "continent_code", r.Continent.Code)
+	putString(geo, "continent_name", r.Continent.Names["en"])
+	putString(geo, "country_iso_code", r.Country.ISOCode)
+	putString(geo, "country_name", r.Country.Names["en"])
+	if len(r.Subdivisions) != 0 {
+		region := r.Subdivisions[0]
+		if region.ISOCode != "" && r.Country.ISOCode != "" {
+			geo["region_iso_code"] = r.Country.ISOCode + "-" + region.ISOCode
+		}
+		putString(geo, "region_name", region.Names["en"])
+	}
+	putString(geo, "city_name", r.City.Names["en"])
+	putString(geo, "postal_code", r.Postal.Code)
+	putString(geo, "timezone", r.Location.TimeZone)
+	if r.Location.Latitude != nil && r.Location.Longitude != nil {
+		geo["location"] = mapstr.M{
+			"lat": *r.Location.Latitude,
+			"lon": *r.Location.Longitude,
+		}
+	}
+	return geo
+}
+
+// fields returns the ECS as fields of the record.
+func (r *asnRecord) fields() mapstr.M {
+	as := mapstr.M{}
+	if r.Number != 0 {
+		as["number"] = r.Number
+	}
+	if r.Organization != "" {
+		as["organization"] = mapstr.M{"name": r.Organization}
+	}
+	return as
+}
+
+func putString(m mapstr.M, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+// Close closes the databases.
+func (p *processor) Close() error {
+	var errs []error
+	for _, db := range []*database{p.city, p.asn} {
+		if db == nil {
+			continue
+		}
+		if err := db.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *processor) String() string {
+	return fmt.Sprintf("geoip=[city=%v, asn=%v, fields=[%+v]]",
+		p.Database.City, p.Database.ASN, p.targets)
+}
@@ -0,0 +1,220 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func cityRecords(city string) map[string]interface{} {
+	return map[string]interface{}{
+		"81.2.69.0/24": map[string]interface{}{
+			"city":      map[string]interface{}{"names": map[string]interface{}{"en": city}},
+			"continent": map[string]interface{}{"code": "EU", "names": map[string]interface{}{"en": "Europe"}},
+			"country":   map[string]interface{}{"iso_code": "GB", "names": map[string]interface{}{"en": "United Kingdom"}},
+			"location": map[string]interface{}{
+				"latitude":  51.5142,
+				"longitude": -0.0931,
+				"time_zone": "Europe/London",
+			},
+			"postal": map[string]interface{}{"code": "EC2V"},
+			"subdivisions": []interface{}{
+				map[string]interface{}{"iso_code": "ENG", "names": map[string]interface{}{"en": "England"}},
+			},
+		},
+	}
+}
+
+var asnRecords = map[string]interface{}{
+	"81.2.69.0/24": map[string]interface{}{
+		"autonomous_system_number":       uint32(20712),
+		"autonomous_system_organization": "Andrews & Arnold Ltd",
+	},
+	"1.128.0.0/11": map[string]interface{}{
+		"autonomous_system_number":       uint32(1221),
+		"autonomous_system_organization": "Telstra Pty Ltd",
+	},
+}
+
+func newTestProcessor(t *testing.T, cfg map[string]interface{}) *processor {
+	t.Helper()
+
+	c, err := conf.NewConfigFrom(cfg)
+	require.NoError(t, err)
+	p, err := New(c, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, p.(*processor).Close()) })
+	return p.(*processor)
+}
+
+func TestGeoIP(t *testing.T) {
+	dir := t.TempDir()
+	p := newTestProcessor(t, map[string]interface{}{
+		"database.city":  writeTestDatabase(t, dir, "city.mmdb", "GeoLite2-City", cityRecords("London")),
+		"database.asn":   writeTestDatabase(t, dir, "asn.mmdb", "GeoLite2-ASN", asnRecords),
+		"tag_on_failure": []string{"_geoip_failure"},
+	})
+	t.Log(p.String())
+
+	t.Run("default fields", func(t *testing.T) {
+		event, err := p.Run(&beat.Event{
+			Fields: mapstr.M{
+				"source":      mapstr.M{"ip": "81.2.69.142"},
+				"destination": mapstr.M{"ip": "1.128.0.1"},
+				"client":      mapstr.M{"ip": "10.0.0.1"},
+			},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, mapstr.M{
+			"ip": "81.2.69.142",
+			"geo": mapstr.M{
+				"continent_code":   "EU",
+				"continent_name":   "Europe",
+				"country_iso_code": "GB",
+				"country_name":     "United Kingdom",
+				"region_iso_code":  "GB-ENG",
+				"region_name":      "England",
+				"city_name":        "London",
+				"postal_code":      "EC2V",
+				"timezone":         "Europe/London",
+				"location":         mapstr.M{"lat": 51.5142, "lon": -0.0931},
+			},
+			"as": mapstr.M{
+				"number":       uint(20712),
+				"organization": mapstr.M{"name": "Andrews & Arnold Ltd"},
+			},
+		}, event.Fields["source"])
+		assert.Equal(t, mapstr.M{
+			"ip": "1.128.0.1",
+			"as": mapstr.M{
+				"number":       uint(1221),
+				"organization": mapstr.M{"name": "Telstra Pty Ltd"},
+			},
+		}, event.Fields["destination"])
+		assert.Equal(t, mapstr.M{"ip": "10.0.0.1"}, event.Fields["client"])
+		assert.NotContains(t, event.Fields, "tags")
+	})
+
+	t.Run("invalid ip", func(t *testing.T) {
+		event, err := p.Run(&beat.Event{
+			Fields: mapstr.M{"source": mapstr.M{"ip": "not an ip"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"_geoip_failure"}, event.Fields["tags"])
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		hits := p.cache.stats.Hit.Get()
+		_, err := p.Run(&beat.Event{
+			Fields: mapstr.M{"source": mapstr.M{"ip": "81.2.69.142"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, hits+1, p.cache.stats.Hit.Get())
+	})
+}
+
+func TestGeoIPFields(t *testing.T) {
+	dir := t.TempDir()
+	p := newTestProcessor(t, map[string]interface{}{
+		"database.asn": writeTestDatabase(t, dir, "asn.mmdb", "GeoLite2-ASN", asnRecords),
+		"fields": map[string]interface{}{
+			"network.forwarded_ip": "forwarded",
+		},
+	})
+
+	event, err := p.Run(&beat.Event{
+		Fields: mapstr.M{
+			"network": mapstr.M{"forwarded_ip": "1.128.0.1"},
+			"source":  mapstr.M{"ip": "81.2.69.142"},
+		},
+	})
+	require.NoError(t, err)
+
+	v, err := event.GetValue("forwarded.as.number")
+	require.NoError(t, err)
+	assert.Equal(t, uint(1221), v)
+	assert.Equal(t, mapstr.M{"ip": "81.2.69.142"}, event.Fields["source"])
+}
+
+func TestGeoIPReload(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestDatabase(t, dir, "city.mmdb", "GeoLite2-City", cityRecords("London"))
+	p := newTestProcessor(t, map[string]interface{}{
+		"database.city":   path,
+		"reload_interval": "1ns",
+	})
+
+	cityName := func() interface{} {
+		event, err := p.Run(&beat.Event{
+			Fields: mapstr.M{"source": mapstr.M{"ip": "81.2.69.142"}},
+		})
+		require.NoError(t, err)
+		v, _ := event.GetValue("source.geo.city_name")
+		return v
+	}
+	assert.Equal(t, "London", cityName())
+
+	// Replace the database like a download tool would, making sure the
+	// modification time changes.
+	update := writeTestDatabase(t, t.TempDir(), "city.mmdb", "GeoLite2-City", cityRecords("Manchester"))
+	require.NoError(t, os.Rename(update, path))
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	assert.Equal(t, "Manchester", cityName())
+
+	// A broken update keeps the previous database.
+	broken := filepath.Join(t.TempDir(), "city.mmdb")
+	require.NoError(t, os.WriteFile(broken, []byte("garbage"), 0o644))
+	require.NoError(t, os.Rename(broken, path))
+	p.cache.purge()
+	assert.Equal(t, "Manchester", cityName())
+}
+
+func TestConfigInvalid(t *testing.T) {
+	for name, cfg := range map[string]map[string]interface{}{
+		"no database": {},
+		"missing database": {
+			"database.city": "/does/not/exist.mmdb",
+		},
+		"invalid cache": {
+			"database.city":          "/does/not/exist.mmdb",
+			"cache.capacity.initial": 10,
+			"cache.capacity.max":     1,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := conf.NewConfigFrom(cfg)
+			require.NoError(t, err)
+			_, err = New(c, logptest.NewTestingLogger(t, ""))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// writeTestDatabase writes an IPv4 MaxMind database mapping each network to
+// its record and returns its path. Records are made of maps, slices,
+// strings, float64 and unsigned integers.
+func writeTestDatabase(t *testing.T, dir, name, dbType string, records map[string]interface{}) string {
+	t.Helper()
+
+	type node [2]int // child node index, or -1 - data offset, or 0 for empty.
+	nodes := []node{{}}
+	var data bytes.Buffer
+
+	networks := make([]string, 0, len(records))
+	for cidr := range records {
+		networks = append(networks, cidr)
+	}
+	sort.Strings(networks)
+	for _, cidr := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := network.Mask.Size()
+		ip := network.IP.To4()
+
+		offset := data.Len()
+		data.Write(encodeValue(records[cidr]))
+
+		n := 0
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[n][bit] = -1 - offset
+				break
+			}
+			if nodes[n][bit] <= 0 {
+				nodes = append(nodes, node{})
+				nodes[n][bit] = len(nodes) - 1
+			}
+			n = nodes[n][bit]
+		}
+	}
+
+	var buf bytes.Buffer
+	nodeCount := len(nodes)
+	for _, n := range nodes {
+		for _, r := range n {
+			value := nodeCount // empty
+			switch {
+			case r > 0:
+				value = r
+			case r < 0:
+				value = nodeCount + 16 + (-1 - r)
+			}
+			buf.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+	buf.WriteString("\xAB\xCD\xEFMaxMind.com")
+	buf.Write(encodeValue(map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"database_type":               dbType,
+		"description":                 map[string]interface{}{"en": "Test database"},
+		"ip_version":                  uint16(4),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+	}))
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// encodeValue encodes v in the MaxMind DB data section format.
+func encodeValue(v interface{}) []byte {
+	var buf bytes.Buffer
+	switch v := v.(type) {
+	case string:
+		buf.Write(controlBytes(2, len(v)))
+		buf.WriteString(v)
+	case float64:
+		buf.Write(controlBytes(3, 8))
+		_ = binary.Write(&buf, binary.BigEndian, math.Float64bits(v))
+	case uint16:
+		writeUint(&buf, 5, uint64(v))
+	case uint32:
+		writeUint(&buf, 6, uint64(v))
+	case uint64:
+		writeUint(&buf, 9, v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.Write(controlBytes(7, len(v)))
+		for _, k := range keys {
+			buf.Write(encodeValue(k))
+			buf.Write(encodeValue(v[k]))
+		}
+	case []interface{}:
+		buf.Write(controlBytes(11, len(v)))
+		for _, e := range v {
+			buf.Write(encodeValue(e))
+		}
+	default:
+		panic("unsupported type")
+	}
+	return buf.Bytes()
+}
+
+func writeUint(buf *bytes.Buffer, typ int, v uint64) {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	buf.Write(controlBytes(typ, len(b)))
+	buf.Write(b)
+}
+
+func controlBytes(typ, size int) []byte {
+	var b []byte
+	if typ > 7 {
+		b = []byte{0, byte(typ - 7)}
+	} else {
+		b = []byte{byte(typ << 5)}
+	}
+	switch {
+	case size < 29:
+		b[0] |= byte(size)
+	case size < 285:
+		b[0] |= 29
+		b = append(b, byte(size-29))
+	default:
+		b[0] |= 30
+		size -= 285
+		b = append(b, byte(size>>8), byte(size))
+	}
+	return b
+}
@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/elastic/go-grok"
+)
+
+type config struct {
+	Field              string            `config:"field"`
+	Patterns           []string          `config:"patterns" validate:"required"`
+	PatternDefinitions map[string]string `config:"pattern_definitions"`
+	TargetPrefix       string            `config:"target_prefix"`
+	IgnoreMissing      bool              `config:"ignore_missing"`
+	IgnoreFailure      bool              `config:"ignore_failure"`
+	matchers           []*grok.Grok
+}
+
+var defaultConfig = config{
+	Field: "message",
+}
+
+// reference matches the %{SYNTAX}, %{SYNTAX:ID} and %{SYNTAX:ID:TYPE}
+// references of a grok pattern.
+var reference = regexp.MustCompile(`%{\w+(?::[\w+.]+(?::(\w+))?)?}`)
+
+// supportedTypes are the types named captures can be converted to.
+var supportedTypes = map[string]bool{
+	"string":  true,
+	"int":     true,
+	"long":    true,
+	"float":   true,
+	"double":  true,
+	"bool":    true,
+	"boolean": true,
+}
+
+// Validate compiles the patterns, so invalid patterns, unknown pattern
+// references and unsupported types are reported when the configuration is
+// loaded.
+func (c *config) Validate() error {
+	if len(c.Patterns) == 0 {
+		return errors.New("at least one pattern is required")
+	}
+
+	for name, definition := range c.PatternDefinitions {
+		if err := checkTypes(definition); err != nil {
+			return fmt.Errorf("invalid pattern definition %s: %w", name, err)
+		}
+	}
+
+	c.matchers = make([]*grok.Grok, 0, len(c.Patterns))
+	for i, pattern := range c.Patterns {
+		if err := checkTypes(pattern); err != nil {
+			return fmt.Errorf("invalid pattern %d %q: %w", i, pattern, err)
+		}
+
+		g, err := grok.NewComplete(c.PatternDefinitions)
+		if err != nil {
+			return fmt.Errorf("invalid pattern definitions: %w", err)
+		}
+		if err := g.Compile(pattern, true); err != nil {
+			return fmt.Errorf("failed to compile pattern %d %q: %w", i, pattern, err)
+		}
+		c.matchers = append(c.matchers, g)
+	}
+	return nil
+}
+
+// checkTypes returns an error if pattern converts a capture to an
+// unsupported type.
+func checkTypes(pattern string) error {
+	for _, m := range reference.FindAllStringSubmatch(pattern, -1) {
+		if typ := m[1]; typ != "" && !supportedTypes[typ] {
+			return fmt.Errorf("unsupported type %q in %s", typ, m[0])
+		}
+	}
+	return nil
+}
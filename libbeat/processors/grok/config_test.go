@@ -0,0 +1,63 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestConfigInvalid(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"no patterns": {},
+		"empty patterns": {
+			"patterns": []string{},
+		},
+		"unknown pattern": {
+			"patterns": []string{"%{WORD:word}", "%{NOT_A_PATTERN:value}"},
+		},
+		"invalid regular expression": {
+			"patterns": []string{"%{WORD:word} (unclosed"},
+		},
+		"invalid pattern definition": {
+			"patterns":            []string{"%{MINE:value}"},
+			"pattern_definitions": map[string]string{"MINE": "[a-z"},
+		},
+		"unsupported type": {
+			"patterns": []string{"%{NUMBER:value:decimal}"},
+		},
+		"unsupported type in pattern definition": {
+			"patterns":            []string{"%{MINE}"},
+			"pattern_definitions": map[string]string{"MINE": "%{NUMBER:value:decimal}"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, err := conf.NewConfigFrom(test)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config := defaultConfig
+			assert.Error(t, c.Unpack(&config))
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	cfg "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const flagParsingError = "grok_parsing_error"
+
+var errNoMatch = errors.New("no pattern matched")
+
+type processor struct {
+	config config
+}
+
+func init() {
+	processors.RegisterPlugin("grok", NewProcessor)
+	jsprocessor.RegisterPlugin("Grok", NewProcessor)
+}
+
+// NewProcessor constructs a new grok processor.
+func NewProcessor(c *cfg.C, log *logp.Logger) (beat.Processor, error) {
+	config := defaultConfig
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the grok configuration: %w", err)
+	}
+	return &processor{config: config}, nil
+}
+
+// Run matches the configured field against the patterns in order and adds
+// the named captures of the first matching pattern to the event.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	v, err := event.GetValue(p.config.Field)
+	if err != nil {
+		if p.config.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return event, nil
+		}
+		return event, err
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return event, fmt.Errorf("field is not a string, value: `%v`, field: `%s`", v, p.config.Field)
+	}
+
+	captures, err := p.match(s)
+	if err != nil {
+		if err := mapstr.AddTagsWithKey(
+			event.Fields,
+			beat.FlagField,
+			[]string{flagParsingError},
+		); err != nil {
+			return event, fmt.Errorf("cannot add new flag the event: %w", err)
+		}
+		if p.config.IgnoreFailure {
+			return event, nil
+		}
+		return event, fmt.Errorf("grok of field `%s` failed: %w", p.config.Field, err)
+	}
+
+	prefix := ""
+	if p.config.TargetPrefix != "" {
+		prefix = p.config.TargetPrefix + "."
+	}
+	backup := event.Clone()
+	for k, v := range captures {
+		if _, err := event.PutValue(prefix+k, v); err != nil {
+			return backup, fmt.Errorf("cannot set key `%s`: %w", prefix+k, err)
+		}
+	}
+	return event, nil
+}
+
+// match returns the named captures of the first pattern matching s.
+func (p *processor) match(s string) (map[string]interface{}, error) {
+	for _, g := range p.config.matchers {
+		captures, err := g.ParseTypedString(s)
+		if err != nil {
+			return nil, err
+		}
+		// An empty result is returned both when the pattern does not match
+		// and when it matches without capturing anything.
+		if len(captures) != 0 || g.MatchString(s) {
+			return captures, nil
+		}
+	}
+	return nil, errNoMatch
+}
+
+func (p *processor) String() string {
+	return "grok=[" + strings.Join(p.config.Patterns, ", ") + "]" +
+		",field=" + p.config.Field +
+		",target_prefix=" + p.config.TargetPrefix
+}
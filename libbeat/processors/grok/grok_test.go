@@ -0,0 +1,159 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestProcessor(t *testing.T) {
+	tests := map[string]struct {
+		config   map[string]interface{}
+		fields   mapstr.M
+		expected mapstr.M
+		err      bool
+	}{
+		"standard patterns with types": {
+			config: map[string]interface{}{
+				"patterns": []string{
+					"%{IP:source.ip} %{WORD:http.request.method} %{URIPATHPARAM:url.original} %{NUMBER:http.response.bytes:int} %{NUMBER:event.duration:float}",
+				},
+			},
+			fields: mapstr.M{"message": "55.3.244.1 GET /index.html 15824 0.043"},
+			expected: mapstr.M{
+				"message": "55.3.244.1 GET /index.html 15824 0.043",
+				"source":  mapstr.M{"ip": "55.3.244.1"},
+				"http":    mapstr.M{"request": mapstr.M{"method": "GET"}, "response": mapstr.M{"bytes": 15824}},
+				"url":     mapstr.M{"original": "/index.html"},
+				"event":   mapstr.M{"duration": 0.043},
+			},
+		},
+		"patterns are tried in order": {
+			config: map[string]interface{}{
+				"patterns": []string{
+					"^%{INT:first:int}$",
+					"^%{WORD:second}$",
+					"^%{DATA:third}$",
+				},
+			},
+			fields: mapstr.M{"message": "hello"},
+			expected: mapstr.M{
+				"message": "hello",
+				"second":  "hello",
+			},
+		},
+		"custom pattern definitions": {
+			config: map[string]interface{}{
+				"field":    "log.original",
+				"patterns": []string{"%{QUEUE:queue} %{STATUS:status:bool}"},
+				"pattern_definitions": map[string]string{
+					"QUEUE":  `q-%{INT}`,
+					"STATUS": `true|false`,
+				},
+			},
+			fields: mapstr.M{"log": mapstr.M{"original": "q-12 true"}},
+			expected: mapstr.M{
+				"log":    mapstr.M{"original": "q-12 true"},
+				"queue":  "q-12",
+				"status": true,
+			},
+		},
+		"target prefix and overwritten field": {
+			config: map[string]interface{}{
+				"patterns":      []string{`\[%{LOGLEVEL:level}\] %{GREEDYDATA:message}`},
+				"target_prefix": "parsed",
+			},
+			fields: mapstr.M{"message": "[WARN] disk almost full"},
+			expected: mapstr.M{
+				"message": "[WARN] disk almost full",
+				"parsed":  mapstr.M{"level": "WARN", "message": "disk almost full"},
+			},
+		},
+		"no match": {
+			config: map[string]interface{}{
+				"patterns": []string{"^%{INT:number}$"},
+			},
+			fields: mapstr.M{"message": "hello"},
+			expected: mapstr.M{
+				"message": "hello",
+				"log":     mapstr.M{"flags": []string{flagParsingError}},
+			},
+			err: true,
+		},
+		"no match ignoring failure": {
+			config: map[string]interface{}{
+				"patterns":       []string{"^%{INT:number}$"},
+				"ignore_failure": true,
+			},
+			fields: mapstr.M{"message": "hello"},
+			expected: mapstr.M{
+				"message": "hello",
+				"log":     mapstr.M{"flags": []string{flagParsingError}},
+			},
+		},
+		"missing field": {
+			config: map[string]interface{}{
+				"patterns": []string{"%{WORD:word}"},
+			},
+			fields:   mapstr.M{"other": "hello"},
+			expected: mapstr.M{"other": "hello"},
+			err:      true,
+		},
+		"missing field ignored": {
+			config: map[string]interface{}{
+				"patterns":       []string{"%{WORD:word}"},
+				"ignore_missing": true,
+			},
+			fields:   mapstr.M{"other": "hello"},
+			expected: mapstr.M{"other": "hello"},
+		},
+		"field is not a string": {
+			config: map[string]interface{}{
+				"patterns": []string{"%{WORD:word}"},
+			},
+			fields:   mapstr.M{"message": 42},
+			expected: mapstr.M{"message": 42},
+			err:      true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, err := conf.NewConfigFrom(test.config)
+			require.NoError(t, err)
+			p, err := NewProcessor(c, logptest.NewTestingLogger(t, ""))
+			require.NoError(t, err)
+
+			event, err := p.Run(&beat.Event{Fields: test.fields})
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expected, event.Fields)
+		})
+	}
+}
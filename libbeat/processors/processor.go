@@ -159,20 +159,67 @@ func (procs *Processors) Close() error {
 
 // Run executes the all processors serially and returns the event and possibly
 // an error. If the event has been dropped (canceled) by a processor in the
-// list then a nil event is returned.
+// list then a nil event is returned. If a processor turned the event into
+// several events, only the first one is returned; use RunMulti to get all
+// of them.
 func (procs *Processors) Run(event *beat.Event) (*beat.Event, error) {
-	var err error
-	for _, p := range procs.List {
-		event, err = p.Run(event)
+	return beat.SingleEvent(procs.RunMulti(event))
+}
+
+// RunMulti executes the all processors serially and returns the resulting
+// events and possibly an error. When a processor turns the event into
+// several events, the remaining processors are executed on each of them.
+func (procs *Processors) RunMulti(event *beat.Event) ([]*beat.Event, error) {
+	for i, p := range procs.List {
+		mp, ok := p.(beat.MultiEventProcessor)
+		if !ok {
+			var err error
+			event, err = p.Run(event)
+			if err != nil {
+				return asList(event), fmt.Errorf("failed applying processor %v: %w", p, err)
+			}
+			if event == nil {
+				// Drop.
+				return nil, nil
+			}
+			continue
+		}
+
+		events, err := mp.RunMulti(event)
 		if err != nil {
-			return event, fmt.Errorf("failed applying processor %v: %w", p, err)
+			return events, fmt.Errorf("failed applying processor %v: %w", p, err)
 		}
-		if event == nil {
+		switch len(events) {
+		case 0:
 			// Drop.
 			return nil, nil
+		case 1:
+			event = events[0]
+			continue
+		}
+
+		rest := &Processors{List: procs.List[i+1:], log: procs.log}
+		var (
+			out  []*beat.Event
+			errs []error
+		)
+		for _, e := range events {
+			res, err := rest.RunMulti(e)
+			out = append(out, res...)
+			if err != nil {
+				errs = append(errs, err)
+			}
 		}
+		return out, errors.Join(errs...)
+	}
+	return []*beat.Event{event}, nil
+}
+
+func asList(event *beat.Event) []*beat.Event {
+	if event == nil {
+		return nil
 	}
-	return event, nil
+	return []*beat.Event{event}
 }
 
 func (procs Processors) String() string {
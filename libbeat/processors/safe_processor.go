@@ -41,6 +41,20 @@ func (p *SafeProcessor) Run(event *beat.Event) (*beat.Event, error) {
 	return p.Processor.Run(event)
 }
 
+// SafeMultiProcessor is a SafeProcessor wrapping a processor that can turn
+// an event into several events.
+type SafeMultiProcessor struct {
+	SafeProcessor
+}
+
+// RunMulti allows to run processor only when `Close` was not called prior
+func (p *SafeMultiProcessor) RunMulti(event *beat.Event) ([]*beat.Event, error) {
+	if atomic.LoadUint32(&p.closed) == 1 {
+		return nil, ErrClosed
+	}
+	return p.Processor.(beat.MultiEventProcessor).RunMulti(event)
+}
+
 // Close makes sure the underlying `Close` function is called only once.
 func (p *SafeProcessor) Close() (err error) {
 	if atomic.CompareAndSwapUint32(&p.closed, 0, 1) {
@@ -73,6 +87,11 @@ func SafeWrap(constructor Constructor) Constructor {
 			return processor, nil
 		}
 
+		if _, ok := processor.(beat.MultiEventProcessor); ok {
+			return &SafeMultiProcessor{
+				SafeProcessor{Processor: processor},
+			}, nil
+		}
 		return &SafeProcessor{
 			Processor: processor,
 		}, nil
@@ -130,3 +130,36 @@ func TestSafeProcessor(t *testing.T) {
 		require.Equal(t, 2, p.runCount)
 	})
 }
+
+type mockCloserMultiProcessor struct {
+	mockCloserProcessor
+	runMultiCount int
+}
+
+func (p *mockCloserMultiProcessor) RunMulti(event *beat.Event) ([]*beat.Event, error) {
+	p.runMultiCount++
+	return []*beat.Event{mockEvent, mockEvent}, nil
+}
+
+func TestSafeMultiProcessor(t *testing.T) {
+	p := &mockCloserMultiProcessor{}
+	sw := SafeWrap(func(config *config.C, _ *logp.Logger) (beat.Processor, error) {
+		return p, nil
+	})
+	sp, err := sw(nil, nil)
+	require.NoError(t, err)
+	require.IsType(t, &SafeMultiProcessor{}, sp)
+
+	events, err := beat.RunProcessor(sp, nil)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, 1, p.runMultiCount)
+
+	require.NoError(t, Close(sp))
+	require.Equal(t, 1, p.closeCount)
+
+	events, err = beat.RunProcessor(sp, nil)
+	require.Nil(t, events)
+	require.ErrorIs(t, err, ErrClosed)
+	require.Equal(t, 1, p.runMultiCount)
+}
@@ -0,0 +1,197 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package split
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/jsontransform"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type split struct {
+	splitConfig
+
+	log *logp.Logger
+}
+
+var (
+	errFieldIsNotArray    = errors.New("field value is not an array")
+	errElementIsNotObject = errors.New("array element is not an object")
+)
+
+const (
+	procName = "split"
+	logName  = "processor." + procName
+)
+
+// The processor is not registered for the javascript processor because
+// the javascript API only allows to return a single event.
+func init() {
+	processors.RegisterPlugin(procName,
+		checks.ConfigChecked(New,
+			checks.RequireFields("field"),
+			checks.AllowedFields(
+				"field", "target_field",
+				"overwrite_keys", "ignore_missing",
+				"ignore_failure", "when",
+			)))
+}
+
+// New constructs a new split processor.
+func New(c *config.C, log *logp.Logger) (beat.Processor, error) {
+	config := defaultConfig()
+
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the "+procName+" processor configuration: %w", err)
+	}
+
+	return newSplit(config, log)
+}
+
+func newSplit(config splitConfig, logger *logp.Logger) (*split, error) {
+	// Default target to overwriting field.
+	if config.Target == nil {
+		config.Target = &config.Field
+	}
+
+	return &split{
+		splitConfig: config,
+		log:         logger.Named(logName),
+	}, nil
+}
+
+// Run splits the event and returns the first resulting event only. The
+// pipeline calls RunMulti, which returns all of them.
+func (p *split) Run(event *beat.Event) (*beat.Event, error) {
+	return beat.SingleEvent(p.RunMulti(event))
+}
+
+// RunMulti returns one event per element of the configured array field.
+// Each event is a copy of the original event, without the array, and the
+// element stored in the target field.
+func (p *split) RunMulti(event *beat.Event) ([]*beat.Event, error) {
+	events, err := p.split(event)
+	if err != nil && !p.IgnoreFailure {
+		err = fmt.Errorf("failed in split on the %q field: %w", p.Field, err)
+		_, _ = event.PutValue("error.message", err.Error())
+		return []*beat.Event{event}, err
+	}
+	if err != nil {
+		return []*beat.Event{event}, nil
+	}
+	return events, nil
+}
+
+func (p *split) split(event *beat.Event) ([]*beat.Event, error) {
+	data, err := event.GetValue(p.Field)
+	if err != nil {
+		if p.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return []*beat.Event{event}, nil
+		}
+		return nil, err
+	}
+
+	elems, err := toSlice(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(elems) == 0 {
+		return []*beat.Event{event}, nil
+	}
+
+	// Check all elements before touching the event, so that a failure
+	// leaves it untouched.
+	var objects []map[string]interface{}
+	if *p.Target == "" {
+		objects = make([]map[string]interface{}, len(elems))
+		for i, elem := range elems {
+			obj, ok := toObject(elem)
+			if !ok {
+				return nil, fmt.Errorf("element %d: %w", i, errElementIsNotObject)
+			}
+			objects[i] = obj
+		}
+	}
+
+	_ = event.Delete(p.Field)
+
+	events := make([]*beat.Event, len(elems))
+	for i, elem := range elems {
+		// The last event reuses the original one, so all others must be
+		// cloned before it gets modified.
+		e := event
+		if i < len(elems)-1 {
+			e = event.Clone()
+		}
+
+		if objects != nil {
+			jsontransform.WriteJSONKeys(e, objects[i], false, p.OverwriteKeys, !p.IgnoreFailure)
+		} else if _, err := e.PutValue(*p.Target, elem); err != nil {
+			return nil, fmt.Errorf("failed to put element %d into field %q: %w", i, *p.Target, err)
+		}
+		events[i] = e
+	}
+	return events, nil
+}
+
+func toSlice(v interface{}) ([]interface{}, error) {
+	switch v := v.(type) {
+	case []interface{}:
+		return v, nil
+	case []mapstr.M:
+		out := make([]interface{}, len(v))
+		for i, m := range v {
+			out[i] = m
+		}
+		return out, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, errFieldIsNotArray
+	}
+	out := make([]interface{}, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out, nil
+}
+
+func toObject(v interface{}) (map[string]interface{}, bool) {
+	switch v := v.(type) {
+	case mapstr.M:
+		return v, true
+	case map[string]interface{}:
+		return v, true
+	}
+	return nil, false
+}
+
+func (p *split) String() string {
+	json, _ := json.Marshal(p.splitConfig)
+	return procName + "=" + string(json)
+}
@@ -0,0 +1,224 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package split
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	_ "github.com/elastic/beats/v7/libbeat/processors/actions"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+var (
+	testItemTargetField = "item"
+	testRootTargetField = ""
+)
+
+func TestSplit(t *testing.T) {
+	var testCases = []struct {
+		description string
+		config      splitConfig
+		input       mapstr.M
+		output      []mapstr.M
+		error       bool
+	}{
+		{
+			description: "element replaces the array",
+			config:      splitConfig{Field: "records"},
+			input: mapstr.M{
+				"source":  "bucket",
+				"records": []interface{}{"a", "b", "c"},
+			},
+			output: []mapstr.M{
+				{"source": "bucket", "records": "a"},
+				{"source": "bucket", "records": "b"},
+				{"source": "bucket", "records": "c"},
+			},
+		},
+		{
+			description: "element in target field",
+			config:      splitConfig{Field: "records", Target: &testItemTargetField},
+			input: mapstr.M{
+				"source":  "bucket",
+				"records": []int{1, 2},
+			},
+			output: []mapstr.M{
+				{"source": "bucket", "item": 1},
+				{"source": "bucket", "item": 2},
+			},
+		},
+		{
+			description: "objects merged into the root",
+			config:      splitConfig{Field: "Records", Target: &testRootTargetField, OverwriteKeys: true},
+			input: mapstr.M{
+				"source": "bucket",
+				"Records": []interface{}{
+					map[string]interface{}{"eventName": "GetObject", "source": "s3"},
+					mapstr.M{"eventName": "PutObject"},
+				},
+			},
+			output: []mapstr.M{
+				{"source": "s3", "eventName": "GetObject"},
+				{"source": "bucket", "eventName": "PutObject"},
+			},
+		},
+		{
+			description: "nested field",
+			config:      splitConfig{Field: "json.Records", Target: &testItemTargetField},
+			input: mapstr.M{
+				"json": mapstr.M{"Records": []mapstr.M{{"id": 1}, {"id": 2}}, "other": true},
+			},
+			output: []mapstr.M{
+				{"json": mapstr.M{"other": true}, "item": mapstr.M{"id": 1}},
+				{"json": mapstr.M{"other": true}, "item": mapstr.M{"id": 2}},
+			},
+		},
+		{
+			description: "empty array keeps the event",
+			config:      splitConfig{Field: "records"},
+			input:       mapstr.M{"records": []interface{}{}},
+			output:      []mapstr.M{{"records": []interface{}{}}},
+		},
+		{
+			description: "missing field",
+			config:      splitConfig{Field: "records"},
+			input:       mapstr.M{"message": "hello"},
+			output: []mapstr.M{{
+				"message": "hello",
+				"error":   mapstr.M{"message": `failed in split on the "records" field: key not found`},
+			}},
+			error: true,
+		},
+		{
+			description: "missing field with ignore_missing",
+			config:      splitConfig{Field: "records", IgnoreMissing: true},
+			input:       mapstr.M{"message": "hello"},
+			output:      []mapstr.M{{"message": "hello"}},
+		},
+		{
+			description: "field is not an array",
+			config:      splitConfig{Field: "records"},
+			input:       mapstr.M{"records": "a"},
+			output: []mapstr.M{{
+				"records": "a",
+				"error":   mapstr.M{"message": `failed in split on the "records" field: field value is not an array`},
+			}},
+			error: true,
+		},
+		{
+			description: "field is not an array with ignore_failure",
+			config:      splitConfig{Field: "records", IgnoreFailure: true},
+			input:       mapstr.M{"records": "a"},
+			output:      []mapstr.M{{"records": "a"}},
+		},
+		{
+			description: "element is not an object when merging into the root",
+			config:      splitConfig{Field: "records", Target: &testRootTargetField},
+			input:       mapstr.M{"records": []interface{}{mapstr.M{"a": 1}, "b"}},
+			output: []mapstr.M{{
+				"records": []interface{}{mapstr.M{"a": 1}, "b"},
+				"error":   mapstr.M{"message": `failed in split on the "records" field: element 1: array element is not an object`},
+			}},
+			error: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.description, func(t *testing.T) {
+			p, err := newSplit(test.config, logptest.NewTestingLogger(t, ""))
+			require.NoError(t, err)
+
+			events, err := p.RunMulti(&beat.Event{Fields: test.input})
+			if test.error {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			fields := make([]mapstr.M, len(events))
+			for i, e := range events {
+				fields[i] = e.Fields
+			}
+			assert.Equal(t, test.output, fields)
+		})
+	}
+}
+
+func TestSplitCopiesParent(t *testing.T) {
+	p, err := newSplit(splitConfig{Field: "records"}, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+
+	event := &beat.Event{
+		Fields: mapstr.M{"records": []interface{}{"a", "b"}, "host": mapstr.M{"name": "x"}},
+		Meta:   mapstr.M{"pipeline": "p"},
+	}
+	events, err := p.RunMulti(event)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	_, _ = events[0].PutValue("host.name", "changed")
+	assert.Equal(t, mapstr.M{"name": "x"}, events[1].Fields["host"])
+	assert.Equal(t, mapstr.M{"pipeline": "p"}, events[0].Meta)
+	assert.Equal(t, mapstr.M{"pipeline": "p"}, events[1].Meta)
+}
+
+func TestSplitInProcessors(t *testing.T) {
+	c := conf.MustNewConfigFrom(`
+- split:
+    field: records
+- add_fields:
+    target: ""
+    fields:
+      processed: true
+`)
+	var pluginConfig processors.PluginConfig
+	require.NoError(t, c.Unpack(&pluginConfig))
+
+	procs, err := processors.New(pluginConfig, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+
+	events, err := procs.RunMulti(&beat.Event{Fields: mapstr.M{"records": []interface{}{"a", "b"}}})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, mapstr.M{"records": "a", "processed": true}, events[0].Fields)
+	assert.Equal(t, mapstr.M{"records": "b", "processed": true}, events[1].Fields)
+
+	event, err := procs.Run(&beat.Event{Fields: mapstr.M{"records": []interface{}{"a", "b"}}})
+	assert.ErrorIs(t, err, beat.ErrMultipleEvents)
+	assert.Equal(t, mapstr.M{"records": "a", "processed": true}, event.Fields)
+}
+
+func TestUnknownOption(t *testing.T) {
+	c := conf.MustNewConfigFrom(`
+- split:
+    field: records
+    unknown: true
+`)
+	var pluginConfig processors.PluginConfig
+	require.NoError(t, c.Unpack(&pluginConfig))
+
+	_, err := processors.New(pluginConfig, logptest.NewTestingLogger(t, ""))
+	assert.Error(t, err)
+}
@@ -0,0 +1,167 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/ua-parser/uap-go/uaparser"
+	"gopkg.in/yaml.v3"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	cfg "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// regexes are the default user agent parsing rules. They are embedded in
+// the binary and can be replaced at runtime with the regexes_file setting.
+//
+//go:embed regexes.yaml
+var regexes []byte
+
+// unknown is the name the parser gives to unrecognized user agents,
+// operating systems and devices.
+const unknown = "Other"
+
+type processor struct {
+	config config
+	parser *uaparser.Parser
+	cache  *lru.Cache[string, mapstr.M]
+}
+
+func init() {
+	processors.RegisterPlugin("user_agent", NewProcessor)
+	jsprocessor.RegisterPlugin("UserAgent", NewProcessor)
+}
+
+// NewProcessor constructs a new user_agent processor.
+func NewProcessor(c *cfg.C, log *logp.Logger) (beat.Processor, error) {
+	config := defaultConfig
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the user_agent configuration: %w", err)
+	}
+
+	definitions := regexes
+	if config.RegexesFile != "" {
+		var err error
+		if definitions, err = os.ReadFile(config.RegexesFile); err != nil {
+			return nil, fmt.Errorf("failed to read user agent regexes: %w", err)
+		}
+	}
+	parser, err := newParser(definitions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user agent regexes: %w", err)
+	}
+
+	p := &processor{config: config, parser: parser}
+	if config.CacheSize > 0 {
+		if p.cache, err = lru.New[string, mapstr.M](config.CacheSize); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// newParser returns a parser using the uap-core regexes contained in data.
+func newParser(data []byte) (parser *uaparser.Parser, err error) {
+	var definitions uaparser.RegexDefinitions
+	if err := yaml.Unmarshal(data, &definitions); err != nil {
+		return nil, err
+	}
+	if len(definitions.UA) == 0 {
+		return nil, errors.New("no user_agent_parsers defined")
+	}
+
+	// The parser panics if a regular expression does not compile.
+	defer func() {
+		if r := recover(); r != nil {
+			parser, err = nil, fmt.Errorf("invalid regular expression: %v", r)
+		}
+	}()
+	// Results are cached by the processor, so keep the cache of the parser
+	// to the minimum.
+	return uaparser.New(uaparser.WithRegexDefinitions(definitions), uaparser.WithCacheSize(1))
+}
+
+// Run parses the user agent contained in the configured field and adds the
+// ECS user agent fields to the event.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	v, err := event.GetValue(p.config.Field)
+	if err != nil {
+		if p.config.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return event, nil
+		}
+		return event, err
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return event, fmt.Errorf("field is not a string, value: `%v`, field: `%s`", v, p.config.Field)
+	}
+
+	for k, v := range p.parse(s) {
+		if _, err := event.PutValue(p.config.Target+"."+k, v); err != nil {
+			return event, fmt.Errorf("cannot set key `%s`: %w", p.config.Target+"."+k, err)
+		}
+	}
+	return event, nil
+}
+
+// parse returns the user agent fields of s. A cached result is returned if
+// it is contained in the cache, otherwise s is parsed.
+func (p *processor) parse(s string) mapstr.M {
+	if p.cache != nil {
+		if fields, found := p.cache.Get(s); found {
+			return fields.Clone()
+		}
+	}
+
+	client := p.parser.Parse(s)
+	fields := mapstr.M{"name": client.UserAgent.Family}
+	if version := client.UserAgent.ToVersionString(); version != "" {
+		fields["version"] = version
+	}
+	if client.Os.Family != unknown {
+		osFields := mapstr.M{
+			"name": client.Os.Family,
+			"full": client.Os.ToString(),
+		}
+		if version := client.Os.ToVersionString(); version != "" {
+			osFields["version"] = version
+		}
+		fields["os"] = osFields
+	}
+	fields["device"] = mapstr.M{"name": client.Device.Family}
+
+	if p.cache != nil {
+		p.cache.Add(s, fields.Clone())
+	}
+	return fields
+}
+
+func (p *processor) String() string {
+	return "user_agent=[field=" + p.config.Field +
+		", target_field=" + p.config.Target + "]"
+}
@@ -0,0 +1,181 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newTestProcessor(t *testing.T, config map[string]interface{}) *processor {
+	t.Helper()
+
+	c, err := conf.NewConfigFrom(config)
+	require.NoError(t, err)
+	p, err := NewProcessor(c, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	return p.(*processor)
+}
+
+func TestProcessor(t *testing.T) {
+	tests := map[string]struct {
+		userAgent string
+		expected  mapstr.M
+	}{
+		"desktop browser": {
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_9_2) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/33.0.1750.149 Safari/537.36",
+			expected: mapstr.M{
+				"name":    "Chrome",
+				"version": "33.0.1750",
+				"os": mapstr.M{
+					"name":    "Mac OS X",
+					"version": "10.9.2",
+					"full":    "Mac OS X 10.9.2",
+				},
+				"device": mapstr.M{"name": "Mac"},
+			},
+		},
+		"mobile browser": {
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 12_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.0 Mobile/15E148 Safari/604.1",
+			expected: mapstr.M{
+				"name":    "Mobile Safari",
+				"version": "12.0",
+				"os": mapstr.M{
+					"name":    "iOS",
+					"version": "12.1",
+					"full":    "iOS 12.1",
+				},
+				"device": mapstr.M{"name": "iPhone"},
+			},
+		},
+		"command line tool": {
+			userAgent: "curl/7.68.0",
+			expected: mapstr.M{
+				"name":    "curl",
+				"version": "7.68.0",
+				"device":  mapstr.M{"name": "Other"},
+			},
+		},
+		"unknown": {
+			userAgent: "definitely not a browser",
+			expected: mapstr.M{
+				"name":   "Other",
+				"device": mapstr.M{"name": "Other"},
+			},
+		},
+	}
+
+	p := newTestProcessor(t, map[string]interface{}{})
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The second run is served from the cache.
+			for i := 0; i < 2; i++ {
+				event, err := p.Run(&beat.Event{
+					Fields: mapstr.M{"user_agent": mapstr.M{"original": test.userAgent}},
+				})
+				require.NoError(t, err)
+
+				test.expected["original"] = test.userAgent
+				assert.Equal(t, test.expected, event.Fields["user_agent"])
+			}
+		})
+	}
+	assert.Equal(t, len(tests), p.cache.Len())
+}
+
+func TestProcessorFields(t *testing.T) {
+	p := newTestProcessor(t, map[string]interface{}{
+		"field":          "http.request.headers.user-agent",
+		"target_field":   "client.user_agent",
+		"ignore_missing": true,
+		"cache_size":     0,
+	})
+
+	event, err := p.Run(&beat.Event{
+		Fields: mapstr.M{"http": mapstr.M{"request": mapstr.M{"headers": mapstr.M{"user-agent": "curl/7.68.0"}}}},
+	})
+	require.NoError(t, err)
+	v, err := event.GetValue("client.user_agent.name")
+	require.NoError(t, err)
+	assert.Equal(t, "curl", v)
+	assert.Nil(t, p.cache)
+
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"message": "hello"}})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{"message": "hello"}, event.Fields)
+}
+
+func TestProcessorErrors(t *testing.T) {
+	p := newTestProcessor(t, map[string]interface{}{})
+
+	_, err := p.Run(&beat.Event{Fields: mapstr.M{"message": "hello"}})
+	assert.Error(t, err)
+
+	_, err = p.Run(&beat.Event{Fields: mapstr.M{"user_agent": mapstr.M{"original": 42}}})
+	assert.Error(t, err)
+}
+
+func TestRegexesFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	valid := write("valid.yaml", `
+user_agent_parsers:
+  - regex: '(InternalCrawler)/(\d+)\.(\d+)'
+os_parsers: []
+device_parsers: []
+`)
+	p := newTestProcessor(t, map[string]interface{}{"regexes_file": valid})
+	event, err := p.Run(&beat.Event{
+		Fields: mapstr.M{"user_agent": mapstr.M{"original": "InternalCrawler/2.1"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{
+		"original": "InternalCrawler/2.1",
+		"name":     "InternalCrawler",
+		"version":  "2.1",
+		"device":   mapstr.M{"name": "Other"},
+	}, event.Fields["user_agent"])
+
+	for name, path := range map[string]string{
+		"missing file":  filepath.Join(dir, "missing.yaml"),
+		"invalid yaml":  write("invalid.yaml", "user_agent_parsers: ["),
+		"no parsers":    write("empty.yaml", "os_parsers: []\n"),
+		"invalid regex": write("regex.yaml", "user_agent_parsers:\n  - regex: '(unclosed'\n"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := conf.NewConfigFrom(map[string]interface{}{"regexes_file": path})
+			require.NoError(t, err)
+			_, err = NewProcessor(c, logptest.NewTestingLogger(t, ""))
+			assert.Error(t, err)
+		})
+	}
+}
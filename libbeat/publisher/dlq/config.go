@@ -0,0 +1,103 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dlq
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+// Storage policies, deciding which entries are given up on once the dead
+// letter queue reaches max_size.
+const (
+	// DropNewer doesn't store new entries while the queue is full.
+	DropNewer = "drop_newer"
+
+	// DropOlder deletes the oldest segments to make room for new entries.
+	DropOlder = "drop_older"
+)
+
+// Config holds the settings of the dead letter queue, configured under
+// dead_letter_queue in the beat configuration.
+type Config struct {
+	Enabled bool `config:"enabled"`
+
+	// The directory holding the segment files. If blank, the directory is
+	// "dead_letter_queue" within the beat's data directory.
+	Path string `config:"path"`
+
+	// MaxSize is the maximum number of bytes the queue occupies on disk.
+	MaxSize cfgtype.ByteSize `config:"max_size"`
+
+	// SegmentSize is the number of bytes written to a segment file before
+	// a new one is created.
+	SegmentSize cfgtype.ByteSize `config:"segment_size"`
+
+	StoragePolicy string `config:"storage_policy"`
+}
+
+// DefaultConfig returns the default settings of the dead letter queue, which
+// is disabled.
+func DefaultConfig() Config {
+	return Config{
+		MaxSize:       1024 * 1024 * 1024,
+		SegmentSize:   10 * 1024 * 1024,
+		StoragePolicy: DropNewer,
+	}
+}
+
+// ReadConfig unpacks the dead_letter_queue settings on top of the defaults.
+// A nil cfg returns the defaults.
+func ReadConfig(cfg *config.C) (Config, error) {
+	c := DefaultConfig()
+	if cfg == nil {
+		return c, nil
+	}
+	if err := cfg.Unpack(&c); err != nil {
+		return c, fmt.Errorf("invalid dead_letter_queue configuration: %w", err)
+	}
+	return c, nil
+}
+
+func (c *Config) Validate() error {
+	if c.SegmentSize <= 0 {
+		return errors.New("dead letter queue segment_size must be greater than 0")
+	}
+	if c.MaxSize < c.SegmentSize {
+		return fmt.Errorf(
+			"dead letter queue max_size (%d) can't be less than segment_size (%d)",
+			c.MaxSize, c.SegmentSize)
+	}
+	switch c.StoragePolicy {
+	case DropNewer, DropOlder:
+	default:
+		return fmt.Errorf("unknown dead letter queue storage_policy '%v'", c.StoragePolicy)
+	}
+	return nil
+}
+
+func (c *Config) directory() string {
+	if c.Path == "" {
+		return paths.Resolve(paths.Data, "dead_letter_queue")
+	}
+	return c.Path
+}
@@ -0,0 +1,184 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dlq
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/go-structform/gotype"
+	"github.com/elastic/go-structform/json"
+)
+
+// EntryID identifies an entry by the segment holding it and its position in
+// the segment. IDs are stable until the segment is rewritten by Remove.
+type EntryID struct {
+	Segment uint64
+	Index   uint64
+}
+
+func (id EntryID) String() string {
+	return fmt.Sprintf("%d-%d", id.Segment, id.Index)
+}
+
+// ParseEntryID parses the string form of an EntryID.
+func ParseEntryID(s string) (EntryID, error) {
+	var id EntryID
+	if _, err := fmt.Sscanf(s, "%d-%d", &id.Segment, &id.Index); err != nil {
+		return id, fmt.Errorf("invalid entry id '%v'", s)
+	}
+	return id, nil
+}
+
+// Entry is an event an output failed to publish, along with the output and
+// the error.
+type Entry struct {
+	ID        EntryID
+	Timestamp time.Time
+	Output    string
+	Error     string
+	Event     beat.Event
+}
+
+// MarshalJSON encodes the entry the way it is stored, including its ID.
+func (e *Entry) MarshalJSON() ([]byte, error) {
+	return newEncoder().encode(e, true)
+}
+
+// record is the serialized form of an entry. The event is stored as the
+// document an output would send, including @timestamp and @metadata.
+type record struct {
+	ID        string   `struct:"id,omitempty"`
+	Timestamp string   `struct:"timestamp"`
+	Output    string   `struct:"output"`
+	Error     string   `struct:"error"`
+	Event     mapstr.M `struct:"event"`
+}
+
+type encoder struct {
+	buf    bytes.Buffer
+	folder *gotype.Iterator
+}
+
+func newEncoder() *encoder {
+	e := &encoder{}
+	e.reset()
+	return e
+}
+
+func (e *encoder) reset() {
+	visitor := json.NewVisitor(&e.buf)
+	// NewIterator only fails on invalid options, and these are fixed.
+	folder, _ := gotype.NewIterator(visitor,
+		gotype.Folders(
+			codec.MakeTimestampEncoder(),
+			codec.MakeBCTimestampEncoder(),
+		),
+	)
+	e.folder = folder
+}
+
+// encode serializes the entry. The ID is only included if withID is set,
+// since it is derived from the position of the entry on disk.
+func (e *encoder) encode(entry *Entry, withID bool) ([]byte, error) {
+	e.buf.Reset()
+
+	document := make(mapstr.M, len(entry.Event.Fields)+2)
+	for k, v := range entry.Event.Fields {
+		document[k] = v
+	}
+	document["@timestamp"] = entry.Event.Timestamp.UTC().Format(time.RFC3339Nano)
+	if len(entry.Event.Meta) > 0 {
+		document["@metadata"] = entry.Event.Meta
+	}
+
+	r := record{
+		Timestamp: entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		Output:    entry.Output,
+		Error:     entry.Error,
+		Event:     document,
+	}
+	if withID {
+		r.ID = entry.ID.String()
+	}
+	if err := e.folder.Fold(r); err != nil {
+		e.reset()
+		return nil, err
+	}
+
+	// Copy the encoded bytes to a new array owned by the caller.
+	result := make([]byte, e.buf.Len())
+	copy(result, e.buf.Bytes())
+	return result, nil
+}
+
+// decode parses an entry serialized by encode.
+func decode(data []byte) (Entry, error) {
+	var r record
+	unfolder, err := gotype.NewUnfolder(&r)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := json.Parse(data, unfolder); err != nil {
+		return Entry{}, err
+	}
+
+	entry := Entry{
+		Output: r.Output,
+		Error:  r.Error,
+	}
+	if entry.Timestamp, err = time.Parse(time.RFC3339Nano, r.Timestamp); err != nil {
+		return Entry{}, fmt.Errorf("invalid entry timestamp: %w", err)
+	}
+
+	fields := r.Event
+	if ts, ok := fields["@timestamp"].(string); ok {
+		if entry.Event.Timestamp, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+			return Entry{}, fmt.Errorf("invalid event timestamp: %w", err)
+		}
+	}
+	delete(fields, "@timestamp")
+	switch meta := fields["@metadata"].(type) {
+	case mapstr.M:
+		entry.Event.Meta = meta
+	case map[string]interface{}:
+		entry.Event.Meta = meta
+	}
+	delete(fields, "@metadata")
+	entry.Event.Fields = fields
+	return entry, nil
+}
+
+// eventContent returns the content of an event, decoding it if the output
+// already encoded it.
+func eventContent(event *publisher.Event) (beat.Event, error) {
+	if event.EncodedEvent == nil || event.Content.Fields != nil {
+		return event.Content, nil
+	}
+	decodable, ok := event.EncodedEvent.(publisher.DecodableEvent)
+	if !ok {
+		return beat.Event{}, errors.New("the event was encoded by the output and can't be decoded")
+	}
+	return decodable.DecodeEvent()
+}
@@ -0,0 +1,478 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dlq
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// Queue is a dead letter queue on local disk. Events an output failed to
+// publish permanently are appended to segment files along with the output
+// and the error, so they can be inspected, exported and replayed later.
+//
+// A Queue always appends to a new segment, created when the first entry is
+// added. Segments are only rewritten when entries are removed.
+type Queue struct {
+	logger *logp.Logger
+	config Config
+	dir    string
+
+	mu       sync.Mutex
+	segments []*segment
+
+	// The segment being written, nil until the first entry is added.
+	current *segment
+	file    *os.File
+	writer  *bufio.Writer
+
+	nextSegmentID uint64
+	encoder       *encoder
+
+	// The total size of the segments on disk.
+	size int64
+
+	metrics queueMetrics
+}
+
+type queueMetrics struct {
+	// Number of events stored.
+	events *monitoring.Uint
+
+	// Number of events that couldn't be stored because the queue is full,
+	// or that were deleted to make room with the drop_older policy.
+	dropped *monitoring.Uint
+
+	// Number of events that couldn't be stored because of an error.
+	failed *monitoring.Uint
+
+	// (Gauge) The size of the queue on disk.
+	bytes *monitoring.Uint
+}
+
+// Open opens the dead letter queue in the directory set in the config,
+// creating the directory if needed. If reg is not nil, the metrics of the
+// queue are reported in it.
+func Open(logger *logp.Logger, config Config, reg *monitoring.Registry) (*Queue, error) {
+	dir := config.directory()
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("couldn't create dead letter queue directory: %w", err)
+	}
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read dead letter queue directory: %w", err)
+	}
+
+	if reg == nil {
+		reg = monitoring.NewRegistry()
+	}
+	q := &Queue{
+		logger:   logger,
+		config:   config,
+		dir:      dir,
+		segments: segments,
+		encoder:  newEncoder(),
+		metrics: queueMetrics{
+			events:  monitoring.NewUint(reg, "events"),
+			dropped: monitoring.NewUint(reg, "dropped"),
+			failed:  monitoring.NewUint(reg, "failed"),
+			bytes:   monitoring.NewUint(reg, "bytes"),
+		},
+	}
+	for _, seg := range segments {
+		q.size += seg.size
+		q.nextSegmentID = seg.id + 1
+	}
+	q.metrics.bytes.Set(uint64(q.size))
+	return q, nil
+}
+
+// Add stores events the output failed to publish permanently. Events that
+// can't be stored are logged and counted, but not returned as an error, as
+// the output has already given up on them.
+func (q *Queue) Add(output string, events []publisher.Event, reason error) {
+	if len(events) == 0 {
+		return
+	}
+	reasonMsg := ""
+	if reason != nil {
+		reasonMsg = reason.Error()
+	}
+	now := time.Now()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range events {
+		content, err := eventContent(&events[i])
+		if err != nil {
+			q.logger.Errorf("Dead letter queue couldn't store event from output %v: %v", output, err)
+			q.metrics.failed.Inc()
+			continue
+		}
+
+		data, err := q.encoder.encode(&Entry{
+			Timestamp: now,
+			Output:    output,
+			Error:     reasonMsg,
+			Event:     content,
+		}, false)
+		if err != nil {
+			q.logger.Errorf("Dead letter queue couldn't encode event from output %v: %v", output, err)
+			q.metrics.failed.Inc()
+			continue
+		}
+
+		if err := q.write(data); err != nil {
+			if errors.Is(err, errFull) {
+				q.metrics.dropped.Inc()
+				continue
+			}
+			q.logger.Errorf("Dead letter queue couldn't write event from output %v: %v", output, err)
+			q.metrics.failed.Inc()
+			continue
+		}
+		q.metrics.events.Inc()
+	}
+
+	if q.writer != nil {
+		if err := q.flush(); err != nil {
+			q.logger.Errorf("Dead letter queue couldn't sync segment: %v", err)
+		}
+	}
+	q.metrics.bytes.Set(uint64(q.size))
+}
+
+var errFull = errors.New("dead letter queue is full")
+
+// write appends a frame holding data, rotating the segment and applying the
+// storage policy as needed. q.mu must be held by the caller.
+func (q *Queue) write(data []byte) error {
+	frameSize := int64(len(data) + frameMetadataSize)
+
+	if q.current != nil && q.current.frames > 0 &&
+		q.current.size+frameSize > int64(q.config.SegmentSize) {
+		if err := q.closeCurrent(); err != nil {
+			return err
+		}
+	}
+
+	needed := frameSize
+	if q.current == nil {
+		needed += segmentHeaderSize
+	}
+	for q.size+needed > int64(q.config.MaxSize) {
+		if q.config.StoragePolicy != DropOlder || len(q.segments) == 0 {
+			return errFull
+		}
+		if err := q.deleteOldest(); err != nil {
+			return err
+		}
+	}
+
+	if q.current == nil {
+		if err := q.createSegment(); err != nil {
+			return err
+		}
+	}
+	if err := writeFrame(q.writer, data); err != nil {
+		return err
+	}
+	q.current.size += frameSize
+	q.current.frames++
+	q.size += frameSize
+	return nil
+}
+
+func (q *Queue) createSegment() error {
+	seg := &segment{id: q.nextSegmentID, size: segmentHeaderSize}
+	file, err := os.OpenFile(segmentPath(q.dir, seg.id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("couldn't create segment: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	if err := writeSegmentHeader(writer); err != nil {
+		file.Close()
+		return fmt.Errorf("couldn't write segment header: %w", err)
+	}
+
+	q.nextSegmentID++
+	q.current, q.file, q.writer = seg, file, writer
+	q.size += segmentHeaderSize
+	return nil
+}
+
+func (q *Queue) flush() error {
+	if err := q.writer.Flush(); err != nil {
+		return err
+	}
+	return q.file.Sync()
+}
+
+// closeCurrent closes the segment being written, so that the next write
+// creates a new one.
+func (q *Queue) closeCurrent() error {
+	if q.current == nil {
+		return nil
+	}
+	err := q.flush()
+	if closeErr := q.file.Close(); err == nil {
+		err = closeErr
+	}
+	q.segments = append(q.segments, q.current)
+	q.current, q.file, q.writer = nil, nil, nil
+	return err
+}
+
+// deleteOldest deletes the oldest segment that isn't being written.
+func (q *Queue) deleteOldest() error {
+	seg := q.segments[0]
+	count, err := q.countEntries(seg)
+	if err != nil {
+		q.logger.Warnf("Dead letter queue couldn't count the entries of segment %d: %v", seg.id, err)
+	}
+	if err := os.Remove(segmentPath(q.dir, seg.id)); err != nil {
+		return fmt.Errorf("couldn't delete segment: %w", err)
+	}
+	q.logger.Warnf("Dead letter queue is full, deleted %d entries of segment %d", count, seg.id)
+	q.metrics.dropped.Add(uint64(count))
+	q.segments = q.segments[1:]
+	q.size -= seg.size
+	return nil
+}
+
+func (q *Queue) countEntries(seg *segment) (uint64, error) {
+	r, err := openSegment(segmentPath(q.dir, seg.id), seg.size)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	var count uint64
+	for {
+		_, _, err := r.next()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+// Scan calls fn with every entry in the queue, oldest first, until fn
+// returns an error. Segments ending with an incomplete entry are read up to
+// that entry.
+func (q *Queue) Scan(fn func(*Entry) error) error {
+	q.mu.Lock()
+	if q.writer != nil {
+		if err := q.writer.Flush(); err != nil {
+			q.mu.Unlock()
+			return err
+		}
+	}
+	// Copy the segments, so entries added while scanning are skipped.
+	segments := make([]segment, 0, len(q.segments)+1)
+	for _, seg := range q.segments {
+		segments = append(segments, *seg)
+	}
+	if q.current != nil {
+		segments = append(segments, *q.current)
+	}
+	q.mu.Unlock()
+
+	for _, seg := range segments {
+		if err := q.scanSegment(seg, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *Queue) scanSegment(seg segment, fn func(*Entry) error) error {
+	r, err := openSegment(segmentPath(q.dir, seg.id), seg.size)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// Deleted by the drop_older policy in the meantime.
+			return nil
+		}
+		return fmt.Errorf("couldn't open segment %d: %w", seg.id, err)
+	}
+	defer r.Close()
+
+	for {
+		index, data, err := r.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			q.logger.Warnf("Dead letter queue stopped reading segment %d: %v", seg.id, err)
+			return nil
+		}
+
+		entry, err := decode(data)
+		if err != nil {
+			q.logger.Warnf("Dead letter queue skipped entry %d of segment %d: %v", index, seg.id, err)
+			continue
+		}
+		entry.ID = EntryID{Segment: seg.id, Index: index}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+}
+
+// Remove deletes the entries with the given IDs, rewriting the segments
+// holding them. The IDs of the remaining entries of these segments change.
+// It returns the number of entries removed.
+func (q *Queue) Remove(ids []EntryID) (int, error) {
+	bySegment := map[uint64]map[uint64]bool{}
+	for _, id := range ids {
+		if bySegment[id.Segment] == nil {
+			bySegment[id.Segment] = map[uint64]bool{}
+		}
+		bySegment[id.Segment][id.Index] = true
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.current != nil && bySegment[q.current.id] != nil {
+		if err := q.closeCurrent(); err != nil {
+			return 0, err
+		}
+	}
+
+	removed := 0
+	segments := make([]*segment, 0, len(q.segments))
+	for i, seg := range q.segments {
+		indexes := bySegment[seg.id]
+		if indexes == nil {
+			segments = append(segments, seg)
+			continue
+		}
+
+		n, err := q.rewriteSegment(seg, indexes)
+		removed += n
+		if err != nil {
+			// Keep the segments not processed yet.
+			q.segments = append(segments, q.segments[i:]...)
+			q.metrics.bytes.Set(uint64(q.size))
+			return removed, err
+		}
+		if seg.size > 0 {
+			segments = append(segments, seg)
+		}
+	}
+	q.segments = segments
+	q.metrics.bytes.Set(uint64(q.size))
+	return removed, nil
+}
+
+// rewriteSegment rewrites seg without the frames at the given indexes,
+// deleting it if no frame is left.
+func (q *Queue) rewriteSegment(seg *segment, indexes map[uint64]bool) (int, error) {
+	path := segmentPath(q.dir, seg.id)
+	r, err := openSegment(path, seg.size)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	size, removed, kept, err := q.copyFrames(seg, r, file, indexes)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || kept == 0 {
+		os.Remove(tmpPath)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if kept == 0 {
+		if err := os.Remove(path); err != nil {
+			return 0, err
+		}
+		size = 0
+	} else if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	q.size += size - seg.size
+	seg.size = size
+	return removed, nil
+}
+
+// copyFrames copies the frames of r to file, except the ones at the given
+// indexes. It returns the size of the new segment, and the number of frames
+// removed and kept.
+func (q *Queue) copyFrames(seg *segment, r *segmentReader, file *os.File, indexes map[uint64]bool) (int64, int, int, error) {
+	writer := bufio.NewWriter(file)
+	if err := writeSegmentHeader(writer); err != nil {
+		return 0, 0, 0, err
+	}
+	size := int64(segmentHeaderSize)
+	removed, kept := 0, 0
+	for {
+		index, data, err := r.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Drop what can't be read, there is no way to recover it.
+			q.logger.Warnf("Dead letter queue stopped reading segment %d: %v", seg.id, err)
+			break
+		}
+		if indexes[index] {
+			removed++
+			continue
+		}
+		if err := writeFrame(writer, data); err != nil {
+			return 0, 0, 0, err
+		}
+		size += int64(len(data) + frameMetadataSize)
+		kept++
+	}
+	if err := writer.Flush(); err != nil {
+		return 0, 0, 0, err
+	}
+	return size, removed, kept, file.Sync()
+}
+
+// Close flushes and closes the segment being written.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closeCurrent()
+}
@@ -0,0 +1,271 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dlq
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func testConfig(t *testing.T) Config {
+	config := DefaultConfig()
+	config.Enabled = true
+	config.Path = t.TempDir()
+	return config
+}
+
+func openTestQueue(t *testing.T, config Config) (*Queue, *monitoring.Registry) {
+	reg := monitoring.NewRegistry()
+	q, err := Open(logptest.NewTestingLogger(t, ""), config, reg)
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close() })
+	return q, reg
+}
+
+func testEvents(n int) []publisher.Event {
+	events := make([]publisher.Event, n)
+	for i := range events {
+		events[i] = publisher.Event{Content: beat.Event{
+			Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC),
+			Meta:      mapstr.M{"index": "logs"},
+			Fields: mapstr.M{
+				"message": "hello",
+				"n":       i,
+				"nested":  mapstr.M{"big": int64(1) << 60},
+			},
+		}}
+	}
+	return events
+}
+
+func scanAll(t *testing.T, q *Queue) []*Entry {
+	var entries []*Entry
+	require.NoError(t, q.Scan(func(entry *Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	return entries
+}
+
+func TestAddAndScan(t *testing.T) {
+	q, reg := openTestQueue(t, testConfig(t))
+
+	q.Add("elasticsearch", testEvents(3), errors.New("mapping conflict"))
+
+	entries := scanAll(t, q)
+	require.Len(t, entries, 3)
+	for i, entry := range entries {
+		assert.Equal(t, EntryID{Segment: 0, Index: uint64(i)}, entry.ID)
+		assert.Equal(t, "elasticsearch", entry.Output)
+		assert.Equal(t, "mapping conflict", entry.Error)
+		assert.WithinDuration(t, time.Now(), entry.Timestamp, time.Minute)
+
+		event := entry.Event
+		assert.True(t, event.Timestamp.Equal(time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC)))
+		assert.Equal(t, "logs", event.Meta["index"])
+		assert.Equal(t, "hello", event.Fields["message"])
+		n, _ := event.Fields.GetValue("n")
+		assert.EqualValues(t, i, n)
+		big, _ := event.Fields.GetValue("nested.big")
+		assert.EqualValues(t, int64(1)<<60, big, "integers must not lose precision")
+	}
+
+	assert.Equal(t, uint64(3), reg.Get("events").(*monitoring.Uint).Get())
+	assert.Positive(t, reg.Get("bytes").(*monitoring.Uint).Get())
+}
+
+// decodableEvent is an encoded event that can be decoded, like the ones of
+// the elasticsearch output.
+type decodableEvent struct {
+	event beat.Event
+}
+
+func (e decodableEvent) DecodeEvent() (beat.Event, error) {
+	return e.event, nil
+}
+
+func TestAddEncodedEvents(t *testing.T) {
+	q, reg := openTestQueue(t, testConfig(t))
+
+	event := beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": "encoded"}}
+	q.Add("test", []publisher.Event{
+		{EncodedEvent: decodableEvent{event: event}},
+		{EncodedEvent: "not decodable"},
+	}, nil)
+
+	entries := scanAll(t, q)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "encoded", entries[0].Event.Fields["message"])
+	assert.Equal(t, uint64(1), reg.Get("failed").(*monitoring.Uint).Get())
+}
+
+func TestSegmentRotationAndReopen(t *testing.T) {
+	config := testConfig(t)
+	config.SegmentSize = 1024
+	q, _ := openTestQueue(t, config)
+
+	for i := 0; i < 10; i++ {
+		q.Add("test", testEvents(1), nil)
+	}
+	require.NoError(t, q.Close())
+
+	segments, err := listSegments(config.Path)
+	require.NoError(t, err)
+	assert.Greater(t, len(segments), 1)
+	for _, seg := range segments {
+		assert.LessOrEqual(t, seg.size, int64(1024))
+	}
+
+	// A new queue appends to a new segment.
+	q, _ = openTestQueue(t, config)
+	q.Add("test", testEvents(1), nil)
+	entries := scanAll(t, q)
+	require.Len(t, entries, 11)
+	assert.Equal(t, EntryID{Segment: segments[len(segments)-1].id + 1, Index: 0}, entries[10].ID)
+}
+
+func TestStoragePolicies(t *testing.T) {
+	for _, policy := range []string{DropNewer, DropOlder} {
+		t.Run(policy, func(t *testing.T) {
+			config := testConfig(t)
+			config.SegmentSize = 512
+			config.MaxSize = 2048
+			config.StoragePolicy = policy
+			q, reg := openTestQueue(t, config)
+
+			for i := 0; i < 50; i++ {
+				events := testEvents(1)
+				events[0].Content.Fields["n"] = i
+				q.Add("test", events, nil)
+			}
+
+			entries := scanAll(t, q)
+			require.NotEmpty(t, entries)
+			assert.LessOrEqual(t, q.size, int64(config.MaxSize))
+			assert.Equal(t, uint64(50), uint64(len(entries))+reg.Get("dropped").(*monitoring.Uint).Get())
+
+			first, _ := entries[0].Event.Fields.GetValue("n")
+			last, _ := entries[len(entries)-1].Event.Fields.GetValue("n")
+			if policy == DropNewer {
+				assert.EqualValues(t, 0, first, "the oldest entries are kept")
+			} else {
+				assert.EqualValues(t, 49, last, "the newest entries are kept")
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	config := testConfig(t)
+	config.SegmentSize = 1024
+	q, _ := openTestQueue(t, config)
+
+	for i := 0; i < 10; i++ {
+		events := testEvents(1)
+		events[0].Content.Fields["n"] = i
+		q.Add("test", events, nil)
+	}
+
+	entries := scanAll(t, q)
+	require.Len(t, entries, 10)
+
+	// Remove all entries of the first segment, and every other entry of the
+	// others.
+	var ids []EntryID
+	for i, entry := range entries {
+		if entry.ID.Segment == 0 || i%2 == 0 {
+			ids = append(ids, entry.ID)
+		}
+	}
+	removed, err := q.Remove(ids)
+	require.NoError(t, err)
+	assert.Equal(t, len(ids), removed)
+
+	_, err = os.Stat(segmentPath(config.Path, 0))
+	assert.True(t, os.IsNotExist(err), "empty segments are deleted")
+
+	var remaining []interface{}
+	for _, entry := range scanAll(t, q) {
+		n, _ := entry.Event.Fields.GetValue("n")
+		remaining = append(remaining, n)
+	}
+	assert.Len(t, remaining, 10-len(ids))
+	for _, n := range remaining {
+		assert.EqualValues(t, 1, n.(int64)%2)
+	}
+
+	// The queue keeps working after the segment being written is rewritten.
+	q.Add("test", testEvents(1), nil)
+	assert.Len(t, scanAll(t, q), 10-len(ids)+1)
+}
+
+func TestScanTruncatedSegment(t *testing.T) {
+	config := testConfig(t)
+	q, _ := openTestQueue(t, config)
+	q.Add("test", testEvents(2), nil)
+	require.NoError(t, q.Close())
+
+	// Simulate a crash while writing the last entry.
+	path := segmentPath(config.Path, 0)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-5))
+
+	q, _ = openTestQueue(t, config)
+	assert.Len(t, scanAll(t, q), 1)
+}
+
+func TestEntryIDs(t *testing.T) {
+	id, err := ParseEntryID("3-17")
+	require.NoError(t, err)
+	assert.Equal(t, EntryID{Segment: 3, Index: 17}, id)
+	assert.Equal(t, "3-17", id.String())
+
+	_, err = ParseEntryID("3")
+	assert.Error(t, err)
+}
+
+func TestReadConfig(t *testing.T) {
+	config, err := ReadConfig(nil)
+	require.NoError(t, err)
+	assert.False(t, config.Enabled)
+	assert.Equal(t, DropNewer, config.StoragePolicy)
+
+	config, err = ReadConfig(conf.MustNewConfigFrom(`{enabled: true, max_size: 10MiB, storage_policy: drop_older}`))
+	require.NoError(t, err)
+	assert.True(t, config.Enabled)
+	assert.EqualValues(t, 10*1024*1024, config.MaxSize)
+	assert.Equal(t, DropOlder, config.StoragePolicy)
+
+	_, err = ReadConfig(conf.MustNewConfigFrom(`{max_size: 1KiB, segment_size: 1MiB}`))
+	assert.Error(t, err)
+	_, err = ReadConfig(conf.MustNewConfigFrom(`storage_policy: keep_all`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,195 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dlq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Segment files use the same framing as the disk queue: after a header
+// holding the format version, each entry is stored in a frame with a 32-bit
+// length in the header, and a 32-bit checksum and a duplicate 32-bit length
+// in the footer.
+const (
+	segmentVersion    = 1
+	segmentHeaderSize = 4
+	segmentExtension  = ".seg"
+
+	frameHeaderSize   = 4
+	frameFooterSize   = 8
+	frameMetadataSize = frameHeaderSize + frameFooterSize
+)
+
+// segment is a segment file in the queue directory.
+type segment struct {
+	id uint64
+
+	// The size of the file, including its header.
+	size int64
+
+	// The number of frames, only known for the segment being written.
+	frames uint64
+}
+
+func segmentPath(dir string, id uint64) string {
+	return filepath.Join(dir, strconv.FormatUint(id, 10)+segmentExtension)
+}
+
+// listSegments returns the segments found in dir, ordered by id.
+func listSegments(dir string) ([]*segment, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []*segment
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasSuffix(name, segmentExtension+".tmp") {
+			// Left over by a Remove that was interrupted.
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if file.IsDir() || !strings.HasSuffix(name, segmentExtension) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, &segment{id: id, size: info.Size()})
+	}
+	// os.ReadDir sorts by name, which isn't the numeric order.
+	sort.Slice(segments, func(i, j int) bool { return segments[i].id < segments[j].id })
+	return segments, nil
+}
+
+// computeChecksum returns the checksum stored in the footer of a frame
+// holding data.
+func computeChecksum(data []byte) uint32 {
+	hash := crc32.NewIEEE()
+	frameLength := uint32(len(data) + frameMetadataSize)
+	_ = binary.Write(hash, binary.LittleEndian, &frameLength)
+	hash.Write(data)
+	return hash.Sum32()
+}
+
+func writeSegmentHeader(w io.Writer) error {
+	return binary.Write(w, binary.LittleEndian, uint32(segmentVersion))
+}
+
+func writeFrame(w io.Writer, data []byte) error {
+	frameLength := uint32(len(data) + frameMetadataSize)
+	if err := binary.Write(w, binary.LittleEndian, frameLength); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, computeChecksum(data)); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, frameLength)
+}
+
+// errTruncated is returned when a segment ends with an incomplete frame,
+// e.g. because the beat was killed while writing it.
+var errTruncated = errors.New("truncated frame")
+
+// segmentReader reads the frames of a segment file, up to a size.
+type segmentReader struct {
+	file   *os.File
+	reader *bufio.Reader
+	index  uint64
+	offset int64
+	limit  int64
+}
+
+func openSegment(path string, limit int64) (*segmentReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &segmentReader{file: file, reader: bufio.NewReader(file), limit: limit}
+	var version uint32
+	if err := binary.Read(r.reader, binary.LittleEndian, &version); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("couldn't read segment header: %w", err)
+	}
+	if version != segmentVersion {
+		file.Close()
+		return nil, fmt.Errorf("unsupported segment version %d", version)
+	}
+	r.offset = segmentHeaderSize
+	return r, nil
+}
+
+// next returns the index and the data of the next frame, or io.EOF at the
+// end of the segment.
+func (r *segmentReader) next() (uint64, []byte, error) {
+	if r.offset >= r.limit {
+		return 0, nil, io.EOF
+	}
+
+	var frameLength uint32
+	if err := binary.Read(r.reader, binary.LittleEndian, &frameLength); err != nil {
+		return 0, nil, errTruncated
+	}
+	if frameLength < frameMetadataSize || r.offset+int64(frameLength) > r.limit {
+		return 0, nil, errTruncated
+	}
+
+	data := make([]byte, frameLength-frameMetadataSize)
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		return 0, nil, errTruncated
+	}
+	var checksum, trailingLength uint32
+	if err := binary.Read(r.reader, binary.LittleEndian, &checksum); err != nil {
+		return 0, nil, errTruncated
+	}
+	if err := binary.Read(r.reader, binary.LittleEndian, &trailingLength); err != nil {
+		return 0, nil, errTruncated
+	}
+	if checksum != computeChecksum(data) || trailingLength != frameLength {
+		return 0, nil, fmt.Errorf("corrupted frame at offset %d", r.offset)
+	}
+
+	index := r.index
+	r.index++
+	r.offset += int64(frameLength)
+	return index, data, nil
+}
+
+func (r *segmentReader) Close() error {
+	return r.file.Close()
+}
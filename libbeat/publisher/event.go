@@ -18,6 +18,8 @@
 package publisher
 
 import (
+	"time"
+
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/elastic-agent-libs/mapstr"
 )
@@ -53,6 +55,39 @@ type Batch interface {
 	Cancelled()
 }
 
+// DeadLetterBatch is implemented by batches that store the events an output
+// gives up on in the dead letter queue, if it is enabled.
+type DeadLetterBatch interface {
+	Batch
+
+	// DeadLetter stores events the output failed to publish permanently,
+	// and that it won't retry, along with the reason. It doesn't complete
+	// the batch, the output still has to call ACK or RetryEvents.
+	DeadLetter(events []Event, err error)
+
+	// DropWithError drops the batch like Drop, storing its events along
+	// with the reason.
+	DropWithError(err error)
+}
+
+// DeadLetter stores events the output failed to publish permanently in the
+// dead letter queue, if the batch supports it.
+func DeadLetter(batch Batch, events []Event, err error) {
+	if b, ok := batch.(DeadLetterBatch); ok && len(events) > 0 {
+		b.DeadLetter(events, err)
+	}
+}
+
+// DropWithError drops the batch, storing its events in the dead letter queue
+// along with the reason if the batch supports it.
+func DropWithError(batch Batch, err error) {
+	if b, ok := batch.(DeadLetterBatch); ok {
+		b.DropWithError(err)
+		return
+	}
+	batch.Drop()
+}
+
 // Event is used by the publisher pipeline and broker to pass additional
 // meta-data to the consumers/outputs.
 type Event struct {
@@ -67,6 +102,20 @@ type Event struct {
 	EncodedEvent interface{}
 }
 
+// DecodableEvent is implemented by the encoded form of events that can be
+// decoded back into the original event, so that the event can be stored in
+// the dead letter queue after its content was cleared.
+type DecodableEvent interface {
+	DecodeEvent() (beat.Event, error)
+}
+
+// TimestampedEvent is implemented by the encoded form of events that keep
+// the timestamp of the original event, so that it can be read without
+// decoding the event.
+type TimestampedEvent interface {
+	Timestamp() time.Time
+}
+
 // EventFlags provides additional flags/option types  for used with the outputs.
 type EventFlags uint8
 
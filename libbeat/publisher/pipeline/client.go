@@ -34,8 +34,10 @@ type client struct {
 	logger     *logp.Logger
 	processors beat.Processor
 	producer   queue.Producer
+	acks       *clientACKs
 	mutex      sync.Mutex
 	waiter     *clientCloseWaiter
+	quota      *quotaClient
 
 	eventFlags publisher.EventFlags
 	canDrop    bool
@@ -74,11 +76,6 @@ func (c *client) Publish(e beat.Event) {
 }
 
 func (c *client) publish(e beat.Event) {
-	var (
-		event   = &e
-		publish = true
-	)
-
 	c.onNewEvent()
 
 	if !c.isOpen.Load() {
@@ -87,11 +84,11 @@ func (c *client) publish(e beat.Event) {
 		return
 	}
 
+	events := []*beat.Event{&e}
 	if c.processors != nil {
 		var err error
 
-		event, err = c.processors.Run(event)
-		publish = event != nil
+		events, err = beat.RunProcessor(c.processors, &e)
 		if err != nil {
 			// If we introduce a dead-letter queue, this is where we should
 			// route the event to it.
@@ -99,22 +96,39 @@ func (c *client) publish(e beat.Event) {
 		}
 	}
 
-	if event != nil {
-		e = *event
-	}
-
-	c.eventListener.AddEvent(e, publish)
-	if !publish {
+	if len(events) == 0 {
+		c.eventListener.AddEvent(e, false)
 		c.onFilteredOut()
 		return
 	}
 
-	e = *event
+	// The events created by processors splitting the event are new events
+	// for the pipeline, but the event listener is notified of the published
+	// event only, through the last event holding the input's private data.
+	for range events[1:] {
+		c.onNewEvent()
+	}
+	c.acks.add(len(events))
+	c.eventListener.AddEvent(*events[len(events)-1], true)
+
+	for _, event := range events {
+		c.push(*event)
+	}
+}
+
+// push pushes an event to the queue.
+func (c *client) push(e beat.Event) {
 	pubEvent := publisher.Event{
 		Content: e,
 		Flags:   c.eventFlags,
 	}
 
+	if !c.quota.acquire(!c.canDrop) {
+		c.acks.drop()
+		c.onDroppedOnPublish(e)
+		return
+	}
+
 	var published bool
 	if c.canDrop {
 		_, published = c.producer.TryPublish(pubEvent)
@@ -125,6 +139,8 @@ func (c *client) publish(e beat.Event) {
 	if published {
 		c.onPublished()
 	} else {
+		c.quota.release(1)
+		c.acks.drop()
 		c.onDroppedOnPublish(e)
 	}
 }
@@ -134,6 +150,9 @@ func (c *client) Close() error {
 		// Only do shutdown handling the first time Close is called
 		c.onClosing()
 
+		// Unblock Publish if it waits for the input quota.
+		c.quota.close()
+
 		c.logger.Debug("client: closing acker")
 		c.waiter.signalClose()
 		c.waiter.wait()
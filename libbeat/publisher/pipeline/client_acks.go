@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+)
+
+// clientACKs translates the ACKs of the events a client pushed to the queue
+// into ACKs of the events published by the client. Processors can turn an
+// event into several events, but the event listener of the client expects
+// one ACK per published event, once all the events created from it were
+// ACKed. The queue ACKs the events of a client in order.
+type clientACKs struct {
+	mu       sync.Mutex
+	listener beat.EventListener
+	pending  []ackGroup // groups of queued events, in publishing order
+	acked    int        // ACKed queued events not yet forwarded to the listener
+}
+
+// ackGroup is either a run of published events queued as a single event
+// each, or a published event queued as several events.
+type ackGroup struct {
+	events int // events in the queue not yet ACKed
+	split  bool
+}
+
+func newClientACKs(listener beat.EventListener) *clientACKs {
+	return &clientACKs{listener: listener}
+}
+
+// add registers a published event, before its n queued events are pushed
+// to the queue.
+func (a *clientACKs) add(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if n == 1 {
+		if last := len(a.pending) - 1; last >= 0 && !a.pending[last].split {
+			a.pending[last].events++
+			return
+		}
+	}
+	a.pending = append(a.pending, ackGroup{events: n, split: n > 1})
+}
+
+// drop unregisters a queued event of the last published event, because it
+// could not be pushed to the queue. Like for events that are not split, the
+// published event is never ACKed if none of its events were queued.
+func (a *clientACKs) drop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	last := len(a.pending) - 1
+	a.pending[last].events--
+	if a.pending[last].events == 0 {
+		a.pending = a.pending[:last]
+	}
+	// The dropped event might have been the last one of its published event
+	// to wait for.
+	a.forward()
+}
+
+// ack handles the ACK of n queued events.
+func (a *clientACKs) ack(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.acked += n
+	a.forward()
+}
+
+// forward notifies the listener of the published events whose queued
+// events were all ACKed. The lock is held while notifying the listener, so
+// ACKs are forwarded in order.
+func (a *clientACKs) forward() {
+	var n int
+	for len(a.pending) > 0 && a.acked > 0 {
+		g := &a.pending[0]
+		if g.split {
+			if a.acked < g.events {
+				break
+			}
+			a.acked -= g.events
+			n++
+		} else {
+			m := min(a.acked, g.events)
+			a.acked -= m
+			g.events -= m
+			n += m
+			if g.events > 0 {
+				break
+			}
+		}
+		a.pending = a.pending[1:]
+	}
+	if n > 0 {
+		a.listener.ACKEvents(n)
+	}
+}
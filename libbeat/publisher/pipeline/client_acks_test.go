@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+)
+
+type countingListener struct {
+	acked []int
+}
+
+func (l *countingListener) AddEvent(beat.Event, bool) {}
+func (l *countingListener) ACKEvents(n int)           { l.acked = append(l.acked, n) }
+func (l *countingListener) ClientClosed()             {}
+
+func TestClientACKs(t *testing.T) {
+	t.Run("single events are forwarded as is", func(t *testing.T) {
+		l := &countingListener{}
+		a := newClientACKs(l)
+		for i := 0; i < 3; i++ {
+			a.add(1)
+		}
+		a.ack(2)
+		a.ack(1)
+		assert.Equal(t, []int{2, 1}, l.acked)
+		assert.Empty(t, a.pending)
+	})
+
+	t.Run("split event is ACKed once all its events are ACKed", func(t *testing.T) {
+		l := &countingListener{}
+		a := newClientACKs(l)
+		a.add(1)
+		a.add(3)
+		a.add(1)
+
+		a.ack(2)
+		assert.Equal(t, []int{1}, l.acked)
+		a.ack(1)
+		assert.Equal(t, []int{1}, l.acked)
+		a.ack(2)
+		assert.Equal(t, []int{1, 2}, l.acked)
+		assert.Empty(t, a.pending)
+	})
+
+	t.Run("consecutive split events", func(t *testing.T) {
+		l := &countingListener{}
+		a := newClientACKs(l)
+		a.add(2)
+		a.add(2)
+
+		a.ack(4)
+		assert.Equal(t, []int{2}, l.acked)
+		assert.Empty(t, a.pending)
+	})
+
+	t.Run("dropped events are not waited for", func(t *testing.T) {
+		l := &countingListener{}
+		a := newClientACKs(l)
+		a.add(3)
+		a.ack(2)
+		assert.Empty(t, l.acked)
+
+		a.drop()
+		assert.Equal(t, []int{1}, l.acked)
+		assert.Empty(t, a.pending)
+	})
+
+	t.Run("fully dropped split event is never ACKed", func(t *testing.T) {
+		l := &countingListener{}
+		a := newClientACKs(l)
+		a.add(1)
+		a.add(2)
+		a.drop()
+		a.drop()
+		a.add(1)
+
+		a.ack(2)
+		assert.Equal(t, []int{2}, l.acked)
+		assert.Empty(t, a.pending)
+	})
+}
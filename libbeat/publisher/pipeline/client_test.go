@@ -29,6 +29,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/acker"
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/processors"
 	"github.com/elastic/beats/v7/libbeat/publisher"
@@ -189,6 +190,53 @@ func TestClient(t *testing.T) {
 		<-done
 		require.Equal(t, expected, received)
 	})
+
+	t.Run("split events are ACKed once", func(t *testing.T) {
+		l := logptest.NewTestingLogger(t, "")
+		q := memqueue.NewQueue(l, nil, memqueue.Settings{
+			Events:        10,
+			MaxGetRequest: 2,
+			FlushTimeout:  time.Millisecond,
+		}, 10, nil)
+
+		ps := testProcessorSupporter{Processor: &testSplitProcessor{n: 3}}
+		pipeline := makePipeline(t, Settings{Processors: ps}, q)
+		defer pipeline.Close()
+
+		var mu sync.Mutex
+		var acked, received int
+		client, err := pipeline.ConnectWith(beat.ClientConfig{
+			EventListener: acker.RawCounting(func(n int) {
+				mu.Lock()
+				defer mu.Unlock()
+				acked += n
+			}),
+		})
+		require.NoError(t, err)
+		defer client.Close()
+
+		output := newMockClient(func(batch publisher.Batch) error {
+			mu.Lock()
+			received += len(batch.Events())
+			mu.Unlock()
+			batch.ACK()
+			return nil
+		})
+		defer output.Close()
+		pipeline.outputController.Set(outputs.Group{Clients: []outputs.Client{output}, BatchSize: 2})
+		defer pipeline.outputController.Set(outputs.Group{})
+
+		client.PublishAll([]beat.Event{
+			{Fields: mapstr.M{"number": 1}},
+			{Fields: mapstr.M{"number": 2}},
+		})
+
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return received == 6 && acked == 2
+		}, 10*time.Second, time.Millisecond, "expected 6 events in the output and 2 ACKs")
+	})
 }
 
 func TestClientWaitClose(t *testing.T) {
@@ -444,6 +492,27 @@ func (p *testProcessor) Run(in *beat.Event) (event *beat.Event, err error) {
 	return p.processorFn(in)
 }
 
+// testSplitProcessor turns each event into n copies of it.
+type testSplitProcessor struct {
+	n int
+}
+
+func (p *testSplitProcessor) String() string {
+	return "testSplitProcessor"
+}
+
+func (p *testSplitProcessor) Run(in *beat.Event) (*beat.Event, error) {
+	return beat.SingleEvent(p.RunMulti(in))
+}
+
+func (p *testSplitProcessor) RunMulti(in *beat.Event) ([]*beat.Event, error) {
+	events := []*beat.Event{in}
+	for i := 1; i < p.n; i++ {
+		events = append(events, in.Clone())
+	}
+	return events, nil
+}
+
 type processorList struct {
 	processors []beat.Processor
 }
@@ -20,6 +20,7 @@ package pipeline
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/processors"
@@ -35,6 +36,19 @@ type Config struct {
 
 	// Event queue
 	Queue config.Namespace `config:"queue"`
+
+	// Dead letter queue for the events the output fails to publish
+	// permanently.
+	DeadLetterQueue *config.C `config:"dead_letter_queue"`
+
+	// Quotas for the events of different inputs admitted into the queue.
+	InputQuotas *config.C `config:"input_quotas"`
+
+	// Events older than MaxEventAge when they are read from the queue are
+	// dropped. The age is computed from the timestamp in MaxEventAgeField,
+	// @timestamp by default.
+	MaxEventAge      time.Duration `config:"max_event_age" validate:"min=0"`
+	MaxEventAgeField string        `config:"max_event_age_field"`
 }
 
 // validateClientConfig checks a ClientConfig can be used with (*Pipeline).ConnectWith.
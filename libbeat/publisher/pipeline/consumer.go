@@ -62,6 +62,17 @@ type consumerTarget struct {
 	ch         chan publisher.Batch
 	timeToLive int
 	batchSize  int
+
+	// If set, batchSizer overrides batchSize with the size requested by
+	// the output at the time a batch is read.
+	batchSizer func() int
+
+	// If set, events the output gives up on are passed to deadLetter.
+	deadLetter deadLetterFunc
+
+	// If set, events older than max_event_age are dropped when they are read
+	// from the queue.
+	expiry *eventExpiry
 }
 
 // retryRequest is used by ttlBatch to add itself back to the eventConsumer
@@ -78,7 +89,7 @@ func newEventConsumer(
 	c := &eventConsumer{
 		logger:        log,
 		retryObserver: observer,
-		queueReader:   makeQueueReader(),
+		queueReader:   makeQueueReader(observer),
 
 		targetChan: make(chan consumerTarget),
 		retryChan:  make(chan retryRequest),
@@ -134,8 +145,10 @@ outerLoop:
 			c.queueReader.req <- queueReaderRequest{
 				queue:      target.queue,
 				retryer:    c,
-				batchSize:  target.batchSize,
+				batchSize:  target.nextBatchSize(),
 				timeToLive: target.timeToLive,
+				deadLetter: target.deadLetter,
+				expiry:     target.expiry,
 			}
 		}
 
@@ -202,6 +215,14 @@ outerLoop:
 	close(c.queueReader.req)
 }
 
+// nextBatchSize returns the size of the next batch to read for the target.
+func (t consumerTarget) nextBatchSize() int {
+	if t.batchSizer != nil {
+		return t.batchSizer()
+	}
+	return t.batchSize
+}
+
 func (c *eventConsumer) setTarget(target consumerTarget) {
 	select {
 	case c.targetChan <- target:
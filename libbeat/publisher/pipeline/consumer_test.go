@@ -50,3 +50,15 @@ func TestNoBatchAssemblyOnNilTarget(t *testing.T) {
 	_, ok := <-c.queueReader.req
 	assert.False(t, ok, "The queue reader shouldn't get a read request when the target is nil")
 }
+
+func TestConsumerTargetBatchSizer(t *testing.T) {
+	target := consumerTarget{batchSize: 100}
+	assert.Equal(t, 100, target.nextBatchSize())
+
+	size := 50
+	target.batchSizer = func() int { return size }
+	assert.Equal(t, 50, target.nextBatchSize())
+
+	size = 75
+	assert.Equal(t, 75, target.nextBatchSize(), "the batch sizer is asked for every batch")
+}
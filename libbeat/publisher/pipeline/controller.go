@@ -25,6 +25,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common/reload"
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/dlq"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
 	conf "github.com/elastic/elastic-agent-libs/config"
@@ -69,6 +70,15 @@ type outputController struct {
 	// configuration reloading which doesn't have access to this
 	// setting.
 	inputQueueSize int
+
+	// If set, the events the output gives up on are stored in the dead
+	// letter queue, along with the name of the output.
+	deadLetterQueue *dlq.Queue
+	outputName      string
+
+	// If set, events older than max_event_age are dropped when they are read
+	// from the queue.
+	expiry *eventExpiry
 }
 
 type producerRequest struct {
@@ -157,10 +167,25 @@ func (c *outputController) Set(outGrp outputs.Group) {
 			queue:      c.queue,
 			ch:         targetChan,
 			batchSize:  outGrp.BatchSize,
+			batchSizer: outGrp.BatchSizer,
 			timeToLive: outGrp.Retry + 1,
+			deadLetter: c.deadLetterFunc(),
+			expiry:     c.expiry,
 		})
 }
 
+// deadLetterFunc returns the function storing events in the dead letter
+// queue for the current output, or nil if it is disabled.
+func (c *outputController) deadLetterFunc() deadLetterFunc {
+	if c.deadLetterQueue == nil {
+		return nil
+	}
+	q, name := c.deadLetterQueue, c.outputName
+	return func(events []publisher.Event, err error) {
+		q.Add(name, events, err)
+	}
+}
+
 // Reload the output
 func (c *outputController) Reload(
 	cfg *reload.ConfigWithMeta,
@@ -173,7 +198,7 @@ func (c *outputController) Reload(
 		}
 	}
 
-	output, err := loadOutput(c.monitors, func(stats outputs.Observer) (string, outputs.Group, error) {
+	name, output, err := loadOutput(c.monitors, func(stats outputs.Observer) (string, outputs.Group, error) {
 		name := outCfg.Name()
 		out, err := outFactory(stats, outCfg)
 		return name, out, err
@@ -182,6 +207,7 @@ func (c *outputController) Reload(
 		return err
 	}
 
+	c.outputName = name
 	c.Set(output)
 
 	return nil
@@ -0,0 +1,105 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+// defaultMaxEventAgeField is the field the age of an event is computed from
+// if max_event_age_field isn't set.
+const defaultMaxEventAgeField = beat.TimestampFieldKey
+
+// eventExpiry decides which events read from the queue are older than
+// max_event_age, so they are dropped instead of being sent to the output.
+type eventExpiry struct {
+	maxAge time.Duration
+
+	// The timestamp field the age of an event is computed from. Events
+	// without a valid timestamp in this field never expire.
+	field string
+
+	now func() time.Time
+}
+
+// newEventExpiry returns the expiry for the given settings, or nil if
+// maxAge isn't positive.
+func newEventExpiry(maxAge time.Duration, field string) *eventExpiry {
+	if maxAge <= 0 {
+		return nil
+	}
+	if field == "" {
+		field = defaultMaxEventAgeField
+	}
+	return &eventExpiry{maxAge: maxAge, field: field, now: time.Now}
+}
+
+// deadline returns the time events must be newer than to be kept.
+func (e *eventExpiry) deadline() time.Time {
+	return e.now().Add(-e.maxAge)
+}
+
+// expired returns true if the event is older than the deadline.
+func (e *eventExpiry) expired(event *publisher.Event, deadline time.Time) bool {
+	ts, ok := e.eventTime(event)
+	return ok && ts.Before(deadline)
+}
+
+// eventTime returns the timestamp of the event. If the output encoded the
+// event when it was added to the queue, the timestamp is read from the
+// encoded event.
+func (e *eventExpiry) eventTime(event *publisher.Event) (time.Time, bool) {
+	content := &event.Content
+	if event.EncodedEvent != nil {
+		if e.field == beat.TimestampFieldKey {
+			if encoded, ok := event.EncodedEvent.(publisher.TimestampedEvent); ok {
+				ts := encoded.Timestamp()
+				return ts, !ts.IsZero()
+			}
+		}
+		if decodable, ok := event.EncodedEvent.(publisher.DecodableEvent); ok {
+			decoded, err := decodable.DecodeEvent()
+			if err != nil {
+				return time.Time{}, false
+			}
+			content = &decoded
+		}
+	}
+
+	if e.field == beat.TimestampFieldKey {
+		return content.Timestamp, !content.Timestamp.IsZero()
+	}
+	value, err := content.GetValue(e.field)
+	if err != nil {
+		return time.Time{}, false
+	}
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case common.Time:
+		return time.Time(v), true
+	case string:
+		ts, err := time.Parse(time.RFC3339Nano, v)
+		return ts, err == nil
+	}
+	return time.Time{}, false
+}
@@ -19,12 +19,15 @@ package pipeline
 
 import (
 	"flag"
+	"fmt"
 
 	"go.elastic.co/apm/v2"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher/dlq"
 	"github.com/elastic/beats/v7/libbeat/publisher/processing"
+	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/monitoring"
 )
@@ -92,15 +95,40 @@ func LoadWithSettings(
 
 	name := beatInfo.Name
 
-	out, err := loadOutput(monitors, makeOutput)
+	outName, out, err := loadOutput(monitors, makeOutput)
 	if err != nil {
 		return nil, err
 	}
 
-	p, err := New(beatInfo, monitors, config.Queue, out, settings)
+	if !settings.InputQuotas.Enabled {
+		settings.InputQuotas, err = readInputQuotaConfig(config.InputQuotas)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if settings.MaxEventAge == 0 {
+		settings.MaxEventAge = config.MaxEventAge
+		settings.MaxEventAgeField = config.MaxEventAgeField
+	}
+
+	var deadLetterQueue *dlq.Queue
+	if settings.DeadLetterQueue == nil {
+		deadLetterQueue, err = openDeadLetterQueue(log, monitors, config.DeadLetterQueue)
+		if err != nil {
+			return nil, err
+		}
+		settings.DeadLetterQueue = deadLetterQueue
+	}
+
+	p, err := newPipeline(beatInfo, monitors, config.Queue, outName, out, settings)
 	if err != nil {
+		if deadLetterQueue != nil {
+			deadLetterQueue.Close()
+		}
 		return nil, err
 	}
+	p.deadLetterQueue = deadLetterQueue
 
 	log.Infof("Beat name: %s", name)
 	return p, err
@@ -109,13 +137,13 @@ func LoadWithSettings(
 func loadOutput(
 	monitors Monitors,
 	makeOutput outputFactory,
-) (outputs.Group, error) {
+) (string, outputs.Group, error) {
 	if publishDisabled {
-		return outputs.Group{}, nil
+		return "", outputs.Group{}, nil
 	}
 
 	if makeOutput == nil {
-		return outputs.Group{}, nil
+		return "", outputs.Group{}, nil
 	}
 
 	var (
@@ -127,7 +155,7 @@ func loadOutput(
 		if metrics != nil {
 			err := metrics.Clear()
 			if err != nil {
-				return outputs.Group{}, err
+				return "", outputs.Group{}, err
 			}
 
 		} else {
@@ -138,7 +166,7 @@ func loadOutput(
 
 	outName, out, err := makeOutput(outStats)
 	if err != nil {
-		return outputs.Fail(err)
+		return "", outputs.Group{}, err
 	}
 
 	if metrics != nil {
@@ -149,7 +177,7 @@ func loadOutput(
 		if telemetry != nil {
 			err := telemetry.Clear()
 			if err != nil {
-				return outputs.Group{}, err
+				return "", outputs.Group{}, err
 			}
 		} else {
 			telemetry = monitors.Telemetry.NewRegistry("output")
@@ -159,5 +187,27 @@ func loadOutput(
 		monitoring.NewInt(telemetry, "clients").Set(int64(len(out.Clients)))
 	}
 
-	return out, nil
+	return outName, out, nil
+}
+
+// openDeadLetterQueue opens the dead letter queue if it is enabled, reporting
+// its metrics under the pipeline namespace.
+func openDeadLetterQueue(log *logp.Logger, monitors Monitors, cfg *config.C) (*dlq.Queue, error) {
+	dlqConfig, err := dlq.ReadConfig(cfg)
+	if err != nil || !dlqConfig.Enabled {
+		return nil, err
+	}
+
+	var reg *monitoring.Registry
+	if monitors.Metrics != nil {
+		reg = monitors.Metrics.GetOrCreateRegistry("pipeline.dead_letter_queue")
+		if err := reg.Clear(); err != nil {
+			return nil, err
+		}
+	}
+	q, err := dlq.Open(log.Named("dead_letter_queue"), dlqConfig, reg)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the dead letter queue: %w", err)
+	}
+	return q, nil
 }
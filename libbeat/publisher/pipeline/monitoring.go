@@ -53,6 +53,9 @@ type retryObserver interface {
 	eventsDropped(int)
 	// Events were sent back to an output worker after an earlier failure.
 	eventsRetry(int)
+	// Events were dropped because they were older than max_event_age when
+	// they were read from the queue.
+	eventsExpired(int)
 }
 
 // metricsObserver is used by many components in the publisher pipeline, to report
@@ -74,6 +77,7 @@ type metricsObserverVars struct {
 	eventsTotal, eventsFiltered, eventsPublished, eventsFailed *monitoring.Uint
 
 	eventsDropped, eventsRetry *monitoring.Uint // (retryer) drop/retry counters
+	eventsExpired              *monitoring.Uint
 	activeEvents               *monitoring.Uint
 }
 
@@ -114,6 +118,10 @@ func newMetricsObserver(metrics *monitoring.Registry) *metricsObserver {
 			// events.dropped counts events that were dropped because errors from
 			// the output workers exceeded the configured maximum retry count.
 			eventsDropped: monitoring.NewUint(reg, "events.dropped"),
+
+			// events.expired counts events that were dropped because they were
+			// older than max_event_age when they were read from the queue.
+			eventsExpired: monitoring.NewUint(reg, "events.expired"),
 		},
 	}
 }
@@ -180,6 +188,11 @@ func (o *metricsObserver) eventsRetry(n int) {
 	o.vars.eventsRetry.Add(uint64(n))
 }
 
+// (retryer) number of events dropped because they were too old
+func (o *metricsObserver) eventsExpired(n int) {
+	o.vars.eventsExpired.Add(uint64(n))
+}
+
 type emptyObserver struct{}
 
 var nilObserver observer = (*emptyObserver)(nil)
@@ -194,3 +207,4 @@ func (*emptyObserver) failedPublishEvent() {}
 func (*emptyObserver) eventsACKed(n int)   {}
 func (*emptyObserver) eventsDropped(int)   {}
 func (*emptyObserver) eventsRetry(int)     {}
+func (*emptyObserver) eventsExpired(int)   {}
@@ -29,12 +29,15 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common/reload"
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/dlq"
 	"github.com/elastic/beats/v7/libbeat/publisher/processing"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/hybridqueue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
 )
 
 // Pipeline implementation providint all beats publisher functionality.
@@ -67,6 +70,13 @@ type Pipeline struct {
 	waitCloseTimeout time.Duration
 
 	processors processing.Supporter
+
+	// If the pipeline opened the dead letter queue, it closes it on Close.
+	deadLetterQueue *dlq.Queue
+
+	// quotas admits the events of the clients into the queue, if input
+	// quotas are enabled.
+	quotas *quotaScheduler
 }
 
 // Settings is used to pass additional settings to a newly created pipeline instance.
@@ -80,6 +90,24 @@ type Settings struct {
 	Processors processing.Supporter
 
 	InputQueueSize int
+
+	// DeadLetterQueue stores the events the output fails to publish
+	// permanently. If it is nil, LoadWithSettings opens the dead letter
+	// queue if it is enabled in the configuration. A queue passed in
+	// Settings isn't closed by the pipeline.
+	DeadLetterQueue *dlq.Queue
+
+	// InputQuotas configures the fair admission of the events of different
+	// inputs into the queue. If it isn't enabled, LoadWithSettings reads it
+	// from the configuration.
+	InputQuotas InputQuotaConfig
+
+	// MaxEventAge drops the events that are older than this when they are
+	// read from the queue. The age is computed from MaxEventAgeField, which
+	// defaults to @timestamp. If MaxEventAge is 0, LoadWithSettings reads
+	// both from the configuration.
+	MaxEventAge      time.Duration
+	MaxEventAgeField string
 }
 
 // WaitCloseMode enumerates the possible behaviors of WaitClose in a pipeline.
@@ -114,6 +142,17 @@ func New(
 	userQueueConfig conf.Namespace,
 	out outputs.Group,
 	settings Settings,
+) (*Pipeline, error) {
+	return newPipeline(beat, monitors, userQueueConfig, "", out, settings)
+}
+
+func newPipeline(
+	beat beat.Info,
+	monitors Monitors,
+	userQueueConfig conf.Namespace,
+	outName string,
+	out outputs.Group,
+	settings Settings,
 ) (*Pipeline, error) {
 	if monitors.Logger == nil {
 		monitors.Logger = logp.NewLogger("publish")
@@ -134,6 +173,14 @@ func New(
 		p.observer = newMetricsObserver(monitors.Metrics)
 	}
 
+	if settings.InputQuotas.Enabled {
+		var reg *monitoring.Registry
+		if monitors.Metrics != nil {
+			reg = monitors.Metrics.GetOrCreateRegistry("pipeline.inputs")
+		}
+		p.quotas = newQuotaScheduler(settings.InputQuotas, reg)
+	}
+
 	// Convert the raw queue config to a parsed Settings object that will
 	// be used during queue creation. This lets us fail immediately on startup
 	// if there's a configuration problem.
@@ -151,6 +198,9 @@ func New(
 		return nil, err
 	}
 	p.outputController = output
+	p.outputController.deadLetterQueue = settings.DeadLetterQueue
+	p.outputController.outputName = outName
+	p.outputController.expiry = newEventExpiry(settings.MaxEventAge, settings.MaxEventAgeField)
 	p.outputController.Set(out)
 
 	return p, nil
@@ -169,6 +219,12 @@ func (p *Pipeline) Close() error {
 	p.outputController.WaitClose(p.waitCloseTimeout)
 
 	p.observer.cleanup()
+
+	if p.deadLetterQueue != nil {
+		if err := p.deadLetterQueue.Close(); err != nil {
+			log.Errorf("Failed to close the dead letter queue: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -213,6 +269,11 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 		clientListener = noopClientListener{}
 	}
 
+	var quota *quotaClient
+	if p.quotas != nil {
+		quota = p.quotas.connect(cfg.InputID)
+	}
+
 	client := &client{
 		logger:         p.monitors.Logger,
 		clientListener: clientListener,
@@ -220,6 +281,7 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 		eventFlags:     eventFlags,
 		canDrop:        canDrop,
 		observer:       p.observer,
+		quota:          quota,
 	}
 
 	client.isOpen.Store(true)
@@ -236,20 +298,21 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 		}
 	}
 
+	if ackHandler == nil {
+		ackHandler = acker.Nil()
+	}
+
+	client.eventListener = ackHandler
+	client.acks = newClientACKs(ackHandler)
+
 	producerCfg := queue.ProducerConfig{
 		ACK: func(count int) {
+			quota.release(count)
 			client.observer.eventsACKed(count)
-			if ackHandler != nil {
-				ackHandler.ACKEvents(count)
-			}
+			client.acks.ack(count)
 		},
 	}
 
-	if ackHandler == nil {
-		ackHandler = acker.Nil()
-	}
-
-	client.eventListener = ackHandler
 	client.waiter = waiter
 	client.producer = p.outputController.queueProducer(producerCfg)
 	if client.producer == nil {
@@ -292,6 +355,12 @@ func queueFactoryForUserConfig(queueType string, userConfig *conf.C) (queue.Queu
 			return nil, err
 		}
 		return diskqueue.FactoryForSettings(settings), nil
+	case hybridqueue.QueueType:
+		settings, err := hybridqueue.SettingsForUserConfig(userConfig)
+		if err != nil {
+			return nil, err
+		}
+		return hybridqueue.FactoryForSettings(settings), nil
 	default:
 		return nil, fmt.Errorf("unrecognized queue type '%v'", queueType)
 	}
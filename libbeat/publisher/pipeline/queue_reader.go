@@ -28,6 +28,8 @@ import (
 type queueReader struct {
 	req  chan queueReaderRequest // "give me a batch for this target"
 	resp chan *ttlBatch          // "here is your batch, or nil"
+
+	observer retryObserver
 }
 
 type queueReaderRequest struct {
@@ -35,12 +37,17 @@ type queueReaderRequest struct {
 	retryer    retryer
 	batchSize  int
 	timeToLive int
+	deadLetter deadLetterFunc
+
+	// If set, events older than max_event_age are dropped from the batch.
+	expiry *eventExpiry
 }
 
-func makeQueueReader() queueReader {
+func makeQueueReader(observer retryObserver) queueReader {
 	qr := queueReader{
-		req:  make(chan queueReaderRequest, 1),
-		resp: make(chan *ttlBatch),
+		req:      make(chan queueReaderRequest, 1),
+		resp:     make(chan *ttlBatch),
+		observer: observer,
 	}
 	return qr
 }
@@ -58,6 +65,8 @@ func (qr *queueReader) run(logger *logp.Logger) {
 		var batch *ttlBatch
 		if queueBatch != nil {
 			batch = newBatch(req.retryer, queueBatch, req.timeToLive)
+			batch.deadLetter = req.deadLetter
+			batch = qr.dropExpired(batch, req.expiry)
 		}
 		select {
 		case qr.resp <- batch:
@@ -70,3 +79,22 @@ func (qr *queueReader) run(logger *logp.Logger) {
 		}
 	}
 }
+
+// dropExpired drops the events of the batch that are older than
+// max_event_age. If all of them are, the batch is acknowledged and nil is
+// returned, so the consumer reads the next one.
+func (qr *queueReader) dropExpired(batch *ttlBatch, expiry *eventExpiry) *ttlBatch {
+	if expiry == nil {
+		return batch
+	}
+	dropped := batch.dropExpired(expiry)
+	if dropped == 0 {
+		return batch
+	}
+	qr.observer.eventsExpired(dropped)
+	if len(batch.events) == 0 {
+		batch.ACK()
+		return nil
+	}
+	return batch
+}
@@ -0,0 +1,403 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// defaultInputID is the input the clients that don't set an input ID are
+// accounted to.
+const defaultInputID = "_default"
+
+// InputQuotaConfig configures the fair admission of the events of different
+// inputs into the queue, configured under input_quotas in the beat
+// configuration.
+//
+// The inputs share MaxEvents events that are published to the queue but not
+// acknowledged yet. Each input that is publishing is entitled to a share of
+// them proportional to its weight. An input can exceed its share while there
+// is room, but once the events are all in use the events of inputs below
+// their share are admitted first, so one busy input can't hold back all the
+// others.
+type InputQuotaConfig struct {
+	Enabled bool `config:"enabled"`
+
+	// MaxEvents is the number of events of all inputs that can be
+	// published to the queue without being acknowledged.
+	MaxEvents int `config:"max_events" validate:"min=1"`
+
+	// Weight is the weight of the inputs that aren't listed in Inputs.
+	Weight int `config:"weight" validate:"min=1"`
+
+	Inputs []InputQuota `config:"inputs"`
+}
+
+// InputQuota configures the quota of the clients publishing events for one
+// input.
+type InputQuota struct {
+	ID string `config:"id" validate:"required"`
+
+	// Weight of the input. If 0, the default weight is used.
+	Weight int `config:"weight" validate:"min=0"`
+
+	// MaxEvents limits the events of the input that are published to the
+	// queue without being acknowledged, regardless of its share. If 0, the
+	// input is only limited by its share.
+	MaxEvents int `config:"max_events" validate:"min=0"`
+}
+
+// DefaultInputQuotaConfig returns the default input quota settings, which are
+// disabled.
+func DefaultInputQuotaConfig() InputQuotaConfig {
+	return InputQuotaConfig{
+		MaxEvents: 3200,
+		Weight:    1,
+	}
+}
+
+// Validate checks every input is only configured once.
+func (c *InputQuotaConfig) Validate() error {
+	seen := make(map[string]struct{}, len(c.Inputs))
+	for _, input := range c.Inputs {
+		if _, ok := seen[input.ID]; ok {
+			return fmt.Errorf("input '%v' is configured more than once", input.ID)
+		}
+		seen[input.ID] = struct{}{}
+	}
+	return nil
+}
+
+// readInputQuotaConfig unpacks the input_quotas settings on top of the
+// defaults. A nil cfg returns the defaults.
+func readInputQuotaConfig(cfg *config.C) (InputQuotaConfig, error) {
+	c := DefaultInputQuotaConfig()
+	if cfg == nil {
+		return c, nil
+	}
+	if err := cfg.Unpack(&c); err != nil {
+		return c, fmt.Errorf("invalid input_quotas configuration: %w", err)
+	}
+	return c, nil
+}
+
+// quotaScheduler admits the events of the pipeline clients into the queue
+// according to the quotas of their inputs.
+type quotaScheduler struct {
+	maxEvents int
+	weight    int
+	quotas    map[string]InputQuota
+	metrics   *monitoring.Registry
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// used is the number of events admitted but not acknowledged yet.
+	used int
+
+	// busyWeight is the sum of the weights of the busy inputs, which have
+	// events admitted or waiting to be admitted.
+	busyWeight int
+
+	// waiting is the number of clients waiting to admit an event.
+	waiting int
+
+	inputs map[string]*inputState
+}
+
+// inputState holds the events admitted for an input, shared by all its
+// clients.
+type inputState struct {
+	id      string
+	weight  int
+	limit   int
+	clients int
+
+	// active is the number of events admitted but not acknowledged yet.
+	active int
+
+	// waiting is the number of clients waiting to admit an event.
+	waiting int
+
+	registryID string
+	metrics    inputStateMetrics
+}
+
+type inputStateMetrics struct {
+	// (Gauge) events.active measures the events admitted into the queue that
+	// are not acknowledged yet.
+	active *monitoring.Uint
+
+	// events.blocked counts the events that had to wait to be admitted.
+	blocked *monitoring.Uint
+
+	// events.dropped counts the events that were dropped because the input
+	// exceeded its quota, for clients that drop events if the queue is full.
+	dropped *monitoring.Uint
+
+	// events.blocked_time.ms counts the milliseconds clients spent waiting
+	// for events to be admitted.
+	blockedTime *monitoring.Uint
+
+	// (Gauge) quota.share measures the events the input is entitled to with
+	// the inputs that are currently busy.
+	share *monitoring.Uint
+}
+
+// quotaClient admits the events of a single pipeline client.
+type quotaClient struct {
+	scheduler *quotaScheduler
+	input     *inputState
+	closed    bool
+}
+
+func newQuotaScheduler(cfg InputQuotaConfig, metrics *monitoring.Registry) *quotaScheduler {
+	quotas := make(map[string]InputQuota, len(cfg.Inputs))
+	for _, quota := range cfg.Inputs {
+		if quota.Weight == 0 {
+			quota.Weight = cfg.Weight
+		}
+		quotas[quota.ID] = quota
+	}
+
+	s := &quotaScheduler{
+		maxEvents: cfg.MaxEvents,
+		weight:    cfg.Weight,
+		quotas:    quotas,
+		metrics:   metrics,
+		inputs:    map[string]*inputState{},
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// connect registers a new client publishing events for the input with the
+// given ID.
+func (s *quotaScheduler) connect(inputID string) *quotaClient {
+	if inputID == "" {
+		inputID = defaultInputID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	input := s.inputs[inputID]
+	if input == nil {
+		input = s.newInputState(inputID)
+		s.inputs[inputID] = input
+	}
+	input.clients++
+	return &quotaClient{scheduler: s, input: input}
+}
+
+func (s *quotaScheduler) newInputState(id string) *inputState {
+	input := &inputState{id: id, weight: s.weight}
+	if quota, ok := s.quotas[id]; ok {
+		input.weight = quota.Weight
+		input.limit = quota.MaxEvents
+	}
+
+	reg := monitoring.NewRegistry()
+	if s.metrics != nil {
+		// Dots would create nested registries, so they are replaced to keep
+		// all inputs on the same level.
+		input.registryID = strings.ReplaceAll(id, ".", "_")
+		s.metrics.Remove(input.registryID)
+		reg = s.metrics.NewRegistry(input.registryID)
+	}
+	monitoring.NewString(reg, "id").Set(id)
+	monitoring.NewInt(reg, "quota.weight").Set(int64(input.weight))
+	monitoring.NewInt(reg, "quota.max_events").Set(int64(input.limit))
+	input.metrics = inputStateMetrics{
+		active:      monitoring.NewUint(reg, "events.active"),
+		blocked:     monitoring.NewUint(reg, "events.blocked"),
+		dropped:     monitoring.NewUint(reg, "events.dropped"),
+		blockedTime: monitoring.NewUint(reg, "events.blocked_time.ms"),
+		share:       monitoring.NewUint(reg, "quota.share"),
+	}
+	return input
+}
+
+// removeIfIdle forgets an input once it has no clients and no events in the
+// queue anymore. Must be called with the lock held.
+func (s *quotaScheduler) removeIfIdle(input *inputState) {
+	if input.clients > 0 || input.active > 0 || s.inputs[input.id] != input {
+		return
+	}
+	delete(s.inputs, input.id)
+	if s.metrics != nil {
+		s.metrics.Remove(input.registryID)
+	}
+}
+
+// update applies a change to the events of an input, keeping track of the
+// weight of the busy inputs. Must be called with the lock held.
+func (s *quotaScheduler) update(input *inputState, active, waiting int) {
+	wasBusy := input.busy()
+	input.active += active
+	input.waiting += waiting
+	s.used += active
+	s.waiting += waiting
+
+	switch busy := input.busy(); {
+	case busy && !wasBusy:
+		s.busyWeight += input.weight
+	case !busy && wasBusy:
+		s.busyWeight -= input.weight
+	}
+	input.metrics.active.Set(uint64(input.active))
+	input.metrics.share.Set(uint64(s.share(input)))
+}
+
+func (input *inputState) busy() bool {
+	return input.active > 0 || input.waiting > 0
+}
+
+// share returns the number of events the input is entitled to, given the
+// inputs that are currently busy. Must be called with the lock held.
+func (s *quotaScheduler) share(input *inputState) int {
+	busyWeight := s.busyWeight
+	if !input.busy() {
+		busyWeight += input.weight
+	}
+	share := s.maxEvents * input.weight / busyWeight
+	if share < 1 {
+		share = 1
+	}
+	return share
+}
+
+// canAdmit reports whether an event of the input would be admitted if it
+// didn't need to give way to other inputs. Must be called with the lock
+// held.
+func (s *quotaScheduler) canAdmit(input *inputState) bool {
+	if s.used >= s.maxEvents {
+		return false
+	}
+	return input.limit == 0 || input.active < input.limit
+}
+
+// admits reports whether an event of the input is admitted now. An input
+// over its share gives way to the waiting inputs that are below theirs.
+// Must be called with the lock held.
+func (s *quotaScheduler) admits(input *inputState) bool {
+	if !s.canAdmit(input) {
+		return false
+	}
+	if input.active < s.share(input) || s.waiting == 0 {
+		return true
+	}
+	for _, other := range s.inputs {
+		if other != input && other.waiting > 0 && other.active < s.share(other) {
+			if other.limit == 0 || other.active < other.limit {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// acquire admits a single event of the client into the queue. If wait is
+// set it blocks until the event is admitted, otherwise the event is dropped
+// if the input exceeds its quota. It returns false if the event isn't
+// admitted. Without quotas all events are admitted.
+func (c *quotaClient) acquire(wait bool) bool {
+	if c == nil {
+		return true
+	}
+	s := c.scheduler
+	input := c.input
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var blockedSince time.Time
+	defer func() {
+		if !blockedSince.IsZero() {
+			input.metrics.blockedTime.Add(uint64(time.Since(blockedSince).Milliseconds()))
+		}
+	}()
+
+	for !c.closed {
+		if s.admits(input) {
+			s.update(input, 1, 0)
+			return true
+		}
+		if !wait {
+			input.metrics.dropped.Inc()
+			return false
+		}
+
+		if blockedSince.IsZero() {
+			blockedSince = time.Now()
+			input.metrics.blocked.Inc()
+		}
+		s.update(input, 0, 1)
+		s.cond.Wait()
+		s.update(input, 0, -1)
+	}
+
+	// The client stopped waiting, which can let another client through.
+	s.cond.Broadcast()
+	return false
+}
+
+// release returns events of the client that were acknowledged, or that
+// failed to be published, to the quota of the input.
+func (c *quotaClient) release(count int) {
+	if c == nil || count <= 0 {
+		return
+	}
+	s := c.scheduler
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.update(c.input, -count, 0)
+	s.removeIfIdle(c.input)
+	if s.waiting > 0 {
+		s.cond.Broadcast()
+	}
+}
+
+// close unblocks the client if it is waiting for an event to be admitted.
+// Its events in the queue keep counting towards the quota of the input
+// until they are released.
+func (c *quotaClient) close() {
+	if c == nil {
+		return
+	}
+	s := c.scheduler
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.input.clients--
+	s.removeIfIdle(c.input)
+	s.cond.Broadcast()
+}
@@ -0,0 +1,176 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestQuotaSchedulerGivesWayToInputsBelowTheirShare(t *testing.T) {
+	s := newQuotaScheduler(InputQuotaConfig{
+		MaxEvents: 4,
+		Weight:    1,
+		Inputs:    []InputQuota{{ID: "audit", Weight: 3}},
+	}, nil)
+	noisy := s.connect("noisy")
+	audit := s.connect("audit")
+
+	// While audit is idle, noisy can use all events.
+	for i := 0; i < 4; i++ {
+		require.True(t, noisy.acquire(false))
+	}
+
+	admitted := make(chan struct{})
+	go func() {
+		audit.acquire(true)
+		close(admitted)
+	}()
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.waiting == 1
+	}, time.Second, time.Millisecond)
+
+	// noisy is over its share of 1 event now that audit is waiting, so the
+	// event released by noisy goes to audit.
+	assert.False(t, noisy.acquire(false))
+	noisy.release(1)
+	<-admitted
+	assert.False(t, noisy.acquire(false))
+
+	noisy.release(3)
+	assert.True(t, audit.acquire(false))
+	assert.True(t, audit.acquire(false))
+	assert.True(t, noisy.acquire(false))
+	assert.False(t, audit.acquire(false))
+}
+
+func TestQuotaSchedulerLimitsInput(t *testing.T) {
+	metrics := monitoring.NewRegistry()
+	s := newQuotaScheduler(InputQuotaConfig{
+		MaxEvents: 10,
+		Weight:    1,
+		Inputs:    []InputQuota{{ID: "logs.noisy", MaxEvents: 2}},
+	}, metrics)
+	noisy := s.connect("logs.noisy")
+	other := s.connect("")
+
+	assert.True(t, noisy.acquire(false))
+	assert.True(t, noisy.acquire(false))
+	assert.False(t, noisy.acquire(false))
+	assert.True(t, other.acquire(false))
+
+	snapshot := monitoring.CollectFlatSnapshot(metrics, monitoring.Full, false)
+	assert.Equal(t, "logs.noisy", snapshot.Strings["logs_noisy.id"])
+	assert.Equal(t, int64(2), snapshot.Ints["logs_noisy.events.active"])
+	assert.Equal(t, int64(1), snapshot.Ints["logs_noisy.events.dropped"])
+	assert.Equal(t, int64(1), snapshot.Ints[defaultInputID+".events.active"])
+
+	// Once all clients are closed and events released, the input is removed.
+	noisy.close()
+	noisy.release(2)
+	snapshot = monitoring.CollectFlatSnapshot(metrics, monitoring.Full, false)
+	assert.NotContains(t, snapshot.Strings, "logs_noisy.id")
+	assert.Contains(t, snapshot.Strings, defaultInputID+".id")
+}
+
+func TestQuotaClientCloseUnblocksAcquire(t *testing.T) {
+	s := newQuotaScheduler(InputQuotaConfig{MaxEvents: 1, Weight: 1}, nil)
+	c := s.connect("input")
+	require.True(t, c.acquire(true))
+
+	result := make(chan bool)
+	go func() { result <- c.acquire(true) }()
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.waiting == 1
+	}, time.Second, time.Millisecond)
+
+	c.close()
+	assert.False(t, <-result)
+}
+
+func TestReadInputQuotaConfig(t *testing.T) {
+	cfg, err := readInputQuotaConfig(nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultInputQuotaConfig(), cfg)
+
+	cfg, err = readInputQuotaConfig(conf.MustNewConfigFrom(map[string]interface{}{
+		"enabled": true,
+		"inputs":  []map[string]interface{}{{"id": "audit", "weight": 4}},
+	}))
+	require.NoError(t, err)
+	assert.True(t, cfg.Enabled)
+	assert.Equal(t, []InputQuota{{ID: "audit", Weight: 4}}, cfg.Inputs)
+
+	_, err = readInputQuotaConfig(conf.MustNewConfigFrom(map[string]interface{}{
+		"inputs": []map[string]interface{}{{"id": "audit"}, {"id": "audit"}},
+	}))
+	assert.ErrorContains(t, err, "configured more than once")
+}
+
+func TestClientReleasesQuotaOnACK(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	q := memqueue.NewQueue(logger, nil, memqueue.Settings{
+		Events:        10,
+		MaxGetRequest: 10,
+		FlushTimeout:  time.Millisecond,
+	}, 0, nil)
+	quotas := DefaultInputQuotaConfig()
+	quotas.Enabled = true
+	quotas.Inputs = []InputQuota{{ID: "noisy", MaxEvents: 2}}
+	pipeline := makePipeline(t, Settings{InputQuotas: quotas}, q)
+	defer pipeline.Close()
+
+	client, err := pipeline.ConnectWith(beat.ClientConfig{
+		InputID:     "noisy",
+		PublishMode: beat.DropIfFull,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		client.Publish(beat.Event{})
+	}
+	batch, err := q.Get(10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, batch.Count(), "events exceeding the quota must be dropped")
+
+	batch.Done()
+	require.Eventually(t, func() bool {
+		pipeline.quotas.mu.Lock()
+		defer pipeline.quotas.mu.Unlock()
+		return pipeline.quotas.used == 0
+	}, time.Second, time.Millisecond)
+
+	client.Publish(beat.Event{})
+	batch, err = q.Get(10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, batch.Count())
+}
@@ -18,6 +18,7 @@
 package pipeline
 
 import (
+	"errors"
 	"sync/atomic"
 
 	"github.com/elastic/beats/v7/libbeat/publisher"
@@ -28,6 +29,15 @@ type retryer interface {
 	retry(batch *ttlBatch, decreaseTTL bool)
 }
 
+// deadLetterFunc stores events the output gave up on in the dead letter
+// queue.
+type deadLetterFunc func(events []publisher.Event, err error)
+
+var (
+	errBatchDropped    = errors.New("batch dropped by the output")
+	errRetriesExceeded = errors.New("retry limit exceeded")
+)
+
 type ttlBatch struct {
 	// The callback to inform the queue (and possibly the producer)
 	// that this batch has been acknowledged.
@@ -49,6 +59,10 @@ type ttlBatch struct {
 	// all split batches descending from the same original batch will
 	// point to the same metadata.
 	split *batchSplitData
+
+	// If set, events the output gives up on are stored in the dead letter
+	// queue.
+	deadLetter deadLetterFunc
 }
 
 type batchSplitData struct {
@@ -88,6 +102,26 @@ func newBatch(retryer retryer, original queue.Batch, ttl int) *ttlBatch {
 	return b
 }
 
+// dropExpired removes the events that are older than max_event_age from the
+// batch, returning the number of events removed. The removed events are
+// acknowledged along with the rest of the batch.
+func (b *ttlBatch) dropExpired(expiry *eventExpiry) int {
+	deadline := expiry.deadline()
+	events := b.events[:0]
+	for i := range b.events {
+		if !expiry.expired(&b.events[i], deadline) {
+			events = append(events, b.events[i])
+		}
+	}
+	dropped := len(b.events) - len(events)
+	for i := len(events); i < len(b.events); i++ {
+		// Help the garbage collector clean up the dropped events
+		b.events[i] = publisher.Event{}
+	}
+	b.events = events
+	return dropped
+}
+
 func (b *ttlBatch) Events() []publisher.Event {
 	return b.events
 }
@@ -99,11 +133,22 @@ func (b *ttlBatch) ACK() {
 }
 
 func (b *ttlBatch) Drop() {
+	b.DropWithError(errBatchDropped)
+}
+
+func (b *ttlBatch) DropWithError(err error) {
+	b.DeadLetter(b.events, err)
 	// Help the garbage collector clean up the event data a little faster
 	b.events = nil
 	b.done()
 }
 
+func (b *ttlBatch) DeadLetter(events []publisher.Event, err error) {
+	if b.deadLetter != nil && len(events) > 0 {
+		b.deadLetter(events, err)
+	}
+}
+
 // SplitRetry is called by the output to report that the batch is
 // too large to ingest. It splits the events into two separate batches
 // and sends both of them back to the retryer. Returns false if the
@@ -126,18 +171,20 @@ func (b *ttlBatch) SplitRetry() bool {
 	events1 := b.events[:splitIndex]
 	events2 := b.events[splitIndex:]
 	b.retryer.retry(&ttlBatch{
-		events:  events1,
-		done:    splitData.doneCallback(len(events1)),
-		retryer: b.retryer,
-		ttl:     b.ttl,
-		split:   splitData,
+		events:     events1,
+		done:       splitData.doneCallback(len(events1)),
+		retryer:    b.retryer,
+		ttl:        b.ttl,
+		split:      splitData,
+		deadLetter: b.deadLetter,
 	}, false)
 	b.retryer.retry(&ttlBatch{
-		events:  events2,
-		done:    splitData.doneCallback(len(events2)),
-		retryer: b.retryer,
-		ttl:     b.ttl,
-		split:   splitData,
+		events:     events2,
+		done:       splitData.doneCallback(len(events2)),
+		retryer:    b.retryer,
+		ttl:        b.ttl,
+		split:      splitData,
+		deadLetter: b.deadLetter,
 	}, false)
 	return true
 }
@@ -178,14 +225,19 @@ func (b *ttlBatch) reduceTTL() bool {
 		return true
 	}
 
-	// filter for events with guaranteed send flags
+	// filter for events with guaranteed send flags, storing the others in
+	// the dead letter queue
+	var dropped []publisher.Event
 	events := b.events[:0]
 	for _, event := range b.events {
 		if event.Guaranteed() {
 			events = append(events, event)
+		} else if b.deadLetter != nil {
+			dropped = append(dropped, event)
 		}
 	}
 	b.events = events
+	b.DeadLetter(dropped, errRetriesExceeded)
 
 	if len(b.events) > 0 {
 		b.ttl = -1 // we need infinite retry for all events left in this batch
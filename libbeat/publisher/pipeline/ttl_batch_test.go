@@ -18,14 +18,18 @@
 package pipeline
 
 import (
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/elastic-agent-libs/mapstr"
 )
 
 func TestBatchSplitRetry(t *testing.T) {
@@ -112,6 +116,144 @@ func TestBatchCallsDoneAndFreesEvents(t *testing.T) {
 	require.True(t, doneCalled, "Calling batch.Drop should invoke the done callback")
 }
 
+func TestBatchDeadLetter(t *testing.T) {
+	type deadLetter struct {
+		events []publisher.Event
+		err    error
+	}
+	var stored []deadLetter
+	newTestBatch := func(events []publisher.Event, ttl int) *ttlBatch {
+		return &ttlBatch{
+			done:    func() {},
+			retryer: &mockRetryer{},
+			ttl:     ttl,
+			events:  events,
+			deadLetter: func(events []publisher.Event, err error) {
+				stored = append(stored, deadLetter{events: events, err: err})
+			},
+		}
+	}
+
+	// Dropping a batch stores all its events.
+	batch := newTestBatch(make([]publisher.Event, 2), 0)
+	batch.Drop()
+	require.Len(t, stored, 1)
+	assert.Len(t, stored[0].events, 2)
+	assert.ErrorIs(t, stored[0].err, errBatchDropped)
+
+	// Events the output gives up on are stored with the reason.
+	stored = nil
+	reason := errors.New("mapping conflict")
+	batch = newTestBatch(make([]publisher.Event, 2), 0)
+	publisher.DeadLetter(batch, batch.events[:1], reason)
+	batch.ACK()
+	require.Len(t, stored, 1)
+	assert.Len(t, stored[0].events, 1)
+	assert.ErrorIs(t, stored[0].err, reason)
+
+	// Once the batch runs out of retries, the events without guaranteed
+	// delivery are stored.
+	stored = nil
+	batch = newTestBatch([]publisher.Event{{}, {Flags: publisher.GuaranteedSend}}, 1)
+	assert.True(t, batch.reduceTTL(), "the batch must stay alive for the guaranteed event")
+	assert.Len(t, batch.events, 1)
+	require.Len(t, stored, 1)
+	assert.Len(t, stored[0].events, 1)
+	assert.ErrorIs(t, stored[0].err, errRetriesExceeded)
+}
+
+func TestBatchDropExpired(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fresh, stale := now.Add(-time.Minute), now.Add(-2*time.Hour)
+
+	timestamped := func(ts time.Time) publisher.Event {
+		return publisher.Event{Content: beat.Event{Timestamp: ts, Fields: mapstr.M{"id": ts.String()}}}
+	}
+	created := func(created interface{}) publisher.Event {
+		return publisher.Event{Content: beat.Event{Timestamp: stale, Fields: mapstr.M{"event": mapstr.M{"created": created}}}}
+	}
+
+	t.Run("timestamp", func(t *testing.T) {
+		expiry := newEventExpiry(time.Hour, "")
+		expiry.now = func() time.Time { return now }
+		batch := &ttlBatch{events: []publisher.Event{
+			timestamped(stale),
+			timestamped(fresh),
+			{EncodedEvent: &timestampedEncoding{ts: stale}},
+			{EncodedEvent: &timestampedEncoding{ts: fresh}},
+			// Events without a timestamp never expire
+			{},
+		}}
+
+		assert.Equal(t, 2, batch.dropExpired(expiry))
+		require.Len(t, batch.events, 3)
+		assert.Equal(t, fresh, batch.events[0].Content.Timestamp)
+		assert.Equal(t, &timestampedEncoding{ts: fresh}, batch.events[1].EncodedEvent)
+	})
+
+	t.Run("field", func(t *testing.T) {
+		expiry := newEventExpiry(time.Hour, "event.created")
+		expiry.now = func() time.Time { return now }
+		batch := &ttlBatch{events: []publisher.Event{
+			created(stale),
+			created(fresh),
+			created(stale.Format(time.RFC3339Nano)),
+			created(fresh.Format(time.RFC3339Nano)),
+			created("not a timestamp"),
+			timestamped(stale),
+		}}
+
+		assert.Equal(t, 2, batch.dropExpired(expiry))
+		require.Len(t, batch.events, 4)
+	})
+}
+
+func TestQueueReaderDropExpired(t *testing.T) {
+	observer := &expiryObserver{}
+	qr := makeQueueReader(observer)
+	expiry := newEventExpiry(time.Hour, "")
+	old := time.Now().Add(-2 * time.Hour)
+
+	doneCalled := false
+	batch := &ttlBatch{
+		done: func() { doneCalled = true },
+		events: []publisher.Event{
+			{Content: beat.Event{Timestamp: old}},
+			{Content: beat.Event{Timestamp: time.Now()}},
+		},
+	}
+	assert.Same(t, batch, qr.dropExpired(batch, expiry), "a batch with events left should be returned")
+	assert.False(t, doneCalled, "a batch with events left shouldn't be acknowledged")
+	assert.Equal(t, 1, observer.expired)
+
+	batch = &ttlBatch{
+		done:   func() { doneCalled = true },
+		events: []publisher.Event{{Content: beat.Event{Timestamp: old}}},
+	}
+	assert.Nil(t, qr.dropExpired(batch, expiry), "a batch without events left shouldn't be returned")
+	assert.True(t, doneCalled, "a batch without events left should be acknowledged")
+	assert.Equal(t, 2, observer.expired)
+
+	batch = &ttlBatch{events: []publisher.Event{{Content: beat.Event{Timestamp: old}}}}
+	assert.Same(t, batch, qr.dropExpired(batch, nil), "events shouldn't be dropped if max_event_age isn't set")
+}
+
+type timestampedEncoding struct {
+	ts time.Time
+}
+
+func (e *timestampedEncoding) Timestamp() time.Time {
+	return e.ts
+}
+
+type expiryObserver struct {
+	expired int
+}
+
+func (o *expiryObserver) eventsDropped(int)   {}
+func (o *expiryObserver) eventsRetry(int)     {}
+func (o *expiryObserver) eventsExpired(n int) { o.expired += n }
+
 func TestNewBatchFreesEvents(t *testing.T) {
 	queueBatch := &mockQueueBatch{}
 	_ = newBatch(nil, queueBatch, 0)
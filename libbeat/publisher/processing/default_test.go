@@ -39,6 +39,7 @@ import (
 	_ "github.com/elastic/beats/v7/libbeat/processors/add_docker_metadata"
 	_ "github.com/elastic/beats/v7/libbeat/processors/add_host_metadata"
 	_ "github.com/elastic/beats/v7/libbeat/processors/add_kubernetes_metadata"
+	_ "github.com/elastic/beats/v7/libbeat/processors/split"
 )
 
 func TestGenerateProcessorList(t *testing.T) {
@@ -439,6 +440,32 @@ func TestDynamicFields(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestSplitEvents(t *testing.T) {
+	cfg := config.MustNewConfigFrom(mapstr.M{
+		"processors": []mapstr.M{
+			{"split": mapstr.M{"field": "records"}},
+			{"add_fields": mapstr.M{"target": "", "fields": mapstr.M{"global": true}}},
+		},
+	})
+	factory, err := MakeDefaultSupport(true, nil)(beat.Info{}, logp.L(), cfg)
+	require.NoError(t, err)
+
+	prog, err := factory.Create(beat.ProcessingConfig{
+		Fields: mapstr.M{"client": true},
+	}, false)
+	require.NoError(t, err)
+	require.Implements(t, (*beat.MultiEventProcessor)(nil), prog)
+
+	actual, err := beat.RunProcessor(prog, &beat.Event{Fields: mapstr.M{"records": []interface{}{"a", "b"}}})
+	require.NoError(t, err)
+	require.Len(t, actual, 2)
+	assert.Equal(t, mapstr.M{"records": "a", "client": true, "global": true}, actual[0].Fields)
+	assert.Equal(t, mapstr.M{"records": "b", "client": true, "global": true}, actual[1].Fields)
+
+	err = factory.Close()
+	require.NoError(t, err)
+}
+
 func TestProcessingClose(t *testing.T) {
 	factory, err := MakeDefaultSupport(true, nil)(beat.Info{}, logp.L(), config.NewConfig())
 	require.NoError(t, err)
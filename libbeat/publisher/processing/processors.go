@@ -120,26 +120,60 @@ func (p *group) Run(event *beat.Event) (*beat.Event, error) {
 	if p == nil || len(p.list) == 0 {
 		return event, nil
 	}
+	return beat.SingleEvent(p.RunMulti(event))
+}
 
-	for _, sub := range p.list {
-		var err error
+// RunMulti runs the processors of the group on the event. When a processor
+// turns the event into several events, the remaining processors are run on
+// each of them.
+func (p *group) RunMulti(event *beat.Event) ([]*beat.Event, error) {
+	if p == nil || len(p.list) == 0 {
+		return []*beat.Event{event}, nil
+	}
 
-		event, err = sub.Run(event)
-		if err != nil {
-			// XXX: We don't drop the event, but continue filtering here if the most
-			//      recent processor did return an event.
-			//      We want processors having this kind of implicit behavior
-			//      on errors?
+	for i, sub := range p.list {
+		mp, ok := sub.(beat.MultiEventProcessor)
+		if !ok {
+			var err error
+
+			event, err = sub.Run(event)
+			if err != nil {
+				// XXX: We don't drop the event, but continue filtering here if the most
+				//      recent processor did return an event.
+				//      We want processors having this kind of implicit behavior
+				//      on errors?
+
+				p.log.Debugf("Fail to apply processor %s: %s", p, err)
+			}
+
+			if event == nil {
+				return nil, err
+			}
+			continue
+		}
 
+		events, err := mp.RunMulti(event)
+		if err != nil {
 			p.log.Debugf("Fail to apply processor %s: %s", p, err)
 		}
-
-		if event == nil {
+		switch len(events) {
+		case 0:
 			return nil, err
+		case 1:
+			event = events[0]
+			continue
+		}
+
+		rest := &group{log: p.log, title: p.title, list: p.list[i+1:]}
+		var out []*beat.Event
+		for _, e := range events {
+			res, _ := rest.RunMulti(e)
+			out = append(out, res...)
 		}
+		return out, nil
 	}
 
-	return event, nil
+	return []*beat.Event{event}, nil
 }
 
 func newProcessor(name string, fn func(*beat.Event) (*beat.Event, error)) *processorFn {
@@ -156,6 +190,23 @@ func newAnnotateProcessor(name string, fn func(*beat.Event)) *processorFn {
 func (p *processorFn) String() string                         { return p.name }
 func (p *processorFn) Run(e *beat.Event) (*beat.Event, error) { return p.fn(e) }
 
+// multiProcessorFn runs a function that can turn an event into several
+// events.
+type multiProcessorFn struct {
+	name string
+	fn   func(event *beat.Event) ([]*beat.Event, error)
+}
+
+func newMultiProcessor(name string, fn func(*beat.Event) ([]*beat.Event, error)) *multiProcessorFn {
+	return &multiProcessorFn{name: name, fn: fn}
+}
+
+func (p *multiProcessorFn) String() string { return p.name }
+func (p *multiProcessorFn) Run(e *beat.Event) (*beat.Event, error) {
+	return beat.SingleEvent(p.fn(e))
+}
+func (p *multiProcessorFn) RunMulti(e *beat.Event) ([]*beat.Event, error) { return p.fn(e) }
+
 func clientEventMeta(meta mapstr.M, needsCopy bool) *processorFn {
 	fn := func(event *beat.Event) { addMeta(event, meta) }
 	if needsCopy {
@@ -18,6 +18,7 @@
 package diskqueue
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"path/filepath"
@@ -66,6 +67,14 @@ type Settings struct {
 
 	// UseCompression enables or disables LZ4 compression
 	UseCompression bool
+
+	// EncryptionKey enables AES-GCM encryption of new segments when set.
+	// It must be 16, 24 or 32 random bytes long.
+	EncryptionKey []byte
+
+	// PreviousEncryptionKeys are only used to read segments written before
+	// the encryption key was rotated.
+	PreviousEncryptionKeys [][]byte
 }
 
 // userConfig holds the parameters for a disk queue that are configurable
@@ -80,6 +89,41 @@ type userConfig struct {
 
 	RetryInterval    *time.Duration `config:"retry_interval" validate:"positive"`
 	MaxRetryInterval *time.Duration `config:"max_retry_interval" validate:"positive"`
+
+	Encryption *encryptionConfig `config:"encryption"`
+}
+
+// encryptionConfig holds the keys used to encrypt the queue. The keys are
+// meant to be stored in the keystore and referenced like ${DISKQUEUE_KEY},
+// so they are never written to the configuration file in plain text.
+// Keys are base64 encoded random bytes, as generated by
+// `openssl rand -base64 32`.
+type encryptionConfig struct {
+	Key          string   `config:"key" validate:"required"`
+	PreviousKeys []string `config:"previous_keys"`
+}
+
+func (c *encryptionConfig) Validate() error {
+	for _, key := range append([]string{c.Key}, c.PreviousKeys...) {
+		if _, err := decodeEncryptionKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeEncryptionKey decodes a base64 encoded key and checks that it can
+// be used as an AES key.
+func decodeEncryptionKey(key string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("disk queue encryption keys must be base64 encoded: %w", err)
+	}
+	if _, err := newEncryptionKey(raw); err != nil {
+		return nil, fmt.Errorf(
+			"disk queue encryption keys must decode to 16, 24 or 32 bytes: %w", err)
+	}
+	return raw, nil
 }
 
 func (c *userConfig) Validate() error {
@@ -163,6 +207,21 @@ func SettingsForUserConfig(config *config.C) (Settings, error) {
 		settings.MaxRetryInterval = *userConfig.MaxRetryInterval
 	}
 
+	if userConfig.Encryption != nil {
+		key, err := decodeEncryptionKey(userConfig.Encryption.Key)
+		if err != nil {
+			return Settings{}, err
+		}
+		settings.EncryptionKey = key
+		for _, key := range userConfig.Encryption.PreviousKeys {
+			raw, err := decodeEncryptionKey(key)
+			if err != nil {
+				return Settings{}, err
+			}
+			settings.PreviousEncryptionKeys = append(settings.PreviousEncryptionKeys, raw)
+		}
+	}
+
 	return settings, nil
 }
 
@@ -187,6 +246,15 @@ func (settings Settings) segmentPath(segmentID segmentID) string {
 		fmt.Sprintf("%v.seg", segmentID))
 }
 
+// decryptionKeys returns the keys that segments may be encrypted with.
+func (settings Settings) decryptionKeys() [][]byte {
+	keys := make([][]byte, 0, 1+len(settings.PreviousEncryptionKeys))
+	if len(settings.EncryptionKey) > 0 {
+		keys = append(keys, settings.EncryptionKey)
+	}
+	return append(keys, settings.PreviousEncryptionKeys...)
+}
+
 // maxValidFrameSize returns the size of the largest possible frame that
 // can be stored with the current queue settings.
 func (settings Settings) maxValidFrameSize() uint64 {
@@ -49,6 +49,7 @@ func (dq *diskQueue) run() {
 
 		case <-dq.close:
 			dq.handleShutdown()
+			close(dq.done)
 			return
 
 		// Writer loop handling
@@ -157,6 +158,9 @@ func (dq *diskQueue) handleReaderLoopResponse(response readerLoopResponse) {
 
 	segment := dq.segments.readingSegment()
 	segment.framesRead += response.frameCount
+	if response.endOfSegment {
+		segment.readEnd = dq.segments.nextReadPosition
+	}
 	if response.err != nil {
 		// If there's an error, we advance to the end of the current segment.
 		// If the segment is in the reading list, it will be removed on the
@@ -164,7 +168,11 @@ func (dq *diskQueue) handleReaderLoopResponse(response readerLoopResponse) {
 		// If the segment is still in the writing list, we can't discard it
 		// until the writer loop is done with it, but we can hope that advancing
 		// to the current write position will get us out of our error state.
-		dq.segments.nextReadPosition = segment.byteCount
+		if end, ok := segment.endPosition(); ok {
+			dq.segments.nextReadPosition = end
+		} else {
+			segment.readEnd = dq.segments.nextReadPosition
+		}
 
 		dq.logger.Errorf(
 			"Error reading segment file %s: %v",
@@ -351,7 +359,7 @@ func (segments *diskQueueSegments) readingSegment() *queueSegment {
 func (dq *diskQueue) maybeAdvanceReadingList() {
 	if len(dq.segments.reading) > 0 {
 		segment := dq.segments.reading[0]
-		if dq.segments.nextReadPosition >= segment.byteCount {
+		if end, ok := segment.endPosition(); ok && dq.segments.nextReadPosition >= end {
 			dq.segments.acking = append(dq.segments.acking, dq.segments.reading[0])
 			dq.segments.reading = dq.segments.reading[1:]
 			dq.segments.nextReadPosition = 0
@@ -372,8 +380,15 @@ func (dq *diskQueue) maybeReadPending() {
 
 	// Get the next available segment from the reading or writing lists.
 	segment := dq.segments.readingSegment()
-	if segment == nil ||
-		dq.segments.nextReadPosition >= segment.byteCount {
+	if segment == nil {
+		// Nothing to read
+		return
+	}
+	endPosition, ok := segment.endPosition()
+	if !ok {
+		endPosition = unknownEndPosition
+	}
+	if dq.segments.nextReadPosition >= endPosition {
 		// Nothing to read
 		return
 	}
@@ -392,7 +407,7 @@ func (dq *diskQueue) maybeReadPending() {
 		segment:       segment,
 		startFrameID:  dq.segments.nextReadFrameID,
 		startPosition: dq.segments.nextReadPosition,
-		endPosition:   segment.byteCount,
+		endPosition:   endPosition,
 	}
 	dq.readerLoop.requestChan <- request
 	dq.reading = true
@@ -310,6 +310,8 @@ func TestHandleReaderLoopResponse(t *testing.T) {
 	// - advance the target segment's framesRead field by response.frameCount
 	// - if there was an error reading the current segment, set
 	//   nextReadPosition to the end of the segment.
+	// - if the end of an encoded segment was reached, or there was an error
+	//   reading it, record the current position as the segment's end.
 
 	testCases := map[string]struct {
 		// The segment structure to start with before calling
@@ -319,6 +321,7 @@ func TestHandleReaderLoopResponse(t *testing.T) {
 
 		expectedFrameID  frameID
 		expectedPosition uint64
+		expectedReadEnd  uint64
 	}{
 		"completely read first reading segment": {
 			segments: diskQueueSegments{
@@ -436,6 +439,55 @@ func TestHandleReaderLoopResponse(t *testing.T) {
 			expectedFrameID:  6,
 			expectedPosition: 1000,
 		},
+		"partially read encoded segment": {
+			segments: diskQueueSegments{
+				reading: []*queueSegment{
+					{id: 1, byteCount: 1000, encoded: true},
+				},
+				nextReadFrameID:  5,
+				nextReadPosition: 12,
+			},
+			response: readerLoopResponse{
+				frameCount: 5,
+				byteCount:  500,
+			},
+			expectedFrameID:  10,
+			expectedPosition: 512,
+		},
+		"reached end of encoded segment": {
+			segments: diskQueueSegments{
+				reading: []*queueSegment{
+					{id: 1, byteCount: 1000, encoded: true},
+				},
+				nextReadFrameID:  5,
+				nextReadPosition: 12,
+			},
+			response: readerLoopResponse{
+				frameCount:   10,
+				byteCount:    1500,
+				endOfSegment: true,
+			},
+			expectedFrameID:  15,
+			expectedPosition: 1512,
+			expectedReadEnd:  1512,
+		},
+		"error reading encoded segment skips remaining data": {
+			segments: diskQueueSegments{
+				reading: []*queueSegment{
+					{id: 1, byteCount: 1000, encoded: true},
+				},
+				nextReadFrameID:  5,
+				nextReadPosition: 12,
+			},
+			response: readerLoopResponse{
+				frameCount: 1,
+				byteCount:  100,
+				err:        fmt.Errorf("something bad happened"),
+			},
+			expectedFrameID:  6,
+			expectedPosition: 112,
+			expectedReadEnd:  112,
+		},
 	}
 
 	logger := logptest.NewTestingLogger(t, "")
@@ -445,6 +497,7 @@ func TestHandleReaderLoopResponse(t *testing.T) {
 			settings: DefaultSettings(),
 			segments: test.segments,
 		}
+		segment := dq.segments.readingSegment()
 		dq.handleReaderLoopResponse(test.response)
 
 		if dq.segments.nextReadFrameID != test.expectedFrameID {
@@ -455,6 +508,10 @@ func TestHandleReaderLoopResponse(t *testing.T) {
 			t.Errorf("%s: expected nextReadPosition = %d, got %d",
 				description, test.expectedPosition, dq.segments.nextReadPosition)
 		}
+		if segment.readEnd != test.expectedReadEnd {
+			t.Errorf("%s: expected readEnd = %d, got %d",
+				description, test.expectedReadEnd, segment.readEnd)
+		}
 	}
 }
 
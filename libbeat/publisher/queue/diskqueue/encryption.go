@@ -0,0 +1,261 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encrypted segments start with the ID of the key they are encrypted
+// with, so that segments written before a key rotation can still be read
+// with the previous key.
+const encryptionKeyIDSize = 8
+
+// encryptionKeyIDLabel is the message authenticated with the key to derive
+// its ID.
+const encryptionKeyIDLabel = "beats disk queue encryption key id"
+
+// Each record holds the data of one Write call, sealed with AES-GCM. It
+// starts with the 32-bit length of the rest of the record, followed by the
+// nonce and the sealed data.
+const encryptionRecordHeaderSize = 4
+
+// maxEncryptionRecordSize bounds the size of a record, so that a corrupt
+// length doesn't make the reader allocate huge buffers.
+const maxEncryptionRecordSize = 1 << 30
+
+// encryptionKey is an AES key along with the ID that is written to the
+// segments it encrypts.
+type encryptionKey struct {
+	id   [encryptionKeyIDSize]byte
+	aead cipher.AEAD
+}
+
+// newEncryptionKey returns an AES-GCM key. The key must be 16, 24 or 32
+// bytes long to select AES-128, AES-192 or AES-256.
+func newEncryptionKey(key []byte) (*encryptionKey, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+
+	k := &encryptionKey{aead: aead}
+	// The ID is derived from the key so it doesn't need to be configured.
+	// It is a keyed hash, so the IDs stored in the segments can't be used to
+	// test guesses of the key.
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encryptionKeyIDLabel))
+	copy(k.id[:], mac.Sum(nil))
+	return k, nil
+}
+
+// EncryptionReader allows reading a stream written by EncryptionWriter.
+type EncryptionReader struct {
+	src  io.ReadCloser
+	keys [][]byte
+
+	aead    cipher.AEAD
+	records uint64
+	buf     []byte
+	plain   []byte
+}
+
+// NewEncryptionReader returns a reader that decrypts the stream using
+// whichever of the keys it was encrypted with. It reads the key ID from
+// src, which must be positioned at the start of the encrypted data.
+func NewEncryptionReader(r io.ReadCloser, keys [][]byte) (*EncryptionReader, error) {
+	er := &EncryptionReader{src: r, keys: keys}
+	if err := er.Reset(); err != nil {
+		return nil, err
+	}
+	return er, nil
+}
+
+func (r *EncryptionReader) Read(p []byte) (int, error) {
+	if len(r.plain) == 0 {
+		if err := r.nextRecord(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// nextRecord reads and decrypts the next record. It returns io.EOF if the
+// stream ends at a record boundary and io.ErrUnexpectedEOF if the last
+// record is incomplete.
+func (r *EncryptionReader) nextRecord() error {
+	var length uint32
+	if err := binary.Read(r.src, binary.LittleEndian, &length); err != nil {
+		return err
+	}
+	if length < uint32(r.aead.NonceSize()+r.aead.Overhead()) || length > maxEncryptionRecordSize {
+		return fmt.Errorf("invalid encrypted record length %d", length)
+	}
+
+	if cap(r.buf) < int(length) {
+		r.buf = make([]byte, length)
+	}
+	record := r.buf[:length]
+	if _, err := io.ReadFull(r.src, record); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	nonce, sealed := record[:r.aead.NonceSize()], record[r.aead.NonceSize():]
+	plain, err := r.aead.Open(sealed[:0], nonce, sealed, recordAdditionalData(r.records))
+	if err != nil {
+		return fmt.Errorf("could not decrypt record %d: %w", r.records, err)
+	}
+	r.records++
+	r.plain = plain
+	return nil
+}
+
+func (r *EncryptionReader) Close() error {
+	return r.src.Close()
+}
+
+// Reset reads the key ID again, assumes that caller has already set the
+// src to the correct position.
+func (r *EncryptionReader) Reset() error {
+	var id [encryptionKeyIDSize]byte
+	if _, err := io.ReadFull(r.src, id[:]); err != nil {
+		return fmt.Errorf("could not read encryption key ID: %w", err)
+	}
+
+	r.aead = nil
+	for _, key := range r.keys {
+		k, err := newEncryptionKey(key)
+		if err != nil {
+			return err
+		}
+		if k.id == id {
+			r.aead = k.aead
+			break
+		}
+	}
+	if r.aead == nil {
+		return fmt.Errorf("segment is encrypted with an unknown key (ID %x)", id)
+	}
+
+	r.records = 0
+	r.plain = nil
+	return nil
+}
+
+// EncryptionWriter allows writing an AES-GCM encrypted stream. Every Write
+// call is sealed as a separate record, so that all frames written to a
+// segment can be read back even if the writer isn't closed cleanly.
+type EncryptionWriter struct {
+	dst     WriteCloseSyncer
+	aead    cipher.AEAD
+	records uint64
+
+	// pending holds the part of the last record that could not be written
+	// to dst yet.
+	pending []byte
+	buf     []byte
+}
+
+// NewEncryptionWriter returns a writer that encrypts the stream with the
+// given key and writes the key ID to dst.
+func NewEncryptionWriter(w WriteCloseSyncer, key []byte) (*EncryptionWriter, error) {
+	k, err := newEncryptionKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(k.id[:]); err != nil {
+		return nil, fmt.Errorf("could not write encryption key ID: %w", err)
+	}
+	return &EncryptionWriter{dst: w, aead: k.aead}, nil
+}
+
+// Write seals p and writes it as a single record. Once p is sealed it is
+// reported as written even if writing the record fails, the rest of the
+// record is written by the next call to Write or Sync instead. This keeps
+// retries of the caller from writing the same data twice.
+func (w *EncryptionWriter) Write(p []byte) (int, error) {
+	if err := w.flush(); err != nil {
+		return 0, err
+	}
+
+	nonceSize := w.aead.NonceSize()
+	length := nonceSize + len(p) + w.aead.Overhead()
+	if cap(w.buf) < encryptionRecordHeaderSize+length {
+		w.buf = make([]byte, encryptionRecordHeaderSize+length)
+	}
+	record := w.buf[:encryptionRecordHeaderSize+nonceSize]
+	binary.LittleEndian.PutUint32(record, uint32(length))
+	nonce := record[encryptionRecordHeaderSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return 0, fmt.Errorf("could not generate nonce: %w", err)
+	}
+	record = w.aead.Seal(record, nonce, p, recordAdditionalData(w.records))
+	w.records++
+
+	w.pending = record
+	return len(p), w.flush()
+}
+
+func (w *EncryptionWriter) flush() error {
+	for len(w.pending) > 0 {
+		n, err := w.dst.Write(w.pending)
+		w.pending = w.pending[n:]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *EncryptionWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.dst.Close()
+}
+
+func (w *EncryptionWriter) Sync() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.dst.Sync()
+}
+
+// recordAdditionalData authenticates the position of a record, so that
+// records can't be reordered or dropped from the middle of a segment
+// without the reader noticing.
+func recordAdditionalData(index uint64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, index)
+}
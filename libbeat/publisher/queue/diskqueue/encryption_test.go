@@ -0,0 +1,264 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+var (
+	testKey      = []byte("0123456789abcdef0123456789abcdef")
+	testOtherKey = []byte("fedcba9876543210")
+)
+
+// writeTestSegment writes the frames to a segment with the given
+// settings and returns the segment.
+func writeTestSegment(t *testing.T, settings Settings, id segmentID, frames ...[]byte) *queueSegment {
+	t.Helper()
+	qs := &queueSegment{id: id}
+	sw, err := qs.getWriter(settings)
+	require.NoError(t, err)
+	for _, frame := range frames {
+		_, err := sw.Write(frame)
+		require.NoError(t, err)
+	}
+	require.NoError(t, sw.UpdateCount(uint32(len(frames))))
+	require.NoError(t, sw.Close())
+	return qs
+}
+
+// testFrame returns a frame as it is written by the writer loop.
+func testFrame(data string) []byte {
+	var buf bytes.Buffer
+	frameSize := uint32(len(data) + frameMetadataSize)
+	_ = binary.Write(&buf, binary.LittleEndian, frameSize)
+	buf.WriteString(data)
+	_ = binary.Write(&buf, binary.LittleEndian, computeChecksum([]byte(data)))
+	_ = binary.Write(&buf, binary.LittleEndian, frameSize)
+	return buf.Bytes()
+}
+
+func TestEncryptedSegmentIsNotPlaintext(t *testing.T) {
+	plaintext := "a secret that must not be on disk in plain text"
+	for name, compress := range map[string]bool{"Encryption": false, "Compression and Encryption": true} {
+		settings := DefaultSettings()
+		settings.Path = t.TempDir()
+		settings.UseCompression = compress
+		settings.EncryptionKey = testKey
+
+		writeTestSegment(t, settings, 0, testFrame(plaintext), testFrame(plaintext))
+
+		data, err := os.ReadFile(settings.segmentPath(0))
+		require.NoError(t, err, name)
+		assert.NotContains(t, string(data), plaintext, name)
+		assert.NotContains(t, string(data), "secret", name)
+
+		header, err := readSegmentHeader(bytes.NewReader(data))
+		require.NoError(t, err, name)
+		assert.Equal(t, ENABLE_ENCRYPTION, header.options&ENABLE_ENCRYPTION, name)
+	}
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	settings.EncryptionKey = testKey
+	old := writeTestSegment(t, settings, 0, testFrame("written with the old key"))
+
+	settings.EncryptionKey = testOtherKey
+	current := writeTestSegment(t, settings, 1, testFrame("written with the new key"))
+
+	t.Run("previous keys are used to read old segments", func(t *testing.T) {
+		settings.PreviousEncryptionKeys = [][]byte{testKey}
+		for _, qs := range []*queueSegment{old, current} {
+			sr, err := qs.getReader(settings)
+			require.NoError(t, err)
+			data, err := io.ReadAll(sr)
+			require.NoError(t, err)
+			assert.Contains(t, string(data), "key")
+			require.NoError(t, sr.Close())
+		}
+	})
+
+	t.Run("segments with unknown keys can't be read", func(t *testing.T) {
+		settings.PreviousEncryptionKeys = nil
+		_, err := old.getReader(settings)
+		assert.ErrorContains(t, err, "unknown key")
+	})
+
+	t.Run("encrypted segments can't be read without keys", func(t *testing.T) {
+		settings.EncryptionKey = nil
+		_, err := current.getReader(settings)
+		assert.ErrorContains(t, err, "unknown key")
+	})
+}
+
+func TestEncryptionDetectsTampering(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	settings.EncryptionKey = testKey
+	qs := writeTestSegment(t, settings, 0, testFrame("abc"), testFrame("defg"))
+
+	path := settings.segmentPath(0)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	sr, err := qs.getReader(settings)
+	require.NoError(t, err)
+	defer sr.Close()
+	_, err = io.ReadAll(sr)
+	assert.ErrorContains(t, err, "could not decrypt record 1")
+}
+
+func TestScanEncryptedSegments(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	settings.EncryptionKey = testKey
+	frames := [][]byte{testFrame("abc"), testFrame("defg"), testFrame("hijkl")}
+	writeTestSegment(t, settings, 0, frames...)
+
+	// Simulate a segment that wasn't closed cleanly, with no frame count
+	// and a partially written last frame.
+	qs := &queueSegment{id: 1}
+	sw, err := qs.getWriter(settings)
+	require.NoError(t, err)
+	for _, frame := range frames[:2] {
+		_, err := sw.Write(frame)
+		require.NoError(t, err)
+	}
+	require.NoError(t, sw.Close())
+	path := settings.segmentPath(1)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-5))
+
+	segments, err := scanExistingSegments(logptest.NewTestingLogger(t, ""), settings)
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+
+	// Segments keep their size on disk, and only the segment that wasn't
+	// closed cleanly is scanned for its frame count.
+	for i, segment := range segments {
+		info, err := os.Stat(settings.segmentPath(segment.id))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(info.Size()), segment.byteCount, i)
+		assert.True(t, segment.encoded, i)
+		_, known := segment.endPosition()
+		assert.False(t, known, i)
+	}
+	assert.Equal(t, uint32(3), segments[0].frameCount)
+	assert.Equal(t, uint32(1), segments[1].frameCount)
+}
+
+func TestReadEncryptedSegmentsAfterRestart(t *testing.T) {
+	for name, compress := range map[string]bool{"Encryption": false, "Compression and Encryption": true} {
+		t.Run(name, func(t *testing.T) {
+			settings := DefaultSettings()
+			settings.Path = t.TempDir()
+			settings.UseCompression = compress
+			settings.EncryptionKey = testKey
+			settings.MaxSegmentSize = 1000
+			const eventCount = 50
+			writeTestQueue(t, settings, eventCount)
+
+			q, err := NewQueue(logptest.NewTestingLogger(t, ""), nil, settings, nil)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, q.Close())
+				<-q.Done()
+			}()
+
+			var messages []string
+			for len(messages) < eventCount {
+				batch, err := q.Get(eventCount)
+				require.NoError(t, err)
+				for i := 0; i < batch.Count(); i++ {
+					event, ok := batch.Entry(i).(publisher.Event)
+					require.True(t, ok)
+					message, err := event.Content.Fields.GetValue("message")
+					require.NoError(t, err)
+					messages = append(messages, message.(string))
+				}
+				batch.Done()
+			}
+			for i, message := range messages {
+				assert.Equal(t, fmt.Sprintf("event %d", i), message)
+			}
+		})
+	}
+}
+
+func TestEncryptionConfig(t *testing.T) {
+	tests := map[string]struct {
+		config encryptionConfig
+		valid  bool
+	}{
+		"AES-128 key":          {config: encryptionConfig{Key: base64.StdEncoding.EncodeToString(testOtherKey)}, valid: true},
+		"AES-256 key":          {config: encryptionConfig{Key: base64.StdEncoding.EncodeToString(testKey)}, valid: true},
+		"raw key":              {config: encryptionConfig{Key: string(testOtherKey)}},
+		"short key":            {config: encryptionConfig{Key: base64.StdEncoding.EncodeToString([]byte("secret"))}},
+		"invalid previous key": {config: encryptionConfig{Key: base64.StdEncoding.EncodeToString(testKey), PreviousKeys: []string{"secret"}}},
+	}
+	for name, tc := range tests {
+		err := tc.config.Validate()
+		if tc.valid {
+			assert.NoError(t, err, name)
+		} else {
+			assert.Error(t, err, name)
+		}
+	}
+}
+
+func TestEncryptionSettingsForUserConfig(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"max_size":                 "1GB",
+		"encryption.key":           base64.StdEncoding.EncodeToString(testKey),
+		"encryption.previous_keys": []string{base64.StdEncoding.EncodeToString(testOtherKey)},
+	})
+	settings, err := SettingsForUserConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, testKey, settings.EncryptionKey)
+	assert.Equal(t, [][]byte{testOtherKey}, settings.PreviousEncryptionKeys)
+}
+
+func TestEncryptionKeyID(t *testing.T) {
+	key, err := newEncryptionKey(testKey)
+	require.NoError(t, err)
+	sum := sha256.Sum256(testKey)
+	assert.NotEqual(t, sum[:encryptionKeyIDSize], key.id[:], "the key ID must not be a plain hash of the key")
+
+	other, err := newEncryptionKey(testOtherKey)
+	require.NoError(t, err)
+	assert.NotEqual(t, key.id, other.id)
+}
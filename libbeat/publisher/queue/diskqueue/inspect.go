@@ -0,0 +1,377 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+// This file holds the helpers used to inspect and repair the files of a
+// disk queue while the queue isn't running.
+
+// SegmentInfo describes a segment file of a disk queue.
+type SegmentInfo struct {
+	ID   uint64
+	Path string
+
+	// Size is the size of the segment file on disk.
+	Size int64
+
+	// Version is the schema version of the segment.
+	Version uint32
+
+	// Options holds the ENABLE_* flags of the segment.
+	Options uint32
+
+	// FrameCount is the number of frames in the segment. If the segment
+	// wasn't closed cleanly, they are counted by scanning the segment.
+	FrameCount uint32
+
+	// Err is set if the segment couldn't be read completely.
+	Err error
+}
+
+// Position is the position of the oldest frame that isn't acknowledged, as
+// stored in the state file of a disk queue.
+type Position struct {
+	SegmentID uint64
+
+	// ByteIndex is the offset of the frame in the segment, counting the
+	// segment header. It is 0 if no frame of the segment was acknowledged.
+	ByteIndex uint64
+
+	// FrameIndex is the index of the frame in the segment.
+	FrameIndex uint64
+}
+
+// Frame is a frame read by ReadSegment.
+type Frame struct {
+	// Index is the index of the frame in the segment.
+	Index uint64
+
+	// Offset is the offset of the frame in the segment, counting the
+	// segment header. For encrypted or compressed segments it is the offset
+	// in the decoded data.
+	Offset uint64
+
+	Event publisher.Event
+}
+
+// SegmentCheck is the result of reading the frames of a segment.
+type SegmentCheck struct {
+	// ValidFrames is the number of frames read before the end of the segment
+	// or the first invalid frame.
+	ValidFrames uint64
+
+	// ValidBytes is the size of the segment up to the end of the last valid
+	// frame, counting the segment header.
+	ValidBytes uint64
+
+	// Err describes why the frame following the valid frames is invalid. It
+	// is nil if all frames of the segment are valid.
+	Err error
+}
+
+// ReadPosition reads the position of the oldest frame that isn't
+// acknowledged from the state file. The state file is empty until the
+// queue acknowledges its first frame, then the zero Position is returned.
+func ReadPosition(settings Settings) (Position, error) {
+	position, err := readStateFile(settings)
+	if err != nil {
+		return Position{}, err
+	}
+	return Position{
+		SegmentID:  uint64(position.segmentID),
+		ByteIndex:  position.byteIndex,
+		FrameIndex: position.frameIndex,
+	}, nil
+}
+
+func readStateFile(settings Settings) (queuePosition, error) {
+	position, err := queuePositionFromPath(settings.stateFilePath())
+	if errors.Is(err, io.EOF) {
+		return queuePosition{}, nil
+	}
+	return position, err
+}
+
+// ListSegments returns the segments of the queue, ordered by ID.
+func ListSegments(settings Settings) ([]SegmentInfo, error) {
+	dirEntries, err := os.ReadDir(settings.directoryPath())
+	if err != nil {
+		return nil, fmt.Errorf("could not read queue directory '%s': %w", settings.directoryPath(), err)
+	}
+
+	var segments []SegmentInfo
+	for _, dirEntry := range dirEntries {
+		id, ok := parseSegmentFileName(dirEntry.Name())
+		if !ok {
+			continue
+		}
+		info := SegmentInfo{ID: id, Path: settings.segmentPath(segmentID(id))}
+		if stat, err := dirEntry.Info(); err == nil {
+			info.Size = stat.Size()
+		}
+		header, err := readSegmentHeaderWithFrameCount(info.Path, settings)
+		if header != nil {
+			info.Version = header.version
+			info.Options = header.options
+			info.FrameCount = header.frameCount
+		}
+		info.Err = err
+		segments = append(segments, info)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].ID < segments[j].ID })
+	return segments, nil
+}
+
+// parseSegmentFileName returns the ID of the segment stored in a file named
+// like "[uint64].seg".
+func parseSegmentFileName(name string) (uint64, bool) {
+	components := strings.Split(name, ".")
+	if len(components) != 2 || strings.ToLower(components[1]) != "seg" {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(components[0], 10, 64)
+	return id, err == nil
+}
+
+// ReadSegment reads the frames of a segment, verifying their checksums, and
+// calls fn with each valid frame if it isn't nil. Reading stops at the first
+// invalid frame, which is described in the returned SegmentCheck. An error
+// is only returned if the segment can't be opened or fn fails.
+func ReadSegment(settings Settings, id uint64, fn func(Frame) error) (SegmentCheck, error) {
+	file, err := os.Open(settings.segmentPath(segmentID(id)))
+	if err != nil {
+		return SegmentCheck{}, fmt.Errorf("couldn't open segment %d: %w", id, err)
+	}
+	defer file.Close()
+
+	header, err := readSegmentHeader(autoRetryReader{file})
+	if err != nil {
+		return SegmentCheck{}, fmt.Errorf("couldn't read header for segment %d: %w", id, err)
+	}
+	sr, err := newSegmentReader(file, header, settings)
+	if err != nil {
+		return SegmentCheck{}, fmt.Errorf("couldn't read segment %d: %w", id, err)
+	}
+	segment := &queueSegment{id: segmentID(id), schemaVersion: &header.version}
+	return readSegmentFrames(sr, segment.headerSize(), fn)
+}
+
+func readSegmentFrames(sr *segmentReader, headerSize uint64, fn func(Frame) error) (SegmentCheck, error) {
+	reader := autoRetryReader{sr}
+	decoder := newEventDecoder()
+	decoder.serializationFormat = sr.serializationFormat
+
+	check := SegmentCheck{ValidBytes: headerSize}
+	for {
+		var frameLength uint32
+		err := binary.Read(reader, binary.LittleEndian, &frameLength)
+		if errors.Is(err, io.EOF) {
+			// The segment ends at a frame boundary.
+			return check, nil
+		}
+		if err != nil {
+			check.Err = fmt.Errorf("couldn't read data frame header: %w", err)
+			return check, nil
+		}
+		if frameLength <= frameMetadataSize {
+			check.Err = fmt.Errorf("data frame with no data (length %d)", frameLength)
+			return check, nil
+		}
+
+		// The frame length may be corrupted, so the data is read without
+		// allocating the whole length upfront.
+		dataLength := int64(frameLength - frameMetadataSize)
+		data, err := io.ReadAll(io.LimitReader(reader, dataLength))
+		if err == nil && int64(len(data)) < dataLength {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			check.Err = fmt.Errorf("couldn't read data frame content: %w", err)
+			return check, nil
+		}
+
+		var checksum uint32
+		if err := binary.Read(reader, binary.LittleEndian, &checksum); err != nil {
+			check.Err = fmt.Errorf("couldn't read data frame checksum: %w", err)
+			return check, nil
+		}
+		if expected := computeChecksum(data); checksum != expected {
+			check.Err = fmt.Errorf("data frame checksum mismatch (%x != %x)", checksum, expected)
+			return check, nil
+		}
+		var duplicateLength uint32
+		if err := binary.Read(reader, binary.LittleEndian, &duplicateLength); err != nil {
+			check.Err = fmt.Errorf("couldn't read data frame footer: %w", err)
+			return check, nil
+		}
+		if duplicateLength != frameLength {
+			check.Err = fmt.Errorf("inconsistent data frame length (%d vs %d)", frameLength, duplicateLength)
+			return check, nil
+		}
+
+		copy(decoder.Buffer(len(data)), data)
+		decoded, err := decoder.Decode()
+		if err != nil {
+			check.Err = fmt.Errorf("couldn't decode data frame: %w", err)
+			return check, nil
+		}
+		event, _ := decoded.(publisher.Event)
+
+		if fn != nil {
+			err := fn(Frame{Index: check.ValidFrames, Offset: check.ValidBytes, Event: event})
+			if err != nil {
+				return check, err
+			}
+		}
+		check.ValidFrames++
+		check.ValidBytes += uint64(frameLength)
+	}
+}
+
+// RepairSegment removes the invalid frames at the end of a segment, keeping
+// the frames before the first invalid one. A segment without valid frames is
+// deleted. If the state file points past the valid frames, it is moved back
+// to the end of the segment. The queue must not be running.
+func RepairSegment(settings Settings, id uint64) (SegmentCheck, error) {
+	check, err := ReadSegment(settings, id, nil)
+	if err != nil || check.Err == nil {
+		return check, err
+	}
+
+	path := settings.segmentPath(segmentID(id))
+	if check.ValidFrames == 0 {
+		if err := os.Remove(path); err != nil {
+			return check, fmt.Errorf("couldn't delete segment %d: %w", id, err)
+		}
+	} else if err := truncateSegment(settings, id, check); err != nil {
+		return check, err
+	}
+
+	return check, clampPosition(settings, id, check)
+}
+
+// truncateSegment cuts a segment after its valid frames. Plain segments are
+// truncated in place. Encrypted or compressed segments are rewritten, as
+// their size on disk doesn't map to frame boundaries.
+func truncateSegment(settings Settings, id uint64, check SegmentCheck) error {
+	path := settings.segmentPath(segmentID(id))
+	file, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("couldn't open segment %d: %w", id, err)
+	}
+	defer file.Close()
+
+	header, err := readSegmentHeader(autoRetryReader{file})
+	if err != nil {
+		return fmt.Errorf("couldn't read header for segment %d: %w", id, err)
+	}
+
+	if header.options&(ENABLE_ENCRYPTION|ENABLE_COMPRESSION) != 0 {
+		return rewriteSegment(settings, id, file, header, check)
+	}
+
+	if err := file.Truncate(int64(check.ValidBytes)); err != nil {
+		return fmt.Errorf("couldn't truncate segment %d: %w", id, err)
+	}
+	if header.version >= 1 {
+		sw := &segmentWriter{dst: file}
+		if err := sw.UpdateCount(uint32(check.ValidFrames)); err != nil {
+			return fmt.Errorf("couldn't update frame count of segment %d: %w", id, err)
+		}
+	}
+	return file.Sync()
+}
+
+// rewriteSegment copies the valid frames of an encrypted or compressed
+// segment to a new file, which then replaces the segment.
+func rewriteSegment(settings Settings, id uint64, file *os.File, header *segmentHeader, check SegmentCheck) error {
+	if header.options&ENABLE_ENCRYPTION != 0 && len(settings.EncryptionKey) == 0 {
+		return fmt.Errorf("segment %d is encrypted, but no encryption key is configured", id)
+	}
+
+	sr, err := newSegmentReader(file, header, settings)
+	if err != nil {
+		return fmt.Errorf("couldn't read segment %d: %w", id, err)
+	}
+	path := settings.segmentPath(segmentID(id))
+	tmpPath := path + ".repair"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("couldn't create repaired segment %d: %w", id, err)
+	}
+	defer os.Remove(tmpPath)
+
+	sw, err := newSegmentWriter(tmpFile, header.options, settings)
+	if err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("couldn't write repaired segment %d: %w", id, err)
+	}
+	_, err = io.CopyN(sw, autoRetryReader{sr}, int64(check.ValidBytes-segmentHeaderSize))
+	if err == nil {
+		err = sw.UpdateCount(uint32(check.ValidFrames))
+	}
+	if err == nil {
+		err = sw.Sync()
+	}
+	if closeErr := sw.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't write repaired segment %d: %w", id, err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// clampPosition moves the position in the state file back to the end of the
+// valid frames of a segment, if it points past them.
+func clampPosition(settings Settings, id uint64, check SegmentCheck) error {
+	position, err := readStateFile(settings)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read queue position: %w", err)
+	}
+	if uint64(position.segmentID) != id || position.frameIndex <= check.ValidFrames {
+		return nil
+	}
+
+	position.byteIndex = check.ValidBytes
+	position.frameIndex = check.ValidFrames
+	file, err := os.OpenFile(settings.stateFilePath(), os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("couldn't open state file: %w", err)
+	}
+	defer file.Close()
+	if err := writeQueuePositionToHandle(file, position); err != nil {
+		return fmt.Errorf("couldn't write queue position: %w", err)
+	}
+	return file.Sync()
+}
@@ -0,0 +1,168 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// writeTestQueue publishes count events to a new queue and closes it once
+// they are all written to disk.
+func writeTestQueue(t *testing.T, settings Settings, count int) {
+	q, err := NewQueue(logptest.NewTestingLogger(t, ""), nil, settings, nil)
+	require.NoError(t, err)
+
+	written := make(chan int, count)
+	producer := q.Producer(queue.ProducerConfig{ACK: func(n int) { written <- n }})
+	for i := 0; i < count; i++ {
+		_, ok := producer.Publish(publisher.Event{Content: beat.Event{
+			Fields: mapstr.M{"message": fmt.Sprintf("event %d", i)},
+		}})
+		require.True(t, ok)
+	}
+	for total := 0; total < count; {
+		total += <-written
+	}
+	require.NoError(t, q.Close())
+	<-q.Done()
+}
+
+func readTestSegment(t *testing.T, settings Settings, id uint64) ([]string, SegmentCheck) {
+	var messages []string
+	check, err := ReadSegment(settings, id, func(frame Frame) error {
+		message, err := frame.Event.Content.Fields.GetValue("message")
+		require.NoError(t, err)
+		messages = append(messages, message.(string))
+		return nil
+	})
+	require.NoError(t, err)
+	return messages, check
+}
+
+func TestInspectAndRepairSegments(t *testing.T) {
+	tests := map[string]func(*Settings){
+		"plain": func(*Settings) {},
+		"compressed": func(s *Settings) {
+			s.UseCompression = true
+		},
+		"encrypted": func(s *Settings) {
+			s.EncryptionKey = []byte("0123456789abcdef")
+		},
+	}
+	for name, configure := range tests {
+		t.Run(name, func(t *testing.T) {
+			settings := DefaultSettings()
+			settings.Path = t.TempDir()
+			configure(&settings)
+			writeTestQueue(t, settings, 5)
+
+			segments, err := ListSegments(settings)
+			require.NoError(t, err)
+			require.Len(t, segments, 1)
+			segment := segments[0]
+			assert.Equal(t, uint32(currentSegmentVersion), segment.Version)
+			assert.Equal(t, uint32(5), segment.FrameCount)
+			assert.NoError(t, segment.Err)
+
+			messages, check := readTestSegment(t, settings, segment.ID)
+			assert.NoError(t, check.Err)
+			assert.Equal(t, []string{"event 0", "event 1", "event 2", "event 3", "event 4"}, messages)
+			assert.Equal(t, uint64(5), check.ValidFrames)
+
+			// Cut the segment in the middle of the last frame.
+			require.NoError(t, os.Truncate(segment.Path, segment.Size-10))
+			messages, check = readTestSegment(t, settings, segment.ID)
+			assert.Error(t, check.Err)
+			assert.Len(t, messages, int(check.ValidFrames))
+
+			repaired, err := RepairSegment(settings, segment.ID)
+			require.NoError(t, err)
+			assert.Equal(t, check.ValidFrames, repaired.ValidFrames)
+
+			messages, check = readTestSegment(t, settings, segment.ID)
+			assert.NoError(t, check.Err)
+			assert.Equal(t, repaired.ValidFrames, check.ValidFrames)
+			assert.Len(t, messages, int(check.ValidFrames))
+
+			segments, err = ListSegments(settings)
+			require.NoError(t, err)
+			require.Len(t, segments, 1)
+			assert.Equal(t, uint32(check.ValidFrames), segments[0].FrameCount)
+			assert.NoError(t, segments[0].Err)
+		})
+	}
+}
+
+func TestRepairSegmentDetectsChecksumMismatch(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	writeTestQueue(t, settings, 3)
+	path := settings.segmentPath(0)
+
+	// Flip a byte in the data of the last frame.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-frameFooterSize-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	_, check := readTestSegment(t, settings, 0)
+	assert.ErrorContains(t, check.Err, "checksum mismatch")
+	assert.Equal(t, uint64(2), check.ValidFrames)
+
+	// The queue position points past the corrupted frame.
+	file, err := os.OpenFile(settings.stateFilePath(), os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	require.NoError(t, writeQueuePositionToHandle(file, queuePosition{
+		segmentID: 0, byteIndex: uint64(len(data)), frameIndex: 3,
+	}))
+	require.NoError(t, file.Close())
+
+	_, err = RepairSegment(settings, 0)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(check.ValidBytes), info.Size())
+
+	position, err := ReadPosition(settings)
+	require.NoError(t, err)
+	assert.Equal(t, Position{SegmentID: 0, ByteIndex: check.ValidBytes, FrameIndex: 2}, position)
+}
+
+func TestRepairSegmentDeletesSegmentWithoutValidFrames(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	writeTestQueue(t, settings, 1)
+	path := settings.segmentPath(0)
+	require.NoError(t, os.Truncate(path, segmentHeaderSize+2))
+
+	check, err := RepairSegment(settings, 0)
+	require.NoError(t, err)
+	assert.Zero(t, check.ValidFrames)
+	assert.NoFileExists(t, path)
+}
@@ -39,6 +39,10 @@ type diskQueue struct {
 	// Metadata related to the segment files.
 	segments diskQueueSegments
 
+	// The number of events that were already in the queue when it was
+	// opened and had not been read yet.
+	restoredEventCount int
+
 	// Metadata related to consumer acks / positions of the oldest remaining
 	// frame.
 	acks *diskQueueACKs
@@ -162,7 +166,7 @@ func NewQueue(
 
 	// Index any existing data segments to be placed in segments.reading.
 	initialSegments, err :=
-		scanExistingSegments(logger, settings.directoryPath())
+		scanExistingSegments(logger, settings)
 	if err != nil {
 		return nil, err
 	}
@@ -216,6 +220,8 @@ func NewQueue(
 		observer: observer,
 		settings: settings,
 
+		restoredEventCount: activeFrameCount,
+
 		segments: diskQueueSegments{
 			reading:          initialSegments,
 			acked:            ackedSegments,
@@ -264,6 +270,12 @@ func (dq *diskQueue) QueueType() string {
 	return QueueType
 }
 
+// RestoredEvents returns the number of events that were already in the
+// queue when it was opened and had not been read by a previous run.
+func (dq *diskQueue) RestoredEvents() int {
+	return dq.restoredEventCount
+}
+
 func (dq *diskQueue) BufferConfig() queue.BufferConfig {
 	return queue.BufferConfig{MaxEvents: 0}
 }
@@ -69,14 +69,16 @@ func TestProduceConsumer(t *testing.T) {
 		}
 	}
 
-	t.Run("direct", testWith(makeTestQueue()))
+	t.Run("direct", testWith(makeTestQueue(nil)))
+	t.Run("encrypted", testWith(makeTestQueue([]byte("0123456789abcdef"))))
 }
 
-func makeTestQueue() queuetest.QueueFactory {
+func makeTestQueue(encryptionKey []byte) queuetest.QueueFactory {
 	return func(t *testing.T) queue.Queue {
 		dir := t.TempDir()
 		settings := DefaultSettings()
 		settings.Path = dir
+		settings.EncryptionKey = encryptionKey
 		logger := logptest.NewTestingLogger(t, "")
 		queue, _ := NewQueue(logger, nil, settings, nil)
 		return testQueue{
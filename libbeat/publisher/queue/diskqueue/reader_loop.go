@@ -19,33 +19,51 @@ package diskqueue
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 )
 
 // startPosition and endPosition are absolute byte offsets into the segment
-// file on disk, and must point to frame boundaries.
+// file on disk (or into its decoded data, for encrypted or compressed
+// segments), and must point to frame boundaries.
 type readerLoopRequest struct {
 	segment       *queueSegment
 	startPosition uint64
 	startFrameID  frameID
-	endPosition   uint64
+
+	// The position to stop reading at, or unknownEndPosition to read
+	// until the end of the segment file.
+	endPosition uint64
 }
 
+// unknownEndPosition is used as a read request's endPosition when the
+// size of the segment's data isn't known.
+const unknownEndPosition = math.MaxUint64
+
+// errSegmentEnd is returned by nextFrame when the segment file ends at a
+// frame boundary.
+var errSegmentEnd = errors.New("couldn't read data frame header: EOF")
+
 type readerLoopResponse struct {
 	// The number of frames successfully read from the requested segment file.
 	frameCount uint64
 
 	// The number of bytes successfully read from the requested segment file.
 	// If this is less than (endOffset - startOffset) from the original request,
-	// then err is guaranteed to be non-nil.
+	// then either err is non-nil or endOfSegment is set.
 	byteCount uint64
 
 	// If there was an error in the segment file (i.e. inconsistent data), the
 	// err field is set.
 	err error
+
+	// Set if a request with unknownEndPosition reached the end of the
+	// segment file.
+	endOfSegment bool
 }
 
 type readerLoop struct {
@@ -159,6 +177,13 @@ func (rl *readerLoop) processRequest(request readerLoopRequest) readerLoopRespon
 		// - there are no more frames to read, or
 		// - we have reached the end of the requested region
 		if err != nil || frame == nil || byteCount >= targetLength {
+			if request.endPosition == unknownEndPosition && errors.Is(err, errSegmentEnd) {
+				return readerLoopResponse{
+					frameCount:   frameCount,
+					byteCount:    byteCount,
+					endOfSegment: true,
+				}
+			}
 			return readerLoopResponse{
 				frameCount: frameCount,
 				byteCount:  byteCount,
@@ -196,6 +221,9 @@ func (rl *readerLoop) nextFrame(handle *segmentReader, maxLength uint64) (*readF
 	reader := autoRetryReader{handle}
 	var frameLength uint32
 	err := binary.Read(reader, binary.LittleEndian, &frameLength)
+	if errors.Is(err, io.EOF) {
+		return nil, errSegmentEnd
+	}
 	if err != nil {
 		return nil, fmt.Errorf("couldn't read data frame header: %w", err)
 	}
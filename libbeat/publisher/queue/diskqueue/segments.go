@@ -25,8 +25,6 @@ import (
 	"os"
 	"path"
 	"sort"
-	"strconv"
-	"strings"
 
 	"github.com/elastic/elastic-agent-libs/logp"
 )
@@ -118,6 +116,16 @@ type queueSegment struct {
 	//
 	// Used to count how many frames still need to be acknowledged by consumers.
 	framesRead uint64
+
+	// Set if this segment was loaded from a previous session and is
+	// encrypted or compressed. Read positions in such a segment refer to
+	// the decoded data, so byteCount (the file size) can't be used to find
+	// the end of the segment while reading it.
+	encoded bool
+
+	// The read position at the end of an encoded segment's data. It is 0
+	// until the reader reaches the end of the segment.
+	readEnd uint64
 }
 
 type segmentHeader struct {
@@ -150,7 +158,7 @@ const currentSegmentVersion = 2
 const segmentHeaderSize = 12
 
 const (
-	_                  uint32 = 1 << iota // 0x1
+	ENABLE_ENCRYPTION  uint32 = 1 << iota // 0x1
 	ENABLE_COMPRESSION                    // 0x2
 	ENABLE_PROTOBUF                       // 0x4
 )
@@ -164,7 +172,8 @@ func (s bySegmentID) Less(i, j int) bool { return s[i].id < s[j].id }
 
 // Scan the given path for segment files, and return them in a list
 // ordered by segment id.
-func scanExistingSegments(logger *logp.Logger, pathStr string) ([]*queueSegment, error) {
+func scanExistingSegments(logger *logp.Logger, settings Settings) ([]*queueSegment, error) {
+	pathStr := settings.directoryPath()
 	dirEntries, err := os.ReadDir(pathStr)
 	if err != nil {
 		return nil, fmt.Errorf("could not read queue directory '%s': %w", pathStr, err)
@@ -178,38 +187,46 @@ func scanExistingSegments(logger *logp.Logger, pathStr string) ([]*queueSegment,
 			continue
 		}
 
-		components := strings.Split(file.Name(), ".")
-		if len(components) == 2 && strings.ToLower(components[1]) == "seg" {
-			// Parse the id as base-10 64-bit unsigned int. We ignore file names that
-			// don't match the "[uint64].seg" pattern.
-			if id, err := strconv.ParseUint(components[0], 10, 64); err == nil {
-				fullPath := path.Join(pathStr, file.Name())
-				header, err := readSegmentHeaderWithFrameCount(fullPath)
-				if header == nil {
-					logger.Errorf("couldn't load segment file '%v': %v", fullPath, err)
-					continue
-				}
-				// If we get an error but still got a valid header back, then we
-				// were able to read at least some frames, so we keep this segment
-				// but issue a warning.
-				if err != nil {
-					logger.Warnf(
-						"error loading segment file '%v', data may be incomplete: %v",
-						fullPath, err)
-				}
-				segments = append(segments, &queueSegment{
-					id:            segmentID(id),
-					schemaVersion: &header.version,
-					frameCount:    header.frameCount,
-					byteCount:     uint64(file.Size()),
-				})
-			}
+		// We ignore file names that don't match the "[uint64].seg" pattern.
+		id, ok := parseSegmentFileName(file.Name())
+		if !ok {
+			continue
+		}
+		fullPath := path.Join(pathStr, file.Name())
+		header, err := readSegmentHeaderWithFrameCount(fullPath, settings)
+		if header == nil {
+			logger.Errorf("couldn't load segment file '%v': %v", fullPath, err)
+			continue
+		}
+		// If we get an error but still got a valid header back, then we
+		// were able to read at least some frames, so we keep this segment
+		// but issue a warning.
+		if err != nil {
+			logger.Warnf(
+				"error loading segment file '%v', data may be incomplete: %v",
+				fullPath, err)
 		}
+		segments = append(segments, &queueSegment{
+			id:            segmentID(id),
+			schemaVersion: &header.version,
+			frameCount:    header.frameCount,
+			byteCount:     uint64(file.Size()),
+			encoded:       header.options&(ENABLE_ENCRYPTION|ENABLE_COMPRESSION) != 0,
+		})
 	}
 	sort.Sort(bySegmentID(segments))
 	return segments, nil
 }
 
+// endPosition returns the read position at the end of this segment, and
+// false if it isn't known yet.
+func (segment *queueSegment) endPosition() (uint64, bool) {
+	if segment.encoded {
+		return segment.readEnd, segment.readEnd > 0
+	}
+	return segment.byteCount, true
+}
+
 // headerSize returns the logical size ("logical" because it may not have
 // been written to disk yet) of this segment file's header region. The
 // segment's first data frame begins immediately after the header.
@@ -238,10 +255,23 @@ func (segment *queueSegment) getReader(queueSettings Settings) (*segmentReader,
 
 	header, err := readSegmentHeader(file)
 	if err != nil {
+		file.Close()
 		return nil, fmt.Errorf(
 			"couldn't read header for segment %d: %w", segment.id, err)
 	}
 
+	sr, err := newSegmentReader(file, header, queueSettings)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf(
+			"couldn't read segment %d: %w", segment.id, err)
+	}
+	return sr, nil
+}
+
+// newSegmentReader returns a segmentReader for the data region of a
+// segment, file must be positioned right after the header.
+func newSegmentReader(file *os.File, header *segmentHeader, queueSettings Settings) (*segmentReader, error) {
 	sr := &segmentReader{}
 	sr.src = file
 
@@ -255,8 +285,17 @@ func (segment *queueSegment) getReader(queueSettings Settings) (*segmentReader,
 		sr.serializationFormat = SerializationCBOR
 	}
 
+	var src io.ReadCloser = sr.src
+	if (header.options & ENABLE_ENCRYPTION) == ENABLE_ENCRYPTION {
+		er, err := NewEncryptionReader(sr.src, queueSettings.decryptionKeys())
+		if err != nil {
+			return nil, err
+		}
+		sr.er = er
+		src = er
+	}
 	if (header.options & ENABLE_COMPRESSION) == ENABLE_COMPRESSION {
-		sr.cr = NewCompressionReader(sr.src)
+		sr.cr = NewCompressionReader(src)
 	}
 	return sr, nil
 }
@@ -275,7 +314,21 @@ func (segment *queueSegment) getWriter(queueSettings Settings) (*segmentWriter,
 	if queueSettings.UseCompression {
 		options = options | ENABLE_COMPRESSION
 	}
+	if len(queueSettings.EncryptionKey) > 0 {
+		options = options | ENABLE_ENCRYPTION
+	}
 
+	sw, err := newSegmentWriter(file, options, queueSettings)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return sw, nil
+}
+
+// newSegmentWriter writes the header of a new segment with the given
+// options to file, and returns a segmentWriter for its data region.
+func newSegmentWriter(file *os.File, options uint32, queueSettings Settings) (*segmentWriter, error) {
 	sw := &segmentWriter{}
 	sw.dst = file
 
@@ -283,8 +336,17 @@ func (segment *queueSegment) getWriter(queueSettings Settings) (*segmentWriter,
 		return nil, err
 	}
 
+	var dst WriteCloseSyncer = sw.dst
+	if (options & ENABLE_ENCRYPTION) == ENABLE_ENCRYPTION {
+		ew, err := NewEncryptionWriter(sw.dst, queueSettings.EncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		sw.ew = ew
+		dst = ew
+	}
 	if (options & ENABLE_COMPRESSION) == ENABLE_COMPRESSION {
-		sw.cw = NewCompressionWriter(sw.dst)
+		sw.cw = NewCompressionWriter(dst)
 	}
 
 	return sw, nil
@@ -316,7 +378,7 @@ func (segment *queueSegment) getWriterWithRetry(
 // file was not closed cleanly), it attempts to calculate it manually
 // by scanning the file, and returns a struct with the "correct"
 // frame count.
-func readSegmentHeaderWithFrameCount(path string) (*segmentHeader, error) {
+func readSegmentHeaderWithFrameCount(path string, settings Settings) (*segmentHeader, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf(
@@ -343,6 +405,11 @@ func readSegmentHeaderWithFrameCount(path string) (*segmentHeader, error) {
 	//   and still has the placeholder value of 0.
 	// In either case, the right thing to do is to scan the file
 	// and fill in the frame count manually.
+	if header.options&(ENABLE_ENCRYPTION|ENABLE_COMPRESSION) != 0 {
+		// The frames of encrypted or compressed segments can only be
+		// found by decoding the segment.
+		return scanDecodedSegment(file, header, settings)
+	}
 	for {
 		var frameLength uint32
 		err = binary.Read(reader, binary.LittleEndian, &frameLength)
@@ -385,6 +452,52 @@ func readSegmentHeaderWithFrameCount(path string) (*segmentHeader, error) {
 	return nil, err
 }
 
+// scanDecodedSegment counts the frames of an encrypted or compressed
+// segment that was not closed cleanly.
+func scanDecodedSegment(file *os.File, header *segmentHeader, settings Settings) (*segmentHeader, error) {
+	sr, err := newSegmentReader(file, header, settings)
+	if err != nil {
+		return nil, err
+	}
+	reader := autoRetryReader{sr}
+
+	for {
+		var frameLength uint32
+		err = binary.Read(reader, binary.LittleEndian, &frameLength)
+		if err != nil {
+			break
+		}
+		if frameLength <= frameMetadataSize {
+			err = fmt.Errorf("data frame with no data (length %d)", frameLength)
+			break
+		}
+		_, err = io.CopyN(io.Discard, reader, int64(frameLength-8))
+		if err != nil {
+			break
+		}
+		var duplicateLength uint32
+		err = binary.Read(reader, binary.LittleEndian, &duplicateLength)
+		if err != nil {
+			break
+		}
+		if frameLength != duplicateLength {
+			err = fmt.Errorf(
+				"mismatched frame length: %v vs %v", frameLength, duplicateLength)
+			break
+		}
+
+		header.frameCount++
+	}
+	if header.frameCount == 0 {
+		return nil, err
+	}
+	// EOF at a frame boundary means we successfully scanned all frames.
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return header, err
+}
+
 // readSegmentHeader decodes a raw header from the given reader and
 // returns it as a struct.
 func readSegmentHeader(in io.Reader) (*segmentHeader, error) {
@@ -443,6 +556,7 @@ func (segments *diskQueueSegments) sizeOnDisk() uint64 {
 // less compressable.
 type segmentReader struct {
 	src                 io.ReadSeekCloser
+	er                  *EncryptionReader
 	cr                  *CompressionReader
 	serializationFormat SerializationFormat
 }
@@ -451,6 +565,9 @@ func (r *segmentReader) Read(p []byte) (int, error) {
 	if r.cr != nil {
 		return r.cr.Read(p)
 	}
+	if r.er != nil {
+		return r.er.Read(p)
+	}
 	return r.src.Read(p)
 }
 
@@ -458,11 +575,14 @@ func (r *segmentReader) Close() error {
 	if r.cr != nil {
 		return r.cr.Close()
 	}
+	if r.er != nil {
+		return r.er.Close()
+	}
 	return r.src.Close()
 }
 
 func (r *segmentReader) Seek(offset int64, whence int) (int64, error) {
-	if r.cr != nil {
+	if r.cr != nil || r.er != nil {
 		//can't seek before segment header
 		if (offset + int64(whence)) < segmentHeaderSize {
 			return 0, fmt.Errorf("illegal seek offset %d, whence %d", offset, whence)
@@ -470,10 +590,17 @@ func (r *segmentReader) Seek(offset int64, whence int) (int64, error) {
 		if _, err := r.src.Seek(segmentHeaderSize, io.SeekStart); err != nil {
 			return 0, fmt.Errorf("could not seek past segment header: %w", err)
 		}
-		if err := r.cr.Reset(); err != nil {
-			return 0, fmt.Errorf("could not reset compression: %w", err)
+		if r.er != nil {
+			if err := r.er.Reset(); err != nil {
+				return 0, fmt.Errorf("could not reset encryption: %w", err)
+			}
 		}
-		written, err := io.CopyN(io.Discard, r.cr, (offset+int64(whence))-segmentHeaderSize)
+		if r.cr != nil {
+			if err := r.cr.Reset(); err != nil {
+				return 0, fmt.Errorf("could not reset compression: %w", err)
+			}
+		}
+		written, err := io.CopyN(io.Discard, r, (offset+int64(whence))-segmentHeaderSize)
 		return written + segmentHeaderSize, err
 	}
 	return r.src.Seek(offset, whence)
@@ -488,6 +615,7 @@ func (r *segmentReader) Seek(offset int64, whence int) (int64, error) {
 // data less compressable.
 type segmentWriter struct {
 	dst *os.File
+	ew  *EncryptionWriter
 	cw  *CompressionWriter
 }
 
@@ -495,6 +623,9 @@ func (w *segmentWriter) Write(p []byte) (int, error) {
 	if w.cw != nil {
 		return w.cw.Write(p)
 	}
+	if w.ew != nil {
+		return w.ew.Write(p)
+	}
 	return w.dst.Write(p)
 }
 
@@ -502,6 +633,9 @@ func (w *segmentWriter) Close() error {
 	if w.cw != nil {
 		return w.cw.Close()
 	}
+	if w.ew != nil {
+		return w.ew.Close()
+	}
 	return w.dst.Close()
 }
 
@@ -509,6 +643,9 @@ func (w *segmentWriter) Sync() error {
 	if w.cw != nil {
 		return w.cw.Sync()
 	}
+	if w.ew != nil {
+		return w.ew.Sync()
+	}
 	return w.dst.Sync()
 }
 
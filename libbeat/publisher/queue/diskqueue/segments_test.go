@@ -28,6 +28,7 @@ func TestSegmentsRoundTrip(t *testing.T) {
 	tests := map[string]struct {
 		id        segmentID
 		compress  bool
+		key       []byte
 		plaintext []byte
 	}{
 		"No Compression": {
@@ -40,6 +41,17 @@ func TestSegmentsRoundTrip(t *testing.T) {
 			compress:  true,
 			plaintext: []byte("compression only"),
 		},
+		"With Encryption": {
+			id:        3,
+			key:       []byte("0123456789abcdef0123456789abcdef"),
+			plaintext: []byte("encryption only"),
+		},
+		"With Compression and Encryption": {
+			id:        4,
+			compress:  true,
+			key:       []byte("0123456789abcdef0123456789abcdef"),
+			plaintext: []byte("compression and encryption"),
+		},
 	}
 	dir := t.TempDir()
 	for name, tc := range tests {
@@ -47,6 +59,7 @@ func TestSegmentsRoundTrip(t *testing.T) {
 		settings := DefaultSettings()
 		settings.Path = dir
 		settings.UseCompression = tc.compress
+		settings.EncryptionKey = tc.key
 		qs := &queueSegment{
 			id: tc.id,
 		}
@@ -84,6 +97,7 @@ func TestSegmentReaderSeek(t *testing.T) {
 	tests := map[string]struct {
 		id         segmentID
 		compress   bool
+		key        []byte
 		plaintexts [][]byte
 	}{
 		"No Compression": {
@@ -96,12 +110,24 @@ func TestSegmentReaderSeek(t *testing.T) {
 			compress:   true,
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 		},
+		"With Encryption": {
+			id:         3,
+			key:        []byte("0123456789abcdef0123456789abcdef"),
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+		},
+		"With Compression and Encryption": {
+			id:         4,
+			compress:   true,
+			key:        []byte("0123456789abcdef0123456789abcdef"),
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+		},
 	}
 	dir := t.TempDir()
 	for name, tc := range tests {
 		settings := DefaultSettings()
 		settings.Path = dir
 		settings.UseCompression = tc.compress
+		settings.EncryptionKey = tc.key
 
 		qs := &queueSegment{
 			id: tc.id,
@@ -136,6 +162,7 @@ func TestSegmentReaderSeekLocations(t *testing.T) {
 	tests := map[string]struct {
 		id         segmentID
 		compress   bool
+		key        []byte
 		plaintexts [][]byte
 		location   int64
 	}{
@@ -151,12 +178,19 @@ func TestSegmentReaderSeekLocations(t *testing.T) {
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 			location:   2,
 		},
+		"Encryption": {
+			id:         2,
+			key:        []byte("0123456789abcdef0123456789abcdef"),
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+			location:   2,
+		},
 	}
 	dir := t.TempDir()
 	for name, tc := range tests {
 		settings := DefaultSettings()
 		settings.Path = dir
 		settings.UseCompression = tc.compress
+		settings.EncryptionKey = tc.key
 		qs := &queueSegment{
 			id: tc.id,
 		}
@@ -0,0 +1,64 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	c "github.com/elastic/elastic-agent-libs/config"
+)
+
+// Settings contains the configuration of both tiers of a hybrid queue.
+type Settings struct {
+	// Memory configures the tier events are kept in until it holds
+	// Memory.Events events.
+	Memory memqueue.Settings
+
+	// Disk configures the tier events are spilled to once the memory tier
+	// is full.
+	Disk diskqueue.Settings
+}
+
+// userConfig holds the parameters for a hybrid queue that are configurable
+// by the end user in the beats yml file. The settings of each tier are the
+// same as for the queue type of the same name.
+type userConfig struct {
+	Mem  *c.C `config:"mem"`
+	Disk *c.C `config:"disk" validate:"required"`
+}
+
+// SettingsForUserConfig returns a Settings struct initialized with the
+// end-user-configurable settings in the given config tree.
+func SettingsForUserConfig(cfg *c.C) (Settings, error) {
+	config := userConfig{}
+	if err := cfg.Unpack(&config); err != nil {
+		return Settings{}, fmt.Errorf("couldn't unpack hybrid queue config: %w", err)
+	}
+
+	memSettings, err := memqueue.SettingsForUserConfig(config.Mem)
+	if err != nil {
+		return Settings{}, fmt.Errorf("invalid hybrid queue mem settings: %w", err)
+	}
+	diskSettings, err := diskqueue.SettingsForUserConfig(config.Disk)
+	if err != nil {
+		return Settings{}, fmt.Errorf("invalid hybrid queue disk settings: %w", err)
+	}
+	return Settings{Memory: memSettings, Disk: diskSettings}, nil
+}
@@ -0,0 +1,88 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// tierObserver forwards the updates of one tier to the queue's observer,
+// and reports them for the tier alone under "pipeline.queue.tiers.{tier}",
+// to show which tier events are served from.
+type tierObserver struct {
+	queue.Observer
+
+	addedEvents    *monitoring.Uint
+	consumedEvents *monitoring.Uint
+	consumedBytes  *monitoring.Uint
+	removedEvents  *monitoring.Uint
+	filledEvents   *monitoring.Uint // gauge
+
+	onRemove func(count int)
+}
+
+func newTierObserver(parent queue.Observer, id tierID, onRemove func(count int)) *tierObserver {
+	var reg *monitoring.Registry
+	if metrics := queue.MetricsRegistry(parent); metrics != nil {
+		tiers := metrics.GetRegistry("tiers")
+		if tiers == nil {
+			tiers = metrics.NewRegistry("tiers")
+		}
+		reg = tiers.NewRegistry(tierNames[id])
+	} else {
+		// Keep the metrics out of the default registry.
+		reg = monitoring.NewRegistry()
+	}
+
+	return &tierObserver{
+		Observer:       parent,
+		addedEvents:    monitoring.NewUint(reg, "added.events"),
+		consumedEvents: monitoring.NewUint(reg, "consumed.events"),
+		consumedBytes:  monitoring.NewUint(reg, "consumed.bytes"),
+		removedEvents:  monitoring.NewUint(reg, "removed.events"),
+		filledEvents:   monitoring.NewUint(reg, "filled.events"),
+		onRemove:       onRemove,
+	}
+}
+
+func (ob *tierObserver) Restore(eventCount int, byteCount int) {
+	ob.filledEvents.Set(uint64(eventCount))
+	ob.Observer.Restore(eventCount, byteCount)
+}
+
+func (ob *tierObserver) AddEvent(byteCount int) {
+	ob.addedEvents.Inc()
+	ob.filledEvents.Inc()
+	ob.Observer.AddEvent(byteCount)
+}
+
+func (ob *tierObserver) ConsumeEvents(eventCount int, byteCount int) {
+	ob.consumedEvents.Add(uint64(eventCount))
+	ob.consumedBytes.Add(uint64(byteCount))
+	ob.Observer.ConsumeEvents(eventCount, byteCount)
+}
+
+func (ob *tierObserver) RemoveEvents(eventCount int, byteCount int) {
+	ob.removedEvents.Add(uint64(eventCount))
+	ob.filledEvents.Sub(uint64(eventCount))
+	ob.Observer.RemoveEvents(eventCount, byteCount)
+	if ob.onRemove != nil {
+		ob.onRemove(eventCount)
+	}
+}
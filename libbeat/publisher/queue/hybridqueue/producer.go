@@ -0,0 +1,157 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+)
+
+// producer publishes events to the tier chosen by the queue. Each tier
+// producer acknowledges its events independently, so the ACKs are merged
+// to report them in the order the events were published.
+type producer struct {
+	queue *hybridQueue
+	tiers [tierCount]queue.Producer
+	acks  *ackMerger
+}
+
+func newProducer(q *hybridQueue, cfg queue.ProducerConfig) *producer {
+	p := &producer{queue: q}
+	if cfg.ACK != nil {
+		p.acks = &ackMerger{onACK: cfg.ACK}
+	}
+	for id := range p.tiers {
+		tierCfg := queue.ProducerConfig{}
+		if p.acks != nil {
+			id := tierID(id)
+			tierCfg.ACK = func(count int) { p.acks.ack(id, count) }
+		}
+		p.tiers[id] = q.tiers[id].queue.Producer(tierCfg)
+	}
+	return p
+}
+
+func (p *producer) Publish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, true)
+}
+
+func (p *producer) TryPublish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, false)
+}
+
+func (p *producer) publish(entry queue.Entry, block bool) (queue.EntryID, bool) {
+	id := p.queue.reserve()
+	if p.acks != nil {
+		p.acks.add(id)
+	}
+
+	var entryID queue.EntryID
+	var ok bool
+	if block {
+		entryID, ok = p.tiers[id].Publish(entry)
+	} else {
+		entryID, ok = p.tiers[id].TryPublish(entry)
+	}
+
+	if !ok && p.acks != nil {
+		p.acks.cancel()
+	}
+	p.queue.published(id, ok)
+	return entryID, ok
+}
+
+func (p *producer) Close() {
+	for _, tierProducer := range p.tiers {
+		tierProducer.Close()
+	}
+}
+
+// ackMerger reports the ACKs of the tiers in publish order. The memory
+// tier acknowledges events once the output did, while the disk tier does
+// as soon as they are written, so events spilled to disk are often
+// acknowledged before older events in memory.
+type ackMerger struct {
+	onACK func(count int)
+
+	mu sync.Mutex
+	// runs holds the tiers of the events that weren't reported yet in
+	// publish order, with consecutive events of the same tier merged.
+	runs []tierRun
+	// acked holds the number of events of each tier that were acknowledged
+	// but not reported yet.
+	acked [tierCount]int
+}
+
+type tierRun struct {
+	tier  tierID
+	count int
+}
+
+// add records that the next event is published to the tier.
+func (m *ackMerger) add(id tierID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n := len(m.runs); n > 0 && m.runs[n-1].tier == id {
+		m.runs[n-1].count++
+		return
+	}
+	m.runs = append(m.runs, tierRun{tier: id, count: 1})
+}
+
+// cancel removes the last event added, after it failed to be published.
+func (m *ackMerger) cancel() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.runs)
+	if n == 0 {
+		return
+	}
+	m.runs[n-1].count--
+	if m.runs[n-1].count == 0 {
+		m.runs = m.runs[:n-1]
+	}
+}
+
+// ack reports the events that can be reported after the tier acknowledged
+// count events. The callback is called with the lock held, since the tiers
+// acknowledge events from different goroutines.
+func (m *ackMerger) ack(id tierID, count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.acked[id] += count
+	total := 0
+	for len(m.runs) > 0 {
+		run := &m.runs[0]
+		n := min(run.count, m.acked[run.tier])
+		if n == 0 {
+			break
+		}
+		run.count -= n
+		m.acked[run.tier] -= n
+		total += n
+		if run.count > 0 {
+			break
+		}
+		m.runs = m.runs[1:]
+	}
+	if total > 0 {
+		m.onACK(total)
+	}
+}
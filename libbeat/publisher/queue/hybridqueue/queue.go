@@ -0,0 +1,289 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// QueueType is the name of the hybrid queue in the queue configuration.
+const QueueType = "hybrid"
+
+type tierID int
+
+const (
+	memoryTier tierID = iota
+	diskTier
+	tierCount
+)
+
+var tierNames = [tierCount]string{"memory", "disk"}
+
+// hybridQueue keeps events in a memory queue until it is full and spills
+// the events that don't fit to a disk queue. Events in memory are always
+// older than the ones on disk: once the queue spills, new events are
+// written to disk until all of it was read, so the output receives the
+// events in the order they were published.
+type hybridQueue struct {
+	logger *logp.Logger
+	tiers  [tierCount]tier
+
+	// The number of events the memory tier can hold.
+	memoryCapacity int
+
+	mu sync.Mutex
+
+	// spilling is set once the memory tier is full. It is reset once all
+	// events on disk have been read, and no more events are being written
+	// to it.
+	spilling bool
+
+	// The number of events in the memory tier, including the ones that are
+	// read but not yet acknowledged.
+	memoryUsed int
+
+	// notify wakes up a consumer waiting for events to be published.
+	notify chan struct{}
+
+	closeOnce sync.Once
+	closing   chan struct{}
+	done      chan struct{}
+}
+
+type tier struct {
+	queue queue.Queue
+
+	// The number of published events in the tier that haven't been
+	// returned by Get.
+	pending int
+
+	// The number of events that are being published to the tier. Get
+	// doesn't wait for them, since publishing them can still fail.
+	reserved int
+}
+
+// FactoryForSettings is a simple wrapper around NewQueue so a concrete
+// Settings object can be wrapped in a queue-agnostic interface for
+// later use by the pipeline.
+func FactoryForSettings(settings Settings) queue.QueueFactory {
+	return func(
+		logger *logp.Logger,
+		observer queue.Observer,
+		inputQueueSize int,
+		encoderFactory queue.EncoderFactory,
+	) (queue.Queue, error) {
+		return NewQueue(logger, observer, settings, inputQueueSize, encoderFactory)
+	}
+}
+
+// NewQueue returns a hybrid queue, opening the disk tier at the configured
+// path. Events left on disk by a previous run are read before any new
+// events.
+func NewQueue(
+	logger *logp.Logger,
+	observer queue.Observer,
+	settings Settings,
+	inputQueueSize int,
+	encoderFactory queue.EncoderFactory,
+) (*hybridQueue, error) {
+	logger = logger.Named("hybridqueue")
+	if observer == nil {
+		observer = queue.NewQueueObserver(nil)
+	}
+
+	q := &hybridQueue{
+		logger:         logger,
+		memoryCapacity: settings.Memory.Events,
+		notify:         make(chan struct{}, 1),
+		closing:        make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+
+	memObserver := newTierObserver(observer, memoryTier, q.memoryRemoved)
+	diskObserver := newTierObserver(observer, diskTier, nil)
+
+	disk, err := diskqueue.NewQueue(logger, diskObserver, settings.Disk, encoderFactory)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open disk tier: %w", err)
+	}
+	mem := memqueue.NewQueue(logger, memObserver, settings.Memory, inputQueueSize, encoderFactory)
+
+	q.tiers[memoryTier] = tier{queue: mem}
+	q.tiers[diskTier] = tier{queue: disk}
+
+	// Events from a previous run were published before any new ones, so
+	// start spilling until they are read.
+	if restored := disk.RestoredEvents(); restored > 0 {
+		q.tiers[diskTier].pending = restored
+		q.spilling = true
+	}
+
+	go func() {
+		<-mem.Done()
+		<-disk.Done()
+		close(q.done)
+	}()
+	return q, nil
+}
+
+func (q *hybridQueue) Close() error {
+	q.closeOnce.Do(func() {
+		close(q.closing)
+		_ = q.tiers[memoryTier].queue.Close()
+		_ = q.tiers[diskTier].queue.Close()
+	})
+	return nil
+}
+
+func (q *hybridQueue) Done() <-chan struct{} {
+	return q.done
+}
+
+func (q *hybridQueue) QueueType() string {
+	return QueueType
+}
+
+func (q *hybridQueue) BufferConfig() queue.BufferConfig {
+	// Like for the disk queue, the number of events is only bounded by the
+	// size of the disk tier.
+	return queue.BufferConfig{MaxEvents: 0}
+}
+
+func (q *hybridQueue) Producer(cfg queue.ProducerConfig) queue.Producer {
+	return newProducer(q, cfg)
+}
+
+// Get returns the next batch from the memory tier as long as it holds
+// events that weren't read yet, and from the disk tier otherwise.
+func (q *hybridQueue) Get(eventCount int) (queue.Batch, error) {
+	for {
+		if id, ok := q.nextTier(); ok {
+			t := &q.tiers[id]
+			batch, err := t.queue.Get(eventCount)
+			if err != nil {
+				return nil, err
+			}
+			q.mu.Lock()
+			t.pending -= batch.Count()
+			q.checkSpilled()
+			more := q.tiers[memoryTier].pending > 0 || q.tiers[diskTier].pending > 0
+			q.mu.Unlock()
+			if more {
+				// Pass the wakeup on in case other consumers are waiting.
+				q.wakeup()
+			}
+			return batch, nil
+		}
+
+		select {
+		case <-q.notify:
+		case <-q.closing:
+			return nil, io.EOF
+		}
+	}
+}
+
+// nextTier returns the tier to read the next batch from, and false if no
+// events are pending in either tier.
+func (q *hybridQueue) nextTier() (tierID, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch {
+	case q.tiers[memoryTier].pending > 0:
+		return memoryTier, true
+	case q.tiers[diskTier].pending > 0:
+		return diskTier, true
+	}
+	return 0, false
+}
+
+// reserve returns the tier a new event is written to. If the memory tier
+// is chosen the event is counted against its capacity, if the disk tier is
+// chosen the event is counted as reserved right away, so that no new events
+// are written to memory before it is read.
+func (q *hybridQueue) reserve() tierID {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.spilling && q.memoryUsed < q.memoryCapacity {
+		q.memoryUsed++
+		return memoryTier
+	}
+	if !q.spilling {
+		q.logger.Debug("Memory tier is full, spilling events to disk")
+		q.spilling = true
+	}
+	q.tiers[diskTier].reserved++
+	return diskTier
+}
+
+// published updates the counts after an event reserved for the tier was
+// published, or failed to be.
+func (q *hybridQueue) published(id tierID, ok bool) {
+	q.mu.Lock()
+	switch {
+	case ok && id == memoryTier:
+		q.tiers[memoryTier].pending++
+	case !ok && id == memoryTier:
+		q.memoryUsed--
+	case ok && id == diskTier:
+		q.tiers[diskTier].reserved--
+		q.tiers[diskTier].pending++
+	case !ok && id == diskTier:
+		q.tiers[diskTier].reserved--
+		q.checkSpilled()
+	}
+	q.mu.Unlock()
+
+	if ok {
+		q.wakeup()
+	}
+}
+
+func (q *hybridQueue) wakeup() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// checkSpilled stops spilling once all events on disk were read. It must
+// be called with the lock held.
+func (q *hybridQueue) checkSpilled() {
+	disk := &q.tiers[diskTier]
+	if q.spilling && disk.pending <= 0 && disk.reserved <= 0 {
+		q.logger.Debug("All spilled events were read, writing new events to memory")
+		q.spilling = false
+	}
+}
+
+// memoryRemoved frees the space of events that were removed from the
+// memory tier.
+func (q *hybridQueue) memoryRemoved(count int) {
+	q.mu.Lock()
+	q.memoryUsed -= count
+	q.mu.Unlock()
+}
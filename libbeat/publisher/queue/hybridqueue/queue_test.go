@@ -0,0 +1,300 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/queuetest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func testSettings(t *testing.T, memoryEvents int) Settings {
+	disk := diskqueue.DefaultSettings()
+	disk.Path = t.TempDir()
+	return Settings{
+		Memory: memqueue.Settings{
+			Events:        memoryEvents,
+			MaxGetRequest: memoryEvents,
+		},
+		Disk: disk,
+	}
+}
+
+func TestProduceConsumer(t *testing.T) {
+	events := 1024
+	batchSize := 16
+
+	for name, memoryEvents := range map[string]int{"memory": 2048, "spilling": 8} {
+		factory := func(t *testing.T) queue.Queue {
+			q, err := NewQueue(logp.NewNopLogger(), nil, testSettings(t, memoryEvents), 0, nil)
+			require.NoError(t, err)
+			return q
+		}
+		t.Run(name, func(t *testing.T) {
+			t.Run("single", func(t *testing.T) {
+				t.Parallel()
+				queuetest.TestSingleProducerConsumer(t, events, batchSize, factory)
+			})
+			t.Run("multi", func(t *testing.T) {
+				t.Parallel()
+				queuetest.TestMultiProducerConsumer(t, events, batchSize, factory)
+			})
+		})
+	}
+}
+
+// readEvents reads count events from the queue, acknowledging the batches,
+// and returns the "n" field of each event.
+func readEvents(t *testing.T, q queue.Queue, count int) []int {
+	t.Helper()
+	var values []int
+	for len(values) < count {
+		batch, err := q.Get(count - len(values))
+		require.NoError(t, err)
+		for i := 0; i < batch.Count(); i++ {
+			event, ok := batch.Entry(i).(publisher.Event)
+			require.True(t, ok)
+			// Events read from disk are decoded with the smallest integer
+			// type that fits, so the value is stored as a string.
+			n, err := event.Content.Fields.GetValue("n")
+			require.NoError(t, err)
+			value, err := strconv.Atoi(n.(string))
+			require.NoError(t, err)
+			values = append(values, value)
+		}
+		batch.Done()
+	}
+	return values
+}
+
+func makeEvent(n int) publisher.Event {
+	return queuetest.MakeEvent(mapstr.M{"n": strconv.Itoa(n)})
+}
+
+func TestSpilledEventsAreReadInOrder(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	observer := queue.NewQueueObserver(reg)
+	q, err := NewQueue(logptest.NewTestingLogger(t, ""), observer, testSettings(t, 4), 0, nil)
+	require.NoError(t, err)
+	defer q.Close()
+
+	acked := make(chan int, 100)
+	producer := q.Producer(queue.ProducerConfig{ACK: func(count int) { acked <- count }})
+
+	// The first events fill the memory tier, the rest are spilled to disk.
+	for i := 0; i < 10; i++ {
+		_, ok := producer.Publish(makeEvent(i))
+		require.True(t, ok)
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, readEvents(t, q, 10))
+
+	// Once the disk tier is drained new events are kept in memory again,
+	// as soon as the memory tier removed the acknowledged events.
+	require.Eventually(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.memoryUsed == 0
+	}, 5*time.Second, time.Millisecond)
+	_, ok := producer.Publish(makeEvent(10))
+	require.True(t, ok)
+	assert.Equal(t, []int{10}, readEvents(t, q, 1))
+
+	total := 0
+	for total < 11 {
+		select {
+		case n := <-acked:
+			total += n
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of 11 events were acknowledged", total)
+		}
+	}
+
+	tiers := reg.GetRegistry("queue").GetRegistry("tiers")
+	require.NotNil(t, tiers)
+	consumed := func(tier string) int64 {
+		snapshot := monitoring.CollectFlatSnapshot(tiers.GetRegistry(tier), monitoring.Full, false)
+		return snapshot.Ints["consumed.events"]
+	}
+	assert.Equal(t, int64(5), consumed("memory"))
+	assert.Equal(t, int64(6), consumed("disk"))
+}
+
+func TestEventsOnDiskAreReadFirstAfterRestart(t *testing.T) {
+	settings := testSettings(t, 4)
+	logger := logptest.NewTestingLogger(t, "")
+
+	q, err := NewQueue(logger, nil, settings, 0, nil)
+	require.NoError(t, err)
+	acked := make(chan int, 8)
+	producer := q.Producer(queue.ProducerConfig{ACK: func(count int) { acked <- count }})
+	for i := 0; i < 8; i++ {
+		_, ok := producer.Publish(makeEvent(i))
+		require.True(t, ok)
+	}
+	// Read the events in memory, the ones on disk are left for the next run.
+	assert.Equal(t, []int{0, 1, 2, 3}, readEvents(t, q, 4))
+	// Only close the queue once all events are written to disk.
+	for total := 0; total < 8; {
+		total += <-acked
+	}
+	require.NoError(t, q.Close())
+	<-q.Done()
+
+	q, err = NewQueue(logger, nil, settings, 0, nil)
+	require.NoError(t, err)
+	defer q.Close()
+	producer = q.Producer(queue.ProducerConfig{})
+	_, ok := producer.Publish(makeEvent(8))
+	require.True(t, ok)
+	assert.Equal(t, []int{4, 5, 6, 7, 8}, readEvents(t, q, 5))
+}
+
+// failingQueue wraps a tier whose producers fail to publish events. Each
+// publish waits for release to be closed, after signaling entered.
+type failingQueue struct {
+	queue.Queue
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (q *failingQueue) Producer(queue.ProducerConfig) queue.Producer {
+	return failingProducer{q}
+}
+
+type failingProducer struct {
+	queue *failingQueue
+}
+
+func (p failingProducer) Publish(queue.Entry) (queue.EntryID, bool) {
+	p.queue.entered <- struct{}{}
+	<-p.queue.release
+	return 0, false
+}
+
+func (p failingProducer) TryPublish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.Publish(entry)
+}
+
+func (p failingProducer) Close() {}
+
+func TestFailedDiskPublishDoesNotBlockConsumer(t *testing.T) {
+	q, err := NewQueue(logptest.NewTestingLogger(t, ""), nil, testSettings(t, 1), 0, nil)
+	require.NoError(t, err)
+	defer q.Close()
+	disk := &failingQueue{
+		Queue:   q.tiers[diskTier].queue,
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	q.tiers[diskTier].queue = disk
+	producer := q.Producer(queue.ProducerConfig{})
+
+	// The first event fills the memory tier, so the second one is spilled
+	// to the disk tier, which fails to write it.
+	_, ok := producer.Publish(makeEvent(0))
+	require.True(t, ok)
+	failed := make(chan bool)
+	go func() {
+		_, ok := producer.Publish(makeEvent(1))
+		failed <- !ok
+	}()
+	<-disk.entered
+
+	// The consumer must not wait for the event being written to disk.
+	assert.Equal(t, []int{0}, readEvents(t, q, 1))
+	read := make(chan []int)
+	go func() {
+		read <- readEvents(t, q, 1)
+	}()
+	// Give the consumer time to wait for events before the write fails.
+	time.Sleep(50 * time.Millisecond)
+	close(disk.release)
+	require.True(t, <-failed)
+
+	// New events are kept in memory again once the space of the first one
+	// is freed, and reach the waiting consumer.
+	require.Eventually(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.memoryUsed == 0
+	}, 5*time.Second, time.Millisecond)
+	_, ok = producer.Publish(makeEvent(2))
+	require.True(t, ok)
+	select {
+	case values := <-read:
+		assert.Equal(t, []int{2}, values)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the consumer is blocked on the disk tier")
+	}
+}
+
+func TestACKMergerReportsInPublishOrder(t *testing.T) {
+	var reported []int
+	m := &ackMerger{onACK: func(count int) { reported = append(reported, count) }}
+
+	for _, id := range []tierID{memoryTier, memoryTier, diskTier, diskTier, diskTier, memoryTier} {
+		m.add(id)
+	}
+
+	// The disk tier acknowledges its events first, but they can only be
+	// reported after the older events in memory.
+	m.ack(diskTier, 3)
+	assert.Empty(t, reported)
+	m.ack(memoryTier, 1)
+	assert.Equal(t, []int{1}, reported)
+	m.ack(memoryTier, 2)
+	assert.Equal(t, []int{1, 5}, reported)
+
+	// Events that fail to be published are not waited for.
+	m.add(diskTier)
+	m.cancel()
+	m.add(memoryTier)
+	m.ack(memoryTier, 1)
+	assert.Equal(t, []int{1, 5, 1}, reported)
+	assert.Empty(t, m.runs)
+}
+
+func TestSettingsForUserConfig(t *testing.T) {
+	cfg := config.MustNewConfigFrom(mapstr.M{
+		"mem.events":    4096,
+		"disk.max_size": "1GB",
+		"disk.path":     "/tmp/hybrid",
+	})
+	settings, err := SettingsForUserConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 4096, settings.Memory.Events)
+	assert.Equal(t, uint64(1000*1000*1000), settings.Disk.MaxBufferSize)
+	assert.Equal(t, "/tmp/hybrid", settings.Disk.Path)
+
+	_, err = SettingsForUserConfig(config.MustNewConfigFrom(mapstr.M{"mem.events": 4096}))
+	assert.Error(t, err, "the disk tier must be configured")
+}
@@ -62,13 +62,15 @@ func (l *ackLoop) handleBatchSig() int {
 	ackedBatches := l.collectAcked()
 
 	count := 0
+	counts := make([]int, len(l.broker.lanes))
 	for batch := ackedBatches.front(); batch != nil; batch = batch.next {
 		count += batch.count
+		counts[batch.lane.index] += batch.count
 	}
 
 	if count > 0 {
 		// report acks to waiting clients
-		l.processACK(ackedBatches, count)
+		l.processACK(ackedBatches, counts)
 	}
 
 	for !ackedBatches.empty() {
@@ -107,7 +109,27 @@ func (l *ackLoop) collectAcked() batchList {
 // Called by ackLoop. This function exists to decouple the work of collecting
 // and running producer callbacks from logical deletion of the events, so
 // input callbacks can't block the queue by occupying the runLoop goroutine.
-func (l *ackLoop) processACK(lst batchList, N int) {
+func (l *ackLoop) processACK(lst batchList, counts []int) {
+	var ackCallbacks []func()
+	if len(l.broker.lanes) > 1 {
+		ackCallbacks = l.laneACKCallbacks(lst)
+	} else {
+		ackCallbacks = l.ackCallbacks(lst)
+	}
+
+	// Signal runLoop to delete the events
+	l.broker.deleteChan <- counts
+
+	// The events have been removed; notify their listeners.
+	for _, f := range ackCallbacks {
+		f()
+	}
+}
+
+// ackCallbacks collects the producer callbacks for the acknowledged batches
+// of a queue with a single lane, where the events of a producer are always
+// acknowledged in the order they were published.
+func (l *ackLoop) ackCallbacks(lst batchList) []func() {
 	ackCallbacks := []func(){}
 	// First we traverse the entries we're about to remove, collecting any callbacks
 	// we need to run.
@@ -135,11 +157,53 @@ func (l *ackLoop) processACK(lst batchList, N int) {
 			entry.producer = nil
 		}
 	}
-	// Signal runLoop to delete the events
-	l.broker.deleteChan <- N
+	return ackCallbacks
+}
 
-	// The events have been removed; notify their listeners.
-	for _, f := range ackCallbacks {
-		f()
+// laneACKCallbacks collects the producer callbacks for the acknowledged
+// batches of a queue with priority lanes. A producer's events can be
+// acknowledged out of order if they were published to different lanes, so
+// the acknowledged events are held back until all events published before
+// them are acknowledged too.
+func (l *ackLoop) laneACKCallbacks(lst batchList) []func() {
+	var producers []*ackProducer
+	seen := map[*ackProducer]struct{}{}
+	for batch := lst.front(); batch != nil; batch = batch.next {
+		for i := 0; i < batch.count; i++ {
+			entry := batch.rawEntry(i)
+			if entry.producer == nil {
+				continue
+			}
+			state := &entry.producer.state
+			if state.acked == nil {
+				state.acked = map[producerID]struct{}{}
+			}
+			if _, ok := seen[entry.producer]; !ok {
+				seen[entry.producer] = struct{}{}
+				producers = append(producers, entry.producer)
+			}
+			state.acked[entry.producerID] = struct{}{}
+			entry.producer = nil
+		}
+	}
+
+	ackCallbacks := []func(){}
+	for _, producer := range producers {
+		state := &producer.state
+		count := 0
+		for {
+			next := state.lastACK + 1
+			if _, ok := state.acked[next]; !ok {
+				break
+			}
+			delete(state.acked, next)
+			state.lastACK = next
+			count++
+		}
+		if count > 0 {
+			cb := state.cb
+			ackCallbacks = append(ackCallbacks, func() { cb(count) })
+		}
 	}
+	return ackCallbacks
 }
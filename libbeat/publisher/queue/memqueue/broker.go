@@ -46,9 +46,13 @@ type broker struct {
 	ctx       context.Context
 	ctxCancel context.CancelFunc
 
-	// The ring buffer backing the queue. All buffer positions should be taken
-	// modulo the size of this array.
-	buf []queueEntry
+	// The priority lanes of the queue, ordered from the highest to the lowest
+	// priority. Each lane has its own ring buffer, the last one is the
+	// default lane.
+	lanes []*lane
+
+	// The index in lanes of each lane, by name.
+	laneIndex map[string]int
 
 	// wait group for queue workers (runLoop and ackLoop)
 	wg sync.WaitGroup
@@ -78,8 +82,8 @@ type broker struct {
 	// When batches are acknowledged, ackLoop saves any metadata needed
 	// for producer callbacks and such, then notifies runLoop that it's
 	// safe to free these events and advance the queue by sending the
-	// acknowledged event count to this channel.
-	deleteChan chan int
+	// acknowledged event count of each lane to this channel.
+	deleteChan chan []int
 
 	// closingChan is closed when the queue has processed a close request.
 	// It's used to prevent producers from blocking on a closing queue.
@@ -105,6 +109,12 @@ type Settings struct {
 	// If positive, the amount of time the queue will wait to fill up
 	// a batch if a Get request asks for more events than we have.
 	FlushTimeout time.Duration
+
+	// Priority lanes, from the highest to the lowest priority. Events are
+	// served from the highest priority lane that has events available. Events
+	// without a matching lane go to the default lane, which holds up to
+	// Events events and has the lowest priority.
+	Lanes []LaneSettings
 }
 
 type queueEntry struct {
@@ -119,10 +129,14 @@ type queueEntry struct {
 type batch struct {
 	queue *broker
 
+	// The lane the events of the batch are read from. A batch never spans
+	// multiple lanes.
+	lane *lane
+
 	// Next batch in the containing batchList
 	next *batch
 
-	// Position and length of the events within the queue buffer
+	// Position and length of the events within the lane buffer
 	start, count int
 
 	// batch.Done() sends to doneChan, where ackLoop reads it and handles
@@ -215,7 +229,8 @@ func newQueue(
 		settings: settings,
 		logger:   logger,
 
-		buf: make([]queueEntry, settings.Events),
+		lanes:     newLanes(settings, observer),
+		laneIndex: map[string]int{},
 
 		encoderFactory: encoderFactory,
 
@@ -226,15 +241,19 @@ func newQueue(
 
 		// internal runLoop and ackLoop channels
 		consumedChan: make(chan batchList),
-		deleteChan:   make(chan int),
+		deleteChan:   make(chan []int),
 		closingChan:  make(chan struct{}),
 	}
 	b.ctx, b.ctxCancel = context.WithCancel(context.Background())
 
+	for i, l := range b.lanes {
+		b.laneIndex[l.name] = i
+	}
+
 	b.runLoop = newRunLoop(b, observer)
 	b.ackLoop = newACKLoop(b)
 
-	observer.MaxEvents(settings.Events)
+	observer.MaxEvents(b.capacity())
 
 	return b
 }
@@ -254,8 +273,17 @@ func (b *broker) QueueType() string {
 
 func (b *broker) BufferConfig() queue.BufferConfig {
 	return queue.BufferConfig{
-		MaxEvents: len(b.buf),
+		MaxEvents: b.capacity(),
+	}
+}
+
+// capacity returns the number of events all lanes of the queue can hold.
+func (b *broker) capacity() int {
+	capacity := 0
+	for _, l := range b.lanes {
+		capacity += len(l.buf)
 	}
+	return capacity
 }
 
 func (b *broker) Producer(cfg queue.ProducerConfig) queue.Producer {
@@ -291,10 +319,11 @@ var batchPool = sync.Pool{
 	},
 }
 
-func newBatch(queue *broker, start, count int) *batch {
+func newBatch(queue *broker, lane *lane, start, count int) *batch {
 	batch := batchPool.Get().(*batch) //nolint:errcheck //safe to ignore type check
 	batch.next = nil
 	batch.queue = queue
+	batch.lane = lane
 	batch.start = start
 	batch.count = count
 	return batch
@@ -302,6 +331,7 @@ func newBatch(queue *broker, start, count int) *batch {
 
 func releaseBatch(b *batch) {
 	b.next = nil
+	b.lane = nil
 	batchPool.Put(b)
 }
 
@@ -391,8 +421,8 @@ func (b *batch) Count() int {
 
 // Return a pointer to the queueEntry for the i-th element of this batch
 func (b *batch) rawEntry(i int) *queueEntry {
-	// Indexes wrap around the end of the queue buffer
-	return &b.queue.buf[(b.start+i)%len(b.queue.buf)]
+	// Indexes wrap around the end of the lane buffer
+	return &b.lane.buf[(b.start+i)%len(b.lane.buf)]
 }
 
 // Return the event referenced by the i-th element of this batch
@@ -404,8 +434,7 @@ func (b *batch) FreeEntries() {
 	// This signals that the event data has been copied out of the batch, and is
 	// safe to free from the queue buffer, so set all the event pointers to nil.
 	for i := 0; i < b.count; i++ {
-		index := (b.start + i) % len(b.queue.buf)
-		b.queue.buf[index].event = nil
+		b.rawEntry(i).event = nil
 	}
 }
 
@@ -33,6 +33,15 @@ type config struct {
 	// since it used to control buffer size in the internal buffer chain.
 	MaxGetRequest int           `config:"flush.min_events" validate:"min=0"`
 	FlushTimeout  time.Duration `config:"flush.timeout"`
+
+	// Priority lanes, from the highest to the lowest priority. Events is the
+	// size of the default lane, which has the lowest priority.
+	Lanes []laneConfig `config:"lanes"`
+}
+
+type laneConfig struct {
+	Name   string `config:"name" validate:"required"`
+	Events int    `config:"events" validate:"min=1"`
 }
 
 var defaultConfig = config{
@@ -45,6 +54,13 @@ func (c *config) Validate() error {
 	if c.MaxGetRequest > c.Events {
 		return errors.New("flush.min_events must be less events")
 	}
+	names := map[string]bool{DefaultLane: true}
+	for _, lane := range c.Lanes {
+		if names[lane.Name] {
+			return fmt.Errorf("lane name '%v' is reserved or used more than once", lane.Name)
+		}
+		names[lane.Name] = true
+	}
 	return nil
 }
 
@@ -57,10 +73,15 @@ func SettingsForUserConfig(cfg *c.C) (Settings, error) {
 			return Settings{}, fmt.Errorf("couldn't unpack memory queue config: %w", err)
 		}
 	}
+	var lanes []LaneSettings
+	for _, lane := range config.Lanes {
+		lanes = append(lanes, LaneSettings{Name: lane.Name, Events: lane.Events})
+	}
 	//nolint:gosimple // Actually want this conversion to be explicit since the types aren't definitionally equal.
 	return Settings{
 		Events:        config.Events,
 		MaxGetRequest: config.MaxGetRequest,
 		FlushTimeout:  config.FlushTimeout,
+		Lanes:         lanes,
 	}, nil
 }
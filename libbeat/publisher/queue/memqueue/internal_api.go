@@ -28,6 +28,13 @@ type pushRequest struct {
 	// early encoding, 0 otherwise.
 	eventSize int
 
+	// The index of the lane the event is published to.
+	lane int
+
+	// Whether the request waits for space if the lane is full. If false the
+	// event is dropped instead.
+	canBlock bool
+
 	// The producer that generated this event, or nil if this producer does
 	// not require ack callbacks.
 	producer *ackProducer
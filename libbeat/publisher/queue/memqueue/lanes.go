@@ -0,0 +1,186 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package memqueue
+
+import (
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// DefaultLane is the name of the lane holding the events that have no
+// priority, or a priority no lane is configured for. It has the lowest
+// priority of all lanes.
+const DefaultLane = "default"
+
+// LaneSettings configures a priority lane of the queue.
+type LaneSettings struct {
+	// The priority of the events the lane holds, as set in the
+	// "@metadata.priority" field of the events.
+	Name string
+
+	// The number of events the lane can hold.
+	Events int
+}
+
+// lane is a ring buffer holding the events of one priority. Events are
+// served from the highest priority lane that has events available, while
+// the events within a lane are served in the order they were published.
+type lane struct {
+	name  string
+	index int
+
+	// The ring buffer backing the lane. All buffer positions should be taken
+	// modulo the size of this array.
+	buf []queueEntry
+
+	// runLoop state of the lane, see the fields of the same name in runLoop.
+	// Only the runLoop goroutine should read or write these fields.
+	bufPos        int
+	eventCount    int
+	consumedCount int
+
+	// Push requests that are waiting for the lane to have space, in the
+	// order they were received. Only the runLoop goroutine should read or
+	// write this list.
+	blocked []pushRequest
+
+	metrics *laneMetrics
+}
+
+// laneMetrics reports the occupancy of a lane under
+// "pipeline.queue.lanes.{name}". It is nil if the queue has a single lane.
+type laneMetrics struct {
+	maxEvents      *monitoring.Uint // gauge
+	filledEvents   *monitoring.Uint // gauge
+	filledPct      *monitoring.Float
+	blockedEvents  *monitoring.Uint // gauge
+	addedEvents    *monitoring.Uint
+	consumedEvents *monitoring.Uint
+	removedEvents  *monitoring.Uint
+}
+
+// newLanes creates the lanes of the queue, ordered from the highest to the
+// lowest priority. The default lane is always the last one.
+func newLanes(settings Settings, observer queue.Observer) []*lane {
+	lanes := make([]*lane, 0, len(settings.Lanes)+1)
+	for _, ls := range settings.Lanes {
+		lanes = append(lanes, &lane{name: ls.Name, buf: make([]queueEntry, ls.Events)})
+	}
+	lanes = append(lanes, &lane{name: DefaultLane, buf: make([]queueEntry, settings.Events)})
+
+	var reg *monitoring.Registry
+	if len(lanes) > 1 {
+		if metrics := queue.MetricsRegistry(observer); metrics != nil {
+			reg = metrics.GetRegistry("lanes")
+			if reg == nil {
+				reg = metrics.NewRegistry("lanes")
+			}
+		} else {
+			// Keep the metrics out of the default registry.
+			reg = monitoring.NewRegistry()
+		}
+	}
+
+	for i, l := range lanes {
+		l.index = i
+		if reg != nil {
+			l.metrics = newLaneMetrics(reg.NewRegistry(l.name), len(l.buf))
+		}
+	}
+	return lanes
+}
+
+func newLaneMetrics(reg *monitoring.Registry, size int) *laneMetrics {
+	m := &laneMetrics{
+		maxEvents:      monitoring.NewUint(reg, "max_events"),
+		filledEvents:   monitoring.NewUint(reg, "filled.events"),
+		filledPct:      monitoring.NewFloat(reg, "filled.pct"),
+		blockedEvents:  monitoring.NewUint(reg, "blocked.events"),
+		addedEvents:    monitoring.NewUint(reg, "added.events"),
+		consumedEvents: monitoring.NewUint(reg, "consumed.events"),
+		removedEvents:  monitoring.NewUint(reg, "removed.events"),
+	}
+	m.maxEvents.Set(uint64(size))
+	return m
+}
+
+// full returns true if the lane can't hold any more events.
+func (l *lane) full() bool {
+	return l.eventCount >= len(l.buf)
+}
+
+// available returns the number of events in the lane that weren't yet sent
+// to consumers.
+func (l *lane) available() int {
+	return l.eventCount - l.consumedCount
+}
+
+func (l *lane) updateFilled() {
+	if l.metrics == nil {
+		return
+	}
+	l.metrics.filledEvents.Set(uint64(l.eventCount))
+	l.metrics.filledPct.Set(float64(l.eventCount) / float64(len(l.buf)))
+	l.metrics.blockedEvents.Set(uint64(len(l.blocked)))
+}
+
+func (l *lane) reportAdded() {
+	if l.metrics != nil {
+		l.metrics.addedEvents.Inc()
+	}
+	l.updateFilled()
+}
+
+func (l *lane) reportConsumed(count int) {
+	if l.metrics != nil {
+		l.metrics.consumedEvents.Add(uint64(count))
+	}
+}
+
+func (l *lane) reportRemoved(count int) {
+	if l.metrics != nil {
+		l.metrics.removedEvents.Add(uint64(count))
+	}
+	l.updateFilled()
+}
+
+// defaultLane returns the lane of the events without a priority.
+func (b *broker) defaultLane() *lane {
+	return b.lanes[len(b.lanes)-1]
+}
+
+// laneFor returns the index of the lane the entry is published to. It must
+// be called before the entry is encoded, since the priority is read from
+// the event metadata.
+func (b *broker) laneFor(entry queue.Entry) int {
+	if len(b.lanes) == 1 {
+		return 0
+	}
+	var priority string
+	switch event := entry.(type) {
+	case publisher.Event:
+		priority = event.Content.Priority()
+	case *publisher.Event:
+		priority = event.Content.Priority()
+	}
+	if index, ok := b.laneIndex[priority]; ok {
+		return index
+	}
+	return len(b.lanes) - 1
+}
@@ -0,0 +1,201 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package memqueue
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func makeLaneQueue(t *testing.T, reg *monitoring.Registry, highEvents int) *broker {
+	t.Helper()
+	q := NewQueue(logp.NewNopLogger(), queue.NewQueueObserver(reg), Settings{
+		Events:        10,
+		MaxGetRequest: 10,
+		Lanes:         []LaneSettings{{Name: "high", Events: highEvents}},
+	}, 0, nil)
+	t.Cleanup(func() { _ = q.Close() })
+	return q
+}
+
+func laneEvent(priority string, n int) publisher.Event {
+	event := publisher.Event{Content: beat.Event{Fields: map[string]interface{}{"n": n}}}
+	if priority != "" {
+		event.Content.SetPriority(priority)
+	}
+	return event
+}
+
+func batchValues(t *testing.T, b queue.Batch) []int {
+	t.Helper()
+	var values []int
+	for i := 0; i < b.Count(); i++ {
+		event, ok := b.Entry(i).(publisher.Event)
+		require.True(t, ok)
+		values = append(values, event.Content.Fields["n"].(int))
+	}
+	return values
+}
+
+func TestLanesServeHigherPriorityFirst(t *testing.T) {
+	q := makeLaneQueue(t, nil, 10)
+	producer := q.Producer(queue.ProducerConfig{})
+
+	// Events with an unknown priority go to the default lane.
+	for i, priority := range []string{"", "low", "high", "", "high", "high"} {
+		_, ok := producer.Publish(laneEvent(priority, i))
+		require.True(t, ok)
+	}
+
+	b, err := q.Get(10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 4, 5}, batchValues(t, b), "high priority events should be served first, in order")
+	b.Done()
+
+	b, err = q.Get(10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 3}, batchValues(t, b), "default lane events should be served in order")
+	b.Done()
+}
+
+func TestLanesFullLaneDoesNotBlockOtherLanes(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	q := makeLaneQueue(t, reg, 2)
+	producer := q.Producer(queue.ProducerConfig{})
+
+	for i := 0; i < 2; i++ {
+		_, ok := producer.Publish(laneEvent("high", i))
+		require.True(t, ok)
+	}
+	_, ok := producer.TryPublish(laneEvent("high", 2))
+	assert.False(t, ok, "TryPublish should drop events for a full lane")
+
+	published := make(chan bool)
+	go func() {
+		blocked := q.Producer(queue.ProducerConfig{})
+		_, ok := blocked.Publish(laneEvent("high", 3))
+		published <- ok
+	}()
+
+	// The default lane still accepts events while a publish waits for the
+	// high priority lane.
+	_, ok = producer.Publish(laneEvent("", 4))
+	require.True(t, ok)
+	require.Eventually(t, func() bool {
+		return monitoring.CollectFlatSnapshot(reg, monitoring.Full, false).Ints["queue.lanes.high.blocked.events"] == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, int64(2), snapshot.Ints["queue.lanes.high.filled.events"])
+	assert.Equal(t, int64(2), snapshot.Ints["queue.lanes.high.max_events"])
+	assert.Equal(t, 1.0, snapshot.Floats["queue.lanes.high.filled.pct"])
+	assert.Equal(t, int64(1), snapshot.Ints["queue.lanes.default.filled.events"])
+	assert.Equal(t, int64(12), snapshot.Ints["queue.max_events"])
+
+	b, err := q.Get(10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, batchValues(t, b))
+	b.Done()
+
+	select {
+	case ok := <-published:
+		assert.True(t, ok, "blocked publish should succeed once the lane has space")
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "publish should be unblocked once the lane has space")
+	}
+
+	b, err = q.Get(10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3}, batchValues(t, b))
+	b.Done()
+}
+
+func TestLanesACKInPublishOrder(t *testing.T) {
+	q := makeLaneQueue(t, nil, 10)
+
+	var mu sync.Mutex
+	var acks []int
+	producer := q.Producer(queue.ProducerConfig{
+		ACK: func(count int) {
+			mu.Lock()
+			defer mu.Unlock()
+			acks = append(acks, count)
+		},
+	})
+	for i, priority := range []string{"", "high", "high"} {
+		_, ok := producer.Publish(laneEvent(priority, i))
+		require.True(t, ok)
+	}
+
+	high, err := q.Get(10)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, batchValues(t, high))
+	low, err := q.Get(10)
+	require.NoError(t, err)
+	require.Equal(t, []int{0}, batchValues(t, low))
+
+	// The high priority events are acknowledged first, but the producer is
+	// only notified once the event published before them is acknowledged.
+	high.Done()
+	low.Done()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(acks) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int{3}, acks)
+}
+
+func TestLanesConfig(t *testing.T) {
+	cfg := conf.MustNewConfigFrom(map[string]interface{}{
+		"events":           64,
+		"flush.min_events": 32,
+		"lanes": []map[string]interface{}{
+			{"name": "critical", "events": 16},
+			{"name": "high", "events": 32},
+		},
+	})
+	settings, err := SettingsForUserConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []LaneSettings{{Name: "critical", Events: 16}, {Name: "high", Events: 32}}, settings.Lanes)
+
+	for name, lanes := range map[string][]map[string]interface{}{
+		"duplicate": {{"name": "high", "events": 16}, {"name": "high", "events": 16}},
+		"reserved":  {{"name": DefaultLane, "events": 16}},
+		"no name":   {{"events": 16}},
+		"empty":     {{"name": "high", "events": 0}},
+	} {
+		cfg := conf.MustNewConfigFrom(map[string]interface{}{"lanes": lanes})
+		_, err := SettingsForUserConfig(cfg)
+		assert.Error(t, err, name)
+	}
+}
@@ -51,6 +51,10 @@ type producerID uint64
 type produceState struct {
 	cb      ackHandler
 	lastACK producerID
+
+	// The events after lastACK that are already acknowledged, if the queue
+	// has priority lanes. Only accessed by the ackLoop goroutine.
+	acked map[producerID]struct{}
 }
 
 type ackHandler func(count int)
@@ -76,6 +80,7 @@ func (p *forgetfulProducer) makePushRequest(event queue.Entry) pushRequest {
 	resp := make(chan queue.EntryID, 1)
 	return pushRequest{
 		event: event,
+		lane:  p.broker.laneFor(event),
 		resp:  resp}
 }
 
@@ -95,6 +100,7 @@ func (p *ackProducer) makePushRequest(event queue.Entry) pushRequest {
 	resp := make(chan queue.EntryID, 1)
 	return pushRequest{
 		event:    event,
+		lane:     p.broker.laneFor(event),
 		producer: p,
 		// We add 1 to the id so the default lastACK of 0 is a
 		// valid initial state and 1 is the first real id.
@@ -127,6 +133,7 @@ func (st *openState) Close() {
 }
 
 func (st *openState) publish(req pushRequest) (queue.EntryID, bool) {
+	req.canBlock = true
 	// If we were given an encoder callback for incoming events, apply it before
 	// sending the entry to the queue.
 	if st.encoder != nil {
@@ -139,8 +146,10 @@ func (st *openState) publish(req pushRequest) (queue.EntryID, bool) {
 		// forever during shutdown, we also have to wait on the queue's
 		// shutdown channel.
 		select {
-		case resp := <-req.resp:
-			return resp, true
+		case resp, ok := <-req.resp:
+			// The response channel is closed if the event was dropped because
+			// its lane is full.
+			return resp, ok
 		case <-st.queueClosing:
 			st.events = nil
 			return 0, false
@@ -167,8 +176,10 @@ func (st *openState) tryPublish(req pushRequest) (queue.EntryID, bool) {
 		// forever during shutdown, we also have to wait on the queue's
 		// shutdown channel.
 		select {
-		case resp := <-req.resp:
-			return resp, true
+		case resp, ok := <-req.resp:
+			// The response channel is closed if the event was dropped because
+			// its lane is full.
+			return resp, ok
 		case <-st.queueClosing:
 			st.events = nil
 			return 0, false
@@ -290,15 +290,15 @@ func TestBatchFreeEntries(t *testing.T) {
 	// reads, since if we do it before we have no way to be sure the insert
 	// has been completed.
 	for i := 0; i < queueSize; i++ {
-		require.NotNil(t, testQueue.buf[i].event, "All queue events must be non-nil")
+		require.NotNil(t, testQueue.defaultLane().buf[i].event, "All queue events must be non-nil")
 	}
 	batch2.FreeEntries()
 	for i := 0; i < batchSize; i++ {
-		require.NotNilf(t, testQueue.buf[i].event, "Queue index %v: batch 1's events should be unaffected by calling FreeEntries on Batch 2", i)
-		require.Nilf(t, testQueue.buf[batchSize+i].event, "Queue index %v: batch 2's events should be nil after FreeEntries", batchSize+i)
+		require.NotNilf(t, testQueue.defaultLane().buf[i].event, "Queue index %v: batch 1's events should be unaffected by calling FreeEntries on Batch 2", i)
+		require.Nilf(t, testQueue.defaultLane().buf[batchSize+i].event, "Queue index %v: batch 2's events should be nil after FreeEntries", batchSize+i)
 	}
 	batch1.FreeEntries()
 	for i := 0; i < queueSize; i++ {
-		require.Nilf(t, testQueue.buf[i].event, "Queue index %v: all events should be nil after calling FreeEntries on both batches")
+		require.Nilf(t, testQueue.defaultLane().buf[i].event, "Queue index %v: all events should be nil after calling FreeEntries on both batches")
 	}
 }
@@ -32,19 +32,19 @@ type runLoop struct {
 	// observer is a metrics observer used to report internal queue state.
 	observer queue.Observer
 
-	// The index of the beginning of the current ring buffer within its backing
-	// array. If the queue isn't empty, bufPos points to the oldest remaining
-	// event.
-	bufPos int
-
-	// The total number of events in the queue.
+	// The total number of events in all lanes of the queue. Each lane tracks
+	// its own count, as well as the index of the beginning of its ring buffer:
+	// if the lane isn't empty, bufPos points to its oldest remaining event.
 	eventCount int
 
-	// The number of consumed events waiting for acknowledgment. The next Get
-	// request will return events starting at position
-	// (bufPos + consumedCount) % len(buf).
+	// The total number of consumed events waiting for acknowledgment. The
+	// next Get request for a lane will return events starting at position
+	// (bufPos + consumedCount) % len(buf) of the lane.
 	consumedCount int
 
+	// The number of events all lanes can hold.
+	capacity int
+
 	// The list of batches that have been consumed and are waiting to be sent
 	// to ackLoop for acknowledgment handling. (This list doesn't contain all
 	// outstanding batches, only the ones not yet forwarded to ackLoop.)
@@ -86,6 +86,7 @@ func newRunLoop(broker *broker, observer queue.Observer) *runLoop {
 		broker:   broker,
 		observer: observer,
 		getTimer: timer,
+		capacity: broker.capacity(),
 	}
 }
 
@@ -99,8 +100,9 @@ func (l *runLoop) run() {
 // standalone helper function to allow testing of loop invariants.
 func (l *runLoop) runIteration() {
 	var pushChan chan pushRequest
-	// Push requests are enabled if the queue isn't full or closing.
-	if l.eventCount < len(l.broker.buf) && !l.closing {
+	// Push requests are enabled if the queue isn't full or closing. Requests
+	// for a lane that is full wait in the lane until it has space.
+	if l.eventCount < l.capacity && !l.closing {
 		pushChan = l.broker.pushChan
 	}
 
@@ -146,8 +148,8 @@ func (l *runLoop) runIteration() {
 		// clear the pending list.
 		l.consumedBatches = batchList{}
 
-	case count := <-l.broker.deleteChan:
-		l.handleDelete(count)
+	case counts := <-l.broker.deleteChan:
+		l.handleDelete(counts)
 
 	case <-timeoutChan:
 		// The get timer has expired, handle the blocked request
@@ -185,16 +187,25 @@ func (l *runLoop) getRequestShouldBlock(req *getRequest) bool {
 	return eventsAvailable < req.entryCount
 }
 
-// Respond to the given get request without blocking or waiting for more events
+// Respond to the given get request without blocking or waiting for more
+// events. The batch is read from the highest priority lane with events
+// available.
 func (l *runLoop) handleGetReply(req *getRequest) {
-	eventsAvailable := l.eventCount - l.consumedCount
+	lane := l.broker.defaultLane()
+	for _, candidate := range l.broker.lanes {
+		if candidate.available() > 0 {
+			lane = candidate
+			break
+		}
+	}
+
 	batchSize := req.entryCount
-	if eventsAvailable < batchSize {
+	if eventsAvailable := lane.available(); eventsAvailable < batchSize {
 		batchSize = eventsAvailable
 	}
 
-	startIndex := l.bufPos + l.consumedCount
-	batch := newBatch(l.broker, startIndex, batchSize)
+	startIndex := lane.bufPos + lane.consumedCount
+	batch := newBatch(l.broker, lane, startIndex, batchSize)
 
 	batchBytes := 0
 	for i := 0; i < batchSize; i++ {
@@ -205,30 +216,68 @@ func (l *runLoop) handleGetReply(req *getRequest) {
 	req.responseChan <- batch
 	l.consumedBatches.append(batch)
 	l.consumedCount += batchSize
+	lane.consumedCount += batchSize
+	lane.reportConsumed(batchSize)
 	l.observer.ConsumeEvents(batchSize, batchBytes)
 }
 
-func (l *runLoop) handleDelete(count int) {
-	byteCount := 0
-	for i := 0; i < count; i++ {
-		entry := l.broker.buf[(l.bufPos+i)%len(l.broker.buf)]
-		byteCount += entry.eventSize
+// handleDelete removes the given number of acknowledged events from the
+// front of each lane.
+func (l *runLoop) handleDelete(counts []int) {
+	for i, count := range counts {
+		if count == 0 {
+			continue
+		}
+		lane := l.broker.lanes[i]
+		byteCount := 0
+		for j := 0; j < count; j++ {
+			entry := lane.buf[(lane.bufPos+j)%len(lane.buf)]
+			byteCount += entry.eventSize
+		}
+		// Advance position and counters. Event data was already cleared in
+		// batch.FreeEntries when the events were vended.
+		lane.bufPos = (lane.bufPos + count) % len(lane.buf)
+		lane.eventCount -= count
+		lane.consumedCount -= count
+		l.eventCount -= count
+		l.consumedCount -= count
+		lane.reportRemoved(count)
+		l.observer.RemoveEvents(count, byteCount)
+
+		// Push requests that were waiting for the lane can proceed now.
+		for len(lane.blocked) > 0 && !lane.full() && !l.closing {
+			req := lane.blocked[0]
+			lane.blocked[0] = pushRequest{}
+			lane.blocked = lane.blocked[1:]
+			l.handleInsert(&req)
+		}
 	}
-	// Advance position and counters. Event data was already cleared in
-	// batch.FreeEntries when the events were vended.
-	l.bufPos = (l.bufPos + count) % len(l.broker.buf)
-	l.eventCount -= count
-	l.consumedCount -= count
-	l.observer.RemoveEvents(count, byteCount)
 }
 
 func (l *runLoop) handleInsert(req *pushRequest) {
+	lane := l.broker.lanes[req.lane]
+	if lane.full() {
+		if req.canBlock {
+			// Wait for the lane to have space. Requests for other lanes are
+			// still accepted in the meantime.
+			lane.blocked = append(lane.blocked, *req)
+			lane.updateFilled()
+		} else {
+			// Closing the response channel tells the producer that the event
+			// was dropped.
+			close(req.resp)
+		}
+		return
+	}
+
 	l.insert(req, l.nextEntryID)
 	// Send back the new event id.
 	req.resp <- l.nextEntryID
 
 	l.nextEntryID++
 	l.eventCount++
+	lane.eventCount++
+	lane.reportAdded()
 
 	// See if this gave us enough for a new batch
 	l.maybeUnblockGetRequest()
@@ -250,8 +299,9 @@ func (l *runLoop) maybeUnblockGetRequest() {
 }
 
 func (l *runLoop) insert(req *pushRequest, id queue.EntryID) {
-	index := (l.bufPos + l.eventCount) % len(l.broker.buf)
-	l.broker.buf[index] = queueEntry{
+	lane := l.broker.lanes[req.lane]
+	index := (lane.bufPos + lane.eventCount) % len(lane.buf)
+	lane.buf[index] = queueEntry{
 		event:      req.event,
 		eventSize:  req.eventSize,
 		id:         id,
@@ -169,7 +169,7 @@ func TestObserverAddEvent(t *testing.T) {
 	rl := &runLoop{
 		observer: queue.NewQueueObserver(reg),
 		broker: &broker{
-			buf: make([]queueEntry, 100),
+			lanes: []*lane{{name: DefaultLane, buf: make([]queueEntry, 100)}},
 		},
 	}
 	request := &pushRequest{
@@ -188,16 +188,17 @@ func TestObserverConsumeEvents(t *testing.T) {
 	rl := &runLoop{
 		observer: queue.NewQueueObserver(reg),
 		broker: &broker{
-			buf: make([]queueEntry, 100),
+			lanes: []*lane{{name: DefaultLane, buf: make([]queueEntry, 100), eventCount: 50}},
 		},
 		eventCount: 50,
 	}
 	// Initialize the queue entries to a test byte size
-	for i := range rl.broker.buf {
-		rl.broker.buf[i].eventSize = 123
+	buf := rl.broker.defaultLane().buf
+	for i := range buf {
+		buf[i].eventSize = 123
 	}
 	request := &getRequest{
-		entryCount:   len(rl.broker.buf),
+		entryCount:   len(buf),
 		responseChan: make(chan *batch, 1),
 	}
 	rl.handleGetReply(request)
@@ -213,17 +214,18 @@ func TestObserverRemoveEvents(t *testing.T) {
 		observer: queue.NewQueueObserver(reg),
 		broker: &broker{
 			ctx:        context.Background(),
-			buf:        make([]queueEntry, 100),
-			deleteChan: make(chan int, 1),
+			lanes:      []*lane{{name: DefaultLane, buf: make([]queueEntry, 100), eventCount: 50}},
+			deleteChan: make(chan []int, 1),
 		},
 		eventCount: 50,
 	}
 	// Initialize the queue entries to a test byte size
-	for i := range rl.broker.buf {
-		rl.broker.buf[i].eventSize = 123
+	buf := rl.broker.defaultLane().buf
+	for i := range buf {
+		buf[i].eventSize = 123
 	}
 	const deleteCount = 25
-	rl.broker.deleteChan <- deleteCount
+	rl.broker.deleteChan <- []int{deleteCount}
 	// Run one iteration of the run loop, so it can handle the delete request
 	rl.runIteration()
 	// It should have deleted 25 events, so we expect the size to be 25 * 123.
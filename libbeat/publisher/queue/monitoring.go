@@ -39,6 +39,8 @@ type Observer interface {
 }
 
 type queueObserver struct {
+	metrics *monitoring.Registry
+
 	maxEvents *monitoring.Uint // gauge
 	maxBytes  *monitoring.Uint // gauge
 
@@ -79,6 +81,8 @@ func NewQueueObserver(metrics *monitoring.Registry) Observer {
 	}
 
 	ob := &queueObserver{
+		metrics: queueMetrics,
+
 		maxEvents: monitoring.NewUint(queueMetrics, "max_events"), // gauge
 		maxBytes:  monitoring.NewUint(queueMetrics, "max_bytes"),  // gauge
 
@@ -99,6 +103,16 @@ func NewQueueObserver(metrics *monitoring.Registry) Observer {
 	return ob
 }
 
+// MetricsRegistry returns the registry an observer created by
+// NewQueueObserver reports to, so queues can add their own metrics next to
+// the common ones. It returns nil for other observers.
+func MetricsRegistry(observer Observer) *monitoring.Registry {
+	if ob, ok := observer.(*queueObserver); ok {
+		return ob.metrics
+	}
+	return nil
+}
+
 func (ob *queueObserver) MaxEvents(value int) {
 	ob.maxEvents.Set(uint64(value))
 }
@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package syslog
+
+import (
+	"strconv"
+	"strings"
+)
+
+var (
+	// facilityKeywords are the facility names of syslog.h, as used by most
+	// syslog implementations.
+	facilityKeywords = map[string]int{
+		"kern":     0,
+		"user":     1,
+		"mail":     2,
+		"daemon":   3,
+		"auth":     4,
+		"syslog":   5,
+		"lpr":      6,
+		"news":     7,
+		"uucp":     8,
+		"cron":     9,
+		"authpriv": 10,
+		"ftp":      11,
+		"ntp":      12,
+		"security": 13,
+		"console":  14,
+		"local0":   16,
+		"local1":   17,
+		"local2":   18,
+		"local3":   19,
+		"local4":   20,
+		"local5":   21,
+		"local6":   22,
+		"local7":   23,
+	}
+
+	// severityKeywords are the severity names of syslog.h, along with their
+	// common aliases.
+	severityKeywords = map[string]int{
+		"emerg":    0,
+		"panic":    0,
+		"alert":    1,
+		"crit":     2,
+		"critical": 2,
+		"err":      3,
+		"error":    3,
+		"warning":  4,
+		"warn":     4,
+		"notice":   5,
+		"info":     6,
+		"debug":    7,
+	}
+)
+
+// FacilityCode returns the facility code of v, which is either a code, a
+// syslog.h keyword like "local0", or a facility name as parsed into the
+// log.syslog.facility.name field. Names are case-insensitive.
+func FacilityCode(v string) (int, bool) {
+	return lookupCode(v, facilityKeywords, facilityLabels)
+}
+
+// SeverityCode returns the severity code of v, which is either a code, a
+// syslog.h keyword like "err", or a severity name as parsed into the
+// log.syslog.severity.name field. Names are case-insensitive.
+func SeverityCode(v string) (int, bool) {
+	return lookupCode(v, severityKeywords, severityLabels)
+}
+
+// Priority returns the priority value of a message from its facility and
+// severity codes.
+func Priority(facility, severity int) int {
+	return facility<<facilityShift | severity&severityMask
+}
+
+func lookupCode(v string, keywords map[string]int, labels []string) (int, bool) {
+	v = strings.TrimSpace(v)
+	if code, err := strconv.Atoi(v); err == nil {
+		return code, code >= 0 && code < len(labels)
+	}
+
+	v = strings.ToLower(v)
+	if code, ok := keywords[v]; ok {
+		return code, true
+	}
+	for code, label := range labels {
+		if strings.ToLower(label) == v {
+			return code, true
+		}
+	}
+	return 0, false
+}
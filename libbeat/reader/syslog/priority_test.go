@@ -0,0 +1,83 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package syslog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFacilityCode(t *testing.T) {
+	cases := map[string]struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		"code":          {in: "16", want: 16, ok: true},
+		"keyword":       {in: "local3", want: 19, ok: true},
+		"keyword_upper": {in: "AUTHPRIV", want: 10, ok: true},
+		"label":         {in: "user-level", want: 1, ok: true},
+		"label_dup":     {in: "security/authorization", want: 4, ok: true},
+		"out_of_range":  {in: "24", ok: false},
+		"negative":      {in: "-1", ok: false},
+		"unknown":       {in: "local8", ok: false},
+		"empty":         {in: "", ok: false},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, ok := FacilityCode(tc.in)
+			assert.Equal(t, tc.ok, ok)
+			if tc.ok {
+				assert.Equal(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSeverityCode(t *testing.T) {
+	cases := map[string]struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		"code":         {in: "3", want: 3, ok: true},
+		"keyword":      {in: "err", want: 3, ok: true},
+		"alias":        {in: "warn", want: 4, ok: true},
+		"label":        {in: "Informational", want: 6, ok: true},
+		"out_of_range": {in: "8", ok: false},
+		"unknown":      {in: "fatal", ok: false},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, ok := SeverityCode(tc.in)
+			assert.Equal(t, tc.ok, ok)
+			if tc.ok {
+				assert.Equal(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPriority(t *testing.T) {
+	assert.Equal(t, 0, Priority(0, 0))
+	assert.Equal(t, 13, Priority(1, 5))
+	assert.Equal(t, 191, Priority(23, 7))
+}
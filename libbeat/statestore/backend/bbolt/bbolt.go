@@ -0,0 +1,123 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bbolt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// Registry configures access to bbolt based stores.
+type Registry struct {
+	log *logp.Logger
+
+	mu     sync.Mutex
+	active bool
+
+	settings Settings
+}
+
+// Settings configures a new Registry.
+type Settings struct {
+	// Registry root directory. Stores will be single files in this directory.
+	Root string
+
+	// FileMode is used to configure the file mode for new files generated by the
+	// registry.  File mode 0600 will be used if this field is not set.
+	FileMode os.FileMode
+
+	// Timeout is how long to wait for the lock on a store file that is held
+	// by another process. Defaults to 1s if not set.
+	Timeout time.Duration
+
+	// If set, updates are not synced to disk. This speeds up updates, but
+	// recent updates might be lost if the machine crashes.
+	NoSync bool
+}
+
+const defaultFileMode os.FileMode = 0600
+
+const defaultTimeout = time.Second
+
+// New configures a bbolt Registry that can be used to open stores.
+func New(log *logp.Logger, settings Settings) (*Registry, error) {
+	if settings.FileMode == 0 {
+		settings.FileMode = defaultFileMode
+	}
+	if settings.Timeout == 0 {
+		settings.Timeout = defaultTimeout
+	}
+
+	root, err := filepath.Abs(settings.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	settings.Root = root
+	return &Registry{
+		log:      log,
+		active:   true,
+		settings: settings,
+	}, nil
+}
+
+// Access creates or opens a store. The memlog store of the same name is
+// migrated into the store, unless this already happened when the store was
+// opened before.
+// Returns an error if any file access fails.
+func (r *Registry) Access(name string) (backend.Store, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.active {
+		return nil, errRegClosed
+	}
+
+	logger := r.log.With("store", name)
+
+	if err := os.MkdirAll(r.settings.Root, os.ModeDir|0770); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(r.settings.Root, name+".db")
+	store, err := openStore(logger, path, r.settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateMemlogStore(logger, store, r.settings.Root, name); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to migrate memlog store '%v': %w", name, err)
+	}
+
+	return store, nil
+}
+
+// Close closes the registry. No new store can be accessed after close.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	r.active = false
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,162 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bbolt
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+	"github.com/elastic/beats/v7/libbeat/statestore/internal/storecompliance"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestCompliance_Default(t *testing.T) {
+	storecompliance.TestBackendCompliance(t, func(testPath string) (backend.Registry, error) {
+		logger := logptest.NewTestingLogger(t, "")
+		return New(logger.Named("test"), Settings{Root: testPath})
+	})
+}
+
+func TestCompliance_NoSync(t *testing.T) {
+	storecompliance.TestBackendCompliance(t, func(testPath string) (backend.Registry, error) {
+		logger := logptest.NewTestingLogger(t, "")
+		return New(logger.Named("test"), Settings{Root: testPath, NoSync: true})
+	})
+}
+
+type testState struct {
+	Offset int64  `struct:"offset"`
+	Source string `struct:"source"`
+}
+
+func TestMigrateMemlogStore(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	root := t.TempDir()
+
+	memReg, err := memlog.New(logger, memlog.Settings{Root: root})
+	require.NoError(t, err)
+	memStore, err := memReg.Access("test")
+	require.NoError(t, err)
+	require.NoError(t, memStore.Set("a", testState{Offset: 10, Source: "/var/log/a.log"}))
+	require.NoError(t, memStore.Set("b", testState{Offset: 20, Source: "/var/log/b.log"}))
+	require.NoError(t, memStore.Set("c", testState{Offset: 30, Source: "/var/log/c.log"}))
+	require.NoError(t, memStore.Remove("c"))
+	require.NoError(t, memStore.Close())
+	require.NoError(t, memReg.Close())
+
+	reg, err := New(logger, Settings{Root: root})
+	require.NoError(t, err)
+	store, err := reg.Access("test")
+	require.NoError(t, err)
+
+	var st testState
+	require.NoError(t, store.Get("a", &st))
+	assert.Equal(t, testState{Offset: 10, Source: "/var/log/a.log"}, st)
+	require.NoError(t, store.Get("b", &st))
+	assert.Equal(t, testState{Offset: 20, Source: "/var/log/b.log"}, st)
+	has, err := store.Has("c")
+	require.NoError(t, err)
+	assert.False(t, has, "removed keys should not be migrated")
+
+	// Keys updated after the migration must not be overwritten by the
+	// memlog store when the store is opened again.
+	require.NoError(t, store.Set("a", testState{Offset: 11, Source: "/var/log/a.log"}))
+	require.NoError(t, store.Close())
+
+	store, err = reg.Access("test")
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.Get("a", &st))
+	assert.Equal(t, int64(11), st.Offset)
+	require.NoError(t, reg.Close())
+}
+
+func TestMigrateMemlogStoreAfterCrash(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	root := t.TempDir()
+
+	memReg, err := memlog.New(logger, memlog.Settings{Root: root})
+	require.NoError(t, err)
+	memStore, err := memReg.Access("test")
+	require.NoError(t, err)
+	require.NoError(t, memStore.Set("a", testState{Offset: 10, Source: "/var/log/a.log"}))
+	require.NoError(t, memStore.Close())
+	require.NoError(t, memReg.Close())
+
+	// Simulate a crash after the store file was created, but before the
+	// memlog store was migrated.
+	s, err := openStore(logger, filepath.Join(root, "test.db"), Settings{FileMode: defaultFileMode, Timeout: defaultTimeout})
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	reg, err := New(logger, Settings{Root: root})
+	require.NoError(t, err)
+	defer reg.Close()
+	store, err := reg.Access("test")
+	require.NoError(t, err)
+	defer store.Close()
+
+	var st testState
+	require.NoError(t, store.Get("a", &st))
+	assert.Equal(t, testState{Offset: 10, Source: "/var/log/a.log"}, st)
+}
+
+func TestStoreFile(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	root := t.TempDir()
+
+	reg, err := New(logger, Settings{Root: root, FileMode: 0640})
+	require.NoError(t, err)
+	defer reg.Close()
+
+	store, err := reg.Access("test")
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	path := filepath.Join(root, "test.db")
+	require.FileExists(t, path)
+	assert.NoDirExists(t, filepath.Join(root, "test"), "no memlog store should be created")
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+	}
+
+	store, err = reg.Access("test")
+	require.NoError(t, err)
+	defer store.Close()
+	_, err = reg.Access("test")
+	assert.Error(t, err, "a store file can't be opened twice")
+}
+
+func TestAccessClosedRegistry(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	reg, err := New(logger, Settings{Root: t.TempDir()})
+	require.NoError(t, err)
+	require.NoError(t, reg.Close())
+
+	_, err = reg.Access("test")
+	assert.ErrorIs(t, err, errRegClosed)
+}
@@ -0,0 +1,40 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package bbolt implements a statestore backend that keeps the key-value pairs
+// of each store in a bbolt database file on disk.
+//
+// Unlike memlog, the store doesn't hold the key-value pairs in memory and
+// doesn't rewrite all of them on checkpoints: bbolt indexes the keys in a
+// B+tree and only the pages of the updated keys are written. This keeps
+// memory usage and update costs low for stores with many keys, like the
+// registry of a filestream input harvesting lots of files.
+//
+// Each store is a single file named `<name>.db` in the registry root
+// directory. The values are stored as JSON documents in the "states" bucket.
+// The "meta" bucket holds the version of the store format and whether the
+// memlog store was migrated.
+//
+// Each update is a bbolt transaction, which is synced to disk when it is
+// committed. Settings.NoSync disables the sync, trading durability on machine
+// crashes for update throughput.
+//
+// If a memlog store of the same name exists in the registry root directory
+// when a store is opened, its key-value pairs are copied into the store in
+// the same transaction that marks the store as migrated. The memlog files are
+// left untouched, but are not read again once the migration has succeeded.
+package bbolt
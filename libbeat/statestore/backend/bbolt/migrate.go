@@ -0,0 +1,107 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bbolt
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// memlogStoreExists checks if there is a memlog store with the given name in
+// the registry root directory.
+func memlogStoreExists(root, name string) bool {
+	fi, err := os.Stat(filepath.Join(root, name, "meta.json"))
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// migrateMemlogStore copies all key-value pairs of the memlog store with the
+// given name into the store, in a single transaction.
+// migrateMemlogStore copies the keys of the memlog store of the given name
+// into s. The keys are copied in the same transaction that marks the store
+// as migrated, so an interrupted migration is retried the next time the
+// store is opened, and a migrated store is never overwritten by the memlog
+// store again.
+func migrateMemlogStore(log *logp.Logger, s *store, root, name string) error {
+	var migrated bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		migrated = tx.Bucket(metaBucket).Get(migratedKey) != nil
+		return nil
+	})
+	if err != nil || migrated {
+		return err
+	}
+
+	if !memlogStoreExists(root, name) {
+		return s.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(metaBucket).Put(migratedKey, []byte("true"))
+		})
+	}
+
+	log.Infof("Migrating memlog store '%v' in %v", name, root)
+
+	reg, err := memlog.New(log.Named("memlog"), memlog.Settings{
+		Root: root,
+		// The memlog store is only read, never write a checkpoint.
+		Checkpoint: func(uint64) bool { return false },
+	})
+	if err != nil {
+		return err
+	}
+	defer reg.Close()
+
+	src, err := reg.Access(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	count := 0
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(statesBucket)
+		err := src.Each(func(key string, dec backend.ValueDecoder) (bool, error) {
+			var v map[string]interface{}
+			if err := dec.Decode(&v); err != nil {
+				return false, err
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				return false, err
+			}
+			count++
+			return true, bucket.Put([]byte(key), data)
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(metaBucket).Put(migratedKey, []byte("true"))
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Migrated %d keys from memlog store '%v'. The memlog store directory %v is no longer used and can be removed.",
+		count, name, filepath.Join(root, name))
+	return nil
+}
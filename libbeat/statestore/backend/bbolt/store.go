@@ -0,0 +1,192 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package bbolt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/elastic/beats/v7/libbeat/common/transform/typeconv"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const storeVersion = "1"
+
+var (
+	metaBucket   = []byte("meta")
+	statesBucket = []byte("states")
+
+	versionKey = []byte("version")
+
+	// migratedKey is set in the meta bucket once the memlog store of the
+	// same name was migrated, or if there was none to migrate.
+	migratedKey = []byte("memlog_migrated")
+)
+
+// store implements a bbolt based store. All operations run in their own
+// bbolt transaction: bbolt allows only one writer, but multiple concurrent
+// readers.
+type store struct {
+	log *logp.Logger
+	db  *bolt.DB
+}
+
+// value is the JSON encoded value of a key-value pair. It is only valid
+// within the transaction that read it.
+type value []byte
+
+// openStore opens the store file at path, creating it if it does not exist.
+func openStore(log *logp.Logger, path string, settings Settings) (*store, error) {
+	if err := ensurePermissions(path, settings.FileMode); err != nil {
+		return nil, fmt.Errorf("failed to update store file permissions: %w", err)
+	}
+
+	db, err := bolt.Open(path, settings.FileMode, &bolt.Options{
+		Timeout: settings.Timeout,
+		NoSync:  settings.NoSync,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store file '%v': %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if version := meta.Get(versionKey); version == nil {
+			if err := meta.Put(versionKey, []byte(storeVersion)); err != nil {
+				return err
+			}
+		} else if string(version) != storeVersion {
+			return fmt.Errorf("store version %v not supported, expected version %v", strconv.Quote(string(version)), storeVersion)
+		}
+		_, err = tx.CreateBucketIfNotExists(statesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize store file '%v': %w", path, err)
+	}
+
+	log.Infof("Opened store file '%v'", path)
+	return &store{log: log, db: db}, nil
+}
+
+// Close closes the store file.
+func (s *store) Close() error {
+	return s.db.Close()
+}
+
+// Has checks if the key is known.
+func (s *store) Has(key string) (bool, error) {
+	var exists bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(statesBucket).Get([]byte(key)) != nil
+		return nil
+	})
+	return exists, err
+}
+
+// Get retrieves and decodes the key-value pair into to.
+func (s *store) Get(key string, to interface{}) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(statesBucket).Get([]byte(key))
+		if v == nil {
+			return errKeyUnknown
+		}
+		return value(v).Decode(to)
+	})
+}
+
+// Set inserts or overwrites a key-value pair.
+func (s *store) Set(key string, v interface{}) error {
+	var tmp mapstr.M
+	if err := typeconv.Convert(&tmp, v); err != nil {
+		return err
+	}
+	data, err := json.Marshal(tmp)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(statesBucket).Put([]byte(key), data)
+	})
+}
+
+// Remove removes a key from the store. The operation does not check if the
+// key exists.
+func (s *store) Remove(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(statesBucket).Delete([]byte(key))
+	})
+}
+
+// Each iterates over all key-value pairs in the store, in key order.
+// The store must not be updated from fn.
+func (s *store) Each(fn func(string, backend.ValueDecoder) (bool, error)) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(statesBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			cont, err := fn(string(k), value(v))
+			if !cont || err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *store) SetID(_ string) {
+	// NOOP
+}
+
+func (v value) Decode(to interface{}) error {
+	var tmp map[string]interface{}
+	if err := json.Unmarshal(v, &tmp); err != nil {
+		return err
+	}
+	return typeconv.Convert(to, tmp)
+}
+
+// ensurePermissions updates the permissions of the file at path if it exists.
+func ensurePermissions(path string, mode os.FileMode) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode().Perm() == mode.Perm() {
+		return nil
+	}
+	return os.Chmod(path, mode)
+}
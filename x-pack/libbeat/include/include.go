@@ -11,6 +11,7 @@ import (
 	// register processors
 	_ "github.com/elastic/beats/v7/x-pack/libbeat/processors/add_cloudfoundry_metadata"
 	_ "github.com/elastic/beats/v7/x-pack/libbeat/processors/add_nomad_metadata"
+	_ "github.com/elastic/beats/v7/x-pack/libbeat/processors/deduplicate"
 
 	// register autodiscover providers
 	_ "github.com/elastic/beats/v7/x-pack/libbeat/autodiscover/providers/aws/ec2"
@@ -19,4 +20,6 @@ import (
 
 	// register outputs
 	_ "github.com/elastic/beats/v7/x-pack/libbeat/outputs/otelconsumer"
+	_ "github.com/elastic/beats/v7/x-pack/libbeat/outputs/s3"
+	_ "github.com/elastic/beats/v7/x-pack/libbeat/outputs/s3/parquet"
 )
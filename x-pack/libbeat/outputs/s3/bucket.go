@@ -0,0 +1,84 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// bucketClient uploads objects to a bucket, which can be on AWS or on an S3
+// compatible store like MinIO. Objects larger than the part size are
+// uploaded with a multipart upload.
+type bucketClient struct {
+	bucket   string
+	timeout  time.Duration
+	uploader *manager.Uploader
+}
+
+func newBucketClient(c *s3Config, awsConfig awssdk.Config) (*bucketClient, error) {
+	endpoint, err := endpointURL(c.AWSConfig.Endpoint, awsConfig.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		if c.AWSConfig.FIPSEnabled {
+			o.EndpointOptions.UseFIPSEndpoint = awssdk.FIPSEndpointStateEnabled
+		}
+		if endpoint != "" {
+			o.BaseEndpoint = awssdk.String(endpoint)
+		}
+		o.UsePathStyle = c.PathStyle
+	})
+
+	return &bucketClient{
+		bucket:  c.Bucket,
+		timeout: c.Timeout,
+		uploader: manager.NewUploader(client, func(u *manager.Uploader) {
+			u.PartSize = int64(c.PartSize)
+		}),
+	}, nil
+}
+
+// endpointURL returns the URL of the S3 service if an endpoint is
+// configured. The endpoint is either a full URL, like for MinIO, or an AWS
+// domain like amazonaws.com.cn.
+func endpointURL(endpoint, region string) (string, error) {
+	switch {
+	case endpoint == "":
+		return "", nil
+	case !strings.Contains(endpoint, "://"):
+		endpoint = "https://s3." + region + "." + endpoint
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return "", err
+	}
+	return endpoint, nil
+}
+
+// put uploads data as the object key.
+func (c *bucketClient) put(ctx context.Context, key string, data []byte, contentType string) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	_, err := c.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      awssdk.String(c.bucket),
+		Key:         awssdk.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: awssdk.String(contentType),
+	})
+	return err
+}
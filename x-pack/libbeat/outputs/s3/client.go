@@ -0,0 +1,320 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package s3
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// uploader stores the contents of an object.
+type uploader interface {
+	put(ctx context.Context, key string, data []byte, contentType string) error
+}
+
+// client buffers events per object key and uploads an object once it
+// reaches flush.max_bytes or is older than flush.interval. All objects are
+// uploaded once they hold flush.max_events events. Batches are only ACKed
+// once all objects holding their events are uploaded. If an upload fails
+// only the events written to the failed object are retried.
+type client struct {
+	log       *logp.Logger
+	observer  outputs.Observer
+	beatName  string
+	bucket    string
+	key       *fmtstr.EventFormatString
+	format    Format
+	store     uploader
+	maxBytes  int
+	maxEvents int
+	interval  time.Duration
+
+	mu      sync.Mutex
+	objects map[string]*object
+	// buffered is the number of events in objects.
+	buffered int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// object is an object being buffered, along with the events it holds of
+// each batch.
+type object struct {
+	prefix  string
+	created time.Time
+	writer  ObjectWriter
+	events  map[*pendingBatch][]publisher.Event
+	count   int
+}
+
+// pendingBatch tracks a batch whose events are spread over one or more
+// objects.
+type pendingBatch struct {
+	batch   publisher.Batch
+	objects int
+	acked   int
+	failed  []publisher.Event
+}
+
+func newClient(
+	log *logp.Logger,
+	observer outputs.Observer,
+	beatName string,
+	bucket string,
+	key *fmtstr.EventFormatString,
+	format Format,
+	store uploader,
+	flush flushConfig,
+) *client {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &client{
+		log:       log,
+		observer:  observer,
+		beatName:  beatName,
+		bucket:    bucket,
+		key:       key,
+		format:    format,
+		store:     store,
+		maxBytes:  int(flush.MaxBytes),
+		maxEvents: flush.MaxEvents,
+		interval:  flush.Interval,
+		objects:   map[string]*object{},
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	c.wg.Add(1)
+	go c.run()
+	return c
+}
+
+func (c *client) Close() error {
+	c.cancel()
+	c.wg.Wait()
+
+	// Upload whatever is still buffered, so events are not kept back until
+	// they are retried by the next run.
+	c.mu.Lock()
+	objects := c.takeAll(nil)
+	c.mu.Unlock()
+
+	for _, obj := range objects {
+		c.upload(context.Background(), obj)
+	}
+	return nil
+}
+
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	pending := &pendingBatch{batch: batch}
+	var full []*object
+	dropped := 0
+
+	c.mu.Lock()
+	for i := range events {
+		event := &events[i]
+
+		prefix, err := c.objectPrefix(&event.Content)
+		if err != nil {
+			c.log.Errorf("Failed to build the object key, dropping event: %+v", err)
+			dropped++
+			continue
+		}
+
+		obj := c.objects[prefix]
+		if obj == nil {
+			obj = &object{
+				prefix:  prefix,
+				created: time.Now(),
+				writer:  c.format.NewObject(),
+				events:  map[*pendingBatch][]publisher.Event{},
+			}
+			c.objects[prefix] = obj
+		}
+
+		if err := obj.writer.Add(&event.Content); err != nil {
+			if event.Guaranteed() {
+				c.log.Errorf("Failed to serialize the event: %+v", err)
+			} else {
+				c.log.Warnf("Failed to serialize the event: %+v", err)
+			}
+			dropped++
+			continue
+		}
+
+		if _, ok := obj.events[pending]; !ok {
+			pending.objects++
+		}
+		obj.events[pending] = append(obj.events[pending], *event)
+		obj.count++
+		c.buffered++
+
+		if obj.writer.Size() >= c.maxBytes {
+			c.take(obj)
+			full = append(full, obj)
+		}
+	}
+	if c.buffered >= c.maxEvents {
+		// The batches of the buffered events hold their space in the
+		// queue, upload everything before the queue fills up.
+		full = c.takeAll(full)
+	}
+	empty := pending.objects == 0
+	c.mu.Unlock()
+
+	if dropped > 0 {
+		c.observer.PermanentErrors(dropped)
+	}
+	if empty {
+		batch.ACK()
+		return nil
+	}
+
+	for _, obj := range full {
+		c.upload(ctx, obj)
+	}
+	return nil
+}
+
+// run uploads the objects that are buffered for longer than flush.interval.
+func (c *client) run() {
+	defer c.wg.Done()
+
+	tick := c.interval / 2
+	if tick <= 0 {
+		tick = c.interval
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			var expired []*object
+			for _, obj := range c.objects {
+				if now.Sub(obj.created) >= c.interval {
+					expired = append(expired, obj)
+					c.take(obj)
+				}
+			}
+			c.mu.Unlock()
+
+			for _, obj := range expired {
+				c.upload(c.ctx, obj)
+			}
+		}
+	}
+}
+
+// take removes an object from the buffered objects before it is uploaded.
+// It must be called with the lock held.
+func (c *client) take(obj *object) {
+	delete(c.objects, obj.prefix)
+	c.buffered -= obj.count
+}
+
+// takeAll removes all buffered objects and appends them to objects. It
+// must be called with the lock held.
+func (c *client) takeAll(objects []*object) []*object {
+	for _, obj := range c.objects {
+		objects = append(objects, obj)
+		c.take(obj)
+	}
+	return objects
+}
+
+func (c *client) upload(ctx context.Context, obj *object) {
+	name := c.objectName(obj)
+
+	data, err := obj.writer.Finish()
+	if err == nil {
+		begin := time.Now()
+		err = c.store.put(ctx, name, data, c.format.ContentType())
+		c.observer.ReportLatency(time.Since(begin))
+	}
+	if err != nil {
+		c.log.Errorf("Failed to upload object %v: %+v", name, err)
+		c.observer.WriteError(err)
+	} else {
+		c.log.Debugf("Uploaded object %v (%d bytes)", name, len(data))
+		c.observer.WriteBytes(len(data))
+	}
+
+	var done []*pendingBatch
+	c.mu.Lock()
+	for pending, events := range obj.events {
+		if err != nil {
+			pending.failed = append(pending.failed, events...)
+		} else {
+			pending.acked += len(events)
+		}
+		pending.objects--
+		if pending.objects == 0 {
+			done = append(done, pending)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, pending := range done {
+		if pending.acked > 0 {
+			c.observer.AckedEvents(pending.acked)
+		}
+		if len(pending.failed) > 0 {
+			c.observer.RetryableErrors(len(pending.failed))
+			pending.batch.RetryEvents(pending.failed)
+			continue
+		}
+		pending.batch.ACK()
+	}
+}
+
+// objectPrefix returns the prefix of the objects the event is written to.
+func (c *client) objectPrefix(event *beat.Event) (string, error) {
+	if c.key == nil {
+		return "", nil
+	}
+	prefix, err := c.key.Run(event)
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(prefix, "/"), nil
+}
+
+// objectName returns a unique name for the object, like
+// {prefix}/{beat}-{created}-{uuid}.{extension}.
+func (c *client) objectName(obj *object) string {
+	id, err := uuid.NewV4()
+	if err != nil {
+		// Fall back to the creation time, which is unique enough unless
+		// several objects are created in the same nanosecond.
+		id = uuid.NewV5(uuid.Nil, obj.created.String())
+	}
+	name := fmt.Sprintf("%s-%s-%s.%s",
+		c.beatName, obj.created.UTC().Format("20060102T150405Z"), id, c.format.Extension())
+	return path.Join(obj.prefix, name)
+}
+
+func (c *client) String() string {
+	return "s3(" + c.bucket + ")"
+}
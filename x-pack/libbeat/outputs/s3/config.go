@@ -0,0 +1,80 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	awscommon "github.com/elastic/beats/v7/x-pack/libbeat/common/aws"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// minPartSize is the smallest part S3 accepts in a multipart upload, except
+// for the last part.
+const minPartSize = 5 * 1024 * 1024
+
+type s3Config struct {
+	Bucket      string                    `config:"bucket" validate:"required"`
+	Key         *fmtstr.EventFormatString `config:"key"`
+	Region      string                    `config:"region"`
+	PathStyle   bool                      `config:"path_style"`
+	Format      string                    `config:"format"`
+	Flush       flushConfig               `config:"flush"`
+	PartSize    cfgtype.ByteSize          `config:"part_size"`
+	BulkMaxSize int                       `config:"bulk_max_size"`
+	MaxRetries  int                       `config:"max_retries"`
+	Timeout     time.Duration             `config:"timeout"`
+	Queue       config.Namespace          `config:"queue"`
+	AWSConfig   awscommon.ConfigAWS       `config:",inline"`
+}
+
+// flushConfig bounds how long and how large an object is buffered before it
+// is uploaded. MaxEvents bounds the events buffered in all objects, since
+// their batches hold space in the queue until they are uploaded.
+type flushConfig struct {
+	MaxBytes  cfgtype.ByteSize `config:"max_bytes"`
+	MaxEvents int              `config:"max_events"`
+	Interval  time.Duration    `config:"interval"`
+}
+
+func defaultConfig() s3Config {
+	return s3Config{
+		Format: "ndjson",
+		Flush: flushConfig{
+			MaxBytes: 64 * 1024 * 1024,
+			// Leaves room in the default memory queue of 3200 events, so
+			// inputs don't wait for flush.interval under load.
+			MaxEvents: 2048,
+			Interval:  5 * time.Minute,
+		},
+		PartSize:    minPartSize,
+		BulkMaxSize: 1600,
+		MaxRetries:  3,
+		Timeout:     90 * time.Second,
+	}
+}
+
+func (c *s3Config) Validate() error {
+	if c.Flush.MaxBytes <= 0 {
+		return errors.New("flush.max_bytes must be greater than 0")
+	}
+	if c.Flush.MaxEvents <= 0 {
+		return errors.New("flush.max_events must be greater than 0")
+	}
+	if c.Flush.Interval <= 0 {
+		return errors.New("flush.interval must be greater than 0")
+	}
+	if c.PartSize < minPartSize {
+		return fmt.Errorf("part_size must be at least %d bytes", minPartSize)
+	}
+	if _, ok := formats[c.Format]; !ok {
+		return fmt.Errorf("unsupported format '%v'", c.Format)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package s3
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/klauspost/compress/gzip"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// Format creates the writers for the objects uploaded by the output.
+type Format interface {
+	// NewObject returns a writer for a new, empty object.
+	NewObject() ObjectWriter
+
+	// Extension is the file extension of the objects, without leading dot.
+	Extension() string
+
+	// ContentType is the MIME type of the objects.
+	ContentType() string
+}
+
+// ObjectWriter accumulates the events of one object.
+type ObjectWriter interface {
+	// Add appends an event to the object.
+	Add(event *beat.Event) error
+
+	// Size returns the approximate size of the object in bytes, used to
+	// decide when the object is flushed.
+	Size() int
+
+	// Finish returns the contents of the object. Add must not be called
+	// after Finish.
+	Finish() ([]byte, error)
+}
+
+// FormatFactory creates a Format from the output configuration.
+type FormatFactory func(info beat.Info, cfg *config.C) (Format, error)
+
+var formats = map[string]FormatFactory{}
+
+// RegisterFormat registers an object format for the s3 output.
+func RegisterFormat(name string, factory FormatFactory) {
+	if _, exists := formats[name]; exists {
+		panic(fmt.Sprintf("s3 output format '%v' already registered", name))
+	}
+	formats[name] = factory
+}
+
+func init() {
+	RegisterFormat("ndjson", newNDJSONFormat)
+}
+
+// ndjsonFormat writes one event per line, encoded with the configured codec.
+type ndjsonFormat struct {
+	index       string
+	codec       codec.Codec
+	compression string
+}
+
+type ndjsonConfig struct {
+	Codec       codec.Config `config:"codec"`
+	Compression string       `config:"compression"`
+}
+
+func newNDJSONFormat(info beat.Info, cfg *config.C) (Format, error) {
+	c := ndjsonConfig{Compression: "none"}
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, err
+	}
+	switch c.Compression {
+	case "none", "gzip":
+	default:
+		return nil, fmt.Errorf("unsupported compression '%v', must be one of %q or %q", c.Compression, "none", "gzip")
+	}
+
+	enc, err := codec.CreateEncoder(info, c.Codec)
+	if err != nil {
+		return nil, err
+	}
+	return &ndjsonFormat{index: info.Beat, codec: enc, compression: c.Compression}, nil
+}
+
+func (f *ndjsonFormat) NewObject() ObjectWriter {
+	return &ndjsonWriter{format: f}
+}
+
+func (f *ndjsonFormat) Extension() string {
+	if f.compression == "gzip" {
+		return "ndjson.gz"
+	}
+	return "ndjson"
+}
+
+func (f *ndjsonFormat) ContentType() string {
+	if f.compression == "gzip" {
+		return "application/gzip"
+	}
+	return "application/x-ndjson"
+}
+
+type ndjsonWriter struct {
+	format *ndjsonFormat
+	buf    bytes.Buffer
+}
+
+func (w *ndjsonWriter) Add(event *beat.Event) error {
+	data, err := w.format.codec.Encode(w.format.index, event)
+	if err != nil {
+		return err
+	}
+	w.buf.Write(data)
+	w.buf.WriteByte('\n')
+	return nil
+}
+
+func (w *ndjsonWriter) Size() int {
+	return w.buf.Len()
+}
+
+func (w *ndjsonWriter) Finish() ([]byte, error) {
+	if w.format.compression != "gzip" {
+		return w.buf.Bytes(), nil
+	}
+
+	var out bytes.Buffer
+	zw := gzip.NewWriter(&out)
+	if _, err := zw.Write(w.buf.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
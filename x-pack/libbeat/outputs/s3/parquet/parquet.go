@@ -0,0 +1,242 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package parquet registers the parquet object format of the s3 output.
+// Events are flattened into columns, one per field, and the schema of each
+// object is inferred from the events it holds.
+package parquet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/apache/arrow/go/v17/parquet"
+	"github.com/apache/arrow/go/v17/parquet/compress"
+	"github.com/apache/arrow/go/v17/parquet/pqarrow"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/x-pack/libbeat/outputs/s3"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func init() {
+	s3.RegisterFormat("parquet", newFormat)
+}
+
+var codecs = map[string]compress.Compression{
+	"none":   compress.Codecs.Uncompressed,
+	"snappy": compress.Codecs.Snappy,
+	"gzip":   compress.Codecs.Gzip,
+	"zstd":   compress.Codecs.Zstd,
+}
+
+type formatConfig struct {
+	Compression string `config:"compression"`
+}
+
+type format struct {
+	compression compress.Compression
+}
+
+func newFormat(_ beat.Info, cfg *config.C) (s3.Format, error) {
+	c := formatConfig{Compression: "snappy"}
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, err
+	}
+	compression, ok := codecs[c.Compression]
+	if !ok {
+		return nil, fmt.Errorf("unsupported parquet compression '%v'", c.Compression)
+	}
+	return &format{compression: compression}, nil
+}
+
+func (f *format) NewObject() s3.ObjectWriter {
+	return &writer{format: f}
+}
+
+func (f *format) Extension() string {
+	return "parquet"
+}
+
+func (f *format) ContentType() string {
+	return "application/vnd.apache.parquet"
+}
+
+// writer keeps the flattened events of an object until the object is
+// finished, as the schema is only known once all events are added.
+type writer struct {
+	format *format
+	rows   []mapstr.M
+	size   int
+}
+
+func (w *writer) Add(event *beat.Event) error {
+	row := event.Fields.Flatten()
+	row["@timestamp"] = event.Timestamp
+	for k, v := range row {
+		v, size, err := normalize(v)
+		if err != nil {
+			return fmt.Errorf("failed to convert field '%v': %w", k, err)
+		}
+		row[k] = v
+		w.size += len(k) + size
+	}
+	w.rows = append(w.rows, row)
+	return nil
+}
+
+func (w *writer) Size() int {
+	return w.size
+}
+
+func (w *writer) Finish() ([]byte, error) {
+	schema := inferSchema(w.rows)
+
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	defer b.Release()
+
+	for _, row := range w.rows {
+		for i, field := range schema.Fields() {
+			appendValue(b.Field(i), field.Type, row[field.Name])
+		}
+	}
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	var buf bytes.Buffer
+	props := parquet.NewWriterProperties(parquet.WithCompression(w.format.compression))
+	fw, err := pqarrow.NewFileWriter(schema, &buf, props, pqarrow.DefaultWriterProps())
+	if err != nil {
+		return nil, err
+	}
+	if err := fw.Write(rec); err != nil {
+		_ = fw.Close()
+		return nil, err
+	}
+	if err := fw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// normalize converts a field value to one of bool, int64, float64, string or
+// time.Time, encoding all other values as JSON. It returns the approximate
+// size of the value.
+func normalize(v interface{}) (interface{}, int, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, 0, nil
+	case bool:
+		return v, 1, nil
+	case int:
+		return int64(v), 8, nil
+	case int8:
+		return int64(v), 8, nil
+	case int16:
+		return int64(v), 8, nil
+	case int32:
+		return int64(v), 8, nil
+	case int64:
+		return v, 8, nil
+	case uint8:
+		return int64(v), 8, nil
+	case uint16:
+		return int64(v), 8, nil
+	case uint32:
+		return int64(v), 8, nil
+	case float32:
+		return float64(v), 8, nil
+	case float64:
+		return v, 8, nil
+	case string:
+		return v, len(v), nil
+	case time.Time:
+		return v, 8, nil
+	case common.Time:
+		return time.Time(v), 8, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, 0, err
+	}
+	return string(data), len(data), nil
+}
+
+// inferSchema returns a schema with one nullable column per field, sorted by
+// name. A field holding values of different types is written as string.
+func inferSchema(rows []mapstr.M) *arrow.Schema {
+	types := map[string]arrow.DataType{}
+	for _, row := range rows {
+		for k, v := range row {
+			t := dataType(v)
+			if t == nil {
+				continue
+			}
+			if prev, ok := types[k]; ok && !arrow.TypeEqual(prev, t) {
+				t = arrow.BinaryTypes.String
+			}
+			types[k] = t
+		}
+	}
+
+	fields := make([]arrow.Field, 0, len(types))
+	for name, t := range types {
+		fields = append(fields, arrow.Field{Name: name, Type: t, Nullable: true})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return arrow.NewSchema(fields, nil)
+}
+
+func dataType(v interface{}) arrow.DataType {
+	switch v.(type) {
+	case bool:
+		return arrow.FixedWidthTypes.Boolean
+	case int64:
+		return arrow.PrimitiveTypes.Int64
+	case float64:
+		return arrow.PrimitiveTypes.Float64
+	case string:
+		return arrow.BinaryTypes.String
+	case time.Time:
+		return arrow.FixedWidthTypes.Timestamp_us
+	}
+	return nil
+}
+
+func appendValue(b array.Builder, t arrow.DataType, v interface{}) {
+	if v == nil {
+		b.AppendNull()
+		return
+	}
+
+	switch b := b.(type) {
+	case *array.BooleanBuilder:
+		b.Append(v.(bool))
+	case *array.Int64Builder:
+		b.Append(v.(int64))
+	case *array.Float64Builder:
+		b.Append(v.(float64))
+	case *array.TimestampBuilder:
+		b.Append(arrow.Timestamp(v.(time.Time).UnixMicro()))
+	case *array.StringBuilder:
+		if s, ok := v.(string); ok {
+			b.Append(s)
+		} else if ts, ok := v.(time.Time); ok {
+			b.Append(ts.UTC().Format(time.RFC3339Nano))
+		} else {
+			b.Append(fmt.Sprint(v))
+		}
+	default:
+		panic(fmt.Sprintf("unexpected parquet column type %v", t))
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package parquet
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/x-pack/libbeat/reader/parquet"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestFormat(t *testing.T) {
+	ts := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	events := []beat.Event{
+		{Timestamp: ts, Fields: mapstr.M{
+			"message": "first",
+			"http":    mapstr.M{"response": mapstr.M{"status_code": 200}},
+			"tags":    []string{"a", "b"},
+			"mixed":   1,
+		}},
+		{Timestamp: ts.Add(time.Second), Fields: mapstr.M{
+			"message": "second",
+			"ok":      true,
+			"mixed":   "one",
+		}},
+	}
+
+	f, err := newFormat(beat.Info{}, config.NewConfig())
+	require.NoError(t, err)
+	assert.Equal(t, "parquet", f.Extension())
+
+	w := f.NewObject()
+	for i := range events {
+		require.NoError(t, w.Add(&events[i]))
+	}
+	assert.Greater(t, w.Size(), 0)
+
+	data, err := w.Finish()
+	require.NoError(t, err)
+
+	r, err := parquet.NewBufferedReader(bytes.NewReader(data), &parquet.Config{BatchSize: 2})
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.True(t, r.Next())
+	raw, err := r.Record()
+	require.NoError(t, err)
+
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &rows))
+	require.Len(t, rows, 2)
+
+	assert.Equal(t, "first", rows[0]["message"])
+	assert.Equal(t, float64(200), rows[0]["http.response.status_code"])
+	assert.Equal(t, `["a","b"]`, rows[0]["tags"])
+	assert.Nil(t, rows[0]["ok"])
+	assert.Equal(t, "1", rows[0]["mixed"])
+	assert.Equal(t, "2025-03-04 05:06:07Z", rows[0]["@timestamp"])
+
+	assert.Equal(t, "second", rows[1]["message"])
+	assert.Equal(t, true, rows[1]["ok"])
+	assert.Nil(t, rows[1]["tags"])
+	assert.Equal(t, "one", rows[1]["mixed"])
+}
+
+func TestFormatInvalidCompression(t *testing.T) {
+	_, err := newFormat(beat.Info{}, config.MustNewConfigFrom(map[string]interface{}{"compression": "lz4"}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package s3
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	awscommon "github.com/elastic/beats/v7/x-pack/libbeat/common/aws"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func init() {
+	outputs.RegisterType("s3", makeS3)
+}
+
+func makeS3(
+	_ outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *config.C,
+) (outputs.Group, error) {
+	log := beat.Logger.Named("s3")
+
+	s3Config := defaultConfig()
+	if err := cfg.Unpack(&s3Config); err != nil {
+		return outputs.Fail(err)
+	}
+
+	format, err := formats[s3Config.Format](beat, cfg)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	awsConfig, err := awscommon.InitializeAWSConfig(s3Config.AWSConfig, log)
+	if err != nil {
+		return outputs.Fail(fmt.Errorf("initializing AWS config: %w", err))
+	}
+	if s3Config.Region != "" {
+		awsConfig.Region = s3Config.Region
+	}
+
+	bucket, err := newBucketClient(&s3Config, awsConfig)
+	if err != nil {
+		return outputs.Fail(fmt.Errorf("invalid endpoint '%v': %w", s3Config.AWSConfig.Endpoint, err))
+	}
+
+	client := newClient(log, observer, beat.Beat, s3Config.Bucket, s3Config.Key, format, bucket, s3Config.Flush)
+	return outputs.Success(s3Config.Queue, s3Config.BulkMaxSize, s3Config.MaxRetries, nil, beat.Logger, client)
+}
@@ -0,0 +1,425 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	awscommon "github.com/elastic/beats/v7/x-pack/libbeat/common/aws"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// testStore is a minimal S3 compatible server using path style addressing.
+// It supports plain and multipart uploads of objects.
+type testStore struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+
+	// Requests for the keys containing failKey are rejected.
+	failKey string
+	fail    bool
+}
+
+func newTestStore(t *testing.T) (*testStore, string) {
+	s := &testStore{t: t, objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv.URL
+}
+
+func (s *testStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, err := io.ReadAll(r.Body)
+	require.NoError(s.t, err)
+
+	assert.True(s.t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=id/"))
+
+	key := r.URL.Path
+	if s.fail || (s.failKey != "" && strings.Contains(key, s.failKey)) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := strconv.Itoa(len(s.uploads) + 1)
+		s.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, id)
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		s.uploads[query.Get("uploadId")][number] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, number))
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		require.NoError(s.t, xml.Unmarshal(body, &complete))
+		parts := s.uploads[query.Get("uploadId")]
+		var data []byte
+		for i, p := range complete.Parts {
+			assert.Equal(s.t, i+1, p.PartNumber)
+			assert.Equal(s.t, fmt.Sprintf(`"etag-%d"`, p.PartNumber), p.ETag)
+			data = append(data, parts[p.PartNumber]...)
+		}
+		s.objects[key] = data
+		delete(s.uploads, query.Get("uploadId"))
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Key>%s</Key></CompleteMultipartUploadResult>`, key)
+
+	case r.Method == http.MethodPut:
+		s.objects[key] = body
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *testStore) setFail(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = fail
+}
+
+func (s *testStore) setFailKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failKey = key
+}
+
+// keys returns the names of all stored objects, sorted.
+func (s *testStore) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for k := range s.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *testStore) object(key string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objects[key]
+}
+
+func makeTestClient(t *testing.T, endpoint string, settings map[string]interface{}) outputs.Client {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"bucket":            "events",
+		"endpoint":          endpoint,
+		"path_style":        true,
+		"region":            "us-east-1",
+		"access_key_id":     "id",
+		"secret_access_key": "secret",
+	})
+	require.NoError(t, cfg.Merge(settings))
+	info := beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")}
+
+	group, err := makeS3(nil, info, outputs.NewNilObserver(), cfg)
+	require.NoError(t, err)
+	require.Len(t, group.Clients, 1)
+	return group.Clients[0]
+}
+
+func testEvents() []beat.Event {
+	ts := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	return []beat.Event{
+		{Timestamp: ts, Fields: mapstr.M{"data_stream": mapstr.M{"dataset": "nginx.access"}, "message": "first"}},
+		{Timestamp: ts, Fields: mapstr.M{"data_stream": mapstr.M{"dataset": "nginx.error"}, "message": "second"}},
+		{Timestamp: ts, Fields: mapstr.M{"data_stream": mapstr.M{"dataset": "nginx.access"}, "message": "third"}},
+	}
+}
+
+func TestMakeS3(t *testing.T) {
+	tests := map[string]struct {
+		config map[string]interface{}
+		valid  bool
+	}{
+		"no bucket": {
+			config: map[string]interface{}{},
+		},
+		"defaults": {
+			config: map[string]interface{}{"bucket": "events"},
+			valid:  true,
+		},
+		"unknown format": {
+			config: map[string]interface{}{"bucket": "events", "format": "csv"},
+		},
+		"part size too small": {
+			config: map[string]interface{}{"bucket": "events", "part_size": "1MiB"},
+		},
+		"no flush.max_events": {
+			config: map[string]interface{}{"bucket": "events", "flush.max_events": 0},
+		},
+		"invalid compression": {
+			config: map[string]interface{}{"bucket": "events", "compression": "lz4"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			info := beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")}
+			group, err := makeS3(nil, info, outputs.NewNilObserver(), config.MustNewConfigFrom(test.config))
+			if test.valid {
+				require.NoError(t, err)
+				for _, c := range group.Clients {
+					c.Close()
+				}
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestPublishFlushOnSize(t *testing.T) {
+	store, endpoint := newTestStore(t)
+	client := makeTestClient(t, endpoint, map[string]interface{}{
+		"key":             "%{[data_stream.dataset]}/%{+yyyy/MM/dd}",
+		"flush.max_bytes": 1,
+		"flush.interval":  "1h",
+	})
+	defer client.Close()
+
+	batch := outest.NewBatch(testEvents()...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	// Every event fills an object, so all objects are uploaded right away.
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	keys := store.keys()
+	require.Len(t, keys, 3)
+	prefixes := map[string]int{}
+	for _, k := range keys {
+		assert.True(t, strings.HasSuffix(k, ".ndjson"), k)
+		assert.Contains(t, k, "/testbeat-20")
+		prefixes[k[:strings.LastIndex(k, "/")]]++
+	}
+	assert.Equal(t, map[string]int{
+		"/events/nginx.access/2025/03/04": 2,
+		"/events/nginx.error/2025/03/04":  1,
+	}, prefixes)
+}
+
+func TestPublishFlushOnInterval(t *testing.T) {
+	store, endpoint := newTestStore(t)
+	client := makeTestClient(t, endpoint, map[string]interface{}{
+		"key":            "%{[data_stream.dataset]}",
+		"flush.interval": "50ms",
+	})
+	defer client.Close()
+
+	signals := make(chan outest.BatchSignal, 1)
+	batch := outest.NewBatch(testEvents()...)
+	batch.OnSignal = func(sig outest.BatchSignal) { signals <- sig }
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	select {
+	case sig := <-signals:
+		assert.Equal(t, outest.BatchACK, sig.Tag)
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch was not ACKed")
+	}
+	require.Len(t, store.keys(), 2)
+
+	for _, k := range store.keys() {
+		lines := strings.Split(strings.TrimSuffix(string(store.object(k)), "\n"), "\n")
+		if strings.Contains(k, "nginx.access") {
+			assert.Len(t, lines, 2)
+			assert.Contains(t, lines[0], `"message":"first"`)
+			assert.Contains(t, lines[1], `"message":"third"`)
+		} else {
+			assert.Len(t, lines, 1)
+			assert.Contains(t, lines[0], `"message":"second"`)
+		}
+	}
+}
+
+func TestPublishFlushOnMaxEvents(t *testing.T) {
+	store, endpoint := newTestStore(t)
+	client := makeTestClient(t, endpoint, map[string]interface{}{
+		"key":              "%{[data_stream.dataset]}",
+		"flush.max_events": 4,
+		"flush.interval":   "1h",
+	})
+	defer client.Close()
+
+	first := outest.NewBatch(testEvents()...)
+	require.NoError(t, client.Publish(context.Background(), first))
+	assert.Empty(t, first.Signals)
+	assert.Empty(t, store.keys())
+
+	// The events of both batches exceed flush.max_events, so all objects
+	// are uploaded, including the ones not holding events of this batch.
+	second := outest.NewBatch(testEvents()[1])
+	require.NoError(t, client.Publish(context.Background(), second))
+	for _, batch := range []*outest.Batch{first, second} {
+		require.Len(t, batch.Signals, 1)
+		assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	}
+	assert.Len(t, store.keys(), 2)
+
+	// The counter is reset after the upload.
+	third := outest.NewBatch(testEvents()...)
+	require.NoError(t, client.Publish(context.Background(), third))
+	assert.Empty(t, third.Signals)
+}
+
+func TestPublishFlushOnClose(t *testing.T) {
+	store, endpoint := newTestStore(t)
+	client := makeTestClient(t, endpoint, map[string]interface{}{
+		"compression":    "gzip",
+		"flush.interval": "1h",
+	})
+
+	batch := outest.NewBatch(testEvents()...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+	assert.Empty(t, batch.Signals)
+
+	require.NoError(t, client.Close())
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	keys := store.keys()
+	require.Len(t, keys, 1)
+	assert.True(t, strings.HasPrefix(keys[0], "/events/testbeat-"), keys[0])
+	assert.True(t, strings.HasSuffix(keys[0], ".ndjson.gz"), keys[0])
+
+	zr, err := gzip.NewReader(bytes.NewReader(store.object(keys[0])))
+	require.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(data), "\n"))
+}
+
+func TestPublishUploadFailure(t *testing.T) {
+	store, endpoint := newTestStore(t)
+	store.setFail(true)
+	client := makeTestClient(t, endpoint, map[string]interface{}{
+		"key":             "%{[data_stream.dataset]}",
+		"flush.max_bytes": 1,
+	})
+	defer client.Close()
+
+	batch := outest.NewBatch(testEvents()...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Len(t, batch.Signals[0].Events, 3)
+	assert.Empty(t, store.keys())
+}
+
+func TestPublishPartialUploadFailure(t *testing.T) {
+	store, endpoint := newTestStore(t)
+	client := makeTestClient(t, endpoint, map[string]interface{}{
+		"key":            "%{[data_stream.dataset]}",
+		"flush.interval": "1h",
+	})
+
+	batch := outest.NewBatch(testEvents()...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	store.setFailKey("nginx.error")
+	require.NoError(t, client.Close())
+
+	// Only the event of the object that failed to upload is retried.
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	require.Len(t, batch.Signals[0].Events, 1)
+	assert.Equal(t, "second", batch.Signals[0].Events[0].Content.Fields["message"])
+
+	keys := store.keys()
+	require.Len(t, keys, 1)
+	assert.Contains(t, keys[0], "/events/nginx.access/")
+}
+
+func TestBucketClientMultipart(t *testing.T) {
+	store, endpoint := newTestStore(t)
+
+	c := defaultConfig()
+	c.Bucket = "events"
+	c.PathStyle = true
+	c.AWSConfig.Endpoint = endpoint
+	c.AWSConfig.AccessKeyID = "id"
+	c.AWSConfig.SecretAccessKey = "secret"
+	c.AWSConfig.DefaultRegion = "us-east-1"
+
+	bucket, err := newBucketClient(&c, awsTestConfig(t, &c))
+	require.NoError(t, err)
+
+	// The object is uploaded in three parts.
+	data := bytes.Repeat([]byte("0123456789abcdef"), (2*minPartSize+1024)/16)
+	require.NoError(t, bucket.put(context.Background(), "some dir/object+1.ndjson", data, "application/x-ndjson"))
+
+	assert.Equal(t, data, store.object("/events/some dir/object+1.ndjson"))
+}
+
+func TestEndpointURL(t *testing.T) {
+	tests := map[string]struct {
+		endpoint string
+		want     string
+	}{
+		"aws": {},
+		"aws domain": {
+			endpoint: "amazonaws.com.cn",
+			want:     "https://s3.eu-west-1.amazonaws.com.cn",
+		},
+		"minio": {
+			endpoint: "http://localhost:9000",
+			want:     "http://localhost:9000",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			endpoint, err := endpointURL(test.endpoint, "eu-west-1")
+			require.NoError(t, err)
+			assert.Equal(t, test.want, endpoint)
+		})
+	}
+}
+
+func awsTestConfig(t *testing.T, c *s3Config) awssdk.Config {
+	awsConfig, err := awscommon.InitializeAWSConfig(c.AWSConfig, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	return awsConfig
+}
@@ -0,0 +1,55 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package deduplicate
+
+import (
+	"errors"
+	"time"
+)
+
+type config struct {
+	// Window is the time during which the events with the same key are
+	// dropped after the first one.
+	Window time.Duration `config:"window" validate:"min=1"`
+
+	// MaxEntries is the maximum number of keys kept in memory. The oldest
+	// keys are forgotten first.
+	MaxEntries int `config:"max_entries" validate:"min=1"`
+
+	Persistence persistenceConfig `config:"persistence"`
+
+	// TargetField is the field the key of the events is stored in, if set.
+	// Setting it to @metadata._id makes Elasticsearch reject the events
+	// sent again by the queue or the output, which don't go through the
+	// processor again.
+	TargetField string `config:"target_field"`
+}
+
+// persistenceConfig configures the persistence of the window in the data
+// path, so that it survives restarts.
+type persistenceConfig struct {
+	Enabled bool `config:"enabled"`
+
+	// ID names the persisted window. Processors using the same ID share
+	// the same window.
+	ID string `config:"id"`
+}
+
+func defaultConfig() config {
+	return config{
+		Window:     10 * time.Minute,
+		MaxEntries: 10000,
+		Persistence: persistenceConfig{
+			ID: "default",
+		},
+	}
+}
+
+func (c *config) Validate() error {
+	if c.Persistence.Enabled && c.Persistence.ID == "" {
+		return errors.New("persistence.id must not be empty")
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package deduplicate
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	badger "github.com/dgraph-io/badger/v4"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/fingerprint"
+	"github.com/elastic/beats/v7/x-pack/libbeat/persistentcache"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const processorName = "deduplicate"
+
+func init() {
+	// Not registered as a JS plugin as it is stateful and has a Close method.
+	processors.RegisterPlugin(processorName, New)
+}
+
+// deduplicate drops the events whose key was already seen during the
+// window. The key is the fingerprint of the configured fields.
+type deduplicate struct {
+	config config
+	log    *logp.Logger
+	hasher fingerprint.Hasher
+	window *window
+
+	// persisted is the window persisted in the data path, nil if the
+	// persistence is disabled.
+	persisted *persistentcache.PersistentCache
+}
+
+// New constructs a new deduplicate processor. The key of the events is
+// computed with the fields, method, encoding and ignore_missing settings of
+// the fingerprint processor.
+func New(cfg *conf.C, log *logp.Logger) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v configuration: %w", processorName, err)
+	}
+	hasher, err := fingerprint.NewHasher(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v configuration: %w", processorName, err)
+	}
+
+	p := &deduplicate{
+		config: config,
+		log:    log.Named(processorName),
+		hasher: hasher,
+		window: newWindow(config.Window, config.MaxEntries),
+	}
+	if config.Persistence.Enabled {
+		p.persisted, err = persistedWindows.open(config.Persistence.ID, p.log)
+		if err != nil {
+			return nil, fmt.Errorf("%v: opening persisted window: %w", processorName, err)
+		}
+	}
+	return p, nil
+}
+
+// Run drops the event if its key was seen during the window.
+func (p *deduplicate) Run(event *beat.Event) (*beat.Event, error) {
+	key, err := p.hasher.Sum(event)
+	if err != nil {
+		return event, fmt.Errorf("%v: %w", processorName, err)
+	}
+
+	if p.window.seen(key) || p.seenPersisted(key) {
+		return nil, nil
+	}
+	if p.config.TargetField != "" {
+		if _, err := event.PutValue(p.config.TargetField, key); err != nil {
+			return event, fmt.Errorf("%v: failed to store the key: %w", processorName, err)
+		}
+	}
+	return event, nil
+}
+
+// seenPersisted reports whether the key is in the persisted window, and
+// adds it otherwise. The persisted keys expire after the window, but they
+// aren't bounded by max_entries.
+func (p *deduplicate) seenPersisted(key string) bool {
+	if p.persisted == nil {
+		return false
+	}
+
+	var seen bool
+	err := p.persisted.Get(key, &seen)
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, badger.ErrKeyNotFound) {
+		p.log.Warnf("Failed to read the persisted window: %v", err)
+	}
+	if err := p.persisted.PutWithTimeout(key, true, p.config.Window); err != nil {
+		p.log.Warnf("Failed to update the persisted window: %v", err)
+	}
+	return false
+}
+
+// Close releases the persisted window.
+func (p *deduplicate) Close() error {
+	if p.persisted == nil {
+		return nil
+	}
+	return persistedWindows.close(p.config.Persistence.ID)
+}
+
+func (p *deduplicate) String() string {
+	return fmt.Sprintf("%v=[window=%v, max_entries=%v, persistence=%v, target_field=%v]",
+		processorName, p.config.Window, p.config.MaxEntries, p.config.Persistence.Enabled, p.config.TargetField)
+}
+
+// persistedWindows holds the persisted windows opened by the processors,
+// which are shared by the processors configured with the same ID.
+var persistedWindows = windowStores{stores: map[string]*windowStore{}}
+
+type windowStores struct {
+	mu     sync.Mutex
+	stores map[string]*windowStore
+}
+
+type windowStore struct {
+	cache *persistentcache.PersistentCache
+	refs  int
+}
+
+func (s *windowStores) open(id string, log *logp.Logger) (*persistentcache.PersistentCache, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if store, ok := s.stores[id]; ok {
+		store.refs++
+		return store.cache, nil
+	}
+	cache, err := persistentcache.New(processorName+"_"+id, persistentcache.Options{}, log)
+	if err != nil {
+		return nil, err
+	}
+	s.stores[id] = &windowStore{cache: cache, refs: 1}
+	return cache, nil
+}
+
+func (s *windowStores) close(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store, ok := s.stores[id]
+	if !ok {
+		return nil
+	}
+	store.refs--
+	if store.refs > 0 {
+		return nil
+	}
+	delete(s.stores, id)
+	return store.cache.Close()
+}
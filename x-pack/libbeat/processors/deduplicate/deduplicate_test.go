@@ -0,0 +1,171 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package deduplicate
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/beat/events"
+	"github.com/elastic/beats/v7/libbeat/processors/fingerprint"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+func TestMain(m *testing.M) {
+	// Override global beats data dir to avoid creating directories in the working copy.
+	tmpdir, err := os.MkdirTemp("", "beats-data-dir")
+	if err != nil {
+		panic(err)
+	}
+	paths.Paths.Data = tmpdir
+
+	result := m.Run()
+	os.RemoveAll(tmpdir)
+	os.Exit(result)
+}
+
+func TestWindow(t *testing.T) {
+	now := time.Now()
+	w := newWindow(time.Minute, 2)
+	w.now = func() time.Time { return now }
+
+	assert.False(t, w.seen("a"))
+	assert.True(t, w.seen("a"))
+
+	now = now.Add(30 * time.Second)
+	assert.False(t, w.seen("b"))
+
+	// a expires, b is still in the window.
+	now = now.Add(31 * time.Second)
+	assert.True(t, w.seen("b"))
+	assert.False(t, w.seen("a"))
+	assert.Equal(t, 2, w.len())
+
+	// The oldest key is evicted when the window is full.
+	assert.False(t, w.seen("c"))
+	assert.Equal(t, 2, w.len())
+	assert.False(t, w.seen("b"))
+}
+
+func TestDeduplicate(t *testing.T) {
+	p := newTestProcessor(t, mapstr.M{
+		"fields": []string{"message", "log.offset"},
+	})
+
+	events := []mapstr.M{
+		{"message": "hello", "log": mapstr.M{"offset": 0}},
+		{"message": "hello", "log": mapstr.M{"offset": 6}},
+		{"message": "hello", "log": mapstr.M{"offset": 0}, "other": "ignored"},
+		{"message": "world", "log": mapstr.M{"offset": 12}},
+	}
+	var published []mapstr.M
+	for _, fields := range events {
+		out, err := p.Run(&beat.Event{Timestamp: time.Now(), Fields: fields})
+		require.NoError(t, err)
+		if out != nil {
+			published = append(published, out.Fields)
+		}
+	}
+	assert.Equal(t, []mapstr.M{events[0], events[1], events[3]}, published)
+
+	_, err := p.Run(&beat.Event{Fields: mapstr.M{"message": "no offset"}})
+	assert.Error(t, err)
+}
+
+func TestDeduplicateTargetField(t *testing.T) {
+	p := newTestProcessor(t, mapstr.M{
+		"fields":       []string{"message"},
+		"target_field": "@metadata._id",
+	})
+
+	out, err := p.Run(&beat.Event{Fields: mapstr.M{"message": "hello"}})
+	require.NoError(t, err)
+	require.NotNil(t, out)
+
+	// The key is the fingerprint of the fields, so the copies of the event
+	// sent again by the queue or the output have the same document ID.
+	fp, err := fingerprint.New(conf.MustNewConfigFrom(mapstr.M{
+		"fields":       []string{"message"},
+		"target_field": "@metadata._id",
+	}), logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	expected, err := fp.Run(&beat.Event{Fields: mapstr.M{"message": "hello"}})
+	require.NoError(t, err)
+	assert.Equal(t, expected.Meta, out.Meta)
+	assert.NotEmpty(t, out.Meta[events.FieldMetaID])
+
+	// Duplicates are still dropped.
+	out, err = p.Run(&beat.Event{Fields: mapstr.M{"message": "hello"}})
+	require.NoError(t, err)
+	assert.Nil(t, out)
+}
+
+func TestDeduplicatePersisted(t *testing.T) {
+	cfg := mapstr.M{
+		"fields":              []string{"message"},
+		"persistence.enabled": true,
+		"persistence.id":      t.Name(),
+	}
+	event := func() *beat.Event {
+		return &beat.Event{Fields: mapstr.M{"message": "hello"}}
+	}
+
+	p := newTestProcessor(t, cfg)
+	out, err := p.Run(event())
+	require.NoError(t, err)
+	assert.NotNil(t, out)
+
+	// Processors with the same ID share the persisted window.
+	shared := newTestProcessor(t, cfg)
+	out, err = shared.Run(event())
+	require.NoError(t, err)
+	assert.Nil(t, out)
+
+	require.NoError(t, p.Close())
+	require.NoError(t, shared.Close())
+
+	// The window survives the restart of the processor.
+	restarted := newTestProcessor(t, cfg)
+	defer restarted.Close()
+	out, err = restarted.Run(event())
+	require.NoError(t, err)
+	assert.Nil(t, out)
+}
+
+func TestConfigInvalid(t *testing.T) {
+	tests := map[string]mapstr.M{
+		"missing fields": {},
+		"zero window": {
+			"fields": []string{"message"},
+			"window": 0,
+		},
+		"empty persistence ID": {
+			"fields":              []string{"message"},
+			"persistence.enabled": true,
+			"persistence.id":      "",
+		},
+	}
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(conf.MustNewConfigFrom(cfg), logptest.NewTestingLogger(t, ""))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func newTestProcessor(t *testing.T, cfg mapstr.M) *deduplicate {
+	t.Helper()
+	p, err := New(conf.MustNewConfigFrom(cfg), logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	return p.(*deduplicate)
+}
@@ -0,0 +1,79 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package deduplicate
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// window remembers the keys added during the last ttl, up to max keys.
+type window struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[string]*list.Element
+
+	// order holds the keys by expiration time, oldest first. All the keys
+	// have the same ttl, so the insertion order is the expiration order.
+	order *list.List
+
+	now func() time.Time
+}
+
+type windowEntry struct {
+	key     string
+	expires time.Time
+}
+
+func newWindow(ttl time.Duration, max int) *window {
+	return &window{
+		ttl:     ttl,
+		max:     max,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// seen reports whether the key was added to the window and didn't expire
+// yet. Unknown keys are added to the window.
+func (w *window) seen(key string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	w.expire(now)
+	if _, ok := w.entries[key]; ok {
+		return true
+	}
+
+	w.entries[key] = w.order.PushBack(windowEntry{key: key, expires: now.Add(w.ttl)})
+	if w.order.Len() > w.max {
+		w.remove(w.order.Front())
+	}
+	return false
+}
+
+func (w *window) expire(now time.Time) {
+	for elem := w.order.Front(); elem != nil; elem = w.order.Front() {
+		if elem.Value.(windowEntry).expires.After(now) {
+			return
+		}
+		w.remove(elem)
+	}
+}
+
+func (w *window) remove(elem *list.Element) {
+	entry := w.order.Remove(elem).(windowEntry)
+	delete(w.entries, entry.key)
+}
+
+func (w *window) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.order.Len()
+}